@@ -12,4 +12,19 @@ app.kubernetes.io/version: {{ .Chart.AppVersion | quote }}
 app.kubernetes.io/managed-by: {{ .Release.Service }}
 giantswarm.io/service-type: "managed"
 application.giantswarm.io/team: {{ index .Chart.Annotations "application.giantswarm.io/team" | quote }}
-{{- end -}}
\ No newline at end of file
+{{- end -}}
+{{/*
+NetworkPolicy "to" peers for networkPolicy.restricted.<key>. Fails on an
+empty list, as a rule without peers allows any destination on its ports.
+*/}}
+{{- define "aws-efs-csi-driver.networkPolicyPeers" -}}
+{{- $cidrs := get .restricted .key }}
+{{- if not $cidrs }}
+{{- fail (printf "networkPolicy.restricted.%s must list at least one CIDR when networkPolicy.restricted.enabled is true; use [0.0.0.0/0] to allow any destination" .key) }}
+{{- end }}
+to:
+{{- range $cidrs }}
+- ipBlock:
+    cidr: {{ . }}
+{{- end }}
+{{- end -}}
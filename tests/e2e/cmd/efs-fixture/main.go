@@ -0,0 +1,263 @@
+// Command efs-fixture provisions and tears down the Crossplane-managed EFS
+// infrastructure the e2e suites run against, so failures can be reproduced
+// by hand against a real file system.
+//
+//	efs-fixture up     -cluster <name> -namespace <org-namespace> [-provider-config <name>] [-filesystem-id <id> | -filesystem-tag <key=value>]
+//	efs-fixture status -cluster <name> [-namespace <org-namespace>]
+//	efs-fixture down   -cluster <name> [-namespace <org-namespace>]
+//	efs-fixture list
+//
+// It talks to the management cluster of the current kubeconfig context
+// unless -kubeconfig or -context say otherwise. The fixture state is kept
+// in a ConfigMap in the organization namespace, shared with the suites, or
+// in the JSON file given by -state-file. Without either, status and down
+// find the resources by their cluster label. With -filesystem-id or
+// -filesystem-tag, up only checks that an existing file system can serve
+// the cluster and creates nothing. In slower regions, -ready-timeout and -available-timeout
+// of up and -delete-timeout of down give Crossplane and AWS more time.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"e2e/internal/efsinfra"
+
+	"github.com/go-logr/logr"
+	"github.com/go-logr/logr/funcr"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const usage = `usage: efs-fixture <command> [flags]
+
+Commands:
+  up      create the file system, security group and mount targets for a cluster
+  status  show the fixture resources of a cluster and their readiness
+  down    delete the fixture resources of a cluster
+  list    list the fixture file systems of all clusters
+
+Run efs-fixture <command> -h for the flags of a command.
+`
+
+type options struct {
+	kubeconfig     string
+	kubeContext    string
+	cluster        string
+	namespace      string
+	stateFile      string
+	throughputMode string
+	providerConfig string
+	fileSystemID   string
+	fileSystemTag  string
+	timeout        time.Duration
+	waits          efsinfra.Timeouts
+	verbose        bool
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	cmd := os.Args[1]
+	run, ok := map[string]func(context.Context, client.Client, options, logr.Logger) error{
+		"up":     up,
+		"status": status,
+		"down":   down,
+		"list":   list,
+	}[cmd]
+	if !ok {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	opts := options{waits: efsinfra.DefaultTimeouts()}
+	fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+	fs.StringVar(&opts.kubeconfig, "kubeconfig", "", "management cluster kubeconfig (default $KUBECONFIG or ~/.kube/config)")
+	fs.StringVar(&opts.kubeContext, "context", "", "kubeconfig context (default the current context)")
+	fs.DurationVar(&opts.timeout, "timeout", 30*time.Minute, "give up after this long")
+	fs.BoolVar(&opts.verbose, "v", false, "log progress to stderr")
+	if cmd != "list" {
+		fs.StringVar(&opts.cluster, "cluster", "", "workload cluster name (required)")
+		fs.StringVar(&opts.namespace, "namespace", "", "organization namespace of the cluster, e.g. org-giantswarm (required for up)")
+		fs.StringVar(&opts.stateFile, "state-file", "", "keep the fixture state in this JSON file instead of a ConfigMap")
+		fs.DurationVar(&opts.waits.Delete, "delete-timeout", opts.waits.Delete, "how long one resource may take to be deleted from AWS")
+	}
+	if cmd == "up" {
+		fs.StringVar(&opts.throughputMode, "throughput-mode", "", "EFS throughput mode, e.g. bursting or elastic")
+		fs.StringVar(&opts.providerConfig, "provider-config", "", "Crossplane ProviderConfig to use (default from the <cluster>-crossplane-config ConfigMap, else the cluster name)")
+		fs.StringVar(&opts.fileSystemID, "filesystem-id", "", "validate and reuse this existing file system instead of creating one")
+		fs.StringVar(&opts.fileSystemTag, "filesystem-tag", "", "validate and reuse the one file system with this key=value tag")
+		fs.DurationVar(&opts.waits.Ready, "ready-timeout", opts.waits.Ready, "how long a resource may take to be Ready")
+		fs.DurationVar(&opts.waits.Available, "available-timeout", opts.waits.Available, "how long a mount target may take to be Ready")
+	}
+	_ = fs.Parse(os.Args[2:])
+	if (cmd != "list" && opts.cluster == "") || (cmd == "up" && opts.namespace == "") {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	ctx, cancel := context.WithTimeout(ctx, opts.timeout)
+	defer cancel()
+
+	log := logr.Discard()
+	if opts.verbose {
+		log = funcr.New(func(prefix, args string) {
+			fmt.Fprintln(os.Stderr, time.Now().Format(time.TimeOnly), args)
+		}, funcr.Options{})
+	}
+
+	c, err := newClient(opts)
+	if err == nil {
+		err = run(ctx, c, opts, log)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "efs-fixture %s: %v\n", cmd, err)
+		os.Exit(1)
+	}
+}
+
+func newClient(opts options) (client.Client, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = opts.kubeconfig
+	cfg, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, &clientcmd.ConfigOverrides{
+		CurrentContext: opts.kubeContext,
+	}).ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("loading kubeconfig: %w", err)
+	}
+	return client.New(cfg, client.Options{})
+}
+
+// newInfra returns the cluster's Infra with its stored state loaded. Without
+// a stored state, the resources are adopted by their cluster label unless
+// adopt is false.
+func newInfra(ctx context.Context, c client.Client, opts options, log logr.Logger, adopt bool) (*efsinfra.Infra, error) {
+	efs := efsinfra.New(opts.cluster, opts.namespace).
+		WithThroughputMode(opts.throughputMode).
+		WithProviderConfig(opts.providerConfig).
+		WithTimeouts(opts.waits).
+		WithLogger(log)
+	switch {
+	case opts.fileSystemID != "":
+		efs.WithExistingFileSystem(opts.fileSystemID)
+	case opts.fileSystemTag != "":
+		key, value, _ := strings.Cut(opts.fileSystemTag, "=")
+		efs.WithExistingFileSystemTag(key, value)
+	}
+	switch {
+	case opts.stateFile != "":
+		efs.WithState(efsinfra.NewFileStore(opts.stateFile))
+	case opts.namespace != "":
+		efs.WithConfigMapState(c)
+	}
+	found, err := efs.LoadState(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !found && adopt {
+		err = efs.Adopt(ctx, c)
+	}
+	return efs, err
+}
+
+func up(ctx context.Context, c client.Client, opts options, log logr.Logger) error {
+	efs, err := newInfra(ctx, c, opts, log, false)
+	if err != nil {
+		return err
+	}
+	// Without a WC client the nodes are not checked.
+	preflight := efs.Preflight(ctx, c, nil)
+	fmt.Println(preflight)
+	if err := preflight.Err(); err != nil {
+		return err
+	}
+	if err := efs.Create(ctx, c); err != nil {
+		return fmt.Errorf("%w\nresources created so far are kept; run up again to resume, or remove them with: efs-fixture down -cluster %s -namespace %s", err, opts.cluster, opts.namespace)
+	}
+	return printStatus(ctx, c, efs)
+}
+
+func status(ctx context.Context, c client.Client, opts options, log logr.Logger) error {
+	efs, err := newInfra(ctx, c, opts, log, true)
+	if err != nil {
+		return err
+	}
+	return printStatus(ctx, c, efs)
+}
+
+func down(ctx context.Context, c client.Client, opts options, log logr.Logger) error {
+	efs, err := newInfra(ctx, c, opts, log, true)
+	if err != nil {
+		return err
+	}
+	resources, err := efs.Status(ctx, c)
+	if err != nil {
+		return err
+	}
+	if len(resources) == 0 {
+		fmt.Printf("no fixture resources for cluster %s\n", opts.cluster)
+		return nil
+	}
+	for _, r := range resources {
+		fmt.Printf("deleting %s %s %s\n", r.Kind, r.Name, r.ID)
+	}
+	if err := efs.Cleanup(ctx, c); err != nil {
+		return err
+	}
+	fmt.Printf("deleted %d resources\n", len(resources))
+	return nil
+}
+
+func list(ctx context.Context, c client.Client, _ options, _ logr.Logger) error {
+	fixtures, err := efsinfra.List(ctx, c)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "CLUSTER\tFILESYSTEM\tID\tREADY\tAGE")
+	for _, f := range fixtures {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%t\t%s\n", f.Cluster, f.Name, orNone(f.FileSystemID), f.Ready, time.Since(f.Created).Round(time.Minute))
+	}
+	return w.Flush()
+}
+
+func printStatus(ctx context.Context, c client.Client, efs *efsinfra.Infra) error {
+	resources, err := efs.Status(ctx, c)
+	if err != nil {
+		return err
+	}
+	if len(resources) == 0 {
+		return errors.New("no fixture resources found")
+	}
+	fmt.Printf("file system: %s\n\n", orNone(efs.FileSystemID()))
+	return writeResources(os.Stdout, resources)
+}
+
+func writeResources(out io.Writer, resources []efsinfra.Resource) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "KIND\tNAME\tID\tREADY\tCONDITIONS")
+	for _, r := range resources {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%t\t%s\n", r.Kind, r.Name, orNone(r.ID), r.Ready, r.Conditions)
+	}
+	return w.Flush()
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "<none>"
+	}
+	return s
+}
@@ -0,0 +1,226 @@
+package benchmark
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Profile identifies the configuration a benchmark ran against. Results are
+// only ever compared with a baseline taken for the same profile.
+type Profile struct {
+	MountOptions   []string `json:"mountOptions"`
+	ThroughputMode string   `json:"throughputMode"`
+}
+
+// Key returns a stable identifier for the profile, e.g. "tls,iam/elastic".
+func (p Profile) Key() string {
+	opts := append([]string(nil), p.MountOptions...)
+	sort.Strings(opts)
+	mode := p.ThroughputMode
+	if mode == "" {
+		mode = "default"
+	}
+	if len(opts) == 0 {
+		return "none/" + mode
+	}
+	return strings.Join(opts, ",") + "/" + mode
+}
+
+// JobResult holds the metrics extracted from one fio job.
+type JobResult struct {
+	Name         string  `json:"name"`
+	IOPS         float64 `json:"iops"`
+	BandwidthKiB float64 `json:"bandwidthKiB"`
+	MeanLatUs    float64 `json:"meanLatencyUs"`
+	P99LatUs     float64 `json:"p99LatencyUs"`
+}
+
+// Run is the outcome of running all benchmark jobs for one profile.
+type Run struct {
+	ChartVersion string      `json:"chartVersion"`
+	Profile      Profile     `json:"profile"`
+	Jobs         []JobResult `json:"jobs"`
+}
+
+// Report is the structured JSON document written after a benchmark suite
+// run. The baseline file uses the same format; its comparison is ignored.
+type Report struct {
+	Runs []Run `json:"runs"`
+	// Comparison sets the runs of this report against each other.
+	Comparison []ProfileDelta `json:"comparison,omitempty"`
+}
+
+// Find returns the run recorded for the given profile, if any.
+func (r Report) Find(p Profile) (Run, bool) {
+	for _, run := range r.Runs {
+		if run.Profile.Key() == p.Key() {
+			return run, true
+		}
+	}
+	return Run{}, false
+}
+
+// LoadReport reads a report or baseline file.
+func LoadReport(path string) (Report, error) {
+	var r Report
+	data, err := os.ReadFile(path) // #nosec G304
+	if err != nil {
+		return r, fmt.Errorf("reading %s: %w", path, err)
+	}
+	if err := json.Unmarshal(data, &r); err != nil {
+		return r, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return r, nil
+}
+
+// WriteReport writes a report as indented JSON.
+func WriteReport(path string, r Report) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644) // #nosec G306
+}
+
+// Regression describes a metric that got worse than the baseline by more
+// than the allowed tolerance.
+type Regression struct {
+	Profile  string  `json:"profile"`
+	Job      string  `json:"job"`
+	Metric   string  `json:"metric"`
+	Baseline float64 `json:"baseline"`
+	Current  float64 `json:"current"`
+	// Change is the relative change, negative when throughput dropped and
+	// positive when latency grew.
+	Change float64 `json:"change"`
+	// BaselineChartVersion is the chart version the baseline was taken with.
+	BaselineChartVersion string `json:"baselineChartVersion"`
+}
+
+func (r Regression) String() string {
+	return fmt.Sprintf("%s %s %s: %.1f -> %.1f (%+.1f%%, baseline from chart %s)",
+		r.Profile, r.Job, r.Metric, r.Baseline, r.Current, r.Change*100, r.BaselineChartVersion)
+}
+
+// Compare returns every metric of current that is worse than the matching
+// baseline metric by more than tolerance (e.g. 0.25 for 25%). Throughput
+// metrics regress when they drop, latency metrics when they grow. Jobs or
+// metrics missing from the baseline are ignored.
+func Compare(baseline, current Run, tolerance float64) []Regression {
+	base := map[string]JobResult{}
+	for _, j := range baseline.Jobs {
+		base[j.Name] = j
+	}
+
+	var regressions []Regression
+	for _, cur := range current.Jobs {
+		b, ok := base[cur.Name]
+		if !ok {
+			continue
+		}
+		for _, m := range []struct {
+			name           string
+			base, cur      float64
+			higherIsBetter bool
+		}{
+			{"iops", b.IOPS, cur.IOPS, true},
+			{"bandwidthKiB", b.BandwidthKiB, cur.BandwidthKiB, true},
+			{"meanLatencyUs", b.MeanLatUs, cur.MeanLatUs, false},
+			{"p99LatencyUs", b.P99LatUs, cur.P99LatUs, false},
+		} {
+			if m.base <= 0 {
+				continue
+			}
+			change := (m.cur - m.base) / m.base
+			worse := change < -tolerance
+			if !m.higherIsBetter {
+				worse = change > tolerance
+			}
+			if worse {
+				regressions = append(regressions, Regression{
+					Profile:              current.Profile.Key(),
+					Job:                  cur.Name,
+					Metric:               m.name,
+					Baseline:             m.base,
+					Current:              m.cur,
+					Change:               change,
+					BaselineChartVersion: baseline.ChartVersion,
+				})
+			}
+		}
+	}
+	return regressions
+}
+
+// ProfileDelta is how one job did under a profile relative to the same job
+// under the reference profile of the same suite run. The metrics are
+// relative changes, e.g. -0.3 for 30% fewer IOPS.
+type ProfileDelta struct {
+	Profile      string  `json:"profile"`
+	Reference    string  `json:"reference"`
+	Job          string  `json:"job"`
+	IOPS         float64 `json:"iops"`
+	BandwidthKiB float64 `json:"bandwidthKiB"`
+	MeanLatUs    float64 `json:"meanLatencyUs"`
+	P99LatUs     float64 `json:"p99LatencyUs"`
+}
+
+func (d ProfileDelta) String() string {
+	return fmt.Sprintf("%s vs %s %s: iops %+.1f%%, bandwidth %+.1f%%, mean latency %+.1f%%, p99 latency %+.1f%%",
+		d.Profile, d.Reference, d.Job, d.IOPS*100, d.BandwidthKiB*100, d.MeanLatUs*100, d.P99LatUs*100)
+}
+
+// CompareProfiles sets every run against the run of the reference profile,
+// job by job, to show what mount options and throughput modes cost.
+// Unlike Compare it does not judge the results. Jobs the reference did not
+// run are left out, and metrics the reference has no value for are 0.
+func CompareProfiles(runs []Run, reference Profile) []ProfileDelta {
+	var ref Run
+	found := false
+	for _, run := range runs {
+		if run.Profile.Key() == reference.Key() {
+			ref, found = run, true
+			break
+		}
+	}
+	if !found {
+		return nil
+	}
+	base := map[string]JobResult{}
+	for _, j := range ref.Jobs {
+		base[j.Name] = j
+	}
+
+	var deltas []ProfileDelta
+	for _, run := range runs {
+		if run.Profile.Key() == reference.Key() {
+			continue
+		}
+		for _, cur := range run.Jobs {
+			b, ok := base[cur.Name]
+			if !ok {
+				continue
+			}
+			deltas = append(deltas, ProfileDelta{
+				Profile:      run.Profile.Key(),
+				Reference:    reference.Key(),
+				Job:          cur.Name,
+				IOPS:         relativeChange(b.IOPS, cur.IOPS),
+				BandwidthKiB: relativeChange(b.BandwidthKiB, cur.BandwidthKiB),
+				MeanLatUs:    relativeChange(b.MeanLatUs, cur.MeanLatUs),
+				P99LatUs:     relativeChange(b.P99LatUs, cur.P99LatUs),
+			})
+		}
+	}
+	return deltas
+}
+
+func relativeChange(base, cur float64) float64 {
+	if base <= 0 {
+		return 0
+	}
+	return (cur - base) / base
+}
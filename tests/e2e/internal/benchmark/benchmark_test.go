@@ -0,0 +1,144 @@
+package benchmark
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+const fioSample = `fio: some warning on stderr
+{
+  "fio version" : "fio-3.36",
+  "jobs" : [
+    {
+      "jobname" : "seq-write",
+      "error" : 0,
+      "read" : {"total_ios" : 0, "bw" : 0, "iops" : 0.0, "lat_ns" : {"mean" : 0.0}, "clat_ns" : {}},
+      "write" : {"total_ios" : 6000, "bw" : 102400, "iops" : 100.0,
+        "lat_ns" : {"mean" : 9500000.0},
+        "clat_ns" : {"percentile" : {"99.000000" : 20000000}}}
+    },
+    {
+      "jobname" : "rand-read",
+      "error" : 0,
+      "read" : {"total_ios" : 90000, "bw" : 6000, "iops" : 1500.0,
+        "lat_ns" : {"mean" : 2000000.0},
+        "clat_ns" : {"percentile" : {"99.000000" : 5000000}}},
+      "write" : {"total_ios" : 0, "bw" : 0, "iops" : 0.0, "lat_ns" : {"mean" : 0.0}, "clat_ns" : {}}
+    }
+  ]
+}
+`
+
+func TestParseFioOutput(t *testing.T) {
+	results, err := ParseFioOutput(fioSample)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []JobResult{
+		{Name: "seq-write", IOPS: 100, BandwidthKiB: 102400, MeanLatUs: 9500, P99LatUs: 20000},
+		{Name: "rand-read", IOPS: 1500, BandwidthKiB: 6000, MeanLatUs: 2000, P99LatUs: 5000},
+	}
+	if len(results) != len(want) {
+		t.Fatalf("got %d results, want %d", len(results), len(want))
+	}
+	for i := range want {
+		if results[i] != want[i] {
+			t.Errorf("result %d = %+v, want %+v", i, results[i], want[i])
+		}
+	}
+
+	if _, err := ParseFioOutput("fio: failed to start"); err == nil {
+		t.Error("expected an error for output without JSON")
+	}
+}
+
+func TestCompare(t *testing.T) {
+	profile := Profile{MountOptions: []string{"tls"}, ThroughputMode: "elastic"}
+	baseline := Run{ChartVersion: "3.3.0", Profile: profile, Jobs: []JobResult{
+		{Name: "rand-read", IOPS: 1000, BandwidthKiB: 4000, MeanLatUs: 2000, P99LatUs: 5000},
+		{Name: "meta-create", IOPS: 300},
+	}}
+	current := Run{ChartVersion: "3.4.0", Profile: profile, Jobs: []JobResult{
+		// IOPS down 10% (within tolerance), p99 latency up 60% (regression).
+		{Name: "rand-read", IOPS: 900, BandwidthKiB: 3600, MeanLatUs: 2100, P99LatUs: 8000},
+		// IOPS down 50% (regression).
+		{Name: "meta-create", IOPS: 150},
+		// Not in the baseline, ignored.
+		{Name: "seq-write", IOPS: 1},
+	}}
+
+	regressions := Compare(baseline, current, 0.25)
+	if len(regressions) != 2 {
+		t.Fatalf("got %d regressions, want 2: %v", len(regressions), regressions)
+	}
+	if r := regressions[0]; r.Job != "rand-read" || r.Metric != "p99LatencyUs" {
+		t.Errorf("unexpected first regression %s", r)
+	}
+	if r := regressions[1]; r.Job != "meta-create" || r.Metric != "iops" || r.BaselineChartVersion != "3.3.0" {
+		t.Errorf("unexpected second regression %s", r)
+	}
+}
+
+func TestCompareProfiles(t *testing.T) {
+	plain := Profile{ThroughputMode: "bursting"}
+	tls := Profile{MountOptions: []string{"tls"}, ThroughputMode: "bursting"}
+	elastic := Profile{ThroughputMode: "elastic"}
+	runs := []Run{
+		{Profile: plain, Jobs: []JobResult{{Name: "seq-read", IOPS: 100, BandwidthKiB: 1000, MeanLatUs: 2000, P99LatUs: 4000}, {Name: "meta-stat", IOPS: 50}}},
+		{Profile: tls, Jobs: []JobResult{{Name: "seq-read", IOPS: 80, BandwidthKiB: 800, MeanLatUs: 2500, P99LatUs: 6000}}},
+		// Not run for the reference, left out.
+		{Profile: elastic, Jobs: []JobResult{{Name: "seq-read", IOPS: 150}, {Name: "rand-write", IOPS: 10}}},
+	}
+
+	deltas := CompareProfiles(runs, plain)
+	want := []ProfileDelta{
+		{Profile: "tls/bursting", Reference: "none/bursting", Job: "seq-read", IOPS: -0.2, BandwidthKiB: -0.2, MeanLatUs: 0.25, P99LatUs: 0.5},
+		{Profile: "none/elastic", Reference: "none/bursting", Job: "seq-read", IOPS: 0.5, BandwidthKiB: -1, MeanLatUs: -1, P99LatUs: -1},
+	}
+	if len(deltas) != len(want) {
+		t.Fatalf("got %d deltas, want %d: %v", len(deltas), len(want), deltas)
+	}
+	for i := range want {
+		if deltas[i] != want[i] {
+			t.Errorf("delta %d = %+v, want %+v", i, deltas[i], want[i])
+		}
+	}
+	if got := deltas[0].String(); got != "tls/bursting vs none/bursting seq-read: iops -20.0%, bandwidth -20.0%, mean latency +25.0%, p99 latency +50.0%" {
+		t.Errorf("String() = %q", got)
+	}
+
+	if deltas := CompareProfiles(runs, Profile{MountOptions: []string{"iam"}}); deltas != nil {
+		t.Errorf("CompareProfiles without a reference run = %v, want nil", deltas)
+	}
+}
+
+func TestProfileKey(t *testing.T) {
+	if got := (Profile{}).Key(); got != "none/default" {
+		t.Errorf("empty profile key = %q", got)
+	}
+	a := Profile{MountOptions: []string{"tls", "iam"}, ThroughputMode: "bursting"}
+	b := Profile{MountOptions: []string{"iam", "tls"}, ThroughputMode: "bursting"}
+	if a.Key() != b.Key() {
+		t.Errorf("mount option order changed the key: %q vs %q", a.Key(), b.Key())
+	}
+}
+
+func TestReportRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "report.json")
+	profile := Profile{MountOptions: []string{"tls"}}
+	in := Report{Runs: []Run{{ChartVersion: "3.3.0", Profile: profile, Jobs: []JobResult{{Name: "seq-read", IOPS: 42}}}}}
+	if err := WriteReport(path, in); err != nil {
+		t.Fatal(err)
+	}
+	out, err := LoadReport(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	run, ok := out.Find(profile)
+	if !ok || run.Jobs[0].IOPS != 42 {
+		t.Errorf("round trip lost data: %+v", out)
+	}
+	if _, ok := out.Find(Profile{}); ok {
+		t.Error("found a run for a profile that was never recorded")
+	}
+}
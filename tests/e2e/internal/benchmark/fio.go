@@ -0,0 +1,97 @@
+package benchmark
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FioArgs returns the fio command line for the benchmark jobs, run one after
+// another (stonewall) against dir. Data jobs are time based and use O_DIRECT
+// so the page cache does not hide NFS round trips; metadata jobs create,
+// stat and unlink a fixed number of small files.
+func FioArgs(dir string, runtime time.Duration) []string {
+	seconds := strconv.Itoa(int(runtime.Seconds()))
+	data := func(name, rw, bs, engine, depth string) []string {
+		return []string{
+			"--name=" + name, "--stonewall", "--rw=" + rw, "--bs=" + bs,
+			"--ioengine=" + engine, "--iodepth=" + depth, "--direct=1",
+			"--size=1G", "--time_based", "--runtime=" + seconds, "--ramp_time=5",
+		}
+	}
+	meta := func(name, engine string) []string {
+		return []string{
+			"--name=" + name, "--stonewall", "--ioengine=" + engine,
+			"--nrfiles=2000", "--filesize=4k", "--bs=4k", "--openfiles=1", "--fallocate=none",
+		}
+	}
+
+	args := []string{"fio", "--output-format=json", "--directory=" + dir}
+	args = append(args, data("seq-write", "write", "1M", "psync", "1")...)
+	args = append(args, data("seq-read", "read", "1M", "psync", "1")...)
+	args = append(args, data("rand-write", "randwrite", "4k", "libaio", "16")...)
+	args = append(args, data("rand-read", "randread", "4k", "libaio", "16")...)
+	args = append(args, meta("meta-create", "filecreate")...)
+	args = append(args, meta("meta-stat", "filestat")...)
+	args = append(args, meta("meta-unlink", "filedelete")...)
+	return args
+}
+
+type fioOutput struct {
+	Jobs []struct {
+		JobName string  `json:"jobname"`
+		Error   int     `json:"error"`
+		Read    fioSide `json:"read"`
+		Write   fioSide `json:"write"`
+	} `json:"jobs"`
+}
+
+type fioSide struct {
+	TotalIOs int64   `json:"total_ios"`
+	BW       float64 `json:"bw"`
+	IOPS     float64 `json:"iops"`
+	LatNs    struct {
+		Mean float64 `json:"mean"`
+	} `json:"lat_ns"`
+	ClatNs struct {
+		Percentile map[string]float64 `json:"percentile"`
+	} `json:"clat_ns"`
+}
+
+// ParseFioOutput extracts per-job results from fio's JSON output. Anything
+// around the JSON document (e.g. warnings fio prints to stderr, which end up
+// in the same pod log) is ignored.
+func ParseFioOutput(output string) ([]JobResult, error) {
+	start := strings.Index(output, "{")
+	end := strings.LastIndex(output, "}")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("no JSON document in fio output")
+	}
+
+	var out fioOutput
+	if err := json.Unmarshal([]byte(output[start:end+1]), &out); err != nil {
+		return nil, fmt.Errorf("parsing fio output: %w", err)
+	}
+
+	var results []JobResult
+	for _, j := range out.Jobs {
+		if j.Error != 0 {
+			return nil, fmt.Errorf("fio job %s failed with error %d", j.JobName, j.Error)
+		}
+		// Latency is taken from whichever direction did the I/O.
+		lat := j.Write
+		if j.Read.TotalIOs > j.Write.TotalIOs {
+			lat = j.Read
+		}
+		results = append(results, JobResult{
+			Name:         j.JobName,
+			IOPS:         j.Read.IOPS + j.Write.IOPS,
+			BandwidthKiB: j.Read.BW + j.Write.BW,
+			MeanLatUs:    lat.LatNs.Mean / 1000,
+			P99LatUs:     lat.ClatNs.Percentile["99.000000"] / 1000,
+		})
+	}
+	return results, nil
+}
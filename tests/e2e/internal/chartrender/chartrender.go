@@ -0,0 +1,100 @@
+package chartrender
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/engine"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/yaml"
+)
+
+// Manifests are the objects a chart rendered, in template order.
+type Manifests []*unstructured.Unstructured
+
+// Render renders the chart in chartDir like `helm template` into namespace
+// kube-system, with values merged over the chart defaults and validated
+// against values.schema.json. Subcharts are rendered when they have been
+// fetched into charts/ with `helm dependency build`, and skipped otherwise.
+func Render(chartDir string, values map[string]interface{}) (Manifests, error) {
+	chrt, err := loader.Load(chartDir)
+	if err != nil {
+		return nil, fmt.Errorf("loading chart %s: %w", chartDir, err)
+	}
+	if values == nil {
+		values = map[string]interface{}{}
+	}
+	// Applies dependency aliases and conditions, like helm install does.
+	if err := chartutil.ProcessDependenciesWithMerge(chrt, values); err != nil {
+		return nil, fmt.Errorf("processing dependencies of %s: %w", chrt.Name(), err)
+	}
+	vals, err := chartutil.ToRenderValues(chrt, values, chartutil.ReleaseOptions{
+		Name:      chrt.Name(),
+		Namespace: "kube-system",
+		IsInstall: true,
+	}, chartutil.DefaultCapabilities)
+	if err != nil {
+		return nil, fmt.Errorf("preparing values for %s: %w", chrt.Name(), err)
+	}
+	files, err := engine.Render(chrt, vals)
+	if err != nil {
+		return nil, fmt.Errorf("rendering %s: %w", chrt.Name(), err)
+	}
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var out Manifests
+	for _, name := range names {
+		if !strings.HasSuffix(name, ".yaml") {
+			continue
+		}
+		for _, doc := range strings.Split(files[name], "\n---") {
+			obj := map[string]interface{}{}
+			if err := yaml.Unmarshal([]byte(doc), &obj); err != nil {
+				return nil, fmt.Errorf("parsing %s: %w", name, err)
+			}
+			if len(obj) == 0 {
+				continue
+			}
+			out = append(out, &unstructured.Unstructured{Object: obj})
+		}
+	}
+	return out, nil
+}
+
+// Find returns the object of the given kind and name, or nil.
+func (m Manifests) Find(kind, name string) *unstructured.Unstructured {
+	for _, obj := range m {
+		if obj.GetKind() == kind && obj.GetName() == name {
+			return obj
+		}
+	}
+	return nil
+}
+
+// Decode converts the object of the given kind and name into a typed
+// object, failing if it was not rendered.
+func (m Manifests) Decode(kind, name string, into interface{}) error {
+	obj := m.Find(kind, name)
+	if obj == nil {
+		return fmt.Errorf("%s %s was not rendered", kind, name)
+	}
+	return runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, into)
+}
+
+// Values parses a YAML values snippet, for tests that override defaults.
+func Values(s string) map[string]interface{} {
+	vals := map[string]interface{}{}
+	if err := yaml.Unmarshal([]byte(s), &vals); err != nil {
+		panic(fmt.Sprintf("invalid values %q: %v", s, err))
+	}
+	return vals
+}
@@ -0,0 +1,179 @@
+package chartrender
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"helm.sh/helm/v3/pkg/chart/loader"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const workloadChart = "../../../../helm/aws-efs-csi-driver"
+
+func renderNetworkPolicy(t *testing.T, values string) networkingv1.NetworkPolicy {
+	t.Helper()
+	m, err := Render(workloadChart, Values(values))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var np networkingv1.NetworkPolicy
+	if err := m.Decode("NetworkPolicy", "aws-efs-csi", &np); err != nil {
+		t.Fatal(err)
+	}
+	return np
+}
+
+// ports flattens a rule's ports into "port/protocol" strings.
+func ports(ps []networkingv1.NetworkPolicyPort) []string {
+	var out []string
+	for _, p := range ps {
+		out = append(out, p.Port.String()+"/"+string(*p.Protocol))
+	}
+	return out
+}
+
+func TestNetworkPolicySelectsDriverPods(t *testing.T) {
+	np := renderNetworkPolicy(t, "")
+
+	// The upstream subchart labels controller and node pods with
+	// app.kubernetes.io/name set to its nameOverride.
+	chrt, err := loader.Load(workloadChart)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nameOverride, _, _ := unstructured.NestedString(chrt.Values, "upstream", "nameOverride")
+	if got := np.Spec.PodSelector.MatchLabels["app.kubernetes.io/name"]; got != nameOverride || got == "" {
+		t.Errorf("podSelector app.kubernetes.io/name = %q, want the upstream nameOverride %q", got, nameOverride)
+	}
+	if len(np.Spec.PodSelector.MatchLabels) != 1 || len(np.Spec.PodSelector.MatchExpressions) != 0 {
+		t.Errorf("podSelector %v must only select on app.kubernetes.io/name to cover controller and node pods", np.Spec.PodSelector)
+	}
+}
+
+func TestNetworkPolicyDefaultLeavesIngressOpen(t *testing.T) {
+	np := renderNetworkPolicy(t, "")
+
+	if len(np.Spec.PolicyTypes) != 1 || np.Spec.PolicyTypes[0] != networkingv1.PolicyTypeEgress {
+		t.Errorf("policyTypes = %v, want only Egress so health and metrics ports stay reachable", np.Spec.PolicyTypes)
+	}
+	if len(np.Spec.Egress) != 1 || len(np.Spec.Egress[0].To) != 0 || len(np.Spec.Egress[0].Ports) != 0 {
+		t.Errorf("egress = %+v, want a single allow-all rule", np.Spec.Egress)
+	}
+}
+
+func TestNetworkPolicyDisabled(t *testing.T) {
+	m, err := Render(workloadChart, Values("networkPolicy: {enabled: false}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Find("NetworkPolicy", "aws-efs-csi") != nil {
+		t.Error("NetworkPolicy rendered although networkPolicy.enabled is false")
+	}
+}
+
+func TestNetworkPolicyRestricted(t *testing.T) {
+	t.Run("defaults", func(t *testing.T) {
+		np := renderNetworkPolicy(t, `
+networkPolicy:
+  restricted:
+    enabled: true
+    nfsCIDRs: [10.0.0.0/16]
+    awsAPICIDRs: [0.0.0.0/0]
+    apiServerCIDRs: [172.31.0.10/32]
+`)
+
+		if len(np.Spec.PolicyTypes) != 2 {
+			t.Errorf("policyTypes = %v, want Ingress and Egress", np.Spec.PolicyTypes)
+		}
+		if len(np.Spec.Ingress) != 1 {
+			t.Fatalf("ingress = %+v, want one rule for the health ports", np.Spec.Ingress)
+		}
+		if got := ports(np.Spec.Ingress[0].Ports); !slices.Equal(got, []string{"9909/TCP", "9809/TCP"}) {
+			t.Errorf("ingress ports = %v", got)
+		}
+		if len(np.Spec.Ingress[0].From) != 0 {
+			t.Errorf("health ports must be reachable from anywhere, got from %+v", np.Spec.Ingress[0].From)
+		}
+
+		want := [][]string{
+			{"53/UDP", "53/TCP"},
+			{"2049/TCP"},
+			{"443/TCP"},
+			{"443/TCP", "6443/TCP"},
+		}
+		if len(np.Spec.Egress) != len(want) {
+			t.Fatalf("egress has %d rules, want %d: %+v", len(np.Spec.Egress), len(want), np.Spec.Egress)
+		}
+		for i, rule := range np.Spec.Egress {
+			if got := ports(rule.Ports); !slices.Equal(got, want[i]) {
+				t.Errorf("egress rule %d ports = %v, want %v", i, got, want[i])
+			}
+		}
+	})
+
+	t.Run("missing CIDRs", func(t *testing.T) {
+		full := map[string]string{
+			"nfsCIDRs":       "[10.0.0.0/16]",
+			"awsAPICIDRs":    "[0.0.0.0/0]",
+			"apiServerCIDRs": "[172.31.0.10/32]",
+		}
+		for missing := range full {
+			values := "networkPolicy: {restricted: {enabled: true"
+			for key, cidrs := range full {
+				if key != missing {
+					values += ", " + key + ": " + cidrs
+				}
+			}
+			values += "}}"
+			_, err := Render(workloadChart, Values(values))
+			if err == nil || !strings.Contains(err.Error(), missing) {
+				t.Errorf("rendering without %s: err = %v, want an error naming it, as an empty list allows any destination", missing, err)
+			}
+		}
+	})
+
+	t.Run("empty ports", func(t *testing.T) {
+		for _, key := range []string{"ingressPorts", "apiServerPorts"} {
+			values := "networkPolicy: {restricted: {enabled: true, nfsCIDRs: [10.0.0.0/16], awsAPICIDRs: [0.0.0.0/0], apiServerCIDRs: [172.31.0.10/32], " + key + ": []}}"
+			if _, err := Render(workloadChart, Values(values)); err == nil {
+				t.Errorf("an empty %s passed schema validation; a rule without ports allows all of them", key)
+			}
+		}
+	})
+
+	t.Run("CIDRs", func(t *testing.T) {
+		np := renderNetworkPolicy(t, `
+networkPolicy:
+  restricted:
+    enabled: true
+    nfsCIDRs: [10.0.0.0/16]
+    awsAPICIDRs: [10.0.128.0/24, 10.0.129.0/24]
+    apiServerCIDRs: [172.31.0.10/32]
+    apiServerPorts: [6443]
+    ingressPorts: [9909]
+`)
+		for i, want := range [][]string{nil, {"10.0.0.0/16"}, {"10.0.128.0/24", "10.0.129.0/24"}, {"172.31.0.10/32"}} {
+			var got []string
+			for _, peer := range np.Spec.Egress[i].To {
+				got = append(got, peer.IPBlock.CIDR)
+			}
+			if !slices.Equal(got, want) {
+				t.Errorf("egress rule %d peers = %v, want %v", i, got, want)
+			}
+		}
+		if got := ports(np.Spec.Egress[3].Ports); !slices.Equal(got, []string{"6443/TCP"}) {
+			t.Errorf("API server ports = %v", got)
+		}
+		if got := ports(np.Spec.Ingress[0].Ports); !slices.Equal(got, []string{"9909/TCP"}) {
+			t.Errorf("ingress ports = %v", got)
+		}
+	})
+
+	t.Run("schema", func(t *testing.T) {
+		if _, err := Render(workloadChart, Values("networkPolicy: {restricted: {enabled: true, nfsCIDRs: [10.0.0.0/16], awsAPICIDRs: [0.0.0.0/0], apiServerCIDRs: [172.31.0.10/32], ingressPort: [9909]}}")); err == nil {
+			t.Error("a misspelled restricted key passed schema validation")
+		}
+	})
+}
@@ -0,0 +1,162 @@
+package chartrender
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"testing"
+
+	"e2e/internal/kyverno"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+const kyvernoPolicies = "../kyverno/testdata/policies"
+
+func renderPolicyExceptions(t *testing.T, values string) []kyverno.PolicyException {
+	t.Helper()
+	m, err := Render(workloadChart, Values(values))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var exceptions []kyverno.PolicyException
+	for _, obj := range m {
+		if obj.GetKind() != "PolicyException" {
+			continue
+		}
+		var e kyverno.PolicyException
+		if err := m.Decode("PolicyException", obj.GetName(), &e); err != nil {
+			t.Fatal(err)
+		}
+		exceptions = append(exceptions, e)
+	}
+	return exceptions
+}
+
+// skipOrFail skips the test locally, but fails it in CI, which has what it
+// needs.
+func skipOrFail(t *testing.T, format string, args ...interface{}) {
+	t.Helper()
+	if os.Getenv("CI") != "" {
+		t.Fatalf(format, args...)
+	}
+	t.Skipf(format, args...)
+}
+
+// loadPolicies returns the vendored policies. Names checked against
+// anything else would only be the names someone typed in.
+func loadPolicies(t *testing.T) []kyverno.Policy {
+	t.Helper()
+	source, err := kyverno.Source(kyvernoPolicies)
+	if err != nil {
+		skipOrFail(t, "%v; run %s/vendor.sh <kyverno-policies version>", err, kyvernoPolicies)
+	}
+	t.Logf("policies from %s", source)
+	policies, err := kyverno.LoadPolicies(kyvernoPolicies)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return policies
+}
+
+func TestPolicyExceptionsReferenceExistingRules(t *testing.T) {
+	exceptions := renderPolicyExceptions(t, "")
+	if len(exceptions) != 2 {
+		t.Fatalf("rendered %d PolicyExceptions, want the controller and node ones", len(exceptions))
+	}
+	for _, e := range exceptions {
+		if e.APIVersion != "kyverno.io/v2" {
+			t.Errorf("%s: apiVersion %s, want kyverno.io/v2", e.Name, e.APIVersion)
+		}
+	}
+	policies := loadPolicies(t)
+	for _, e := range exceptions {
+		for _, ref := range kyverno.UnknownReferences(e, policies) {
+			t.Errorf("%s references unknown %s", e.Name, ref)
+		}
+	}
+}
+
+func TestPolicyExceptionsDisabled(t *testing.T) {
+	exceptions := renderPolicyExceptions(t, "global:\n  podSecurityStandards:\n    enforced: false\n")
+	if len(exceptions) != 0 {
+		t.Errorf("rendered %d PolicyExceptions with podSecurityStandards.enforced=false", len(exceptions))
+	}
+}
+
+// kyvernoBinary returns the kyverno CLI from E2E_KYVERNO_BINARY or PATH.
+func kyvernoBinary(t *testing.T) string {
+	t.Helper()
+	if bin := os.Getenv("E2E_KYVERNO_BINARY"); bin != "" {
+		return bin
+	}
+	bin, err := exec.LookPath("kyverno")
+	if err != nil {
+		skipOrFail(t, "kyverno CLI not found; install it or set E2E_KYVERNO_BINARY")
+	}
+	return bin
+}
+
+// TestPolicyExceptionsAdmitDriverPods runs the vendored policies with the
+// kyverno CLI against the rendered controller and node workloads and their
+// pods, as each kind Kyverno admits on the way from Deployment or DaemonSet
+// to Pod.
+func TestPolicyExceptionsAdmitDriverPods(t *testing.T) {
+	m, err := Render(workloadChart, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	controller, node := m.Find("Deployment", "efs-csi-controller"), m.Find("DaemonSet", "efs-csi-node")
+	if controller == nil || node == nil {
+		skipOrFail(t, "upstream subchart not vendored; run helm dependency build helm/aws-efs-csi-driver")
+	}
+	loadPolicies(t)
+	bin := kyvernoBinary(t)
+
+	var resources, exceptions [][]byte
+	add := func(into *[][]byte, obj map[string]interface{}) {
+		data, err := yaml.Marshal(obj)
+		if err != nil {
+			t.Fatal(err)
+		}
+		*into = append(*into, data)
+	}
+	for _, tt := range []struct {
+		workload *unstructured.Unstructured
+		pod      string
+	}{
+		{controller, "efs-csi-controller-6f7c9d8b5-x2v4q"},
+		{node, "efs-csi-node-k8w2m"},
+	} {
+		add(&resources, tt.workload.Object)
+		template, _, err := unstructured.NestedMap(tt.workload.Object, "spec", "template")
+		if err != nil {
+			t.Fatal(err)
+		}
+		pod := &unstructured.Unstructured{Object: template}
+		pod.SetAPIVersion("v1")
+		pod.SetKind("Pod")
+		pod.SetName(tt.pod)
+		pod.SetNamespace(tt.workload.GetNamespace())
+		add(&resources, pod.Object)
+	}
+	for _, obj := range m {
+		if obj.GetKind() == "PolicyException" {
+			add(&exceptions, obj.Object)
+		}
+	}
+
+	results, err := kyverno.Apply(context.Background(), bin, kyvernoPolicies, resources, exceptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) == 0 {
+		t.Fatal("kyverno evaluated no rule against the driver workloads")
+	}
+	for _, r := range results {
+		if r.Blocking() {
+			t.Errorf("denied: %s", r)
+		}
+	}
+}
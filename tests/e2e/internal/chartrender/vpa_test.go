@@ -0,0 +1,110 @@
+package chartrender
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// vpaValues sets every verticalPodAutoscaler value to something other
+// than its default, so a template still reading a hardcoded or crossed
+// value shows up.
+const vpaValues = `
+verticalPodAutoscaler:
+  controller:
+    updateMode: Initial
+    minAllowed: {cpu: 11m, memory: 12Mi}
+    maxAllowed: {cpu: 13m, memory: 14Mi}
+    evictionRequirements:
+    - resources: [cpu]
+      changeRequirement: TargetHigherThanRequests
+  node:
+    updateMode: "Off"
+    minAllowed: {cpu: 21m, memory: 22Mi}
+    maxAllowed: {cpu: 23m, memory: 24Mi}
+    evictionRequirements:
+    - resources: [memory]
+      changeRequirement: TargetLowerThanRequests
+`
+
+func renderVPA(t *testing.T, values, name string) *unstructured.Unstructured {
+	t.Helper()
+	m, err := Render(workloadChart, Values(values))
+	if err != nil {
+		t.Fatal(err)
+	}
+	vpa := m.Find("VerticalPodAutoscaler", name)
+	if vpa == nil {
+		t.Fatalf("VerticalPodAutoscaler %s was not rendered", name)
+	}
+	return vpa
+}
+
+func TestVPAValues(t *testing.T) {
+	for _, tt := range []struct {
+		name, kind, target, component string
+	}{
+		{"efs-csi-controller-vpa", "Deployment", "efs-csi-controller", "controller"},
+		{"efs-csi-node-vpa", "DaemonSet", "efs-csi-node", "node"},
+	} {
+		t.Run(tt.component, func(t *testing.T) {
+			vpa := renderVPA(t, vpaValues, tt.name)
+			want, _, _ := unstructured.NestedMap(Values(vpaValues), "verticalPodAutoscaler", tt.component)
+
+			if vpa.GetNamespace() != "kube-system" {
+				t.Errorf("namespace = %q, want the release namespace", vpa.GetNamespace())
+			}
+			targetRef, _, _ := unstructured.NestedStringMap(vpa.Object, "spec", "targetRef")
+			if targetRef["apiVersion"] != "apps/v1" || targetRef["kind"] != tt.kind || targetRef["name"] != tt.target {
+				t.Errorf("targetRef = %v, want apps/v1 %s %s", targetRef, tt.kind, tt.target)
+			}
+
+			mode, _, _ := unstructured.NestedString(vpa.Object, "spec", "updatePolicy", "updateMode")
+			if mode != want["updateMode"] {
+				t.Errorf("updateMode = %q, want %q", mode, want["updateMode"])
+			}
+			eviction, _, _ := unstructured.NestedSlice(vpa.Object, "spec", "updatePolicy", "evictionRequirements")
+			if !reflect.DeepEqual(eviction, want["evictionRequirements"]) {
+				t.Errorf("evictionRequirements = %v, want %v", eviction, want["evictionRequirements"])
+			}
+
+			policies, _, _ := unstructured.NestedSlice(vpa.Object, "spec", "resourcePolicy", "containerPolicies")
+			if len(policies) != 1 {
+				t.Fatalf("%d container policies, want one for efs-plugin", len(policies))
+			}
+			policy := policies[0].(map[string]interface{})
+			if policy["containerName"] != "efs-plugin" {
+				t.Errorf("containerName = %v, want efs-plugin", policy["containerName"])
+			}
+			for _, bound := range []string{"minAllowed", "maxAllowed"} {
+				got, _, _ := unstructured.NestedStringMap(policy, bound)
+				if !reflect.DeepEqual(got, toStringMap(want[bound])) {
+					t.Errorf("%s = %v, want %v", bound, got, want[bound])
+				}
+			}
+		})
+	}
+}
+
+func TestVPADefaults(t *testing.T) {
+	for _, name := range []string{"efs-csi-controller-vpa", "efs-csi-node-vpa"} {
+		vpa := renderVPA(t, "", name)
+		if _, found, _ := unstructured.NestedFieldNoCopy(vpa.Object, "spec", "updatePolicy", "evictionRequirements"); found {
+			t.Errorf("%s renders evictionRequirements without any configured", name)
+		}
+		policies, _, _ := unstructured.NestedSlice(vpa.Object, "spec", "resourcePolicy", "containerPolicies")
+		if len(policies) != 1 {
+			t.Errorf("%s has %d container policies, want one", name, len(policies))
+		}
+	}
+}
+
+func toStringMap(v interface{}) map[string]string {
+	out := map[string]string{}
+	m, _ := v.(map[string]interface{})
+	for k, val := range m {
+		out[k], _ = val.(string)
+	}
+	return out
+}
@@ -0,0 +1,235 @@
+// Package cleanup tears down what e2e suites create, in reverse creation
+// order, even when a run is interrupted.
+//
+// A suite defers each teardown on its Tracker at the point it creates
+// something. The Tracker registers it with Ginkgo's DeferCleanup, so it runs
+// when the registering node is done: after the spec for an It, and after
+// the container's last spec for a BeforeAll of an Ordered container, which
+// is where resources shared by several specs are created.
+//
+// After a first interrupt Ginkgo still runs cleanup nodes, each with the
+// Tracker's timeout. A second interrupt cancels the running teardown, which
+// then only issues its deletes, and makes Ginkgo skip the cleanup nodes
+// that have not run. Finish, called from a ReportAfterSuite node, which
+// Ginkgo still runs, issues their deletes and reports what could not be
+// confirmed as deleted.
+package cleanup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/onsi/ginkgo/v2"
+)
+
+// Func tears down what one creation point made. With wait set it deletes
+// and waits until everything is gone, and ctx is canceled if the run is
+// interrupted. Without wait it only issues the deletes.
+type Func func(ctx context.Context, wait bool) error
+
+// Result is the outcome of one deferred teardown.
+type Result struct {
+	Name string
+	// Confirmed is set when the teardown waited until everything was gone.
+	Confirmed bool
+	// WaitSkipped is set when the run was interrupted and the teardown only
+	// issued its deletes.
+	WaitSkipped bool
+	Err         error
+	Duration    time.Duration
+}
+
+// Report lists the results of the teardowns, last deferred first.
+type Report []Result
+
+// Unconfirmed returns the teardowns whose resources may still exist.
+func (r Report) Unconfirmed() []Result {
+	var out []Result
+	for _, res := range r {
+		if !res.Confirmed {
+			out = append(out, res)
+		}
+	}
+	return out
+}
+
+// String formats the report, one teardown per line.
+func (r Report) String() string {
+	var b strings.Builder
+	for _, res := range r {
+		switch {
+		case res.Confirmed:
+			fmt.Fprintf(&b, "deleted           %s (%s)\n", res.Name, res.Duration.Round(time.Second))
+		case res.WaitSkipped && res.Err == nil:
+			fmt.Fprintf(&b, "NOT CONFIRMED     %s: deletes issued, waiting skipped\n", res.Name)
+		default:
+			fmt.Fprintf(&b, "NOT CONFIRMED     %s: %v\n", res.Name, res.Err)
+		}
+	}
+	return b.String()
+}
+
+// Tracker registers teardowns with DeferCleanup and keeps their results for
+// the final report.
+type Tracker struct {
+	log logr.Logger
+	// timeout bounds a teardown that waits, and is what it gets after the
+	// first interrupt.
+	timeout time.Duration
+	// deleteTimeout bounds a teardown that only issues deletes. It stays
+	// below Ginkgo's default grace period of 30s, which is all an
+	// interrupted node gets to return.
+	deleteTimeout time.Duration
+	// deferCleanup registers a cleanup node, ginkgoDeferCleanup outside
+	// tests.
+	deferCleanup func(body func(context.Context) error, timeout time.Duration)
+
+	mu    sync.Mutex
+	steps []*step
+}
+
+type step struct {
+	name    string
+	fn      Func
+	started bool
+	result  *Result
+}
+
+// New returns an empty Tracker.
+func New(log logr.Logger) *Tracker {
+	return &Tracker{
+		log:           log,
+		timeout:       30 * time.Minute,
+		deleteTimeout: 20 * time.Second,
+		deferCleanup:  ginkgoDeferCleanup,
+	}
+}
+
+// WithTimeout sets how long a teardown may wait until everything is gone.
+func (t *Tracker) WithTimeout(d time.Duration) *Tracker {
+	t.timeout = d
+	return t
+}
+
+// Defer registers fn with DeferCleanup. Deferring a name again before its
+// teardown ran is a no-op, so every spec that may create the resources of
+// a teardown can defer it.
+func (t *Tracker) Defer(name string, fn Func) {
+	t.mu.Lock()
+	for _, s := range t.steps {
+		if s.name == name && !s.started {
+			t.mu.Unlock()
+			return
+		}
+	}
+	s := &step{name: name, fn: fn}
+	t.steps = append(t.steps, s)
+	t.mu.Unlock()
+
+	t.deferCleanup(func(ctx context.Context) error {
+		return t.run(ctx, s).Err
+	}, t.timeout)
+}
+
+func ginkgoDeferCleanup(body func(context.Context) error, timeout time.Duration) {
+	ginkgo.DeferCleanup(func(ctx ginkgo.SpecContext) error {
+		return body(ctx)
+	}, ginkgo.NodeTimeout(timeout))
+}
+
+// run waits for the teardown, or only issues its deletes once ctx is
+// canceled by an interrupt or the timeout.
+func (t *Tracker) run(ctx context.Context, s *step) Result {
+	if !t.start(s) {
+		return Result{Name: s.name}
+	}
+	res := Result{Name: s.name}
+	start := time.Now()
+
+	t.log.Info("cleaning up", "name", s.name)
+	res.Err = call(ctx, s.fn, true)
+	res.Confirmed = res.Err == nil
+	if !res.Confirmed && ctx.Err() != nil {
+		t.log.Info("cleanup interrupted, issuing deletes without waiting", "name", s.name)
+		res.Err = t.issue(ctx, s)
+		res.WaitSkipped = true
+	}
+	res.Duration = time.Since(start)
+	return t.finish(s, res)
+}
+
+// Finish issues, without waiting, the deletes of teardowns that never ran
+// because a second interrupt made Ginkgo skip them, and reports every
+// teardown, last deferred first. Call it from ReportAfterSuite.
+func (t *Tracker) Finish(ctx context.Context) Report {
+	t.mu.Lock()
+	steps := slices.Clone(t.steps)
+	t.mu.Unlock()
+
+	var report Report
+	for i := len(steps) - 1; i >= 0; i-- {
+		s := steps[i]
+		if t.start(s) {
+			t.log.Info("cleanup skipped, issuing deletes without waiting", "name", s.name)
+			start := time.Now()
+			res := Result{Name: s.name, WaitSkipped: true, Err: t.issue(ctx, s)}
+			res.Duration = time.Since(start)
+			report = append(report, t.finish(s, res))
+			continue
+		}
+		t.mu.Lock()
+		res := s.result
+		t.mu.Unlock()
+		if res == nil {
+			res = &Result{Name: s.name, Err: errors.New("still running when the suite ended")}
+		}
+		report = append(report, *res)
+	}
+	return report
+}
+
+// start claims s, reporting false if it already ran or is running.
+func (t *Tracker) start(s *step) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if s.started {
+		return false
+	}
+	s.started = true
+	return true
+}
+
+func (t *Tracker) finish(s *step, res Result) Result {
+	if res.Err != nil {
+		t.log.Error(res.Err, "cleanup failed", "name", s.name)
+	}
+	t.mu.Lock()
+	s.result = &res
+	t.mu.Unlock()
+	return res
+}
+
+// issue runs the teardown without waiting, on a context that outlives the
+// interrupted one.
+func (t *Tracker) issue(ctx context.Context, s *step) error {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), t.deleteTimeout)
+	defer cancel()
+	return call(ctx, s.fn, false)
+}
+
+// call runs fn, turning a panic, such as a failed Gomega assertion, into
+// an error so the remaining teardowns still run.
+func call(ctx context.Context, fn Func, wait bool) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("panic: %v", p)
+		}
+	}()
+	return fn(ctx, wait)
+}
@@ -0,0 +1,244 @@
+package cleanup
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/onsi/ginkgo/v2"
+)
+
+// fakeNodes stands in for Ginkgo's cleanup nodes.
+type fakeNodes []func(context.Context) error
+
+func newTestTracker() (*Tracker, *fakeNodes) {
+	nodes := &fakeNodes{}
+	t := New(logr.Discard())
+	t.deferCleanup = func(body func(context.Context) error, _ time.Duration) {
+		*nodes = append(*nodes, body)
+	}
+	return t, nodes
+}
+
+// run runs the nodes last registered first, like Ginkgo, with ctx for the
+// first n of them and skips the rest, like Ginkgo after a second
+// interrupt. n < 0 runs all of them.
+func (n *fakeNodes) run(ctx context.Context, count int) {
+	for i := len(*n) - 1; i >= 0 && count != 0; i-- {
+		_ = (*n)[i](ctx)
+		count--
+	}
+	*n = nil
+}
+
+func TestRunOrderAndFailures(t *testing.T) {
+	r, nodes := newTestTracker()
+	var ran []string
+	record := func(name string, err error) Func {
+		return func(ctx context.Context, wait bool) error {
+			ran = append(ran, fmt.Sprintf("%s wait=%v", name, wait))
+			return err
+		}
+	}
+	r.Defer("file system", record("file system", nil))
+	r.Defer("pvc", record("pvc", errors.New("pvc still bound")))
+	r.Defer("file system", record("file system again", nil))
+	r.Defer("pod", func(ctx context.Context, wait bool) error {
+		ran = append(ran, "pod")
+		panic("assertion failed")
+	})
+	if len(*nodes) != 3 {
+		t.Fatalf("registered %d cleanup nodes, want 3", len(*nodes))
+	}
+
+	nodes.run(context.Background(), -1)
+	report := r.Finish(context.Background())
+
+	want := []string{"pod", "pvc wait=true", "file system wait=true"}
+	if !slices.Equal(ran, want) {
+		t.Errorf("ran %v, want %v", ran, want)
+	}
+	unconfirmed := report.Unconfirmed()
+	if len(unconfirmed) != 2 || unconfirmed[0].Name != "pod" || unconfirmed[1].Name != "pvc" {
+		t.Fatalf("Unconfirmed() = %+v, want pod and pvc", unconfirmed)
+	}
+	if !strings.Contains(unconfirmed[0].Err.Error(), "panic: assertion failed") {
+		t.Errorf("pod error = %v, want the panic", unconfirmed[0].Err)
+	}
+	s := report.String()
+	for _, line := range []string{"NOT CONFIRMED     pvc: pvc still bound", "deleted           file system"} {
+		if !strings.Contains(s, line) {
+			t.Errorf("report %q does not contain %q", s, line)
+		}
+	}
+
+	// Once its teardown ran, a name can be deferred again.
+	r.Defer("pvc", record("pvc", nil))
+	if len(*nodes) != 1 {
+		t.Errorf("deferring pvc after its teardown registered %d nodes, want 1", len(*nodes))
+	}
+}
+
+func TestInterruptedTeardown(t *testing.T) {
+	r, nodes := newTestTracker()
+	var ran []string
+	r.Defer("file system", func(ctx context.Context, wait bool) error {
+		ran = append(ran, fmt.Sprintf("file system wait=%v", wait))
+		return nil
+	})
+	r.Defer("pvc", func(ctx context.Context, wait bool) error {
+		ran = append(ran, fmt.Sprintf("pvc wait=%v", wait))
+		if !wait {
+			return ctx.Err()
+		}
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	// The second interrupt cancels the pvc teardown while it waits, and
+	// Ginkgo skips the file system one.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	nodes.run(ctx, 1)
+	report := r.Finish(context.Background())
+
+	want := []string{"pvc wait=true", "pvc wait=false", "file system wait=false"}
+	if !slices.Equal(ran, want) {
+		t.Errorf("ran %v, want %v", ran, want)
+	}
+	if len(report.Unconfirmed()) != 2 {
+		t.Errorf("Unconfirmed() = %+v, want both", report.Unconfirmed())
+	}
+	for _, res := range report {
+		if !res.WaitSkipped || res.Err != nil {
+			t.Errorf("%s: WaitSkipped=%v Err=%v, want deletes issued without error", res.Name, res.WaitSkipped, res.Err)
+		}
+	}
+	if !strings.Contains(report.String(), "NOT CONFIRMED     file system: deletes issued, waiting skipped") {
+		t.Errorf("report = %q", report.String())
+	}
+}
+
+const childEnv = "CLEANUP_INTERRUPT_CHILD"
+
+// TestSecondInterrupt runs a Ginkgo suite in a child process and sends it
+// two SIGINTs: the first while a spec runs, the second while that spec's
+// teardown waits.
+func TestSecondInterrupt(t *testing.T) {
+	if os.Getenv(childEnv) != "" {
+		runInterruptedSuite(t)
+		return
+	}
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestSecondInterrupt$") // #nosec G204
+	cmd.Env = append(os.Environ(), childEnv+"=1")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd.Stderr = cmd.Stdout
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = cmd.Process.Kill() }()
+
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		s := bufio.NewScanner(stdout)
+		for s.Scan() {
+			lines <- s.Text()
+		}
+	}()
+	var output, marks []string
+	waitFor := func(mark string) {
+		t.Helper()
+		timeout := time.After(time.Minute)
+		for {
+			select {
+			case line, ok := <-lines:
+				if !ok {
+					t.Fatalf("child exited before %q:\n%s", mark, strings.Join(output, "\n"))
+				}
+				output = append(output, line)
+				if m, ok := strings.CutPrefix(line, "MARK "); ok {
+					marks = append(marks, m)
+					if m == mark {
+						return
+					}
+				}
+			case <-timeout:
+				t.Fatalf("no %q within a minute:\n%s", mark, strings.Join(output, "\n"))
+			}
+		}
+	}
+
+	waitFor("blocked")
+	if err := cmd.Process.Signal(syscall.SIGINT); err != nil {
+		t.Fatal(err)
+	}
+	waitFor("pvc wait=true")
+	if err := cmd.Process.Signal(syscall.SIGINT); err != nil {
+		t.Fatal(err)
+	}
+	waitFor("report done")
+	for line := range lines {
+		output = append(output, line)
+	}
+	if err := cmd.Wait(); err == nil {
+		t.Error("interrupted suite exited successfully")
+	}
+
+	want := []string{"blocked", "pvc wait=true", "pvc wait=false", "file system wait=false", "report done"}
+	if !slices.Equal(marks, want) {
+		t.Errorf("marks %v, want %v\n%s", marks, want, strings.Join(output, "\n"))
+	}
+	all := strings.Join(output, "\n")
+	for _, line := range []string{"NOT CONFIRMED     pvc: deletes issued, waiting skipped", "NOT CONFIRMED     file system: deletes issued, waiting skipped"} {
+		if !strings.Contains(all, line) {
+			t.Errorf("final report lacks %q:\n%s", line, all)
+		}
+	}
+}
+
+// runInterruptedSuite is the child of TestSecondInterrupt. The file system
+// teardown is deferred from a BeforeAll, like the EFS fixture of the
+// suites, and the pvc one from the spec.
+func runInterruptedSuite(t *testing.T) {
+	tracker := New(logr.Discard())
+	record := func(name string) Func {
+		return func(ctx context.Context, wait bool) error {
+			fmt.Printf("MARK %s wait=%v\n", name, wait)
+			if !wait {
+				return nil
+			}
+			<-ctx.Done()
+			return ctx.Err()
+		}
+	}
+
+	ginkgo.ReportAfterSuite("cleanup report", func(ctx ginkgo.SpecContext, _ ginkgo.Report) {
+		fmt.Print(tracker.Finish(ctx).String())
+		fmt.Println("MARK report done")
+	})
+	ginkgo.Describe("interrupted", ginkgo.Ordered, func() {
+		ginkgo.BeforeAll(func() {
+			tracker.Defer("file system", record("file system"))
+		})
+		ginkgo.It("waits to be interrupted", func(ctx ginkgo.SpecContext) {
+			tracker.Defer("pvc", record("pvc"))
+			fmt.Println("MARK blocked")
+			<-ctx.Done()
+		})
+	})
+	ginkgo.RunSpecs(t, "cleanup interrupt")
+}
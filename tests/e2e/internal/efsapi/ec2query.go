@@ -0,0 +1,168 @@
+package efsapi
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+)
+
+// ec2Client calls the few EC2 Query API actions the tests need. It signs
+// requests with the SDK's SigV4 signer, which keeps this module off the
+// very large service/ec2 package.
+type ec2Client struct {
+	endpoint    string
+	region      string
+	credentials aws.CredentialsProvider
+	httpClient  *http.Client
+}
+
+func newEC2Client(cfg aws.Config) *ec2Client {
+	endpoint := fmt.Sprintf("https://ec2.%s.amazonaws.com/", cfg.Region)
+	if strings.HasPrefix(cfg.Region, "cn-") {
+		endpoint = fmt.Sprintf("https://ec2.%s.amazonaws.com.cn/", cfg.Region)
+	}
+	return &ec2Client{
+		endpoint:    endpoint,
+		region:      cfg.Region,
+		credentials: cfg.Credentials,
+		httpClient:  &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+type describeSecurityGroupsResponse struct {
+	Groups []struct {
+		GroupID     string `xml:"groupId"`
+		Permissions []struct {
+			Protocol string `xml:"ipProtocol"`
+			FromPort *int   `xml:"fromPort"`
+			ToPort   *int   `xml:"toPort"`
+			Groups   []struct {
+				GroupID string `xml:"groupId"`
+			} `xml:"groups>item"`
+			Ranges []struct {
+				CIDR string `xml:"cidrIp"`
+			} `xml:"ipRanges>item"`
+		} `xml:"ipPermissions>item"`
+	} `xml:"securityGroupInfo>item"`
+}
+
+type describeNetworkInterfacesResponse struct {
+	Interfaces []struct {
+		ID          string `xml:"networkInterfaceId"`
+		Description string `xml:"description"`
+		Status      string `xml:"status"`
+	} `xml:"networkInterfaceSet>item"`
+}
+
+type ec2ErrorResponse struct {
+	Errors []struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	} `xml:"Errors>Error"`
+}
+
+func (c *ec2Client) ingressRules(ctx context.Context, groupIDs []string) ([]IngressRule, error) {
+	form := url.Values{
+		"Action":  {"DescribeSecurityGroups"},
+		"Version": {"2016-11-15"},
+	}
+	for i, id := range groupIDs {
+		form.Set(fmt.Sprintf("GroupId.%d", i+1), id)
+	}
+	body, err := c.do(ctx, form)
+	if err != nil {
+		return nil, fmt.Errorf("describing security groups %v: %w", groupIDs, err)
+	}
+	var resp describeSecurityGroupsResponse
+	if err := xml.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("parsing DescribeSecurityGroups response: %w", err)
+	}
+
+	var rules []IngressRule
+	for _, g := range resp.Groups {
+		for _, p := range g.Permissions {
+			r := IngressRule{GroupID: g.GroupID, Protocol: p.Protocol, FromPort: -1, ToPort: -1}
+			if p.FromPort != nil {
+				r.FromPort = *p.FromPort
+			}
+			if p.ToPort != nil {
+				r.ToPort = *p.ToPort
+			}
+			for _, rg := range p.Ranges {
+				r.CIDRs = append(r.CIDRs, rg.CIDR)
+			}
+			for _, sg := range p.Groups {
+				r.SourceGroups = append(r.SourceGroups, sg.GroupID)
+			}
+			rules = append(rules, r)
+		}
+	}
+	return rules, nil
+}
+
+func (c *ec2Client) networkInterfaces(ctx context.Context, groupID string) ([]NetworkInterface, error) {
+	body, err := c.do(ctx, url.Values{
+		"Action":           {"DescribeNetworkInterfaces"},
+		"Version":          {"2016-11-15"},
+		"Filter.1.Name":    {"group-id"},
+		"Filter.1.Value.1": {groupID},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("describing network interfaces of %s: %w", groupID, err)
+	}
+	var resp describeNetworkInterfacesResponse
+	if err := xml.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("parsing DescribeNetworkInterfaces response: %w", err)
+	}
+	out := make([]NetworkInterface, 0, len(resp.Interfaces))
+	for _, i := range resp.Interfaces {
+		out = append(out, NetworkInterface{ID: i.ID, Description: i.Description, Status: i.Status})
+	}
+	return out, nil
+}
+
+func (c *ec2Client) do(ctx context.Context, form url.Values) ([]byte, error) {
+	payload := form.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint, strings.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+
+	creds, err := c.credentials.Retrieve(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("resolving AWS credentials: %w", err)
+	}
+	hash := sha256.Sum256([]byte(payload))
+	if err := v4.NewSigner().SignHTTP(ctx, creds, req, hex.EncodeToString(hash[:]), "ec2", c.region, time.Now()); err != nil {
+		return nil, fmt.Errorf("signing request: %w", err)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		var e ec2ErrorResponse
+		if xml.Unmarshal(body, &e) == nil && len(e.Errors) > 0 {
+			return nil, fmt.Errorf("%s: %s", e.Errors[0].Code, e.Errors[0].Message)
+		}
+		return nil, fmt.Errorf("HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return body, nil
+}
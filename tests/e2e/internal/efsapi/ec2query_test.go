@@ -0,0 +1,87 @@
+package efsapi
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+)
+
+const describeSecurityGroupsXML = `<?xml version="1.0" encoding="UTF-8"?>
+<DescribeSecurityGroupsResponse xmlns="http://ec2.amazonaws.com/doc/2016-11-15/">
+  <securityGroupInfo>
+    <item>
+      <groupId>sg-efs</groupId>
+      <ipPermissions>
+        <item>
+          <ipProtocol>tcp</ipProtocol>
+          <fromPort>2049</fromPort>
+          <toPort>2049</toPort>
+          <groups><item><groupId>sg-nodes</groupId></item></groups>
+          <ipRanges><item><cidrIp>10.0.0.0/16</cidrIp></item></ipRanges>
+        </item>
+        <item>
+          <ipProtocol>-1</ipProtocol>
+          <groups/>
+          <ipRanges><item><cidrIp>192.168.0.0/24</cidrIp></item></ipRanges>
+        </item>
+      </ipPermissions>
+    </item>
+  </securityGroupInfo>
+</DescribeSecurityGroupsResponse>`
+
+func testEC2Client(t *testing.T, h http.HandlerFunc) *ec2Client {
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	c := newEC2Client(aws.Config{
+		Region:      "eu-west-1",
+		Credentials: credentials.NewStaticCredentialsProvider("AKID", "SECRET", ""),
+	})
+	c.endpoint = srv.URL
+	return c
+}
+
+func TestIngressRules(t *testing.T) {
+	c := testEC2Client(t, func(w http.ResponseWriter, r *http.Request) {
+		if auth := r.Header.Get("Authorization"); !strings.Contains(auth, "/eu-west-1/ec2/aws4_request") {
+			t.Errorf("request not signed for ec2: %q", auth)
+		}
+		if err := r.ParseForm(); err != nil {
+			t.Fatal(err)
+		}
+		if r.Form.Get("Action") != "DescribeSecurityGroups" || r.Form.Get("GroupId.1") != "sg-efs" {
+			t.Errorf("unexpected form %v", r.Form)
+		}
+		_, _ = w.Write([]byte(describeSecurityGroupsXML))
+	})
+
+	rules, err := c.ingressRules(context.Background(), []string{"sg-efs"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != 2 {
+		t.Fatalf("got %d rules, want 2: %+v", len(rules), rules)
+	}
+	if r := rules[0]; r.GroupID != "sg-efs" || r.Protocol != "tcp" || r.FromPort != 2049 || r.ToPort != 2049 ||
+		len(r.CIDRs) != 1 || r.CIDRs[0] != "10.0.0.0/16" || len(r.SourceGroups) != 1 || r.SourceGroups[0] != "sg-nodes" {
+		t.Errorf("first rule = %+v", r)
+	}
+	if r := rules[1]; r.Protocol != "-1" || r.FromPort != -1 || r.ToPort != -1 {
+		t.Errorf("all-traffic rule = %+v, want ports -1", r)
+	}
+}
+
+func TestIngressRulesError(t *testing.T) {
+	c := testEC2Client(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`<Response><Errors><Error><Code>InvalidGroup.NotFound</Code><Message>The security group 'sg-x' does not exist</Message></Error></Errors></Response>`))
+	})
+	_, err := c.ingressRules(context.Background(), []string{"sg-x"})
+	if err == nil || !strings.Contains(err.Error(), "InvalidGroup.NotFound") {
+		t.Fatalf("ingressRules() = %v, want InvalidGroup.NotFound", err)
+	}
+}
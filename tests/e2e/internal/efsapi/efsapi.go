@@ -0,0 +1,100 @@
+package efsapi
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/efs"
+)
+
+// AccessPoint is the subset of an EFS access point the tests care about.
+type AccessPoint struct {
+	ID           string
+	FileSystemID string
+	Path         string
+	State        string
+}
+
+// Client is the part of the EFS API used to verify what the CSI driver did
+// behind the scenes. It is implemented by the AWS SDK backed client and by Fake.
+type Client interface {
+	ListAccessPoints(ctx context.Context, fileSystemID string) ([]AccessPoint, error)
+}
+
+type awsClient struct {
+	efs *efs.Client
+}
+
+// NewAWSClient creates a Client using the default AWS credential chain.
+// It fails early if no credentials can be resolved so callers can tell
+// "no API access" apart from "access point missing".
+func NewAWSClient(ctx context.Context, region string) (Client, error) {
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(region))
+	if err != nil {
+		return nil, fmt.Errorf("loading AWS config: %w", err)
+	}
+	if _, err := cfg.Credentials.Retrieve(ctx); err != nil {
+		return nil, fmt.Errorf("resolving AWS credentials: %w", err)
+	}
+	return &awsClient{efs: efs.NewFromConfig(cfg)}, nil
+}
+
+func (c *awsClient) ListAccessPoints(ctx context.Context, fileSystemID string) ([]AccessPoint, error) {
+	var aps []AccessPoint
+	p := efs.NewDescribeAccessPointsPaginator(c.efs, &efs.DescribeAccessPointsInput{
+		FileSystemId: aws.String(fileSystemID),
+	})
+	for p.HasMorePages() {
+		out, err := p.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("describing access points of %s: %w", fileSystemID, err)
+		}
+		for _, ap := range out.AccessPoints {
+			a := AccessPoint{
+				ID:           aws.ToString(ap.AccessPointId),
+				FileSystemID: aws.ToString(ap.FileSystemId),
+				State:        string(ap.LifeCycleState),
+			}
+			if ap.RootDirectory != nil {
+				a.Path = aws.ToString(ap.RootDirectory.Path)
+			}
+			aps = append(aps, a)
+		}
+	}
+	return aps, nil
+}
+
+// AccessPointExists reports whether the given access point is still present
+// on the file system. Access points that are being deleted count as gone.
+func AccessPointExists(ctx context.Context, c Client, fileSystemID, accessPointID string) (bool, error) {
+	aps, err := c.ListAccessPoints(ctx, fileSystemID)
+	if err != nil {
+		return false, err
+	}
+	for _, ap := range aps {
+		if ap.ID == accessPointID && ap.State != "deleting" && ap.State != "deleted" {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// ParseVolumeHandle splits a CSI volume handle into file system and access
+// point IDs. Dynamically provisioned volumes use "fs-xxx::fsap-xxx", static
+// ones may use "fs-xxx:/subpath:fsap-xxx" or just "fs-xxx".
+func ParseVolumeHandle(handle string) (fileSystemID, accessPointID string, err error) {
+	parts := strings.Split(handle, ":")
+	if len(parts) == 0 || !strings.HasPrefix(parts[0], "fs-") {
+		return "", "", fmt.Errorf("volume handle %q does not start with a file system ID", handle)
+	}
+	if len(parts) > 3 {
+		return "", "", fmt.Errorf("volume handle %q has too many segments", handle)
+	}
+	if len(parts) == 3 {
+		accessPointID = parts[2]
+	}
+	return parts[0], accessPointID, nil
+}
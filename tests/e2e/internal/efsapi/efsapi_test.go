@@ -0,0 +1,60 @@
+package efsapi
+
+import (
+	"context"
+	"testing"
+)
+
+func TestParseVolumeHandle(t *testing.T) {
+	tests := []struct {
+		handle  string
+		fsID    string
+		apID    string
+		wantErr bool
+	}{
+		{handle: "fs-0123::fsap-0456", fsID: "fs-0123", apID: "fsap-0456"},
+		{handle: "fs-0123:/data:fsap-0456", fsID: "fs-0123", apID: "fsap-0456"},
+		{handle: "fs-0123", fsID: "fs-0123"},
+		{handle: "fs-0123:/data", fsID: "fs-0123"},
+		{handle: "fsap-0456", wantErr: true},
+		{handle: "fs-0123:a:b:c", wantErr: true},
+	}
+	for _, tt := range tests {
+		fsID, apID, err := ParseVolumeHandle(tt.handle)
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("ParseVolumeHandle(%q) error = %v, wantErr %v", tt.handle, err, tt.wantErr)
+		}
+		if fsID != tt.fsID || apID != tt.apID {
+			t.Errorf("ParseVolumeHandle(%q) = %q, %q; want %q, %q", tt.handle, fsID, apID, tt.fsID, tt.apID)
+		}
+	}
+}
+
+func TestAccessPointExists(t *testing.T) {
+	ctx := context.Background()
+	fake := NewFake()
+	kept := fake.CreateAccessPoint("fs-1", "/dynamic/pvc-a")
+	removed := fake.CreateAccessPoint("fs-1", "/dynamic/pvc-b")
+	other := fake.CreateAccessPoint("fs-2", "/dynamic/pvc-c")
+	if err := fake.DeleteAccessPoint(removed); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		fsID, apID string
+		want       bool
+	}{
+		{"fs-1", kept, true},
+		{"fs-1", removed, false},
+		{"fs-1", other, false},
+		{"fs-2", other, true},
+	} {
+		got, err := AccessPointExists(ctx, fake, tt.fsID, tt.apID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("AccessPointExists(%s, %s) = %v, want %v", tt.fsID, tt.apID, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package efsapi
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Fake is an in-memory stand-in for the EFS API. It lets helpers that reason
+// about access points be exercised without AWS credentials.
+type Fake struct {
+	mu           sync.Mutex
+	nextID       int
+	accessPoints map[string]AccessPoint
+	// tokens maps client tokens to the access point they created, so a
+	// retried create returns the same access point like EFS does.
+	tokens map[string]string
+}
+
+// NewFake returns an empty Fake.
+func NewFake() *Fake {
+	return &Fake{accessPoints: map[string]AccessPoint{}, tokens: map[string]string{}}
+}
+
+// CreateAccessPoint adds an access point to the fake and returns its ID.
+func (f *Fake) CreateAccessPoint(fileSystemID, path string) string {
+	ap, _ := f.createAccessPoint(fileSystemID, path, "")
+	return ap.ID
+}
+
+// createAccessPoint adds an access point unless one was already created
+// with the same non-empty client token, in which case that one is returned
+// and created is false.
+func (f *Fake) createAccessPoint(fileSystemID, path, clientToken string) (ap AccessPoint, created bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if id, ok := f.tokens[clientToken]; ok && clientToken != "" {
+		if existing, ok := f.accessPoints[id]; ok {
+			return existing, false
+		}
+	}
+	f.nextID++
+	id := fmt.Sprintf("fsap-%017x", f.nextID)
+	f.accessPoints[id] = AccessPoint{
+		ID:           id,
+		FileSystemID: fileSystemID,
+		Path:         path,
+		State:        "available",
+	}
+	if clientToken != "" {
+		f.tokens[clientToken] = id
+	}
+	return f.accessPoints[id], true
+}
+
+// DeleteAccessPoint removes an access point from the fake.
+func (f *Fake) DeleteAccessPoint(accessPointID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.accessPoints[accessPointID]; !ok {
+		return fmt.Errorf("access point %s not found", accessPointID)
+	}
+	delete(f.accessPoints, accessPointID)
+	return nil
+}
+
+func (f *Fake) ListAccessPoints(_ context.Context, fileSystemID string) ([]AccessPoint, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var aps []AccessPoint
+	for _, ap := range f.accessPoints {
+		if ap.FileSystemID == fileSystemID {
+			aps = append(aps, ap)
+		}
+	}
+	sort.Slice(aps, func(i, j int) bool { return aps[i].ID < aps[j].ID })
+	return aps, nil
+}
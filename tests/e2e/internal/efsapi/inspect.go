@@ -0,0 +1,141 @@
+package efsapi
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/efs"
+)
+
+// FileSystem is the subset of an EFS file system needed to reuse it.
+type FileSystem struct {
+	ID             string
+	Name           string
+	State          string
+	ThroughputMode string
+	Tags           map[string]string
+}
+
+// MountTarget is an EFS mount target and the security groups on its
+// network interface.
+type MountTarget struct {
+	ID             string
+	FileSystemID   string
+	SubnetID       string
+	AZ             string
+	VPCID          string
+	State          string
+	SecurityGroups []string
+}
+
+// IngressRule is one inbound permission of a security group.
+type IngressRule struct {
+	GroupID  string
+	Protocol string
+	// FromPort and ToPort are -1 when the rule covers all ports.
+	FromPort     int
+	ToPort       int
+	CIDRs        []string
+	SourceGroups []string
+}
+
+// NetworkInterface is an ENI that uses a security group, which keeps the
+// group from being deleted.
+type NetworkInterface struct {
+	ID          string
+	Description string
+	Status      string
+}
+
+// Inspector reads what is needed to check that an existing file system can
+// serve a cluster. It is implemented by the AWS backed client and by tests.
+type Inspector interface {
+	FileSystems(ctx context.Context) ([]FileSystem, error)
+	MountTargets(ctx context.Context, fileSystemID string) ([]MountTarget, error)
+	IngressRules(ctx context.Context, groupIDs []string) ([]IngressRule, error)
+	NetworkInterfaces(ctx context.Context, groupID string) ([]NetworkInterface, error)
+}
+
+type awsInspector struct {
+	efs *efs.Client
+	ec2 *ec2Client
+}
+
+// NewAWSInspector creates an Inspector using the default AWS credential
+// chain, failing early when no credentials can be resolved.
+func NewAWSInspector(ctx context.Context, region string) (Inspector, error) {
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(region))
+	if err != nil {
+		return nil, fmt.Errorf("loading AWS config: %w", err)
+	}
+	if _, err := cfg.Credentials.Retrieve(ctx); err != nil {
+		return nil, fmt.Errorf("resolving AWS credentials: %w", err)
+	}
+	return &awsInspector{efs: efs.NewFromConfig(cfg), ec2: newEC2Client(cfg)}, nil
+}
+
+func (c *awsInspector) FileSystems(ctx context.Context) ([]FileSystem, error) {
+	var out []FileSystem
+	p := efs.NewDescribeFileSystemsPaginator(c.efs, &efs.DescribeFileSystemsInput{})
+	for p.HasMorePages() {
+		page, err := p.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("describing file systems: %w", err)
+		}
+		for _, fs := range page.FileSystems {
+			f := FileSystem{
+				ID:             aws.ToString(fs.FileSystemId),
+				Name:           aws.ToString(fs.Name),
+				State:          string(fs.LifeCycleState),
+				ThroughputMode: string(fs.ThroughputMode),
+				Tags:           map[string]string{},
+			}
+			for _, t := range fs.Tags {
+				f.Tags[aws.ToString(t.Key)] = aws.ToString(t.Value)
+			}
+			out = append(out, f)
+		}
+	}
+	return out, nil
+}
+
+func (c *awsInspector) MountTargets(ctx context.Context, fileSystemID string) ([]MountTarget, error) {
+	var out []MountTarget
+	p := efs.NewDescribeMountTargetsPaginator(c.efs, &efs.DescribeMountTargetsInput{
+		FileSystemId: aws.String(fileSystemID),
+	})
+	for p.HasMorePages() {
+		page, err := p.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("describing mount targets of %s: %w", fileSystemID, err)
+		}
+		for _, mt := range page.MountTargets {
+			sgs, err := c.efs.DescribeMountTargetSecurityGroups(ctx, &efs.DescribeMountTargetSecurityGroupsInput{
+				MountTargetId: mt.MountTargetId,
+			})
+			if err != nil {
+				return nil, fmt.Errorf("describing security groups of %s: %w", aws.ToString(mt.MountTargetId), err)
+			}
+			out = append(out, MountTarget{
+				ID:             aws.ToString(mt.MountTargetId),
+				FileSystemID:   aws.ToString(mt.FileSystemId),
+				SubnetID:       aws.ToString(mt.SubnetId),
+				AZ:             aws.ToString(mt.AvailabilityZoneName),
+				VPCID:          aws.ToString(mt.VpcId),
+				State:          string(mt.LifeCycleState),
+				SecurityGroups: sgs.SecurityGroups,
+			})
+		}
+	}
+	return out, nil
+}
+
+func (c *awsInspector) IngressRules(ctx context.Context, groupIDs []string) ([]IngressRule, error) {
+	return c.ec2.ingressRules(ctx, groupIDs)
+}
+
+func (c *awsInspector) NetworkInterfaces(ctx context.Context, groupID string) ([]NetworkInterface, error) {
+	return c.ec2.networkInterfaces(ctx, groupID)
+}
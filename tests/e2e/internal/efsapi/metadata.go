@@ -0,0 +1,53 @@
+package efsapi
+
+import (
+	"net/http"
+	"strings"
+)
+
+// MetadataServer serves the part of the EC2 instance metadata service the
+// CSI driver reads at start-up to learn its instance, region and zone, so
+// the driver can run outside EC2. Point the driver at it with
+// AWS_EC2_METADATA_SERVICE_ENDPOINT. It answers IMDSv2 token requests and
+// serves every path without checking the token.
+type MetadataServer struct {
+	InstanceID       string
+	Region           string
+	AvailabilityZone string
+}
+
+func (m MetadataServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPut && r.URL.Path == "/latest/api/token" {
+		w.Header().Set("X-Aws-Ec2-Metadata-Token-Ttl-Seconds", r.Header.Get("X-Aws-Ec2-Metadata-Token-Ttl-Seconds"))
+		_, _ = w.Write([]byte("local-imds-token"))
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	switch strings.TrimSuffix(r.URL.Path, "/") {
+	case "/latest/meta-data/instance-id":
+		_, _ = w.Write([]byte(m.InstanceID))
+	case "/latest/meta-data/instance-type":
+		_, _ = w.Write([]byte("m5.large"))
+	case "/latest/meta-data/placement/region":
+		_, _ = w.Write([]byte(m.Region))
+	case "/latest/meta-data/placement/availability-zone":
+		_, _ = w.Write([]byte(m.AvailabilityZone))
+	case "/latest/dynamic/instance-identity/document":
+		writeJSON(w, http.StatusOK, map[string]string{
+			"accountId":        "000000000000",
+			"architecture":     "x86_64",
+			"availabilityZone": m.AvailabilityZone,
+			"imageId":          "ami-00000000000000000",
+			"instanceId":       m.InstanceID,
+			"instanceType":     "m5.large",
+			"privateIp":        "127.0.0.1",
+			"region":           m.Region,
+		})
+	default:
+		http.NotFound(w, r)
+	}
+}
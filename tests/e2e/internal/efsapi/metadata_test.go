@@ -0,0 +1,42 @@
+package efsapi
+
+import (
+	"context"
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/feature/ec2/imds"
+)
+
+func TestMetadataServer(t *testing.T) {
+	ctx := context.Background()
+	ts := httptest.NewServer(MetadataServer{InstanceID: "i-0000000000local", Region: "eu-west-1", AvailabilityZone: "eu-west-1a"})
+	t.Cleanup(ts.Close)
+	c := imds.New(imds.Options{Endpoint: ts.URL})
+
+	doc, err := c.GetInstanceIdentityDocument(ctx, &imds.GetInstanceIdentityDocumentInput{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc.InstanceID != "i-0000000000local" || doc.Region != "eu-west-1" || doc.AvailabilityZone != "eu-west-1a" {
+		t.Errorf("instance identity document = %+v", doc.InstanceIdentityDocument)
+	}
+
+	out, err := c.GetMetadata(ctx, &imds.GetMetadataInput{Path: "placement/availability-zone"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Content.Close()
+	zone, err := io.ReadAll(out.Content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(zone) != "eu-west-1a" {
+		t.Errorf("placement/availability-zone = %q", zone)
+	}
+
+	if _, err := c.GetMetadata(ctx, &imds.GetMetadataInput{Path: "iam/security-credentials/"}); err == nil {
+		t.Error("GetMetadata of an unserved path succeeded")
+	}
+}
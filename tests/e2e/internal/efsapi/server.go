@@ -0,0 +1,324 @@
+package efsapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+const apiPrefix = "/2015-02-01"
+
+// ServerOptions shape how the local EFS endpoint behaves under load.
+type ServerOptions struct {
+	// Latency is added to every request before it is served.
+	Latency time.Duration
+	// RequestsPerSecond limits the request rate across all operations,
+	// like the per-account EFS API limits. Requests over the limit get a
+	// ThrottlingException. Zero means unlimited.
+	RequestsPerSecond float64
+	// Burst is the number of requests allowed at once on top of the rate.
+	// Defaults to RequestsPerSecond.
+	Burst int
+	// AccessPointLimit caps the access points per file system, zero means
+	// unlimited. EFS returns AccessPointLimitExceeded past 10000.
+	AccessPointLimit int
+}
+
+// ServerStats counts the requests a Server saw, per operation.
+type ServerStats struct {
+	Requests  map[string]int `json:"requests"`
+	Throttled map[string]int `json:"throttled"`
+}
+
+// TotalThrottled returns the number of throttled requests.
+func (s ServerStats) TotalThrottled() int {
+	total := 0
+	for _, n := range s.Throttled {
+		total += n
+	}
+	return total
+}
+
+// Server serves the part of the EFS REST API the CSI controller uses for
+// dynamic provisioning from a Fake, so the AWS SDK and the driver can be
+// pointed at it through an endpoint override. Any "fs-" ID is treated as an
+// available file system.
+type Server struct {
+	fake    *Fake
+	opts    ServerOptions
+	limiter *rate.Limiter
+
+	mu    sync.Mutex
+	stats ServerStats
+	// details keeps what CreateAccessPoint was given beyond the Fake's
+	// fields, since the driver reads the POSIX users of the access points
+	// back to allocate GIDs and their client tokens to find retried ones.
+	details map[string]accessPointDetails
+}
+
+type accessPointDetails struct {
+	clientToken  string
+	posixUser    *posixUserJSON
+	creationInfo *creationInfoJSON
+	tags         []tagJSON
+}
+
+// NewServer returns a Server backed by fake.
+func NewServer(fake *Fake, opts ServerOptions) *Server {
+	s := &Server{
+		fake:    fake,
+		opts:    opts,
+		stats:   ServerStats{Requests: map[string]int{}, Throttled: map[string]int{}},
+		details: map[string]accessPointDetails{},
+	}
+	if opts.RequestsPerSecond > 0 {
+		burst := opts.Burst
+		if burst <= 0 {
+			burst = int(opts.RequestsPerSecond)
+		}
+		s.limiter = rate.NewLimiter(rate.Limit(opts.RequestsPerSecond), max(burst, 1))
+	}
+	return s
+}
+
+// Stats returns a copy of the request counters.
+func (s *Server) Stats() ServerStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := ServerStats{Requests: map[string]int{}, Throttled: map[string]int{}}
+	for k, v := range s.stats.Requests {
+		out.Requests[k] = v
+	}
+	for k, v := range s.stats.Throttled {
+		out.Throttled[k] = v
+	}
+	return out
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	op, handler := s.route(r)
+	if handler == nil {
+		writeError(w, http.StatusNotFound, "UnknownOperationException", fmt.Sprintf("%s %s is not served by the local EFS endpoint", r.Method, r.URL.Path))
+		return
+	}
+
+	throttled := s.limiter != nil && !s.limiter.Allow()
+	s.mu.Lock()
+	s.stats.Requests[op]++
+	if throttled {
+		s.stats.Throttled[op]++
+	}
+	s.mu.Unlock()
+
+	if s.opts.Latency > 0 {
+		time.Sleep(s.opts.Latency)
+	}
+	if throttled {
+		writeError(w, http.StatusTooManyRequests, "ThrottlingException", "Rate exceeded")
+		return
+	}
+	handler(w, r)
+}
+
+func (s *Server) route(r *http.Request) (string, http.HandlerFunc) {
+	path := strings.TrimPrefix(r.URL.Path, apiPrefix)
+	switch {
+	case r.Method == http.MethodPost && path == "/access-points":
+		return "CreateAccessPoint", s.createAccessPoint
+	case r.Method == http.MethodGet && path == "/access-points":
+		return "DescribeAccessPoints", s.describeAccessPoints
+	case r.Method == http.MethodDelete && strings.HasPrefix(path, "/access-points/"):
+		return "DeleteAccessPoint", s.deleteAccessPoint
+	case r.Method == http.MethodGet && path == "/file-systems":
+		return "DescribeFileSystems", s.describeFileSystems
+	}
+	return "", nil
+}
+
+type accessPointJSON struct {
+	AccessPointID  string            `json:"AccessPointId"`
+	AccessPointARN string            `json:"AccessPointArn"`
+	ClientToken    string            `json:"ClientToken,omitempty"`
+	FileSystemID   string            `json:"FileSystemId"`
+	LifeCycleState string            `json:"LifeCycleState"`
+	PosixUser      *posixUserJSON    `json:"PosixUser,omitempty"`
+	RootDirectory  rootDirectoryJSON `json:"RootDirectory"`
+	Tags           []tagJSON         `json:"Tags,omitempty"`
+}
+
+type posixUserJSON struct {
+	UID           int64   `json:"Uid"`
+	GID           int64   `json:"Gid"`
+	SecondaryGIDs []int64 `json:"SecondaryGids,omitempty"`
+}
+
+type rootDirectoryJSON struct {
+	Path         string            `json:"Path"`
+	CreationInfo *creationInfoJSON `json:"CreationInfo,omitempty"`
+}
+
+type creationInfoJSON struct {
+	OwnerUID    int64  `json:"OwnerUid"`
+	OwnerGID    int64  `json:"OwnerGid"`
+	Permissions string `json:"Permissions"`
+}
+
+type tagJSON struct {
+	Key   string `json:"Key"`
+	Value string `json:"Value"`
+}
+
+func (s *Server) toJSON(ap AccessPoint) accessPointJSON {
+	s.mu.Lock()
+	d := s.details[ap.ID]
+	s.mu.Unlock()
+	return accessPointJSON{
+		AccessPointID:  ap.ID,
+		AccessPointARN: fmt.Sprintf("arn:aws:elasticfilesystem:local:000000000000:access-point/%s", ap.ID),
+		ClientToken:    d.clientToken,
+		FileSystemID:   ap.FileSystemID,
+		LifeCycleState: ap.State,
+		PosixUser:      d.posixUser,
+		RootDirectory:  rootDirectoryJSON{Path: ap.Path, CreationInfo: d.creationInfo},
+		Tags:           d.tags,
+	}
+}
+
+func (s *Server) createAccessPoint(w http.ResponseWriter, r *http.Request) {
+	var in struct {
+		ClientToken   string            `json:"ClientToken"`
+		FileSystemID  string            `json:"FileSystemId"`
+		PosixUser     *posixUserJSON    `json:"PosixUser"`
+		RootDirectory rootDirectoryJSON `json:"RootDirectory"`
+		Tags          []tagJSON         `json:"Tags"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		writeError(w, http.StatusBadRequest, "BadRequest", err.Error())
+		return
+	}
+	if !strings.HasPrefix(in.FileSystemID, "fs-") {
+		writeError(w, http.StatusNotFound, "FileSystemNotFound", fmt.Sprintf("file system %q does not exist", in.FileSystemID))
+		return
+	}
+	if limit := s.opts.AccessPointLimit; limit > 0 {
+		aps, _ := s.fake.ListAccessPoints(r.Context(), in.FileSystemID)
+		if len(aps) >= limit {
+			writeError(w, http.StatusForbidden, "AccessPointLimitExceeded", fmt.Sprintf("file system %s already has %d access points", in.FileSystemID, len(aps)))
+			return
+		}
+	}
+	path := in.RootDirectory.Path
+	if path == "" {
+		path = "/"
+	}
+	ap, created := s.fake.createAccessPoint(in.FileSystemID, path, in.ClientToken)
+	if created {
+		s.mu.Lock()
+		s.details[ap.ID] = accessPointDetails{
+			clientToken:  in.ClientToken,
+			posixUser:    in.PosixUser,
+			creationInfo: in.RootDirectory.CreationInfo,
+			tags:         in.Tags,
+		}
+		s.mu.Unlock()
+	}
+	writeJSON(w, http.StatusOK, s.toJSON(ap))
+}
+
+func (s *Server) describeAccessPoints(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	fileSystemID, accessPointID := q.Get("FileSystemId"), q.Get("AccessPointId")
+
+	var aps []AccessPoint
+	if accessPointID != "" {
+		s.fake.mu.Lock()
+		ap, ok := s.fake.accessPoints[accessPointID]
+		s.fake.mu.Unlock()
+		if !ok {
+			writeError(w, http.StatusNotFound, "AccessPointNotFound", fmt.Sprintf("access point %s does not exist", accessPointID))
+			return
+		}
+		aps = []AccessPoint{ap}
+	} else {
+		aps, _ = s.fake.ListAccessPoints(r.Context(), fileSystemID)
+	}
+
+	// NextToken is the ID to continue from, IDs are listed in order.
+	pageSize := 100
+	if n, err := strconv.Atoi(q.Get("MaxResults")); err == nil && n > 0 {
+		pageSize = n
+	}
+	start := 0
+	if token := q.Get("NextToken"); token != "" {
+		for start < len(aps) && aps[start].ID < token {
+			start++
+		}
+	}
+	end := min(start+pageSize, len(aps))
+
+	out := struct {
+		AccessPoints []accessPointJSON
+		NextToken    string `json:",omitempty"`
+	}{AccessPoints: []accessPointJSON{}}
+	for _, ap := range aps[start:end] {
+		out.AccessPoints = append(out.AccessPoints, s.toJSON(ap))
+	}
+	if end < len(aps) {
+		out.NextToken = aps[end].ID
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func (s *Server) deleteAccessPoint(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, apiPrefix+"/access-points/")
+	if err := s.fake.DeleteAccessPoint(id); err != nil {
+		writeError(w, http.StatusNotFound, "AccessPointNotFound", err.Error())
+		return
+	}
+	s.mu.Lock()
+	delete(s.details, id)
+	s.mu.Unlock()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) describeFileSystems(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("FileSystemId")
+	if !strings.HasPrefix(id, "fs-") {
+		writeError(w, http.StatusNotFound, "FileSystemNotFound", fmt.Sprintf("file system %q does not exist", id))
+		return
+	}
+	type fileSystem struct {
+		FileSystemID   string `json:"FileSystemId"`
+		LifeCycleState string
+		CreationTime   int64
+		CreationToken  string
+		OwnerID        string `json:"OwnerId"`
+	}
+	writeJSON(w, http.StatusOK, struct{ FileSystems []fileSystem }{
+		FileSystems: []fileSystem{{
+			FileSystemID:   id,
+			LifeCycleState: "available",
+			CreationToken:  id,
+			OwnerID:        "000000000000",
+		}},
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// writeError answers like the EFS REST API, which the SDK decodes from the
+// X-Amzn-ErrorType header.
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("X-Amzn-ErrorType", code)
+	writeJSON(w, status, map[string]string{"ErrorCode": code, "Message": message})
+}
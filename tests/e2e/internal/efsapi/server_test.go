@@ -0,0 +1,139 @@
+package efsapi
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/efs"
+	"github.com/aws/aws-sdk-go-v2/service/efs/types"
+	"github.com/aws/smithy-go"
+)
+
+func newServerClient(t *testing.T, opts ServerOptions) (*efs.Client, *Fake, *Server) {
+	t.Helper()
+	fake := NewFake()
+	srv := NewServer(fake, opts)
+	ts := httptest.NewServer(srv)
+	t.Cleanup(ts.Close)
+	return efs.New(efs.Options{
+		BaseEndpoint:     aws.String(ts.URL),
+		Region:           "us-east-1",
+		Credentials:      credentials.NewStaticCredentialsProvider("local", "local", ""),
+		RetryMaxAttempts: 1,
+	}), fake, srv
+}
+
+func TestServerAccessPointLifecycle(t *testing.T) {
+	ctx := context.Background()
+	c, fake, _ := newServerClient(t, ServerOptions{})
+
+	fs, err := c.DescribeFileSystems(ctx, &efs.DescribeFileSystemsInput{FileSystemId: aws.String("fs-1")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fs.FileSystems) != 1 || fs.FileSystems[0].LifeCycleState != types.LifeCycleStateAvailable {
+		t.Fatalf("DescribeFileSystems = %+v", fs.FileSystems)
+	}
+
+	create := &efs.CreateAccessPointInput{
+		ClientToken:  aws.String("pvc-a"),
+		FileSystemId: aws.String("fs-1"),
+		PosixUser:    &types.PosixUser{Uid: aws.Int64(50000), Gid: aws.Int64(50000)},
+		RootDirectory: &types.RootDirectory{
+			Path:         aws.String("/dynamic/pvc-a"),
+			CreationInfo: &types.CreationInfo{OwnerUid: aws.Int64(50000), OwnerGid: aws.Int64(50000), Permissions: aws.String("700")},
+		},
+	}
+	first, err := c.CreateAccessPoint(ctx, create)
+	if err != nil {
+		t.Fatal(err)
+	}
+	retried, err := c.CreateAccessPoint(ctx, create)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if aws.ToString(retried.AccessPointId) != aws.ToString(first.AccessPointId) {
+		t.Errorf("create with the same client token returned %s, want %s", aws.ToString(retried.AccessPointId), aws.ToString(first.AccessPointId))
+	}
+	described, err := c.DescribeAccessPoints(ctx, &efs.DescribeAccessPointsInput{AccessPointId: first.AccessPointId})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The driver allocates GIDs from the POSIX users it lists.
+	if ap := described.AccessPoints[0]; aws.ToString(ap.ClientToken) != "pvc-a" || ap.PosixUser == nil || aws.ToInt64(ap.PosixUser.Gid) != 50000 ||
+		aws.ToString(ap.RootDirectory.CreationInfo.Permissions) != "700" {
+		t.Errorf("DescribeAccessPoints = %+v, want the client token, POSIX user and creation info it was created with", ap)
+	}
+	for i := 0; i < 4; i++ {
+		fake.CreateAccessPoint("fs-1", "/other")
+	}
+
+	var listed []string
+	pages := efs.NewDescribeAccessPointsPaginator(c, &efs.DescribeAccessPointsInput{
+		FileSystemId: aws.String("fs-1"),
+		MaxResults:   aws.Int32(2),
+	})
+	for pages.HasMorePages() {
+		out, err := pages.NextPage(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, ap := range out.AccessPoints {
+			listed = append(listed, aws.ToString(ap.AccessPointId))
+		}
+	}
+	if len(listed) != 5 {
+		t.Errorf("paginated listing returned %d access points, want 5: %v", len(listed), listed)
+	}
+
+	if _, err := c.DeleteAccessPoint(ctx, &efs.DeleteAccessPointInput{AccessPointId: first.AccessPointId}); err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.DeleteAccessPoint(ctx, &efs.DeleteAccessPointInput{AccessPointId: first.AccessPointId})
+	var notFound *types.AccessPointNotFound
+	if !errors.As(err, &notFound) {
+		t.Errorf("deleting a deleted access point: got %v, want AccessPointNotFound", err)
+	}
+}
+
+func TestServerThrottling(t *testing.T) {
+	ctx := context.Background()
+	c, _, srv := newServerClient(t, ServerOptions{RequestsPerSecond: 1, Burst: 1})
+
+	var throttled int
+	for i := 0; i < 3; i++ {
+		_, err := c.DescribeAccessPoints(ctx, &efs.DescribeAccessPointsInput{FileSystemId: aws.String("fs-1")})
+		var apiErr smithy.APIError
+		if errors.As(err, &apiErr) && apiErr.ErrorCode() == "ThrottlingException" {
+			throttled++
+		} else if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if throttled == 0 {
+		t.Fatal("no request was throttled")
+	}
+	stats := srv.Stats()
+	if stats.Requests["DescribeAccessPoints"] != 3 || stats.TotalThrottled() != throttled {
+		t.Errorf("Stats() = %+v, want 3 requests and %d throttled", stats, throttled)
+	}
+}
+
+func TestServerAccessPointLimit(t *testing.T) {
+	ctx := context.Background()
+	c, fake, _ := newServerClient(t, ServerOptions{AccessPointLimit: 1})
+	fake.CreateAccessPoint("fs-1", "/a")
+
+	_, err := c.CreateAccessPoint(ctx, &efs.CreateAccessPointInput{
+		ClientToken:  aws.String("pvc-b"),
+		FileSystemId: aws.String("fs-1"),
+	})
+	var limit *types.AccessPointLimitExceeded
+	if !errors.As(err, &limit) {
+		t.Errorf("got %v, want AccessPointLimitExceeded", err)
+	}
+}
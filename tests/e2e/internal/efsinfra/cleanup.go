@@ -0,0 +1,223 @@
+package efsinfra
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"e2e/internal/efsapi"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// dependencies lists, per managed resource kind, the kinds whose AWS
+// resources it refers to. A resource is only deleted once everything that
+// depends on it is gone, whatever order Create made them in.
+var dependencies = map[schema.GroupVersionKind][]schema.GroupVersionKind{
+	ec2SecurityGroupRuleGVK: {ec2SecurityGroupGVK},
+	efsMountTargetGVK:       {efsFileSystemGVK, ec2SecurityGroupGVK},
+	efsFileSystemPolicyGVK:  {efsFileSystemGVK},
+}
+
+// dependents returns, for each of refs, the indexes of the refs that
+// depend on it.
+func dependents(refs []resourceRef) [][]int {
+	out := make([][]int, len(refs))
+	for i, ref := range refs {
+		for j, other := range refs {
+			for _, dep := range dependencies[other.gvk] {
+				if dep == ref.gvk {
+					out[i] = append(out[i], j)
+				}
+			}
+		}
+	}
+	return out
+}
+
+// Cleanup deletes all Crossplane resources and waits for them to be fully
+// removed. Each resource is deleted as soon as its dependents are gone, so
+// independent resources are deleted in parallel. A resource whose deletion
+// does not finish is reported with what blocks it, and the resources it
+// depends on are left alone. Cleanup carries on past failures and returns
+// them all. The stored state is deleted once everything is gone; until
+// then it keeps what is left.
+func (e *Infra) Cleanup(ctx context.Context, c client.Client) error {
+	refs := e.created
+	deps := dependents(refs)
+	done := make([]chan struct{}, len(refs))
+	for i := range done {
+		done[i] = make(chan struct{})
+	}
+	errs := make([]error, len(refs))
+
+	var wg sync.WaitGroup
+	for i, ref := range refs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer close(done[i])
+			var left []string
+			for _, d := range deps[i] {
+				<-done[d]
+				if errs[d] != nil {
+					left = append(left, refs[d].String())
+				}
+			}
+			if len(left) > 0 {
+				errs[i] = fmt.Errorf("not deleting %s: %s still exist", ref, strings.Join(left, ", "))
+				return
+			}
+			errs[i] = e.delete(ctx, c, ref)
+		}()
+	}
+	wg.Wait()
+
+	var remaining []resourceRef
+	for i, ref := range refs {
+		if errs[i] != nil {
+			remaining = append(remaining, ref)
+		}
+	}
+	e.created = remaining
+	if err := errors.Join(errs...); err != nil {
+		if serr := e.saveState(ctx); serr != nil {
+			e.log.Error(serr, "saving fixture state")
+		}
+		return err
+	}
+	if e.store != nil {
+		if err := e.store.Delete(ctx); err != nil {
+			return fmt.Errorf("deleting fixture state: %w", err)
+		}
+	}
+	return nil
+}
+
+// Delete issues the deletion of every tracked resource at once, without
+// waiting for dependents to go first or for anything to be gone. Crossplane
+// retries what AWS refuses until its dependents are deleted. It is for runs
+// that cannot wait: the state is kept, so a later Cleanup, or efs-fixture
+// down, confirms the deletion.
+func (e *Infra) Delete(ctx context.Context, c client.Client) error {
+	var errs []error
+	for _, ref := range e.created {
+		obj := &unstructured.Unstructured{}
+		obj.SetGroupVersionKind(ref.gvk)
+		obj.SetName(ref.name)
+		if err := client.IgnoreNotFound(c.Delete(ctx, obj)); err != nil {
+			errs = append(errs, fmt.Errorf("deleting %s: %w", ref, err))
+			continue
+		}
+		e.log.Info("deletion issued", "kind", ref.gvk.Kind, "name", ref.name)
+	}
+	return errors.Join(errs...)
+}
+
+// delete deletes a resource and waits for it to be gone. If it is not, the
+// error says what the resource was last seen waiting on.
+func (e *Infra) delete(ctx context.Context, c client.Client, ref resourceRef) error {
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(ref.gvk)
+	obj.SetName(ref.name)
+	if err := c.Delete(ctx, obj); err != nil {
+		if apierrors.IsNotFound(err) {
+			e.log.Info("resource already deleted", "kind", ref.gvk.Kind, "name", ref.name)
+			return nil
+		}
+		return fmt.Errorf("deleting %s: %w", ref, err)
+	}
+	e.log.Info("deleting resource", "kind", ref.gvk.Kind, "name", ref.name)
+
+	var blockers []string
+	err := e.waitFor(ctx, e.timeouts.Delete, ref.String()+" to be deleted", func(ctx context.Context) bool {
+		obj := &unstructured.Unstructured{}
+		obj.SetGroupVersionKind(ref.gvk)
+		err := c.Get(ctx, types.NamespacedName{Name: ref.name}, obj)
+		if apierrors.IsNotFound(err) {
+			e.log.Info("resource deleted", "kind", ref.gvk.Kind, "name", ref.name)
+			return true
+		}
+		if err != nil {
+			e.log.Info("cannot fetch resource status", "kind", ref.gvk.Kind, "name", ref.name, "error", err.Error())
+			return false
+		}
+		blockers = e.deletionBlockers(ctx, ref, obj)
+		if len(blockers) > 0 {
+			e.log.Info("deletion blocked", "kind", ref.gvk.Kind, "name", ref.name, "blockedBy", strings.Join(blockers, "; "))
+		} else {
+			e.log.Info("resource still deleting", "kind", ref.gvk.Kind, "name", ref.name, "conditions", conditionSummary(obj))
+		}
+		return false
+	})
+	if err != nil && len(blockers) > 0 {
+		return fmt.Errorf("%w; blocked by: %s", err, strings.Join(blockers, "; "))
+	}
+	return err
+}
+
+// deletionBlockers explains why a resource being deleted still exists: the
+// failing Crossplane conditions, which carry the AWS error such as
+// DependencyViolation, and for a security group the network interfaces
+// still attached to it.
+func (e *Infra) deletionBlockers(ctx context.Context, ref resourceRef, obj *unstructured.Unstructured) []string {
+	var blockers []string
+	conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	for _, c := range conditions {
+		cond, ok := c.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		t, _, _ := unstructured.NestedString(cond, "type")
+		s, _, _ := unstructured.NestedString(cond, "status")
+		msg, _, _ := unstructured.NestedString(cond, "message")
+		if s == "False" && msg != "" {
+			blockers = append(blockers, fmt.Sprintf("%s=False: %s", t, msg))
+		}
+	}
+
+	if ref.gvk != ec2SecurityGroupGVK {
+		return blockers
+	}
+	id := ref.id
+	if id == "" {
+		id, _, _ = unstructured.NestedString(obj.Object, "status", "atProvider", "id")
+	}
+	inspector := e.blockerInspector(ctx)
+	if id == "" || inspector == nil {
+		return blockers
+	}
+	enis, err := inspector.NetworkInterfaces(ctx, id)
+	if err != nil {
+		e.log.Info("cannot list network interfaces", "securityGroupID", id, "error", err.Error())
+		return blockers
+	}
+	for _, eni := range enis {
+		blockers = append(blockers, fmt.Sprintf("%s attached to %s (%s, %s)", id, eni.ID, eni.Description, eni.Status))
+	}
+	return blockers
+}
+
+// blockerInspector returns the AWS API used to find what blocks a deletion,
+// creating it on first use. Without AWS credentials it returns nil and
+// blockers are only taken from the Crossplane conditions.
+func (e *Infra) blockerInspector(ctx context.Context) efsapi.Inspector {
+	e.inspectorOnce.Do(func() {
+		if e.inspector != nil {
+			return
+		}
+		i, err := efsapi.NewAWSInspector(ctx, e.region)
+		if err != nil {
+			e.log.Info("not inspecting AWS for deletion blockers", "error", err.Error())
+			return
+		}
+		e.inspector = i
+	})
+	return e.inspector
+}
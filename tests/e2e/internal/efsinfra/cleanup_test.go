@@ -0,0 +1,160 @@
+package efsinfra
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"e2e/internal/efsapi"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+// stuck makes a managed resource stay around after deletion, with the
+// given Synced=False message.
+func stuck(obj client.Object, message string) client.Object {
+	u := obj.(*unstructured.Unstructured)
+	u.SetFinalizers([]string{"finalizer.managedresource.crossplane.io"})
+	if message != "" {
+		u.Object["status"].(map[string]interface{})["conditions"] = []interface{}{
+			map[string]interface{}{"type": "Synced", "status": "False", "reason": "ReconcileError", "message": message},
+		}
+	}
+	return u
+}
+
+func TestCleanupFollowsDependencies(t *testing.T) {
+	ctx := context.Background()
+	objs := append(fixtureObjects(), managed(efsFileSystemPolicyGVK, "wc1-efs-e2e-fs-policy", "wc1", "fs-1"))
+
+	var mu sync.Mutex
+	var deleted []string
+	base := newFakeClient(objs...)
+	c := interceptor.NewClient(base.(client.WithWatch), interceptor.Funcs{
+		Delete: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.DeleteOption) error {
+			mu.Lock()
+			deleted = append(deleted, obj.GetName())
+			mu.Unlock()
+			return c.Delete(ctx, obj, opts...)
+		},
+	})
+
+	e := New("wc1", "")
+	if err := e.Adopt(ctx, c); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Cleanup(ctx, c); err != nil {
+		t.Fatal(err)
+	}
+
+	at := map[string]int{}
+	for i, name := range deleted {
+		at[name] = i
+	}
+	if len(at) != 6 {
+		t.Fatalf("deleted %v, want all 6 resources", deleted)
+	}
+	for _, before := range []struct{ dependent, dependency string }{
+		{"wc1-efs-e2e-sgr-nfs", "wc1-efs-e2e-sg"},
+		{"wc1-efs-e2e-mt-eu-west-1a", "wc1-efs-e2e-sg"},
+		{"wc1-efs-e2e-mt-eu-west-1b", "wc1-efs-e2e-fs"},
+		{"wc1-efs-e2e-fs-policy", "wc1-efs-e2e-fs"},
+	} {
+		if at[before.dependent] > at[before.dependency] {
+			t.Errorf("%s deleted before %s: %v", before.dependency, before.dependent, deleted)
+		}
+	}
+}
+
+func TestCleanupReportsBlockers(t *testing.T) {
+	objs := fixtureObjects()
+	objs[0] = stuck(objs[0], "delete failed: DependencyViolation: resource sg-1 has a dependent object")
+	c := newFakeClient(objs...)
+
+	e := New("wc1", "").WithInspector(&fakeInspector{interfaces: map[string][]efsapi.NetworkInterface{
+		"sg-1": {{ID: "eni-1", Description: "ELB app/leftover", Status: "in-use"}},
+	}})
+	if err := e.Adopt(context.Background(), c); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	err := e.Cleanup(ctx, c)
+	if err == nil {
+		t.Fatal("Cleanup() succeeded with a stuck security group")
+	}
+	for _, want := range []string{
+		"SecurityGroup wc1-efs-e2e-sg to be deleted",
+		"Synced=False: delete failed: DependencyViolation",
+		"sg-1 attached to eni-1 (ELB app/leftover, in-use)",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Cleanup() error %q does not contain %q", err, want)
+		}
+	}
+	// Only the security group is left for the next Cleanup.
+	if len(e.created) != 1 || e.created[0].name != "wc1-efs-e2e-sg" {
+		t.Errorf("left %v, want only the security group", e.created)
+	}
+}
+
+func TestCleanupKeepsDependenciesOfStuckResources(t *testing.T) {
+	objs := fixtureObjects()
+	objs[3] = stuck(objs[3], "")
+	c := newFakeClient(objs...)
+
+	e := New("wc1", "")
+	if err := e.Adopt(context.Background(), c); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	err := e.Cleanup(ctx, c)
+	if err == nil {
+		t.Fatal("Cleanup() succeeded with a stuck mount target")
+	}
+	for _, want := range []string{
+		"not deleting FileSystem wc1-efs-e2e-fs: MountTarget wc1-efs-e2e-mt-eu-west-1b still exist",
+		"not deleting SecurityGroup wc1-efs-e2e-sg: MountTarget wc1-efs-e2e-mt-eu-west-1b still exist",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Cleanup() error %q does not contain %q", err, want)
+		}
+	}
+	if len(e.created) != 3 {
+		t.Errorf("left %v, want the mount target, file system and security group", e.created)
+	}
+}
+
+func TestDeleteDoesNotWait(t *testing.T) {
+	objs := fixtureObjects()
+	objs[3] = stuck(objs[3], "")
+	c := newFakeClient(objs...)
+
+	e := New("wc1", "")
+	if err := e.Adopt(context.Background(), c); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Delete(context.Background(), c); err != nil {
+		t.Fatal(err)
+	}
+	left, err := e.Status(context.Background(), c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var gone int
+	for _, r := range left {
+		if r.Conditions == "not found" {
+			gone++
+		}
+	}
+	// Everything but the stuck mount target is gone, including what it
+	// depends on, and all of it is still tracked for a later Cleanup.
+	if gone != 4 || len(e.created) != 5 {
+		t.Errorf("%d of %d resources gone, %d tracked; want 4, 5", gone, len(left), len(e.created))
+	}
+}
@@ -0,0 +1,707 @@
+package efsinfra
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"e2e/internal/efsapi"
+
+	"github.com/go-logr/logr"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ClusterLabel is set on every Crossplane resource Create makes, to the
+// workload cluster name, so leftovers can be found without local state.
+const ClusterLabel = "efs-e2e.giantswarm.io/cluster"
+
+// pollInterval is how often readiness and deletion are checked.
+const pollInterval = 10 * time.Second
+
+var (
+	awsClusterGVK = schema.GroupVersionKind{
+		Group:   "infrastructure.cluster.x-k8s.io",
+		Version: "v1beta2",
+		Kind:    "AWSCluster",
+	}
+
+	providerConfigGVK = schema.GroupVersionKind{
+		Group:   "aws.upbound.io",
+		Version: "v1beta1",
+		Kind:    "ProviderConfig",
+	}
+
+	efsFileSystemGVK = schema.GroupVersionKind{
+		Group:   "efs.aws.upbound.io",
+		Version: "v1beta1",
+		Kind:    "FileSystem",
+	}
+
+	efsMountTargetGVK = schema.GroupVersionKind{
+		Group:   "efs.aws.upbound.io",
+		Version: "v1beta1",
+		Kind:    "MountTarget",
+	}
+
+	efsFileSystemPolicyGVK = schema.GroupVersionKind{
+		Group:   "efs.aws.upbound.io",
+		Version: "v1beta1",
+		Kind:    "FileSystemPolicy",
+	}
+
+	ec2SecurityGroupGVK = schema.GroupVersionKind{
+		Group:   "ec2.aws.upbound.io",
+		Version: "v1beta1",
+		Kind:    "SecurityGroup",
+	}
+
+	ec2SecurityGroupRuleGVK = schema.GroupVersionKind{
+		Group:   "ec2.aws.upbound.io",
+		Version: "v1beta1",
+		Kind:    "SecurityGroupRule",
+	}
+
+	// creationOrder lists the managed resource kinds in the order Create
+	// makes them. Cleanup follows dependencies instead.
+	creationOrder = []schema.GroupVersionKind{
+		ec2SecurityGroupGVK,
+		efsFileSystemGVK,
+		ec2SecurityGroupRuleGVK,
+		efsMountTargetGVK,
+		efsFileSystemPolicyGVK,
+	}
+)
+
+// Infra provisions and tears down the EFS file system, security group and
+// mount targets a test suite runs against, using Crossplane managed
+// resources on the MC. Its methods return errors rather than failing a
+// spec, so it can be driven from Ginkgo suites and from cmd/efs-fixture.
+type Infra struct {
+	clusterName    string
+	orgNamespace   string
+	region         string
+	providerConfig string
+	// providerConfigFrom says where providerConfig came from.
+	providerConfigFrom string
+	account            Account
+	throughputMode     string
+	vpcID              string
+	vpcCIDR            string
+	privateSubnets     []subnetInfo
+	// privateCIDRs are every private subnet of the cluster, including
+	// those in an AZ whose mount target is in another subnet. The node
+	// check uses them to tell private from public subnets.
+	privateCIDRs []subnetInfo
+	// nodeSecurityGroups are the CAPA node security groups, accepted as
+	// the NFS source of a reused file system's security group rules.
+	nodeSecurityGroups []string
+	log                logr.Logger
+	recordPhase        PhaseFunc
+	store              StateStore
+	existing           existing
+	inspector          efsapi.Inspector
+	inspectorOnce      sync.Once
+	reused             bool
+	timeouts           Timeouts
+
+	fileSystemID    string
+	securityGroupID string
+
+	// Track created resources for cleanup (in creation order).
+	created []resourceRef
+}
+
+type subnetInfo struct {
+	id   string
+	az   string
+	cidr string
+}
+
+type resourceRef struct {
+	gvk  schema.GroupVersionKind
+	name string
+	// id is the AWS ID, once Crossplane reports it.
+	id string
+}
+
+func (r resourceRef) String() string {
+	return r.gvk.Kind + " " + r.name
+}
+
+// New returns an Infra for the given workload cluster. The Crossplane
+// ProviderConfig defaults to the cluster name until DiscoverProviderConfig
+// finds a better one.
+func New(clusterName, orgNamespace string) *Infra {
+	return &Infra{
+		clusterName:        clusterName,
+		orgNamespace:       orgNamespace,
+		providerConfig:     clusterName,
+		providerConfigFrom: "the cluster name",
+		log:                logr.Discard(),
+		recordPhase:        func(string, time.Duration, string) {},
+		timeouts:           DefaultTimeouts(),
+	}
+}
+
+// Timeouts bound the waits for Crossplane and AWS. Slower regions may need
+// more.
+type Timeouts struct {
+	// Ready is how long a managed resource may take to report its AWS ID
+	// and to be Ready.
+	Ready time.Duration
+	// Available is how long a mount target may take to be Ready, and the
+	// file system to switch throughput modes.
+	Available time.Duration
+	// Delete is how long one resource may take to be gone from AWS.
+	Delete time.Duration
+}
+
+// DefaultTimeouts returns the timeouts of an Infra from New.
+func DefaultTimeouts() Timeouts {
+	return Timeouts{
+		Ready:     5 * time.Minute,
+		Available: 10 * time.Minute,
+		Delete:    10 * time.Minute,
+	}
+}
+
+// WithTimeouts replaces the DefaultTimeouts.
+func (e *Infra) WithTimeouts(t Timeouts) *Infra {
+	e.timeouts = t
+	return e
+}
+
+// WithLogger sets where progress is logged, e.g. GinkgoLogr in suites.
+func (e *Infra) WithLogger(log logr.Logger) *Infra {
+	e.log = log
+	return e
+}
+
+// PhaseFunc receives how long a phase of Create took and the AWS ID it
+// produced, if any.
+type PhaseFunc func(name string, took time.Duration, id string)
+
+// WithPhaseRecorder makes Create report how long it waited for the
+// SecurityGroup ID, the FileSystem ID and the MountTargets, e.g. to
+// testhelpers.RecordPhase in suites.
+func (e *Infra) WithPhaseRecorder(f PhaseFunc) *Infra {
+	e.recordPhase = f
+	return e
+}
+
+// WithThroughputMode sets the throughput mode of the file system created by
+// Create (e.g. bursting or elastic). The EFS default is used when unset.
+func (e *Infra) WithThroughputMode(mode string) *Infra {
+	e.throughputMode = mode
+	return e
+}
+
+// ThroughputMode returns the throughput mode of the file system: the one
+// set by WithThroughputMode or SetThroughputMode, or the one a reused file
+// system is in. It is empty when the file system uses the EFS default.
+func (e *Infra) ThroughputMode() string {
+	return e.throughputMode
+}
+
+// FileSystemID returns the AWS ID of the file system once Create has finished.
+func (e *Infra) FileSystemID() string {
+	return e.fileSystemID
+}
+
+// Region returns the AWS region discovered by DiscoverNetwork.
+func (e *Infra) Region() string {
+	return e.region
+}
+
+// VPCCIDR returns the VPC CIDR discovered by DiscoverNetwork, 0.0.0.0/0 if
+// the AWSCluster does not report one.
+func (e *Infra) VPCCIDR() string {
+	return e.vpcCIDR
+}
+
+// DiscoverNetwork reads the AWSCluster resource to extract VPC, subnets, and region.
+func (e *Infra) DiscoverNetwork(ctx context.Context, c client.Client) error {
+	awsCluster := &unstructured.Unstructured{}
+	awsCluster.SetGroupVersionKind(awsClusterGVK)
+
+	if err := c.Get(ctx, types.NamespacedName{
+		Name:      e.clusterName,
+		Namespace: e.orgNamespace,
+	}, awsCluster); err != nil {
+		return fmt.Errorf("getting AWSCluster %s/%s: %w", e.orgNamespace, e.clusterName, err)
+	}
+
+	// Region
+	region, ok, _ := unstructured.NestedString(awsCluster.Object, "spec", "region")
+	if !ok || region == "" {
+		return fmt.Errorf("AWSCluster missing spec.region")
+	}
+	e.region = region
+
+	// VPC ID — try status first, then spec
+	vpcID, _, _ := unstructured.NestedString(awsCluster.Object, "status", "networkStatus", "vpc", "id")
+	if vpcID == "" {
+		vpcID, _, _ = unstructured.NestedString(awsCluster.Object, "spec", "network", "vpc", "id")
+	}
+	if vpcID == "" {
+		return fmt.Errorf("could not find VPC ID in AWSCluster status or spec")
+	}
+	e.vpcID = vpcID
+
+	// VPC CIDR — for security group rule
+	cidr, _, _ := unstructured.NestedString(awsCluster.Object, "status", "networkStatus", "vpc", "cidrBlock")
+	if cidr == "" {
+		cidr, _, _ = unstructured.NestedString(awsCluster.Object, "spec", "network", "vpc", "cidrBlock")
+	}
+	if cidr == "" {
+		cidr = "0.0.0.0/0"
+	}
+	e.vpcCIDR = cidr
+
+	// Subnets — try status first, then spec
+	subnets, ok, _ := unstructured.NestedSlice(awsCluster.Object, "status", "networkStatus", "subnets")
+	if !ok || len(subnets) == 0 {
+		subnets, ok, _ = unstructured.NestedSlice(awsCluster.Object, "spec", "network", "subnets")
+	}
+	if !ok || len(subnets) == 0 {
+		return fmt.Errorf("no subnets found in AWSCluster")
+	}
+
+	// Keep one private subnet per AZ for mount targets.
+	e.privateSubnets = nil
+	e.privateCIDRs = nil
+	seenAZs := map[string]bool{}
+	for _, s := range subnets {
+		sub, ok := s.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		isPublic, _, _ := unstructured.NestedBool(sub, "isPublic")
+		if isPublic {
+			continue
+		}
+		// resourceID is the actual AWS subnet ID (subnet-xxx),
+		// while id is the CAPI name (clustername-subnet-private-az).
+		id, _, _ := unstructured.NestedString(sub, "resourceID")
+		if id == "" {
+			id, _, _ = unstructured.NestedString(sub, "id")
+		}
+		az, _, _ := unstructured.NestedString(sub, "availabilityZone")
+		subnetCIDR, _, _ := unstructured.NestedString(sub, "cidrBlock")
+		if az != "" && subnetCIDR != "" {
+			e.privateCIDRs = append(e.privateCIDRs, subnetInfo{id: id, az: az, cidr: subnetCIDR})
+		}
+		if id == "" || az == "" || seenAZs[az] {
+			continue
+		}
+		seenAZs[az] = true
+		e.privateSubnets = append(e.privateSubnets, subnetInfo{id: id, az: az, cidr: subnetCIDR})
+	}
+	if len(e.privateSubnets) == 0 {
+		return fmt.Errorf("no private subnets found in AWSCluster")
+	}
+
+	// Security groups by role; nodes are in the "node" one.
+	e.nodeSecurityGroups = nil
+	if id, _, _ := unstructured.NestedString(awsCluster.Object, "status", "networkStatus", "securityGroups", "node", "id"); id != "" {
+		e.nodeSecurityGroups = append(e.nodeSecurityGroups, id)
+	}
+
+	e.log.Info("discovered network",
+		"region", e.region,
+		"vpcID", e.vpcID,
+		"vpcCIDR", e.vpcCIDR,
+		"privateSubnets", len(e.privateSubnets),
+		"providerConfig", e.providerConfig,
+	)
+
+	return nil
+}
+
+// Create provisions EFS infrastructure via Crossplane on the MC.
+// It creates a SecurityGroup, FileSystem, ingress rule, and MountTargets,
+// then waits for all resources to become ready. Resources created before a
+// failure stay tracked, so Cleanup removes them. Resources that already
+// exist for the cluster, e.g. from a run restored with LoadState, are
+// reused, so Create also resumes an interrupted run. With an existing file
+// system configured, Create only validates it and creates nothing.
+func (e *Infra) Create(ctx context.Context, c client.Client) error {
+	if e.existing.enabled() {
+		return e.useExisting(ctx)
+	}
+
+	prefix := e.prefix()
+	// Both are created before either is waited for, so their phases overlap.
+	start := time.Now()
+
+	sg := newCrossplaneResource(ec2SecurityGroupGVK, prefix+"-sg", map[string]interface{}{
+		"forProvider": map[string]interface{}{
+			"region":      e.region,
+			"vpcId":       e.vpcID,
+			"description": "EFS E2E test - NFS access",
+			"tags": map[string]interface{}{
+				"Name": prefix + "-sg",
+			},
+		},
+		"providerConfigRef": map[string]interface{}{
+			"name": e.providerConfig,
+		},
+	})
+	if err := e.create(ctx, c, sg); err != nil {
+		return err
+	}
+
+	fsForProvider := map[string]interface{}{
+		"region":          e.region,
+		"performanceMode": "generalPurpose",
+		"tags": map[string]interface{}{
+			"Name": prefix + "-fs",
+		},
+	}
+	if e.throughputMode != "" {
+		fsForProvider["throughputMode"] = e.throughputMode
+	}
+	fs := newCrossplaneResource(efsFileSystemGVK, prefix+"-fs", map[string]interface{}{
+		"forProvider": fsForProvider,
+		"providerConfigRef": map[string]interface{}{
+			"name": e.providerConfig,
+		},
+	})
+	if err := e.create(ctx, c, fs); err != nil {
+		return err
+	}
+
+	if err := e.waitFor(ctx, e.timeouts.Ready, "SecurityGroup AWS ID", func(ctx context.Context) bool {
+		e.securityGroupID = e.getAtProviderID(ctx, c, ec2SecurityGroupGVK, prefix+"-sg")
+		if e.securityGroupID != "" {
+			e.log.Info("SecurityGroup has AWS ID", "name", prefix+"-sg", "id", e.securityGroupID)
+		} else {
+			e.logResourceStatus(ctx, c, ec2SecurityGroupGVK, prefix+"-sg")
+		}
+		return e.securityGroupID != ""
+	}); err != nil {
+		return err
+	}
+	e.recordPhase("SecurityGroup ID", time.Since(start), e.securityGroupID)
+	if err := e.setID(ctx, ec2SecurityGroupGVK, prefix+"-sg", e.securityGroupID); err != nil {
+		return err
+	}
+	if err := e.waitReady(ctx, c, ec2SecurityGroupGVK, prefix+"-sg", e.timeouts.Ready); err != nil {
+		return err
+	}
+
+	if err := e.waitFor(ctx, e.timeouts.Ready, "FileSystem AWS ID", func(ctx context.Context) bool {
+		e.fileSystemID = e.getAtProviderID(ctx, c, efsFileSystemGVK, prefix+"-fs")
+		if e.fileSystemID != "" {
+			e.log.Info("FileSystem has AWS ID", "name", prefix+"-fs", "id", e.fileSystemID)
+		} else {
+			e.logResourceStatus(ctx, c, efsFileSystemGVK, prefix+"-fs")
+		}
+		return e.fileSystemID != ""
+	}); err != nil {
+		return err
+	}
+	e.recordPhase("FileSystem ID", time.Since(start), e.fileSystemID)
+	if err := e.setID(ctx, efsFileSystemGVK, prefix+"-fs", e.fileSystemID); err != nil {
+		return err
+	}
+	if err := e.waitReady(ctx, c, efsFileSystemGVK, prefix+"-fs", e.timeouts.Ready); err != nil {
+		return err
+	}
+
+	sgr := newCrossplaneResource(ec2SecurityGroupRuleGVK, prefix+"-sgr-nfs", map[string]interface{}{
+		"forProvider": map[string]interface{}{
+			"region":          e.region,
+			"securityGroupId": e.securityGroupID,
+			"type":            "ingress",
+			"fromPort":        float64(2049),
+			"toPort":          float64(2049),
+			"protocol":        "tcp",
+			"cidrBlocks":      []interface{}{e.vpcCIDR},
+		},
+		"providerConfigRef": map[string]interface{}{
+			"name": e.providerConfig,
+		},
+	})
+	if err := e.create(ctx, c, sgr); err != nil {
+		return err
+	}
+	if err := e.waitReady(ctx, c, ec2SecurityGroupRuleGVK, prefix+"-sgr-nfs", e.timeouts.Ready); err != nil {
+		return err
+	}
+	if err := e.setID(ctx, ec2SecurityGroupRuleGVK, prefix+"-sgr-nfs", e.getAtProviderID(ctx, c, ec2SecurityGroupRuleGVK, prefix+"-sgr-nfs")); err != nil {
+		return err
+	}
+
+	e.log.Info("creating MountTargets", "subnets", len(e.privateSubnets))
+	start = time.Now()
+	for _, subnet := range e.privateSubnets {
+		mtName := prefix + "-mt-" + subnet.az
+		mt := newCrossplaneResource(efsMountTargetGVK, mtName, map[string]interface{}{
+			"forProvider": map[string]interface{}{
+				"region":         e.region,
+				"fileSystemId":   e.fileSystemID,
+				"subnetId":       subnet.id,
+				"securityGroups": []interface{}{e.securityGroupID},
+			},
+			"providerConfigRef": map[string]interface{}{
+				"name": e.providerConfig,
+			},
+		})
+		if err := e.create(ctx, c, mt); err != nil {
+			return err
+		}
+	}
+
+	var mountTargetIDs []string
+	for _, subnet := range e.privateSubnets {
+		mtName := prefix + "-mt-" + subnet.az
+		if err := e.waitReady(ctx, c, efsMountTargetGVK, mtName, e.timeouts.Available); err != nil {
+			return err
+		}
+		id := e.getAtProviderID(ctx, c, efsMountTargetGVK, mtName)
+		if err := e.setID(ctx, efsMountTargetGVK, mtName, id); err != nil {
+			return err
+		}
+		mountTargetIDs = append(mountTargetIDs, id)
+	}
+	e.recordPhase("MountTargets ready", time.Since(start), strings.Join(mountTargetIDs, ","))
+
+	e.log.Info("all EFS infrastructure is ready",
+		"fileSystemID", e.fileSystemID,
+		"securityGroupID", e.securityGroupID,
+		"mountTargets", len(e.privateSubnets),
+	)
+	return nil
+}
+
+// ApplyFileSystemPolicy attaches a resource policy to the file system
+// created by Create and waits for Crossplane to report it ready. The policy
+// is removed together with the rest of the infrastructure by Cleanup.
+// It refuses to touch a reused file system.
+func (e *Infra) ApplyFileSystemPolicy(ctx context.Context, c client.Client, policy string) error {
+	if e.reused {
+		return fmt.Errorf("not attaching a policy to the reused file system %s", e.fileSystemID)
+	}
+	name := e.prefix() + "-fs-policy"
+
+	fsp := newCrossplaneResource(efsFileSystemPolicyGVK, name, map[string]interface{}{
+		"forProvider": map[string]interface{}{
+			"region":       e.region,
+			"fileSystemId": e.fileSystemID,
+			"policy":       policy,
+		},
+		"providerConfigRef": map[string]interface{}{
+			"name": e.providerConfig,
+		},
+	})
+	if err := e.create(ctx, c, fsp); err != nil {
+		return err
+	}
+	return e.waitReady(ctx, c, efsFileSystemPolicyGVK, name, e.timeouts.Ready)
+}
+
+// SetThroughputMode switches the file system created by Create to another
+// throughput mode, e.g. from bursting to elastic, and waits for Crossplane
+// to report the file system in that mode. EFS limits how often some
+// switches can be made, see UpdateFileSystem. It refuses to touch a reused
+// file system.
+func (e *Infra) SetThroughputMode(ctx context.Context, c client.Client, mode string) error {
+	if e.reused {
+		return fmt.Errorf("not changing the throughput mode of the reused file system %s", e.fileSystemID)
+	}
+	name := e.prefix() + "-fs"
+	fs := &unstructured.Unstructured{}
+	fs.SetGroupVersionKind(efsFileSystemGVK)
+	if err := c.Get(ctx, types.NamespacedName{Name: name}, fs); err != nil {
+		return fmt.Errorf("getting FileSystem %s: %w", name, err)
+	}
+	patch := client.MergeFrom(fs.DeepCopy())
+	if err := unstructured.SetNestedField(fs.Object, mode, "spec", "forProvider", "throughputMode"); err != nil {
+		return err
+	}
+	if err := c.Patch(ctx, fs, patch); err != nil {
+		return fmt.Errorf("setting the throughput mode of FileSystem %s: %w", name, err)
+	}
+	start := time.Now()
+	err := e.waitFor(ctx, e.timeouts.Available, fmt.Sprintf("FileSystem %s to be in throughput mode %s", name, mode), func(ctx context.Context) bool {
+		obj := &unstructured.Unstructured{}
+		obj.SetGroupVersionKind(efsFileSystemGVK)
+		if err := c.Get(ctx, types.NamespacedName{Name: name}, obj); err != nil {
+			return false
+		}
+		got, _, _ := unstructured.NestedString(obj.Object, "status", "atProvider", "throughputMode")
+		return got == mode && isReady(obj)
+	})
+	if err != nil {
+		e.logResourceStatus(ctx, c, efsFileSystemGVK, name)
+		return err
+	}
+	e.throughputMode = mode
+	e.recordPhase("throughput mode "+mode, time.Since(start), e.fileSystemID)
+	return nil
+}
+
+func (e *Infra) prefix() string {
+	return e.clusterName + "-efs-e2e"
+}
+
+// create labels and creates a managed resource and tracks it for Cleanup.
+// A resource of the same name this cluster's fixture created earlier is
+// reused instead.
+func (e *Infra) create(ctx context.Context, c client.Client, obj *unstructured.Unstructured) error {
+	obj.SetLabels(map[string]string{ClusterLabel: e.clusterName})
+	err := c.Create(ctx, obj)
+	switch {
+	case apierrors.IsAlreadyExists(err):
+		existing := &unstructured.Unstructured{}
+		existing.SetGroupVersionKind(obj.GroupVersionKind())
+		if err := c.Get(ctx, types.NamespacedName{Name: obj.GetName()}, existing); err != nil {
+			return fmt.Errorf("getting existing %s %s: %w", obj.GetKind(), obj.GetName(), err)
+		}
+		if owner := existing.GetLabels()[ClusterLabel]; owner != e.clusterName {
+			return fmt.Errorf("%s %s already exists and is not labelled %s=%s", obj.GetKind(), obj.GetName(), ClusterLabel, e.clusterName)
+		}
+		e.log.Info("reusing existing "+obj.GetKind(), "name", obj.GetName())
+	case err != nil:
+		return fmt.Errorf("creating %s %s: %w", obj.GetKind(), obj.GetName(), err)
+	default:
+		e.log.Info("created "+obj.GetKind(), "name", obj.GetName())
+	}
+	e.track(obj.GroupVersionKind(), obj.GetName())
+	return e.saveState(ctx)
+}
+
+// track records a resource for Cleanup, once.
+func (e *Infra) track(gvk schema.GroupVersionKind, name string) {
+	for _, ref := range e.created {
+		if ref.gvk == gvk && ref.name == name {
+			return
+		}
+	}
+	e.created = append(e.created, resourceRef{gvk: gvk, name: name})
+}
+
+// setID records a tracked resource's AWS ID and saves the state.
+func (e *Infra) setID(ctx context.Context, gvk schema.GroupVersionKind, name, id string) error {
+	e.recordID(gvk, name, id)
+	return e.saveState(ctx)
+}
+
+func (e *Infra) recordID(gvk schema.GroupVersionKind, name, id string) {
+	for i := range e.created {
+		if e.created[i].gvk == gvk && e.created[i].name == name {
+			e.created[i].id = id
+		}
+	}
+}
+
+// waitFor polls cond until it holds, the timeout passes or ctx is done.
+func (e *Infra) waitFor(ctx context.Context, timeout time.Duration, what string, cond func(context.Context) bool) error {
+	e.log.Info("waiting for " + what)
+	err := wait.PollUntilContextTimeout(ctx, pollInterval, timeout, true, func(ctx context.Context) (bool, error) {
+		return cond(ctx), nil
+	})
+	if err != nil {
+		return fmt.Errorf("waiting for %s: %w", what, err)
+	}
+	return nil
+}
+
+func (e *Infra) waitReady(ctx context.Context, c client.Client, gvk schema.GroupVersionKind, name string, timeout time.Duration) error {
+	return e.waitFor(ctx, timeout, fmt.Sprintf("%s %s to be ready", gvk.Kind, name), func(ctx context.Context) bool {
+		return e.isResourceReady(ctx, c, gvk, name)
+	})
+}
+
+func newCrossplaneResource(gvk schema.GroupVersionKind, name string, spec map[string]interface{}) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(gvk)
+	obj.SetName(name)
+	obj.Object["spec"] = spec
+	return obj
+}
+
+func (e *Infra) getAtProviderID(ctx context.Context, c client.Client, gvk schema.GroupVersionKind, name string) string {
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(gvk)
+	if err := c.Get(ctx, types.NamespacedName{Name: name}, obj); err != nil {
+		e.log.Info("resource not found", "kind", gvk.Kind, "name", name, "error", err.Error())
+		return ""
+	}
+	id, _, _ := unstructured.NestedString(obj.Object, "status", "atProvider", "id")
+	return id
+}
+
+// logResourceStatus logs all conditions for a Crossplane resource.
+func (e *Infra) logResourceStatus(ctx context.Context, c client.Client, gvk schema.GroupVersionKind, name string) {
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(gvk)
+	if err := c.Get(ctx, types.NamespacedName{Name: name}, obj); err != nil {
+		e.log.Info("cannot fetch resource status", "kind", gvk.Kind, "name", name, "error", err.Error())
+		return
+	}
+	conditions := conditionSummary(obj)
+	if conditions == "" {
+		e.log.Info("resource has no conditions yet", "kind", gvk.Kind, "name", name)
+		return
+	}
+	e.log.Info("resource status", "kind", gvk.Kind, "name", name, "conditions", conditions)
+}
+
+func (e *Infra) isResourceReady(ctx context.Context, c client.Client, gvk schema.GroupVersionKind, name string) bool {
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(gvk)
+	if err := c.Get(ctx, types.NamespacedName{Name: name}, obj); err != nil {
+		e.log.Info("resource not found", "kind", gvk.Kind, "name", name, "error", err.Error())
+		return false
+	}
+	if isReady(obj) {
+		e.log.Info("resource is ready", "kind", gvk.Kind, "name", name)
+		return true
+	}
+	e.log.Info("resource not ready", "kind", gvk.Kind, "name", name, "conditions", conditionSummary(obj))
+	return false
+}
+
+// isReady reports whether a managed resource has condition Ready=True.
+func isReady(obj *unstructured.Unstructured) bool {
+	conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	for _, c := range conditions {
+		cond, ok := c.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		t, _, _ := unstructured.NestedString(cond, "type")
+		s, _, _ := unstructured.NestedString(cond, "status")
+		if t == "Ready" && s == "True" {
+			return true
+		}
+	}
+	return false
+}
+
+// conditionSummary formats a managed resource's conditions on one line.
+func conditionSummary(obj *unstructured.Unstructured) string {
+	conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	var parts []string
+	for _, c := range conditions {
+		cond, ok := c.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		t, _, _ := unstructured.NestedString(cond, "type")
+		s, _, _ := unstructured.NestedString(cond, "status")
+		reason, _, _ := unstructured.NestedString(cond, "reason")
+		msg, _, _ := unstructured.NestedString(cond, "message")
+		parts = append(parts, fmt.Sprintf("%s=%s (%s: %s)", t, s, reason, msg))
+	}
+	return strings.Join(parts, " | ")
+}
@@ -0,0 +1,187 @@
+package efsinfra
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// managed returns a Crossplane managed resource labelled for cluster, with
+// an AWS ID and Ready condition when id is set.
+func managed(gvk schema.GroupVersionKind, name, cluster, id string) *unstructured.Unstructured {
+	obj := newCrossplaneResource(gvk, name, map[string]interface{}{})
+	if cluster != "" {
+		obj.SetLabels(map[string]string{ClusterLabel: cluster})
+	}
+	if id != "" {
+		obj.Object["status"] = map[string]interface{}{
+			"atProvider": map[string]interface{}{"id": id},
+			"conditions": []interface{}{
+				map[string]interface{}{"type": "Synced", "status": "True"},
+				map[string]interface{}{"type": "Ready", "status": "True", "reason": "Available"},
+			},
+		}
+	}
+	return obj
+}
+
+func newFakeClient(objs ...client.Object) client.Client {
+	mapper := meta.NewDefaultRESTMapper(nil)
+	for _, gvk := range creationOrder {
+		mapper.Add(gvk, meta.RESTScopeRoot)
+	}
+	mapper.Add(providerConfigGVK, meta.RESTScopeRoot)
+	mapper.Add(awsClusterGVK, meta.RESTScopeNamespace)
+	mapper.Add(corev1.SchemeGroupVersion.WithKind("ConfigMap"), meta.RESTScopeNamespace)
+	mapper.Add(corev1.SchemeGroupVersion.WithKind("Secret"), meta.RESTScopeNamespace)
+	scheme := runtime.NewScheme()
+	_ = corev1.AddToScheme(scheme)
+	return fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithRESTMapper(mapper).
+		WithObjects(objs...).
+		Build()
+}
+
+func fixtureObjects() []client.Object {
+	return []client.Object{
+		managed(ec2SecurityGroupGVK, "wc1-efs-e2e-sg", "wc1", "sg-1"),
+		managed(efsFileSystemGVK, "wc1-efs-e2e-fs", "wc1", "fs-1"),
+		managed(ec2SecurityGroupRuleGVK, "wc1-efs-e2e-sgr-nfs", "wc1", "sgrule-1"),
+		managed(efsMountTargetGVK, "wc1-efs-e2e-mt-eu-west-1b", "wc1", "fsmt-b"),
+		managed(efsMountTargetGVK, "wc1-efs-e2e-mt-eu-west-1a", "wc1", ""),
+		managed(efsFileSystemGVK, "wc2-efs-e2e-fs", "wc2", "fs-2"),
+		managed(efsFileSystemGVK, "unrelated-fs", "", "fs-3"),
+	}
+}
+
+func TestAdoptAndStatus(t *testing.T) {
+	ctx := context.Background()
+	c := newFakeClient(fixtureObjects()...)
+
+	e := New("wc1", "org-test")
+	if err := e.Adopt(ctx, c); err != nil {
+		t.Fatal(err)
+	}
+	// Adopting twice must not track anything twice.
+	if err := e.Adopt(ctx, c); err != nil {
+		t.Fatal(err)
+	}
+	if e.FileSystemID() != "fs-1" || e.securityGroupID != "sg-1" {
+		t.Errorf("adopted IDs fs=%q sg=%q, want fs-1 and sg-1", e.FileSystemID(), e.securityGroupID)
+	}
+
+	got, err := e.Status(ctx, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Resource{
+		{Kind: "SecurityGroup", Name: "wc1-efs-e2e-sg", ID: "sg-1", Ready: true},
+		{Kind: "FileSystem", Name: "wc1-efs-e2e-fs", ID: "fs-1", Ready: true},
+		{Kind: "SecurityGroupRule", Name: "wc1-efs-e2e-sgr-nfs", ID: "sgrule-1", Ready: true},
+		{Kind: "MountTarget", Name: "wc1-efs-e2e-mt-eu-west-1a"},
+		{Kind: "MountTarget", Name: "wc1-efs-e2e-mt-eu-west-1b", ID: "fsmt-b", Ready: true},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Status() returned %d resources, want %d: %+v", len(got), len(want), got)
+	}
+	for i := range want {
+		g := got[i]
+		g.Conditions = ""
+		if g != want[i] {
+			t.Errorf("resource %d = %+v, want %+v", i, g, want[i])
+		}
+	}
+	if got[0].Conditions != "Synced=True (: ) | Ready=True (Available: )" {
+		t.Errorf("conditions = %q", got[0].Conditions)
+	}
+}
+
+func TestCleanupDeletesAdoptedResources(t *testing.T) {
+	ctx := context.Background()
+	c := newFakeClient(fixtureObjects()...)
+
+	e := New("wc1", "")
+	if err := e.Adopt(ctx, c); err != nil {
+		t.Fatal(err)
+	}
+	// A resource deleted by hand in the meantime is not an error.
+	if err := c.Delete(ctx, managed(efsMountTargetGVK, "wc1-efs-e2e-mt-eu-west-1a", "", "")); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Cleanup(ctx, c); err != nil {
+		t.Fatal(err)
+	}
+
+	left, err := e.Status(ctx, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range left {
+		if r.Conditions != "not found" {
+			t.Errorf("%s %s still exists", r.Kind, r.Name)
+		}
+	}
+	fixtures, err := List(ctx, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fixtures) != 1 || fixtures[0].Cluster != "wc2" {
+		t.Errorf("List() after cleanup = %+v, want only wc2", fixtures)
+	}
+}
+
+func TestList(t *testing.T) {
+	fixtures, err := List(context.Background(), newFakeClient(fixtureObjects()...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	byCluster := map[string]Fixture{}
+	for _, f := range fixtures {
+		byCluster[f.Cluster] = f
+	}
+	if len(fixtures) != 2 || byCluster["wc1"].FileSystemID != "fs-1" || byCluster["wc2"].FileSystemID != "fs-2" || !byCluster["wc1"].Ready {
+		t.Errorf("List() = %+v, want the labelled file systems of wc1 and wc2", fixtures)
+	}
+}
+
+func TestListWithoutCRDs(t *testing.T) {
+	c := fake.NewClientBuilder().WithScheme(runtime.NewScheme()).WithRESTMapper(meta.NewDefaultRESTMapper(nil)).Build()
+	fixtures, err := List(context.Background(), c)
+	if err != nil || len(fixtures) != 0 {
+		t.Errorf("List() without the Crossplane CRDs = %v, %v; want nothing", fixtures, err)
+	}
+}
+
+func TestSetThroughputMode(t *testing.T) {
+	ctx := context.Background()
+	fs := managed(efsFileSystemGVK, "wc1-efs-e2e-fs", "wc1", "fs-1")
+	fs.Object["spec"] = map[string]interface{}{"forProvider": map[string]interface{}{"throughputMode": "bursting"}}
+	// Crossplane has already reconciled the change.
+	_ = unstructured.SetNestedField(fs.Object, "elastic", "status", "atProvider", "throughputMode")
+	c := newFakeClient(fs)
+
+	e := New("wc1", "org-test")
+	e.fileSystemID = "fs-1"
+	if err := e.SetThroughputMode(ctx, c, "elastic"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Get(ctx, client.ObjectKeyFromObject(fs), fs); err != nil {
+		t.Fatal(err)
+	}
+	if got, _, _ := unstructured.NestedString(fs.Object, "spec", "forProvider", "throughputMode"); got != "elastic" {
+		t.Errorf("spec.forProvider.throughputMode = %q, want elastic", got)
+	}
+
+	e.reused = true
+	if err := e.SetThroughputMode(ctx, c, "bursting"); err == nil {
+		t.Error("SetThroughputMode on a reused file system succeeded")
+	}
+}
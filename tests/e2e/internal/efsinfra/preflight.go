@@ -0,0 +1,283 @@
+package efsinfra
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// controlPlaneLabel marks nodes test pods are not scheduled to.
+const controlPlaneLabel = "node-role.kubernetes.io/control-plane"
+
+// crdFixes says what provides the CRDs of each API group.
+var crdFixes = map[string]string{
+	"infrastructure.cluster.x-k8s.io": "run against the MC of a CAPA cluster",
+	"aws.upbound.io":                  "install the Upbound provider-family-aws on the MC",
+	"efs.aws.upbound.io":              "install the Upbound provider-aws-efs on the MC",
+	"ec2.aws.upbound.io":              "install the Upbound provider-aws-ec2 on the MC",
+}
+
+// Check is the outcome of one pre-flight check.
+type Check struct {
+	Name   string
+	Passed bool
+	Detail string
+	// Fix says what to change when the check failed.
+	Fix string
+}
+
+func (c Check) String() string {
+	status := "PASS"
+	if !c.Passed {
+		status = "FAIL"
+	}
+	s := fmt.Sprintf("%s %s: %s", status, c.Name, c.Detail)
+	if !c.Passed && c.Fix != "" {
+		s += "\n     fix: " + c.Fix
+	}
+	return s
+}
+
+// PreflightReport lists the pre-flight checks in the order they ran.
+type PreflightReport struct {
+	Checks []Check
+}
+
+func (r *PreflightReport) pass(name, detail string) {
+	r.Checks = append(r.Checks, Check{Name: name, Passed: true, Detail: detail})
+}
+
+func (r *PreflightReport) fail(name, detail, fix string) {
+	r.Checks = append(r.Checks, Check{Name: name, Detail: detail, Fix: fix})
+}
+
+// Failed returns the checks that did not pass.
+func (r PreflightReport) Failed() []Check {
+	var out []Check
+	for _, c := range r.Checks {
+		if !c.Passed {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// String renders one line per check, with the fix under failed ones.
+func (r PreflightReport) String() string {
+	lines := make([]string, 0, len(r.Checks))
+	for _, c := range r.Checks {
+		lines = append(lines, c.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Err returns the failed checks and their fixes, or nil if all passed.
+func (r PreflightReport) Err() error {
+	failed := r.Failed()
+	if len(failed) == 0 {
+		return nil
+	}
+	errs := make([]error, 0, len(failed))
+	for _, c := range failed {
+		errs = append(errs, errors.New(c.String()))
+	}
+	return fmt.Errorf("%d of %d pre-flight checks failed:\n%w", len(failed), len(r.Checks), errors.Join(errs...))
+}
+
+// Preflight checks that the MC and WC can run Create before anything is
+// made in AWS: that the CRDs of every kind Create uses are installed, that
+// the AWSCluster is ready and its network can be discovered, that the
+// ProviderConfig exists, is healthy and has usable credentials, and that
+// every worker node of the WC maps to a private subnet a mount target is
+// created in. It runs DiscoverNetwork and DiscoverProviderConfig, so call
+// it instead of them. Without a WC client, wc nil, the nodes are not checked.
+// With an existing file system, nothing is created through Crossplane, so
+// only the AWSCluster and the nodes are checked.
+func (e *Infra) Preflight(ctx context.Context, mc, wc client.Client) PreflightReport {
+	start := time.Now()
+	var r PreflightReport
+
+	gvks := []schema.GroupVersionKind{awsClusterGVK}
+	if !e.existing.enabled() {
+		gvks = append(gvks, providerConfigGVK)
+		gvks = append(gvks, creationOrder...)
+	}
+	for _, gvk := range gvks {
+		checkCRD(mc, gvk, &r)
+	}
+
+	e.checkAWSCluster(ctx, mc, &r)
+	if err := e.DiscoverNetwork(ctx, mc); err != nil {
+		r.fail("AWSCluster network", err.Error(),
+			fmt.Sprintf("check status.networkStatus of AWSCluster %s/%s", e.orgNamespace, e.clusterName))
+	} else {
+		r.pass("AWSCluster network", fmt.Sprintf("region %s, VPC %s, private subnets %s", e.region, e.vpcID, e.subnetSummary()))
+	}
+
+	if !e.existing.enabled() {
+		e.checkProviderConfig(ctx, mc, &r)
+	}
+	if wc != nil && len(e.privateSubnets) > 0 {
+		e.checkNodes(ctx, wc, &r)
+	}
+
+	failed := len(r.Failed())
+	e.recordPhase("pre-flight", time.Since(start), fmt.Sprintf("%d/%d passed", len(r.Checks)-failed, len(r.Checks)))
+	e.log.Info("pre-flight checks done", "checks", len(r.Checks), "failed", failed)
+	return r
+}
+
+func checkCRD(c client.Client, gvk schema.GroupVersionKind, r *PreflightReport) {
+	name := "CRD " + gvk.Kind + "." + gvk.Group + "/" + gvk.Version
+	_, err := c.RESTMapper().RESTMapping(gvk.GroupKind(), gvk.Version)
+	switch {
+	case meta.IsNoMatchError(err):
+		r.fail(name, "not installed", crdFixes[gvk.Group])
+	case err != nil:
+		r.fail(name, err.Error(), "check that the MC API server is reachable and serves discovery")
+	default:
+		r.pass(name, "installed")
+	}
+}
+
+func (e *Infra) checkAWSCluster(ctx context.Context, c client.Client, r *PreflightReport) {
+	name := "AWSCluster " + e.orgNamespace + "/" + e.clusterName
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(awsClusterGVK)
+	err := c.Get(ctx, types.NamespacedName{Name: e.clusterName, Namespace: e.orgNamespace}, obj)
+	switch {
+	case apierrors.IsNotFound(err):
+		r.fail(name, "not found", "check the cluster name and organization namespace")
+		return
+	case err != nil:
+		r.fail(name, err.Error(), "check that the MC credentials may read AWSClusters")
+		return
+	}
+	ready, _, _ := unstructured.NestedBool(obj.Object, "status", "ready")
+	if !ready && !isReady(obj) {
+		detail := "not ready"
+		if conditions := conditionSummary(obj); conditions != "" {
+			detail += ": " + conditions
+		}
+		r.fail(name, detail, fmt.Sprintf("wait for the cluster to be provisioned, or see kubectl describe awscluster -n %s %s", e.orgNamespace, e.clusterName))
+		return
+	}
+	r.pass(name, "ready")
+}
+
+func (e *Infra) checkProviderConfig(ctx context.Context, c client.Client, r *PreflightReport) {
+	const name = "ProviderConfig"
+	if err := e.DiscoverProviderConfig(ctx, c); err != nil {
+		var pe *providerConfigError
+		fix := ""
+		if errors.As(err, &pe) {
+			fix = pe.fix
+		}
+		r.fail(name, err.Error(), fix)
+		return
+	}
+	detail := fmt.Sprintf("%s is healthy, named by %s", e.providerConfig, e.providerConfigFrom)
+	if e.account.ID != "" {
+		detail += ", account " + e.account.ID
+	}
+	r.pass(name, detail)
+}
+
+// checkNodes maps every worker node of the WC to the private subnet its
+// InternalIP is in, or else to the private subnet of its zone, which the
+// mount target it uses is created in.
+func (e *Infra) checkNodes(ctx context.Context, c client.Client, r *PreflightReport) {
+	const name = "WC nodes"
+	var nodes corev1.NodeList
+	if err := c.List(ctx, &nodes); err != nil {
+		r.fail(name, err.Error(), "check that the WC credentials may list nodes")
+		return
+	}
+
+	perSubnet := map[string]int{}
+	var workers int
+	var unmapped []string
+	for _, node := range nodes.Items {
+		if _, ok := node.Labels[controlPlaneLabel]; ok {
+			continue
+		}
+		workers++
+		s, ok := subnetOf(node, e.privateSubnets, e.privateCIDRs)
+		if !ok {
+			unmapped = append(unmapped, fmt.Sprintf("%s (zone %q, %s)", node.Name, node.Labels[corev1.LabelTopologyZone], internalIP(node)))
+			continue
+		}
+		perSubnet[s.id+" ("+s.az+")"]++
+	}
+
+	if workers == 0 {
+		r.fail(name, "no worker nodes", "wait for the node pools of the cluster to come up")
+		return
+	}
+	if len(unmapped) > 0 {
+		r.fail(name, fmt.Sprintf("%d of %d worker nodes are outside the private subnets: %s", len(unmapped), workers, strings.Join(unmapped, ", ")),
+			fmt.Sprintf("add private subnets for these zones to the AWSCluster; mount targets are only created in %s", e.subnetSummary()))
+		return
+	}
+	counts := make([]string, 0, len(perSubnet))
+	for subnet, n := range perSubnet {
+		counts = append(counts, fmt.Sprintf("%s: %d", subnet, n))
+	}
+	sort.Strings(counts)
+	r.pass(name, fmt.Sprintf("%d worker nodes in private subnets, %s", workers, strings.Join(counts, ", ")))
+}
+
+// subnetOf returns the mount target subnet for the node, the one in the AZ
+// of the private subnet that contains the node's InternalIP. Only when no
+// private subnet CIDR is known does it go by the node's zone, which would
+// otherwise let a node in a public subnet of that zone pass.
+func subnetOf(node corev1.Node, subnets, private []subnetInfo) (subnetInfo, bool) {
+	zone := node.Labels[corev1.LabelTopologyZone]
+	if len(private) > 0 {
+		zone = ""
+		if ip := net.ParseIP(internalIP(node)); ip != nil {
+			for _, s := range private {
+				if _, cidr, err := net.ParseCIDR(s.cidr); err == nil && cidr.Contains(ip) {
+					zone = s.az
+					break
+				}
+			}
+		}
+	}
+	for _, s := range subnets {
+		if zone != "" && s.az == zone {
+			return s, true
+		}
+	}
+	return subnetInfo{}, false
+}
+
+func internalIP(node corev1.Node) string {
+	for _, a := range node.Status.Addresses {
+		if a.Type == corev1.NodeInternalIP {
+			return a.Address
+		}
+	}
+	return "no InternalIP"
+}
+
+// subnetSummary lists the private subnets as id (az).
+func (e *Infra) subnetSummary() string {
+	parts := make([]string, 0, len(e.privateSubnets))
+	for _, s := range e.privateSubnets {
+		parts = append(parts, s.id+" ("+s.az+")")
+	}
+	return strings.Join(parts, ", ")
+}
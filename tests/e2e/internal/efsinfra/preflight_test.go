@@ -0,0 +1,177 @@
+package efsinfra
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func awsCluster(ready bool) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{
+		"spec": map[string]interface{}{"region": "eu-west-1"},
+		"status": map[string]interface{}{
+			"ready": ready,
+			"networkStatus": map[string]interface{}{
+				"vpc": map[string]interface{}{"id": "vpc-1", "cidrBlock": "10.0.0.0/16"},
+				"subnets": []interface{}{
+					map[string]interface{}{"resourceID": "subnet-a", "availabilityZone": "eu-west-1a", "cidrBlock": "10.0.0.0/20"},
+					map[string]interface{}{"resourceID": "subnet-b", "availabilityZone": "eu-west-1b", "cidrBlock": "10.0.16.0/20"},
+					map[string]interface{}{"resourceID": "subnet-a2", "availabilityZone": "eu-west-1a", "cidrBlock": "10.0.64.0/20"},
+					map[string]interface{}{"resourceID": "subnet-pub", "availabilityZone": "eu-west-1c", "cidrBlock": "10.0.32.0/20", "isPublic": true},
+				},
+			},
+		},
+	}}
+	obj.SetGroupVersionKind(awsClusterGVK)
+	obj.SetName("wc1")
+	obj.SetNamespace("org-test")
+	return obj
+}
+
+func providerConfig(name string, conditions ...interface{}) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{
+		"spec": map[string]interface{}{
+			"credentials": map[string]interface{}{"source": "IRSA"},
+		},
+	}}
+	obj.SetGroupVersionKind(providerConfigGVK)
+	obj.SetName(name)
+	if len(conditions) == 0 {
+		conditions = []interface{}{map[string]interface{}{"type": "Healthy", "status": "True"}}
+	}
+	obj.Object["status"] = map[string]interface{}{"conditions": conditions}
+	return obj
+}
+
+func node(name, zone, ip string, labels ...string) *corev1.Node {
+	n := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{corev1.LabelTopologyZone: zone}}}
+	for _, l := range labels {
+		n.Labels[l] = ""
+	}
+	n.Status.Addresses = []corev1.NodeAddress{{Type: corev1.NodeInternalIP, Address: ip}}
+	return n
+}
+
+func wcClient(nodes ...client.Object) client.Client {
+	return fake.NewClientBuilder().WithObjects(nodes...).Build()
+}
+
+func TestPreflight(t *testing.T) {
+	ctx := context.Background()
+	mc := newFakeClient(awsCluster(true), providerConfig("wc1"))
+	wc := wcClient(
+		node("cp-1", "eu-west-1c", "10.0.32.5", controlPlaneLabel),
+		node("worker-1", "eu-west-1a", "10.0.1.5"),
+		node("worker-2", "eu-west-1b", "10.0.17.5"),
+		// In a second private subnet of its zone, which gets no mount target.
+		node("worker-3", "eu-west-1a", "10.0.64.5"),
+	)
+
+	var phases []string
+	e := New("wc1", "org-test").WithPhaseRecorder(func(name string, _ time.Duration, id string) {
+		phases = append(phases, name+"="+id)
+	})
+	r := e.Preflight(ctx, mc, wc)
+	if err := r.Err(); err != nil {
+		t.Fatalf("Preflight() failed:\n%s", r)
+	}
+	if len(r.Checks) != 11 {
+		t.Errorf("Preflight() ran %d checks, want 11:\n%s", len(r.Checks), r)
+	}
+	last := r.Checks[len(r.Checks)-1]
+	if want := "3 worker nodes in private subnets, subnet-a (eu-west-1a): 2, subnet-b (eu-west-1b): 1"; last.Detail != want {
+		t.Errorf("node check = %q, want %q", last.Detail, want)
+	}
+	if e.Region() != "eu-west-1" || len(e.privateSubnets) != 2 {
+		t.Errorf("network not discovered: region=%q subnets=%v", e.Region(), e.privateSubnets)
+	}
+	if len(phases) != 1 || phases[0] != "pre-flight=11/11 passed" {
+		t.Errorf("phases = %v", phases)
+	}
+}
+
+func TestPreflightReportsFailures(t *testing.T) {
+	ctx := context.Background()
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(awsClusterGVK, meta.RESTScopeNamespace)
+	mapper.Add(providerConfigGVK, meta.RESTScopeRoot)
+	mapper.Add(corev1.SchemeGroupVersion.WithKind("ConfigMap"), meta.RESTScopeNamespace)
+	scheme := runtime.NewScheme()
+	_ = corev1.AddToScheme(scheme)
+	var mc client.Client = fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithRESTMapper(mapper).
+		WithObjects(awsCluster(false), providerConfig("other")).
+		Build()
+	wc := wcClient(node("worker-1", "eu-west-1c", "10.0.33.5"))
+
+	r := New("wc1", "org-test").Preflight(ctx, mc, wc)
+	err := r.Err()
+	if err == nil {
+		t.Fatalf("Preflight() passed:\n%s", r)
+	}
+	for _, want := range []string{
+		"FAIL CRD FileSystem.efs.aws.upbound.io/v1beta1: not installed\n     fix: install the Upbound provider-aws-efs on the MC",
+		"FAIL CRD SecurityGroup.ec2.aws.upbound.io/v1beta1: not installed",
+		"FAIL AWSCluster org-test/wc1: not ready",
+		"FAIL ProviderConfig: ProviderConfig wc1, named by the cluster name, not found",
+		"FAIL WC nodes: 1 of 1 worker nodes are outside the private subnets: worker-1 (zone \"eu-west-1c\", 10.0.33.5)",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Err() does not contain %q:\n%s", want, err)
+		}
+	}
+	if strings.Contains(err.Error(), "CRD AWSCluster") || !strings.HasPrefix(err.Error(), "8 of 11 pre-flight checks failed") {
+		t.Errorf("Err() = %s", err)
+	}
+
+	mc = newFakeClient(awsCluster(true), providerConfig("wc1",
+		map[string]interface{}{"type": "Healthy", "status": "False", "reason": "InvalidCredentials", "message": "no such role"}))
+	r = New("wc1", "org-test").Preflight(ctx, mc, nil)
+	if err := r.Err(); err == nil || !strings.Contains(err.Error(), "FAIL ProviderConfig: ProviderConfig wc1 is unhealthy: Healthy=False (InvalidCredentials: no such role)") {
+		t.Errorf("Err() = %v, want the unhealthy ProviderConfig", err)
+	}
+
+	pc := providerConfig("wc1")
+	delete(pc.Object, "status")
+	r = New("wc1", "org-test").Preflight(ctx, newFakeClient(awsCluster(true), pc), nil)
+	if err := r.Err(); err == nil || !strings.Contains(err.Error(), "FAIL ProviderConfig: ProviderConfig wc1 is of unknown health: it has no conditions\n     fix: check that provider-aws is running and reports Healthy=True on it") {
+		t.Errorf("Err() = %v, want the ProviderConfig of unknown health", err)
+	}
+	r = New("wc1", "org-test").Preflight(ctx, newFakeClient(awsCluster(true), providerConfig("wc1",
+		map[string]interface{}{"type": "Healthy", "status": "Unknown", "reason": "Pending"})), nil)
+	if err := r.Err(); err == nil || !strings.Contains(err.Error(), "ProviderConfig wc1 is of unknown health: no Healthy=True condition, Healthy=Unknown (Pending: )") {
+		t.Errorf("Err() = %v, want the ProviderConfig of unknown health", err)
+	}
+}
+
+func TestSubnetOf(t *testing.T) {
+	subnets := []subnetInfo{{id: "subnet-a", az: "eu-west-1a", cidr: "10.0.0.0/20"}, {id: "subnet-b", az: "eu-west-1b", cidr: "10.0.16.0/20"}}
+	private := append(subnets, subnetInfo{id: "subnet-a2", az: "eu-west-1a", cidr: "10.0.64.0/20"})
+	tests := []struct {
+		name    string
+		node    *corev1.Node
+		private []subnetInfo
+		want    string
+	}{
+		{"in a mount target subnet", node("n", "eu-west-1b", "10.0.17.5"), private, "subnet-b"},
+		{"in another private subnet of the zone", node("n", "eu-west-1a", "10.0.64.5"), private, "subnet-a"},
+		{"in a public subnet of a zone with a mount target", node("n", "eu-west-1a", "10.0.32.5"), private, ""},
+		{"by zone without subnet CIDRs", node("n", "eu-west-1a", "10.0.32.5"), nil, "subnet-a"},
+	}
+	for _, tt := range tests {
+		s, ok := subnetOf(*tt.node, subnets, tt.private)
+		if ok != (tt.want != "") || s.id != tt.want {
+			t.Errorf("%s: subnetOf() = %q, %v, want %q", tt.name, s.id, ok, tt.want)
+		}
+	}
+}
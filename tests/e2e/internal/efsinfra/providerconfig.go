@@ -0,0 +1,214 @@
+package efsinfra
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+)
+
+// Account is the cluster's AWS account as the values key of the
+// crossplane-config ConfigMap describes it. The bundle chart builds the
+// driver's IAM role and its trust policy from the same values.
+type Account struct {
+	ID          string   `json:"accountID"`
+	Partition   string   `json:"awsPartition"`
+	OIDCDomains []string `json:"oidcDomains"`
+}
+
+// providerConfigError is a ProviderConfig problem and what to do about it.
+type providerConfigError struct {
+	err error
+	fix string
+}
+
+func (p *providerConfigError) Error() string { return p.err.Error() }
+
+func (p *providerConfigError) Unwrap() error { return p.err }
+
+func providerConfigErrorf(fix, format string, args ...interface{}) error {
+	return &providerConfigError{err: fmt.Errorf(format, args...), fix: fix}
+}
+
+// WithProviderConfig makes Create use the named Crossplane ProviderConfig
+// instead of looking it up in the crossplane-config ConfigMap.
+func (e *Infra) WithProviderConfig(name string) *Infra {
+	if name != "" {
+		e.providerConfig, e.providerConfigFrom = name, "WithProviderConfig"
+	}
+	return e
+}
+
+// Account returns the AWS account found by DiscoverProviderConfig.
+func (e *Infra) Account() Account {
+	return e.account
+}
+
+// DiscoverProviderConfig finds the Crossplane ProviderConfig Create uses and
+// checks that it can act in the cluster's account. The name comes from
+// WithProviderConfig, else from the providerConfigName key of the
+// <cluster>-crossplane-config ConfigMap, else from a loaded state, else it
+// is the cluster name like in the bundle chart. The values key of the
+// ConfigMap gives the Account. A missing ConfigMap leaves the defaults,
+// while any other error reading it, e.g. an RBAC denial, is returned. The
+// ProviderConfig must exist, have no False condition, and its credentials
+// must be usable: a Secret source needs the Secret, and the role it
+// finally assumes must be in the account and partition of the values.
+func (e *Infra) DiscoverProviderConfig(ctx context.Context, c client.Client) error {
+	key := types.NamespacedName{
+		Name:      e.clusterName + "-crossplane-config",
+		Namespace: e.orgNamespace,
+	}
+	var cm corev1.ConfigMap
+	err := c.Get(ctx, key, &cm)
+	switch {
+	case apierrors.IsNotFound(err):
+		e.log.Info("no crossplane-config ConfigMap, using defaults", "configMap", key.String())
+	case err != nil:
+		return providerConfigErrorf("check that the MC credentials may read ConfigMaps in "+e.orgNamespace,
+			"reading ConfigMap %s: %w", key, err)
+	default:
+		if name := cm.Data["providerConfigName"]; name != "" && e.providerConfigFrom != "WithProviderConfig" {
+			e.providerConfig, e.providerConfigFrom = name, "ConfigMap "+key.String()
+		}
+		if values := cm.Data["values"]; values != "" {
+			var account Account
+			if err := yaml.Unmarshal([]byte(values), &account); err != nil {
+				return providerConfigErrorf("fix the values key of ConfigMap "+key.String(),
+					"parsing values of ConfigMap %s: %w", key, err)
+			}
+			e.account = account
+		}
+	}
+	e.log.Info("using providerConfig",
+		"name", e.providerConfig,
+		"from", e.providerConfigFrom,
+		"accountID", e.account.ID,
+		"awsPartition", e.account.Partition,
+		"oidcDomains", e.account.OIDCDomains,
+	)
+
+	pc := &unstructured.Unstructured{}
+	pc.SetGroupVersionKind(providerConfigGVK)
+	err = c.Get(ctx, types.NamespacedName{Name: e.providerConfig}, pc)
+	switch {
+	case apierrors.IsNotFound(err):
+		return providerConfigErrorf(
+			fmt.Sprintf("create it for the cluster's AWS account, or set providerConfigName in ConfigMap %s", key),
+			"ProviderConfig %s, named by %s, not found", e.providerConfig, e.providerConfigFrom)
+	case err != nil:
+		return providerConfigErrorf("check that the MC credentials may read ProviderConfigs",
+			"getting ProviderConfig %s: %w", e.providerConfig, err)
+	}
+	fix := fmt.Sprintf("check its credentials, see kubectl describe providerconfigs.aws.upbound.io %s", e.providerConfig)
+	if err := providerConfigHealth(pc); err != nil {
+		if errors.Is(err, errHealthUnknown) {
+			fix = fmt.Sprintf("check that provider-aws is running and reports Healthy=True on it, see kubectl describe providerconfigs.aws.upbound.io %s", e.providerConfig)
+		}
+		return providerConfigErrorf(fix, "ProviderConfig %s is %w", e.providerConfig, err)
+	}
+	if err := e.checkCredentials(ctx, c, pc); err != nil {
+		return providerConfigErrorf(fix, "ProviderConfig %s: %w", e.providerConfig, err)
+	}
+	return nil
+}
+
+// errHealthUnknown is returned by providerConfigHealth for a ProviderConfig
+// that does not report Healthy=True but no failing condition either.
+var errHealthUnknown = errors.New("of unknown health")
+
+// providerConfigHealth returns why a ProviderConfig cannot be taken as
+// healthy: one of its conditions, e.g. Healthy, is False, or it has no
+// Healthy=True condition.
+func providerConfigHealth(obj *unstructured.Unstructured) error {
+	conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	var healthy bool
+	for _, c := range conditions {
+		cond, ok := c.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		t, _, _ := unstructured.NestedString(cond, "type")
+		s, _, _ := unstructured.NestedString(cond, "status")
+		if s == "False" {
+			return fmt.Errorf("unhealthy: %s", conditionSummary(obj))
+		}
+		healthy = healthy || t == "Healthy" && s == "True"
+	}
+	if healthy {
+		return nil
+	}
+	if len(conditions) == 0 {
+		return fmt.Errorf("%w: it has no conditions", errHealthUnknown)
+	}
+	return fmt.Errorf("%w: no Healthy=True condition, %s", errHealthUnknown, conditionSummary(obj))
+}
+
+// checkCredentials checks the credentials source of a ProviderConfig and
+// that the roles it assumes fit the account.
+func (e *Infra) checkCredentials(ctx context.Context, c client.Client, pc *unstructured.Unstructured) error {
+	source, _, _ := unstructured.NestedString(pc.Object, "spec", "credentials", "source")
+	var roles []string
+	switch source {
+	case "Secret":
+		ref, _, _ := unstructured.NestedStringMap(pc.Object, "spec", "credentials", "secretRef")
+		var secret corev1.Secret
+		if err := c.Get(ctx, types.NamespacedName{Name: ref["name"], Namespace: ref["namespace"]}, &secret); err != nil {
+			return fmt.Errorf("credentials secret %s/%s: %w", ref["namespace"], ref["name"], err)
+		}
+		if len(secret.Data[ref["key"]]) == 0 {
+			return fmt.Errorf("credentials secret %s/%s has no key %q", ref["namespace"], ref["name"], ref["key"])
+		}
+	case "WebIdentity":
+		role, _, _ := unstructured.NestedString(pc.Object, "spec", "credentials", "webIdentity", "roleARN")
+		if role == "" {
+			return errors.New("WebIdentity credentials without spec.credentials.webIdentity.roleARN")
+		}
+		roles = append(roles, role)
+	case "IRSA", "PodIdentity", "Upbound":
+	case "":
+		return errors.New("no spec.credentials.source")
+	default:
+		return fmt.Errorf("unknown credentials source %q", source)
+	}
+
+	chain, _, _ := unstructured.NestedSlice(pc.Object, "spec", "assumeRoleChain")
+	for _, link := range chain {
+		if l, ok := link.(map[string]interface{}); ok {
+			role, _, _ := unstructured.NestedString(l, "roleARN")
+			roles = append(roles, role)
+		}
+	}
+	for i, role := range roles {
+		partition, account, ok := parseRoleARN(role)
+		if !ok {
+			return fmt.Errorf("role %q is not an IAM role ARN", role)
+		}
+		if e.account.Partition != "" && partition != e.account.Partition {
+			return fmt.Errorf("role %s is in partition %s, not %s", role, partition, e.account.Partition)
+		}
+		// Only the last role acts on the cluster's resources; the roles
+		// before it may be in the MC's account.
+		if i == len(roles)-1 && e.account.ID != "" && account != e.account.ID {
+			return fmt.Errorf("role %s is in account %s, not the cluster's account %s", role, account, e.account.ID)
+		}
+	}
+	return nil
+}
+
+// parseRoleARN returns the partition and account of an IAM role ARN such
+// as arn:aws:iam::123456789012:role/name.
+func parseRoleARN(arn string) (partition, account string, ok bool) {
+	parts := strings.SplitN(arn, ":", 6)
+	if len(parts) != 6 || parts[0] != "arn" || parts[2] != "iam" || !strings.HasPrefix(parts[5], "role/") {
+		return "", "", false
+	}
+	return parts[1], parts[4], true
+}
@@ -0,0 +1,163 @@
+package efsinfra
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+const crossplaneValues = `accountID: "123456789012"
+awsPartition: aws
+oidcDomains:
+  - irsa.wc1.example.com
+  - wc1.irsa.example.com
+region: eu-west-1
+`
+
+func crossplaneConfig(data map[string]string) *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "wc1-crossplane-config", Namespace: "org-test"},
+		Data:       data,
+	}
+}
+
+// assumingRoles returns a ProviderConfig with WebIdentity credentials for
+// the first role that assumes the others in turn.
+func assumingRoles(name string, roles ...string) *unstructured.Unstructured {
+	pc := providerConfig(name)
+	pc.Object["spec"] = map[string]interface{}{
+		"credentials": map[string]interface{}{
+			"source":      "WebIdentity",
+			"webIdentity": map[string]interface{}{"roleARN": roles[0]},
+		},
+	}
+	var chain []interface{}
+	for _, r := range roles[1:] {
+		chain = append(chain, map[string]interface{}{"roleARN": r})
+	}
+	if chain != nil {
+		pc.Object["spec"].(map[string]interface{})["assumeRoleChain"] = chain
+	}
+	return pc
+}
+
+func TestDiscoverProviderConfig(t *testing.T) {
+	const (
+		mcRole = "arn:aws:iam::999999999999:role/mc-crossplane"
+		wcRole = "arn:aws:iam::123456789012:role/giantswarm-wc1-capa-controller"
+	)
+	values := map[string]string{"values": crossplaneValues}
+	secretPC := providerConfig("wc1")
+	secretPC.Object["spec"] = map[string]interface{}{
+		"credentials": map[string]interface{}{
+			"source":    "Secret",
+			"secretRef": map[string]interface{}{"namespace": "crossplane", "name": "aws-creds", "key": "credentials"},
+		},
+	}
+
+	tests := map[string]struct {
+		objs     []client.Object
+		explicit string
+		deny     bool
+		wantName string
+		wantFrom string
+		wantErr  string
+	}{
+		"name and account from the ConfigMap": {
+			objs:     []client.Object{crossplaneConfig(map[string]string{"providerConfigName": "wc1-pc", "values": crossplaneValues}), assumingRoles("wc1-pc", mcRole, wcRole)},
+			wantName: "wc1-pc",
+			wantFrom: "ConfigMap org-test/wc1-crossplane-config",
+		},
+		"no ConfigMap": {
+			objs:     []client.Object{providerConfig("wc1")},
+			wantName: "wc1",
+			wantFrom: "the cluster name",
+		},
+		"explicit name": {
+			objs:     []client.Object{crossplaneConfig(map[string]string{"providerConfigName": "wc1-pc"}), providerConfig("manual")},
+			explicit: "manual",
+			wantName: "manual",
+			wantFrom: "WithProviderConfig",
+		},
+		"RBAC denial": {
+			objs:     []client.Object{providerConfig("wc1")},
+			deny:     true,
+			wantName: "wc1",
+			wantErr:  `reading ConfigMap org-test/wc1-crossplane-config: configmaps "wc1-crossplane-config" is forbidden`,
+		},
+		"malformed values": {
+			objs:     []client.Object{crossplaneConfig(map[string]string{"values": "accountID: [\n"}), providerConfig("wc1")},
+			wantName: "wc1",
+			wantErr:  "parsing values of ConfigMap org-test/wc1-crossplane-config",
+		},
+		"missing ProviderConfig": {
+			objs:     []client.Object{crossplaneConfig(map[string]string{"providerConfigName": "wc1-pc"})},
+			wantName: "wc1-pc",
+			wantErr:  "ProviderConfig wc1-pc, named by ConfigMap org-test/wc1-crossplane-config, not found",
+		},
+		"role in another account": {
+			objs:     []client.Object{crossplaneConfig(values), assumingRoles("wc1", wcRole, mcRole)},
+			wantName: "wc1",
+			wantErr:  "role " + mcRole + " is in account 999999999999, not the cluster's account 123456789012",
+		},
+		"role in another partition": {
+			objs:     []client.Object{crossplaneConfig(values), assumingRoles("wc1", "arn:aws-cn:iam::123456789012:role/wc1")},
+			wantName: "wc1",
+			wantErr:  "is in partition aws-cn, not aws",
+		},
+		"secret without the key": {
+			objs: []client.Object{
+				secretPC,
+				&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "aws-creds", Namespace: "crossplane"}, Data: map[string][]byte{"other": []byte("x")}},
+			},
+			wantName: "wc1",
+			wantErr:  `credentials secret crossplane/aws-creds has no key "credentials"`,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			c := newFakeClient(tt.objs...)
+			if tt.deny {
+				c = interceptor.NewClient(c.(client.WithWatch), interceptor.Funcs{
+					Get: func(ctx context.Context, c client.WithWatch, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+						if _, ok := obj.(*corev1.ConfigMap); ok {
+							return apierrors.NewForbidden(schema.GroupResource{Resource: "configmaps"}, key.Name, nil)
+						}
+						return c.Get(ctx, key, obj, opts...)
+					},
+				})
+			}
+			e := New("wc1", "org-test").WithProviderConfig(tt.explicit)
+			err := e.DiscoverProviderConfig(context.Background(), c)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Fatalf("DiscoverProviderConfig() = %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Fatalf("DiscoverProviderConfig() = %v, want an error containing %q", err, tt.wantErr)
+			}
+			if e.providerConfig != tt.wantName || (tt.wantFrom != "" && e.providerConfigFrom != tt.wantFrom) {
+				t.Errorf("providerConfig = %q from %s, want %q from %s", e.providerConfig, e.providerConfigFrom, tt.wantName, tt.wantFrom)
+			}
+		})
+	}
+}
+
+func TestDiscoverProviderConfigParsesValues(t *testing.T) {
+	c := newFakeClient(crossplaneConfig(map[string]string{"values": crossplaneValues}), providerConfig("wc1"))
+	e := New("wc1", "org-test")
+	if err := e.DiscoverProviderConfig(context.Background(), c); err != nil {
+		t.Fatal(err)
+	}
+	a := e.Account()
+	if a.ID != "123456789012" || a.Partition != "aws" || len(a.OIDCDomains) != 2 || a.OIDCDomains[1] != "wc1.irsa.example.com" {
+		t.Errorf("Account() = %+v", a)
+	}
+}
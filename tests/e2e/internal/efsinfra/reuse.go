@@ -0,0 +1,220 @@
+package efsinfra
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"slices"
+	"strings"
+
+	"e2e/internal/efsapi"
+)
+
+const nfsPort = 2049
+
+// existing selects a file system to reuse instead of creating one.
+type existing struct {
+	id       string
+	tagKey   string
+	tagValue string
+}
+
+func (x existing) enabled() bool {
+	return x.id != "" || x.tagKey != ""
+}
+
+func (x existing) String() string {
+	if x.id != "" {
+		return x.id
+	}
+	return fmt.Sprintf("tag %s=%s", x.tagKey, x.tagValue)
+}
+
+// WithExistingFileSystem makes Create validate and use the file system with
+// the given ID instead of creating infrastructure.
+func (e *Infra) WithExistingFileSystem(id string) *Infra {
+	e.existing = existing{id: id}
+	return e
+}
+
+// WithExistingFileSystemTag makes Create use the one available file system
+// tagged key=value instead of creating infrastructure.
+func (e *Infra) WithExistingFileSystemTag(key, value string) *Infra {
+	e.existing = existing{tagKey: key, tagValue: value}
+	return e
+}
+
+// WithExistingFromEnv reuses the file system named by E2E_EFS_FILESYSTEM_ID,
+// or the one tagged E2E_EFS_FILESYSTEM_TAG (key=value), if either is set.
+func (e *Infra) WithExistingFromEnv() *Infra {
+	if id := os.Getenv("E2E_EFS_FILESYSTEM_ID"); id != "" {
+		return e.WithExistingFileSystem(id)
+	}
+	if tag := os.Getenv("E2E_EFS_FILESYSTEM_TAG"); tag != "" {
+		key, value, _ := strings.Cut(tag, "=")
+		return e.WithExistingFileSystemTag(key, value)
+	}
+	return e
+}
+
+// WithInspector sets the AWS API used to validate a reused file system.
+// By default one is created from the default credential chain.
+func (e *Infra) WithInspector(i efsapi.Inspector) *Infra {
+	e.inspector = i
+	return e
+}
+
+// Reused reports whether the file system was reused rather than created.
+// A reused file system is neither modified nor deleted.
+func (e *Infra) Reused() bool {
+	return e.reused
+}
+
+// useExisting resolves the configured file system and checks it can serve
+// the cluster: it must be available, have an available mount target in the
+// cluster VPC in every node AZ, and those mount targets' security groups
+// must allow NFS from the node subnets.
+func (e *Infra) useExisting(ctx context.Context) error {
+	if e.inspector == nil {
+		i, err := efsapi.NewAWSInspector(ctx, e.region)
+		if err != nil {
+			return fmt.Errorf("validating file system %s: %w", e.existing, err)
+		}
+		e.inspector = i
+	}
+
+	fs, err := e.findExisting(ctx)
+	if err != nil {
+		return err
+	}
+	mts, err := e.inspector.MountTargets(ctx, fs.ID)
+	if err != nil {
+		return err
+	}
+	var groups []string
+	for _, mt := range mts {
+		for _, sg := range mt.SecurityGroups {
+			if !slices.Contains(groups, sg) {
+				groups = append(groups, sg)
+			}
+		}
+	}
+	var rules []efsapi.IngressRule
+	if len(groups) > 0 {
+		if rules, err = e.inspector.IngressRules(ctx, groups); err != nil {
+			return err
+		}
+	}
+
+	if problems := validateExisting(fs, mts, rules, e.vpcID, e.nodeSubnets(), e.nodeSecurityGroups); len(problems) > 0 {
+		return fmt.Errorf("file system %s cannot serve cluster %s:\n- %s", fs.ID, e.clusterName, strings.Join(problems, "\n- "))
+	}
+
+	e.fileSystemID = fs.ID
+	e.throughputMode = fs.ThroughputMode
+	e.reused = true
+	e.log.Info("reusing existing file system", "fileSystemID", fs.ID, "name", fs.Name, "mountTargets", len(mts))
+	return e.saveState(ctx)
+}
+
+func (e *Infra) findExisting(ctx context.Context) (efsapi.FileSystem, error) {
+	all, err := e.inspector.FileSystems(ctx)
+	if err != nil {
+		return efsapi.FileSystem{}, err
+	}
+	var matches []efsapi.FileSystem
+	for _, fs := range all {
+		switch {
+		case e.existing.id != "" && fs.ID == e.existing.id:
+			return fs, nil
+		case e.existing.tagKey != "" && fs.Tags[e.existing.tagKey] == e.existing.tagValue && fs.State == "available":
+			matches = append(matches, fs)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return efsapi.FileSystem{}, fmt.Errorf("no available file system matches %s", e.existing)
+	case 1:
+		return matches[0], nil
+	}
+	var ids []string
+	for _, fs := range matches {
+		ids = append(ids, fs.ID)
+	}
+	return efsapi.FileSystem{}, fmt.Errorf("%d file systems match %s: %s", len(matches), e.existing, strings.Join(ids, ", "))
+}
+
+// nodeSubnets returns the private subnets, with the VPC CIDR standing in
+// for subnets whose CIDR is unknown.
+func (e *Infra) nodeSubnets() []subnetInfo {
+	out := make([]subnetInfo, 0, len(e.privateSubnets))
+	for _, s := range e.privateSubnets {
+		if s.cidr == "" {
+			s.cidr = e.vpcCIDR
+		}
+		out = append(out, s)
+	}
+	return out
+}
+
+// validateExisting returns why a file system cannot serve nodes in the given
+// subnets of vpcID, or nothing if it can.
+func validateExisting(fs efsapi.FileSystem, mts []efsapi.MountTarget, rules []efsapi.IngressRule, vpcID string, subnets []subnetInfo, nodeGroups []string) []string {
+	var problems []string
+	if fs.State != "available" {
+		problems = append(problems, fmt.Sprintf("file system is %s, not available", fs.State))
+	}
+	for _, mt := range mts {
+		if mt.VPCID != vpcID {
+			problems = append(problems, fmt.Sprintf("mount target %s is in %s, not the cluster VPC %s", mt.ID, mt.VPCID, vpcID))
+		}
+	}
+	for _, s := range subnets {
+		i := slices.IndexFunc(mts, func(mt efsapi.MountTarget) bool { return mt.AZ == s.az && mt.VPCID == vpcID })
+		if i < 0 {
+			problems = append(problems, fmt.Sprintf("no mount target in %s", s.az))
+			continue
+		}
+		mt := mts[i]
+		if mt.State != "available" {
+			problems = append(problems, fmt.Sprintf("mount target %s in %s is %s, not available", mt.ID, s.az, mt.State))
+		}
+		if !slices.ContainsFunc(rules, func(r efsapi.IngressRule) bool {
+			return slices.Contains(mt.SecurityGroups, r.GroupID) && allowsNFS(r, s.cidr, nodeGroups)
+		}) {
+			problems = append(problems, fmt.Sprintf("security groups %v of mount target %s do not allow TCP %d from %s (%s)", mt.SecurityGroups, mt.ID, nfsPort, s.cidr, s.az))
+		}
+	}
+	return problems
+}
+
+// allowsNFS reports whether the rule lets TCP 2049 in from all of cidr, or
+// from one of the node security groups.
+func allowsNFS(r efsapi.IngressRule, cidr string, nodeGroups []string) bool {
+	if r.Protocol != "tcp" && r.Protocol != "6" && r.Protocol != "-1" {
+		return false
+	}
+	if r.Protocol != "-1" && r.FromPort != -1 && (r.FromPort > nfsPort || r.ToPort < nfsPort) {
+		return false
+	}
+	if slices.ContainsFunc(r.SourceGroups, func(g string) bool { return slices.Contains(nodeGroups, g) }) {
+		return true
+	}
+	_, want, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return false
+	}
+	wantOnes, _ := want.Mask.Size()
+	for _, c := range r.CIDRs {
+		_, allowed, err := net.ParseCIDR(c)
+		if err != nil {
+			continue
+		}
+		ones, _ := allowed.Mask.Size()
+		if allowed.Contains(want.IP) && ones <= wantOnes {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,161 @@
+package efsinfra
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"e2e/internal/efsapi"
+)
+
+type fakeInspector struct {
+	fileSystems  []efsapi.FileSystem
+	mountTargets []efsapi.MountTarget
+	rules        []efsapi.IngressRule
+	interfaces   map[string][]efsapi.NetworkInterface
+}
+
+func (f *fakeInspector) FileSystems(context.Context) ([]efsapi.FileSystem, error) {
+	return f.fileSystems, nil
+}
+
+func (f *fakeInspector) MountTargets(_ context.Context, id string) ([]efsapi.MountTarget, error) {
+	var out []efsapi.MountTarget
+	for _, mt := range f.mountTargets {
+		if mt.FileSystemID == id {
+			out = append(out, mt)
+		}
+	}
+	return out, nil
+}
+
+func (f *fakeInspector) IngressRules(context.Context, []string) ([]efsapi.IngressRule, error) {
+	return f.rules, nil
+}
+
+func (f *fakeInspector) NetworkInterfaces(_ context.Context, groupID string) ([]efsapi.NetworkInterface, error) {
+	return f.interfaces[groupID], nil
+}
+
+func reusable() *fakeInspector {
+	return &fakeInspector{
+		fileSystems: []efsapi.FileSystem{
+			{ID: "fs-shared", State: "available", ThroughputMode: "elastic", Tags: map[string]string{"team": "storage"}},
+			{ID: "fs-other", State: "available", Tags: map[string]string{"team": "other"}},
+		},
+		mountTargets: []efsapi.MountTarget{
+			{ID: "fsmt-a", FileSystemID: "fs-shared", AZ: "eu-west-1a", VPCID: "vpc-1", State: "available", SecurityGroups: []string{"sg-efs"}},
+			{ID: "fsmt-b", FileSystemID: "fs-shared", AZ: "eu-west-1b", VPCID: "vpc-1", State: "available", SecurityGroups: []string{"sg-efs"}},
+		},
+		rules: []efsapi.IngressRule{
+			{GroupID: "sg-efs", Protocol: "tcp", FromPort: 2049, ToPort: 2049, CIDRs: []string{"10.0.0.0/16"}},
+		},
+	}
+}
+
+func reuseInfra(i efsapi.Inspector) *Infra {
+	e := New("wc1", "org-test").WithInspector(i)
+	e.vpcID, e.vpcCIDR = "vpc-1", "10.0.0.0/16"
+	e.privateSubnets = []subnetInfo{
+		{id: "subnet-a", az: "eu-west-1a", cidr: "10.0.0.0/20"},
+		{id: "subnet-b", az: "eu-west-1b"},
+	}
+	return e
+}
+
+func TestCreateReusesExistingFileSystem(t *testing.T) {
+	ctx := context.Background()
+	c := newFakeClient()
+
+	for name, e := range map[string]*Infra{
+		"by ID":  reuseInfra(reusable()).WithExistingFileSystem("fs-shared"),
+		"by tag": reuseInfra(reusable()).WithExistingFileSystemTag("team", "storage"),
+	} {
+		if err := e.Create(ctx, c); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if e.FileSystemID() != "fs-shared" || !e.Reused() || len(e.created) != 0 {
+			t.Errorf("%s: fs=%q reused=%v created=%v, want fs-shared reused and nothing created", name, e.FileSystemID(), e.Reused(), e.created)
+		}
+		if e.ThroughputMode() != "elastic" {
+			t.Errorf("%s: throughput mode %q, want that of the reused file system", name, e.ThroughputMode())
+		}
+		if err := e.ApplyFileSystemPolicy(ctx, c, "{}"); err == nil {
+			t.Errorf("%s: ApplyFileSystemPolicy on a reused file system succeeded", name)
+		}
+	}
+}
+
+func TestCreateRejectsUnusableFileSystem(t *testing.T) {
+	tests := map[string]struct {
+		mutate func(*fakeInspector)
+		want   string
+	}{
+		"unknown ID": {
+			mutate: func(f *fakeInspector) { f.fileSystems = f.fileSystems[1:] },
+			want:   "no available file system matches fs-shared",
+		},
+		"other VPC": {
+			mutate: func(f *fakeInspector) { f.mountTargets[1].VPCID = "vpc-2" },
+			want:   "no mount target in eu-west-1b",
+		},
+		"missing AZ": {
+			mutate: func(f *fakeInspector) { f.mountTargets = f.mountTargets[:1] },
+			want:   "no mount target in eu-west-1b",
+		},
+		"mount target creating": {
+			mutate: func(f *fakeInspector) { f.mountTargets[0].State = "creating" },
+			want:   "mount target fsmt-a in eu-west-1a is creating",
+		},
+		"wrong port": {
+			mutate: func(f *fakeInspector) { f.rules[0].FromPort, f.rules[0].ToPort = 22, 22 },
+			want:   "do not allow TCP 2049 from 10.0.0.0/20",
+		},
+		"narrower CIDR": {
+			mutate: func(f *fakeInspector) { f.rules[0].CIDRs = []string{"10.0.0.0/20"} },
+			want:   "do not allow TCP 2049 from 10.0.0.0/16 (eu-west-1b)",
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			f := reusable()
+			tt.mutate(f)
+			e := reuseInfra(f).WithExistingFileSystem("fs-shared")
+			err := e.Create(context.Background(), newFakeClient())
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("Create() = %v, want an error containing %q", err, tt.want)
+			}
+			if e.Reused() || e.FileSystemID() != "" {
+				t.Errorf("rejected file system was recorded: %q", e.FileSystemID())
+			}
+		})
+	}
+}
+
+func TestCreateRejectsAmbiguousTag(t *testing.T) {
+	f := reusable()
+	f.fileSystems[1].Tags["team"] = "storage"
+	err := reuseInfra(f).WithExistingFileSystemTag("team", "storage").Create(context.Background(), newFakeClient())
+	if err == nil || !strings.Contains(err.Error(), "2 file systems match tag team=storage") {
+		t.Fatalf("Create() = %v, want an ambiguous tag error", err)
+	}
+}
+
+func TestAllowsNFS(t *testing.T) {
+	tests := []struct {
+		rule efsapi.IngressRule
+		want bool
+	}{
+		{efsapi.IngressRule{Protocol: "tcp", FromPort: 2049, ToPort: 2049, CIDRs: []string{"10.0.0.0/8"}}, true},
+		{efsapi.IngressRule{Protocol: "tcp", FromPort: 0, ToPort: 65535, CIDRs: []string{"10.0.16.0/20"}}, false},
+		{efsapi.IngressRule{Protocol: "-1", FromPort: -1, ToPort: -1, CIDRs: []string{"0.0.0.0/0"}}, true},
+		{efsapi.IngressRule{Protocol: "udp", FromPort: 2049, ToPort: 2049, CIDRs: []string{"10.0.0.0/8"}}, false},
+		{efsapi.IngressRule{Protocol: "tcp", FromPort: 2049, ToPort: 2049, SourceGroups: []string{"sg-nodes"}}, true},
+		{efsapi.IngressRule{Protocol: "tcp", FromPort: 2049, ToPort: 2049, SourceGroups: []string{"sg-other"}}, false},
+	}
+	for _, tt := range tests {
+		if got := allowsNFS(tt.rule, "10.0.0.0/20", []string{"sg-nodes"}); got != tt.want {
+			t.Errorf("allowsNFS(%+v) = %v, want %v", tt.rule, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,271 @@
+package efsinfra
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// stateKey is the ConfigMap data key holding the JSON state.
+	stateKey = "state.json"
+
+	// FileSystemIDAnnotation is set on the state ConfigMap to the file
+	// system's AWS ID.
+	FileSystemIDAnnotation = "efs-e2e.giantswarm.io/file-system-id"
+)
+
+// State is what an Infra knows about its fixture: the discovered network,
+// the resources created so far in creation order, and their AWS IDs. It is
+// saved after every change, so another process can resume or clean up.
+type State struct {
+	Cluster         string          `json:"cluster"`
+	OrgNamespace    string          `json:"orgNamespace,omitempty"`
+	Region          string          `json:"region,omitempty"`
+	ProviderConfig  string          `json:"providerConfig,omitempty"`
+	ThroughputMode  string          `json:"throughputMode,omitempty"`
+	VPCID           string          `json:"vpcID,omitempty"`
+	VPCCIDR         string          `json:"vpcCIDR,omitempty"`
+	Subnets         []StateSubnet   `json:"subnets,omitempty"`
+	FileSystemID    string          `json:"fileSystemID,omitempty"`
+	SecurityGroupID string          `json:"securityGroupID,omitempty"`
+	Reused          bool            `json:"reused,omitempty"`
+	Resources       []StateResource `json:"resources"`
+	UpdatedAt       time.Time       `json:"updatedAt"`
+}
+
+// StateSubnet is a private subnet picked for a mount target.
+type StateSubnet struct {
+	ID   string `json:"id"`
+	AZ   string `json:"az"`
+	CIDR string `json:"cidr,omitempty"`
+}
+
+// StateResource is a created Crossplane managed resource.
+type StateResource struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Name       string `json:"name"`
+	ID         string `json:"id,omitempty"`
+}
+
+// StateStore persists a State between processes. Load returns nil and no
+// error when nothing is stored.
+type StateStore interface {
+	Load(ctx context.Context) (*State, error)
+	Save(ctx context.Context, s *State) error
+	Delete(ctx context.Context) error
+}
+
+// WithState makes the Infra save its state to store after every change.
+func (e *Infra) WithState(store StateStore) *Infra {
+	e.store = store
+	return e
+}
+
+// WithConfigMapState keeps the state in the cluster's organization
+// namespace on the MC, where the suites and cmd/efs-fixture both find it.
+func (e *Infra) WithConfigMapState(c client.Client) *Infra {
+	return e.WithState(NewConfigMapStore(c, e.orgNamespace, StateConfigMapName(e.clusterName)))
+}
+
+// LoadState restores the Infra from its store, so Create resumes where an
+// earlier process stopped and Cleanup deletes exactly what it created. It
+// reports whether any state was found.
+func (e *Infra) LoadState(ctx context.Context) (bool, error) {
+	if e.store == nil {
+		return false, nil
+	}
+	s, err := e.store.Load(ctx)
+	if err != nil || s == nil {
+		return false, err
+	}
+	if s.Cluster != e.clusterName {
+		return false, fmt.Errorf("stored state is for cluster %q, not %q", s.Cluster, e.clusterName)
+	}
+	if e.orgNamespace == "" {
+		e.orgNamespace = s.OrgNamespace
+	}
+	if s.ProviderConfig != "" && e.providerConfigFrom != "WithProviderConfig" {
+		e.providerConfig, e.providerConfigFrom = s.ProviderConfig, "the fixture state"
+	}
+	if e.throughputMode == "" {
+		e.throughputMode = s.ThroughputMode
+	}
+	e.region, e.vpcID, e.vpcCIDR = s.Region, s.VPCID, s.VPCCIDR
+	e.privateSubnets = nil
+	for _, sub := range s.Subnets {
+		e.privateSubnets = append(e.privateSubnets, subnetInfo{id: sub.ID, az: sub.AZ, cidr: sub.CIDR})
+	}
+	e.fileSystemID, e.securityGroupID, e.reused = s.FileSystemID, s.SecurityGroupID, s.Reused
+	e.created = nil
+	for _, r := range s.Resources {
+		e.created = append(e.created, resourceRef{
+			gvk:  schema.FromAPIVersionAndKind(r.APIVersion, r.Kind),
+			name: r.Name,
+			id:   r.ID,
+		})
+	}
+	e.log.Info("loaded fixture state", "resources", len(e.created), "fileSystemID", e.fileSystemID, "updatedAt", s.UpdatedAt)
+	return true, nil
+}
+
+// State returns a snapshot of what the Infra knows.
+func (e *Infra) State() *State {
+	s := &State{
+		Cluster:         e.clusterName,
+		OrgNamespace:    e.orgNamespace,
+		Region:          e.region,
+		ProviderConfig:  e.providerConfig,
+		ThroughputMode:  e.throughputMode,
+		VPCID:           e.vpcID,
+		VPCCIDR:         e.vpcCIDR,
+		FileSystemID:    e.fileSystemID,
+		SecurityGroupID: e.securityGroupID,
+		Reused:          e.reused,
+		Resources:       []StateResource{},
+	}
+	for _, sub := range e.privateSubnets {
+		s.Subnets = append(s.Subnets, StateSubnet{ID: sub.id, AZ: sub.az, CIDR: sub.cidr})
+	}
+	for _, ref := range e.created {
+		apiVersion, kind := ref.gvk.ToAPIVersionAndKind()
+		s.Resources = append(s.Resources, StateResource{APIVersion: apiVersion, Kind: kind, Name: ref.name, ID: ref.id})
+	}
+	return s
+}
+
+func (e *Infra) saveState(ctx context.Context) error {
+	if e.store == nil {
+		return nil
+	}
+	s := e.State()
+	s.UpdatedAt = time.Now().UTC()
+	if err := e.store.Save(ctx, s); err != nil {
+		return fmt.Errorf("saving fixture state: %w", err)
+	}
+	return nil
+}
+
+// FileStore keeps the state in a JSON file.
+type FileStore struct {
+	Path string
+}
+
+// NewFileStore returns a store writing to path.
+func NewFileStore(path string) *FileStore {
+	return &FileStore{Path: path}
+}
+
+func (f *FileStore) Load(_ context.Context) (*State, error) {
+	data, err := os.ReadFile(f.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var s State
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", f.Path, err)
+	}
+	return &s, nil
+}
+
+// Save writes the file atomically, so a crash never leaves half a state.
+func (f *FileStore) Save(_ context.Context, s *State) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(f.Path), 0o750); err != nil {
+		return err
+	}
+	tmp := f.Path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, f.Path)
+}
+
+func (f *FileStore) Delete(_ context.Context) error {
+	if err := os.Remove(f.Path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// ConfigMapStore keeps the state in a ConfigMap, so it survives the test
+// runner. The ConfigMap carries ClusterLabel and the file system ID as an
+// annotation, to be found with kubectl.
+type ConfigMapStore struct {
+	client client.Client
+	key    types.NamespacedName
+}
+
+// NewConfigMapStore returns a store using the ConfigMap namespace/name.
+func NewConfigMapStore(c client.Client, namespace, name string) *ConfigMapStore {
+	return &ConfigMapStore{client: c, key: types.NamespacedName{Namespace: namespace, Name: name}}
+}
+
+// StateConfigMapName is the ConfigMap the suites and cmd/efs-fixture keep a
+// cluster's fixture state in, in the cluster's organization namespace.
+func StateConfigMapName(clusterName string) string {
+	return clusterName + "-efs-e2e-state"
+}
+
+func (s *ConfigMapStore) Load(ctx context.Context) (*State, error) {
+	var cm corev1.ConfigMap
+	err := s.client.Get(ctx, s.key, &cm)
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("getting ConfigMap %s: %w", s.key, err)
+	}
+	var st State
+	if err := json.Unmarshal([]byte(cm.Data[stateKey]), &st); err != nil {
+		return nil, fmt.Errorf("parsing ConfigMap %s: %w", s.key, err)
+	}
+	return &st, nil
+}
+
+func (s *ConfigMapStore) Save(ctx context.Context, st *State) error {
+	data, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        s.key.Name,
+			Namespace:   s.key.Namespace,
+			Labels:      map[string]string{ClusterLabel: st.Cluster},
+			Annotations: map[string]string{FileSystemIDAnnotation: st.FileSystemID},
+		},
+		Data: map[string]string{stateKey: string(data)},
+	}
+	err = s.client.Create(ctx, cm)
+	if apierrors.IsAlreadyExists(err) {
+		err = s.client.Update(ctx, cm)
+	}
+	return err
+}
+
+func (s *ConfigMapStore) Delete(ctx context.Context) error {
+	cm := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: s.key.Name, Namespace: s.key.Namespace}}
+	if err := s.client.Delete(ctx, cm); err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
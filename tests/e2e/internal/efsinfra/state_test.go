@@ -0,0 +1,145 @@
+package efsinfra
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// resumable is an Infra state in the middle of Create, as a crashed run
+// leaves it.
+func resumable() *Infra {
+	e := New("wc1", "org-test")
+	e.region, e.vpcID, e.vpcCIDR = "eu-west-1", "vpc-1", "10.0.0.0/16"
+	e.privateSubnets = []subnetInfo{{id: "subnet-a", az: "eu-west-1a"}, {id: "subnet-b", az: "eu-west-1b"}}
+	e.track(ec2SecurityGroupGVK, "wc1-efs-e2e-sg")
+	e.recordID(ec2SecurityGroupGVK, "wc1-efs-e2e-sg", "sg-1")
+	e.securityGroupID = "sg-1"
+	e.track(efsFileSystemGVK, "wc1-efs-e2e-fs")
+	return e
+}
+
+func TestStateStores(t *testing.T) {
+	ctx := context.Background()
+	for name, store := range map[string]StateStore{
+		"file":      NewFileStore(filepath.Join(t.TempDir(), "nested", "state.json")),
+		"configmap": NewConfigMapStore(newFakeClient(), "org-test", StateConfigMapName("wc1")),
+	} {
+		t.Run(name, func(t *testing.T) {
+			if s, err := store.Load(ctx); s != nil || err != nil {
+				t.Fatalf("Load() of an empty store = %v, %v", s, err)
+			}
+
+			saved := resumable().WithState(store)
+			if err := saved.saveState(ctx); err != nil {
+				t.Fatal(err)
+			}
+			// Saving again must replace, not fail.
+			saved.recordID(efsFileSystemGVK, "wc1-efs-e2e-fs", "fs-1")
+			saved.fileSystemID = "fs-1"
+			if err := saved.saveState(ctx); err != nil {
+				t.Fatal(err)
+			}
+
+			loaded := New("wc1", "").WithState(store)
+			found, err := loaded.LoadState(ctx)
+			if err != nil || !found {
+				t.Fatalf("LoadState() = %v, %v", found, err)
+			}
+			if !reflect.DeepEqual(loaded.created, saved.created) || !reflect.DeepEqual(loaded.privateSubnets, saved.privateSubnets) {
+				t.Errorf("loaded resources %+v subnets %+v, want %+v %+v", loaded.created, loaded.privateSubnets, saved.created, saved.privateSubnets)
+			}
+			if loaded.orgNamespace != "org-test" || loaded.FileSystemID() != "fs-1" || loaded.Region() != "eu-west-1" {
+				t.Errorf("loaded namespace=%q fs=%q region=%q", loaded.orgNamespace, loaded.FileSystemID(), loaded.Region())
+			}
+
+			if _, err := New("wc2", "").WithState(store).LoadState(ctx); err == nil {
+				t.Error("LoadState() accepted the state of another cluster")
+			}
+
+			if err := store.Delete(ctx); err != nil {
+				t.Fatal(err)
+			}
+			if err := store.Delete(ctx); err != nil {
+				t.Errorf("deleting a deleted state: %v", err)
+			}
+			if s, _ := store.Load(ctx); s != nil {
+				t.Error("state still stored after Delete")
+			}
+		})
+	}
+}
+
+func TestCreateResumes(t *testing.T) {
+	ctx := context.Background()
+	// The crashed run had created everything, but only saved the first
+	// resources before it died. All of them became ready meanwhile.
+	c := newFakeClient(
+		managed(ec2SecurityGroupGVK, "wc1-efs-e2e-sg", "wc1", "sg-1"),
+		managed(efsFileSystemGVK, "wc1-efs-e2e-fs", "wc1", "fs-1"),
+		managed(ec2SecurityGroupRuleGVK, "wc1-efs-e2e-sgr-nfs", "wc1", "sgrule-1"),
+		managed(efsMountTargetGVK, "wc1-efs-e2e-mt-eu-west-1a", "wc1", "fsmt-a"),
+		managed(efsMountTargetGVK, "wc1-efs-e2e-mt-eu-west-1b", "wc1", "fsmt-b"),
+	)
+	store := NewConfigMapStore(c, "org-test", StateConfigMapName("wc1"))
+	if err := resumable().WithState(store).saveState(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	var phases []string
+	e := New("wc1", "org-test").WithState(store).WithPhaseRecorder(func(name string, _ time.Duration, id string) {
+		phases = append(phases, name+"="+id)
+	})
+	if _, err := e.LoadState(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Create(ctx, c); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"SecurityGroup ID=sg-1", "FileSystem ID=fs-1", "MountTargets ready=fsmt-a,fsmt-b"}; !reflect.DeepEqual(phases, want) {
+		t.Errorf("recorded phases %v, want %v", phases, want)
+	}
+
+	s, err := store.Load(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, r := range s.Resources {
+		got = append(got, r.Kind+"/"+r.Name+"="+r.ID)
+	}
+	want := []string{
+		"SecurityGroup/wc1-efs-e2e-sg=sg-1",
+		"FileSystem/wc1-efs-e2e-fs=fs-1",
+		"SecurityGroupRule/wc1-efs-e2e-sgr-nfs=sgrule-1",
+		"MountTarget/wc1-efs-e2e-mt-eu-west-1a=fsmt-a",
+		"MountTarget/wc1-efs-e2e-mt-eu-west-1b=fsmt-b",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("saved resources:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	if err := e.Cleanup(ctx, c); err != nil {
+		t.Fatal(err)
+	}
+	if s, _ := store.Load(ctx); s != nil {
+		t.Error("state still stored after Cleanup")
+	}
+}
+
+func TestCreateRefusesForeignResources(t *testing.T) {
+	ctx := context.Background()
+	c := newFakeClient(managed(ec2SecurityGroupGVK, "wc1-efs-e2e-sg", "", "sg-1"))
+
+	e := New("wc1", "org-test")
+	err := e.Create(ctx, c)
+	if err == nil || !strings.Contains(err.Error(), "is not labelled") {
+		t.Fatalf("Create() over an unlabelled SecurityGroup = %v", err)
+	}
+	if len(e.created) != 0 {
+		t.Errorf("tracked %v, which Cleanup would delete", e.created)
+	}
+}
@@ -0,0 +1,118 @@
+package efsinfra
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Resource is one managed resource of the fixture as Crossplane reports it.
+type Resource struct {
+	Kind       string
+	Name       string
+	ID         string
+	Ready      bool
+	Conditions string
+}
+
+// Fixture is the file system Create made for a cluster.
+type Fixture struct {
+	Cluster      string
+	Name         string
+	FileSystemID string
+	Ready        bool
+	Created      time.Time
+}
+
+// Adopt finds the resources an earlier Create made for the cluster by their
+// ClusterLabel and tracks them, so Status and Cleanup cover them.
+func (e *Infra) Adopt(ctx context.Context, c client.Client) error {
+	for _, gvk := range creationOrder {
+		items, err := listManaged(ctx, c, gvk, client.MatchingLabels{ClusterLabel: e.clusterName})
+		if err != nil {
+			return err
+		}
+		for _, obj := range items {
+			id, _, _ := unstructured.NestedString(obj.Object, "status", "atProvider", "id")
+			e.track(gvk, obj.GetName())
+			e.recordID(gvk, obj.GetName(), id)
+			switch gvk {
+			case efsFileSystemGVK:
+				e.fileSystemID = id
+			case ec2SecurityGroupGVK:
+				e.securityGroupID = id
+			}
+			e.log.Info("adopted resource", "kind", gvk.Kind, "name", obj.GetName(), "id", id)
+		}
+	}
+	return nil
+}
+
+// Status returns the tracked resources in creation order. Resources that
+// no longer exist are reported with Conditions "not found".
+func (e *Infra) Status(ctx context.Context, c client.Client) ([]Resource, error) {
+	out := make([]Resource, 0, len(e.created))
+	for _, ref := range e.created {
+		r := Resource{Kind: ref.gvk.Kind, Name: ref.name}
+		obj := &unstructured.Unstructured{}
+		obj.SetGroupVersionKind(ref.gvk)
+		err := c.Get(ctx, types.NamespacedName{Name: ref.name}, obj)
+		switch {
+		case apierrors.IsNotFound(err):
+			r.Conditions = "not found"
+		case err != nil:
+			return nil, fmt.Errorf("getting %s %s: %w", ref.gvk.Kind, ref.name, err)
+		default:
+			r.ID, _, _ = unstructured.NestedString(obj.Object, "status", "atProvider", "id")
+			r.Ready = isReady(obj)
+			r.Conditions = conditionSummary(obj)
+		}
+		out = append(out, r)
+	}
+	return out, nil
+}
+
+// List returns the file systems Create made for any cluster, oldest first.
+func List(ctx context.Context, c client.Client) ([]Fixture, error) {
+	items, err := listManaged(ctx, c, efsFileSystemGVK, client.HasLabels{ClusterLabel})
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Fixture, 0, len(items))
+	for _, obj := range items {
+		id, _, _ := unstructured.NestedString(obj.Object, "status", "atProvider", "id")
+		out = append(out, Fixture{
+			Cluster:      obj.GetLabels()[ClusterLabel],
+			Name:         obj.GetName(),
+			FileSystemID: id,
+			Ready:        isReady(&obj),
+			Created:      obj.GetCreationTimestamp().Time,
+		})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Created.Before(out[j].Created) })
+	return out, nil
+}
+
+// listManaged lists managed resources of one kind, sorted by name. A kind
+// whose CRD is not installed has no resources.
+func listManaged(ctx context.Context, c client.Client, gvk schema.GroupVersionKind, opts ...client.ListOption) ([]unstructured.Unstructured, error) {
+	list := &unstructured.UnstructuredList{}
+	list.SetGroupVersionKind(gvk.GroupVersion().WithKind(gvk.Kind + "List"))
+	err := c.List(ctx, list, opts...)
+	if meta.IsNoMatchError(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("listing %s: %w", gvk.Kind, err)
+	}
+	sort.Slice(list.Items, func(i, j int) bool { return list.Items[i].GetName() < list.Items[j].GetName() })
+	return list.Items, nil
+}
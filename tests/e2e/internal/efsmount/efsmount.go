@@ -0,0 +1,157 @@
+// Package efsmount inspects EFS mounts from the node's point of view: the
+// kernel mount table and the state files efs-utils keeps for every mount it
+// tunnels through stunnel or efs-proxy.
+package efsmount
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// StateDir is where efs-utils writes its per-mount state files. The
+// efs-csi-node DaemonSet mounts it from the host into the efs-plugin
+// container.
+const StateDir = "/var/run/efs"
+
+// snapshotSeparator splits the mount table from the state files in the
+// output of SnapshotCommand.
+const snapshotSeparator = "--- efs-state ---"
+
+// SnapshotCommand returns a command that prints the mount table followed by
+// one line per efs-utils state file ("<file name> <json>"). It only needs a
+// POSIX shell, so it runs in the efs-plugin container as is.
+func SnapshotCommand() []string {
+	return []string{"sh", "-c", fmt.Sprintf(
+		`cat /proc/mounts; echo '%s'; for f in %s/fs-*; do [ -f "$f" ] && printf '%%s %%s\n' "${f##*/}" "$(tr -d '\n' < "$f")"; done; true`,
+		snapshotSeparator, StateDir,
+	)}
+}
+
+// Mount is one entry of /proc/mounts.
+type Mount struct {
+	Source  string
+	Target  string
+	FSType  string
+	Options map[string]string
+}
+
+// State is the subset of an efs-utils state file the tests care about.
+type State struct {
+	File        string   `json:"-"`
+	PID         int      `json:"pid"`
+	Cmd         []string `json:"cmd"`
+	FileSystem  string   `json:"fsId"`
+	AccessPoint string   `json:"accessPoint"`
+	// CredentialsMethod is only recorded when the mount uses IAM
+	// authorization, e.g. "webidentity" or "metadata".
+	CredentialsMethod string `json:"awsCredentialsMethod"`
+}
+
+// TLS reports whether the mount's tunnel encrypts traffic. Older efs-utils
+// only start stunnel for TLS mounts; efs-utils v2 routes every mount through
+// efs-proxy and passes --tls when encryption is on.
+func (s State) TLS() bool {
+	if len(s.Cmd) == 0 {
+		return false
+	}
+	bin := path.Base(s.Cmd[0])
+	if strings.HasPrefix(bin, "stunnel") {
+		return true
+	}
+	if bin == "efs-proxy" {
+		for _, arg := range s.Cmd[1:] {
+			if arg == "--tls" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// IAM reports whether efs-utils authorized the mount with IAM credentials.
+func (s State) IAM() bool {
+	return s.CredentialsMethod != ""
+}
+
+// Snapshot is the parsed output of SnapshotCommand.
+type Snapshot struct {
+	Mounts []Mount
+	States []State
+}
+
+// ParseSnapshot parses the output of SnapshotCommand. State files that are
+// not valid JSON (e.g. caught mid-write) are skipped.
+func ParseSnapshot(output string) (Snapshot, error) {
+	table, states, found := strings.Cut(output, snapshotSeparator)
+	if !found {
+		return Snapshot{}, fmt.Errorf("no %q marker in output", snapshotSeparator)
+	}
+
+	var snap Snapshot
+	for _, line := range strings.Split(table, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 4 {
+			continue
+		}
+		m := Mount{
+			Source:  fields[0],
+			Target:  unescapeMountPath(fields[1]),
+			FSType:  fields[2],
+			Options: map[string]string{},
+		}
+		for _, opt := range strings.Split(fields[3], ",") {
+			k, v, _ := strings.Cut(opt, "=")
+			m.Options[k] = v
+		}
+		snap.Mounts = append(snap.Mounts, m)
+	}
+
+	for _, line := range strings.Split(states, "\n") {
+		name, data, found := strings.Cut(strings.TrimSpace(line), " ")
+		if !found {
+			continue
+		}
+		var s State
+		if err := json.Unmarshal([]byte(data), &s); err != nil {
+			continue
+		}
+		s.File = name
+		snap.States = append(snap.States, s)
+	}
+	return snap, nil
+}
+
+// VolumeMountPath returns the suffix of the kubelet path a CSI volume is
+// mounted at for a pod.
+func VolumeMountPath(podUID, pvName string) string {
+	return fmt.Sprintf("/pods/%s/volumes/kubernetes.io~csi/%s/mount", podUID, pvName)
+}
+
+// FindVolume returns the NFS mount backing a pod's CSI volume and the state
+// file efs-utils wrote for it.
+func (s Snapshot) FindVolume(podUID, pvName string) (Mount, State, error) {
+	suffix := VolumeMountPath(podUID, pvName)
+	for _, m := range s.Mounts {
+		if !strings.HasPrefix(m.FSType, "nfs") || !strings.HasSuffix(m.Target, suffix) {
+			continue
+		}
+		// efs-utils names state files <fs-id>.<mount point with / as .>.<port>.
+		name := "." + strings.TrimPrefix(strings.ReplaceAll(m.Target, "/", "."), ".") + "." + m.Options["port"]
+		for _, st := range s.States {
+			if strings.HasPrefix(st.File, "fs-") && strings.HasSuffix(st.File, name) {
+				return m, st, nil
+			}
+		}
+		return m, State{}, fmt.Errorf("no efs-utils state file for mount %s (port %s)", m.Target, m.Options["port"])
+	}
+	return Mount{}, State{}, fmt.Errorf("no NFS mount ending in %s", suffix)
+}
+
+// unescapeMountPath undoes the octal escaping /proc/mounts applies to
+// spaces, tabs, newlines and backslashes.
+func unescapeMountPath(p string) string {
+	r := strings.NewReplacer(`\040`, " ", `\011`, "\t", `\012`, "\n", `\134`, `\`)
+	return r.Replace(p)
+}
@@ -0,0 +1,73 @@
+package efsmount
+
+import "testing"
+
+const (
+	podUID = "0b1c2d3e-aaaa-bbbb-cccc-123456789abc"
+	pvName = "pvc-7f3d"
+)
+
+const snapshotSample = `overlay / overlay rw,relatime 0 0
+127.0.0.1:/ /var/lib/kubelet/pods/` + podUID + `/volumes/kubernetes.io~csi/` + pvName + `/mount nfs4 rw,relatime,vers=4.1,rsize=1048576,port=20049,addr=127.0.0.1 0 0
+127.0.0.1:/ /var/lib/kubelet/pods/other/volumes/kubernetes.io~csi/pvc-other/mount nfs4 rw,relatime,vers=4.1,port=20050,addr=127.0.0.1 0 0
+--- efs-state ---
+fs-0123.var.lib.kubelet.pods.` + podUID + `.volumes.kubernetes.io~csi.` + pvName + `.mount.20049 {"pid": 42, "cmd": ["/usr/bin/efs-proxy", "/var/run/efs/stunnel-config.fs-0123", "--tls"], "fsId": "fs-0123", "accessPoint": "fsap-0abc", "awsCredentialsMethod": "metadata"}
+fs-0123.var.lib.kubelet.pods.other.volumes.kubernetes.io~csi.pvc-other.mount.20050 {"pid": 43, "cmd": ["/usr/bin/efs-proxy", "/var/run/efs/stunnel-config.fs-0123"], "fsId": "fs-0123"}
+fs-0123.broken.20051 {"pid":
+`
+
+func TestFindVolume(t *testing.T) {
+	snap, err := ParseSnapshot(snapshotSample)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snap.Mounts) != 3 || len(snap.States) != 2 {
+		t.Fatalf("parsed %d mounts and %d states, want 3 and 2", len(snap.Mounts), len(snap.States))
+	}
+
+	m, st, err := snap.FindVolume(podUID, pvName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Source != "127.0.0.1:/" || m.Options["port"] != "20049" {
+		t.Errorf("unexpected mount %+v", m)
+	}
+	if !st.TLS() || !st.IAM() || st.AccessPoint != "fsap-0abc" {
+		t.Errorf("unexpected state %+v", st)
+	}
+
+	_, other, err := snap.FindVolume("other", "pvc-other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.TLS() || other.IAM() {
+		t.Errorf("plain efs-proxy mount reported as TLS or IAM: %+v", other)
+	}
+
+	if _, _, err := snap.FindVolume("missing", pvName); err == nil {
+		t.Error("expected an error for a volume that is not mounted")
+	}
+}
+
+func TestStateTLS(t *testing.T) {
+	cases := []struct {
+		cmd  []string
+		want bool
+	}{
+		{[]string{"/usr/bin/stunnel5", "/var/run/efs/stunnel-config.fs-0123"}, true},
+		{[]string{"/usr/bin/efs-proxy", "/var/run/efs/stunnel-config.fs-0123", "--tls"}, true},
+		{[]string{"/usr/bin/efs-proxy", "/var/run/efs/stunnel-config.fs-0123"}, false},
+		{nil, false},
+	}
+	for _, c := range cases {
+		if got := (State{Cmd: c.cmd}).TLS(); got != c.want {
+			t.Errorf("TLS() for %v = %v, want %v", c.cmd, got, c.want)
+		}
+	}
+}
+
+func TestParseSnapshotWithoutMarker(t *testing.T) {
+	if _, err := ParseSnapshot("sh: cat: not found"); err == nil {
+		t.Error("expected an error when the state separator is missing")
+	}
+}
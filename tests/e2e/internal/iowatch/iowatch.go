@@ -0,0 +1,91 @@
+// Package iowatch measures how an application experiences a volume while
+// the driver underneath it is disrupted. A heartbeat loop in the test pod
+// appends a timestamp to a file on the volume every second; afterwards the
+// file shows every window in which writes stalled, and the pod log every
+// write that failed outright.
+package iowatch
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// IOErrorTag prefixes the log line the heartbeat loop prints for a failed write.
+const IOErrorTag = "IOERROR"
+
+// HeartbeatScript returns a shell loop that appends the current Unix time to
+// file every second and logs failed writes. It runs until the pod is deleted.
+func HeartbeatScript(file string) string {
+	return fmt.Sprintf(`while :; do
+  now=$(date +%%s)
+  echo $now >> %[1]s || echo "%[2]s $now: write to %[1]s failed"
+  sleep 1
+done`, file, IOErrorTag)
+}
+
+// Gap is a period in which no heartbeat reached the volume.
+type Gap struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+}
+
+// Duration returns the length of the gap.
+func (g Gap) Duration() time.Duration {
+	return g.To.Sub(g.From)
+}
+
+func (g Gap) String() string {
+	return fmt.Sprintf("%s from %s", g.Duration(), g.From.UTC().Format(time.RFC3339))
+}
+
+// ParseHeartbeats parses the heartbeat file. Lines that are not a timestamp
+// (e.g. a line torn by a remount) are skipped.
+func ParseHeartbeats(content string) []time.Time {
+	var beats []time.Time
+	for _, line := range strings.Split(content, "\n") {
+		sec, err := strconv.ParseInt(strings.TrimSpace(line), 10, 64)
+		if err != nil {
+			continue
+		}
+		beats = append(beats, time.Unix(sec, 0))
+	}
+	sort.Slice(beats, func(i, j int) bool { return beats[i].Before(beats[j]) })
+	return beats
+}
+
+// FindGaps returns every gap between consecutive heartbeats longer than window.
+func FindGaps(beats []time.Time, window time.Duration) []Gap {
+	var gaps []Gap
+	for i := 1; i < len(beats); i++ {
+		if beats[i].Sub(beats[i-1]) > window {
+			gaps = append(gaps, Gap{From: beats[i-1], To: beats[i]})
+		}
+	}
+	return gaps
+}
+
+// LongestGap returns the longest gap between consecutive heartbeats, or a
+// zero Gap when there are fewer than two.
+func LongestGap(beats []time.Time) Gap {
+	var longest Gap
+	for _, g := range FindGaps(beats, 0) {
+		if g.Duration() > longest.Duration() {
+			longest = g
+		}
+	}
+	return longest
+}
+
+// IOErrors returns the failed writes reported in a heartbeat pod's log.
+func IOErrors(logs string) []string {
+	var errs []string
+	for _, line := range strings.Split(logs, "\n") {
+		if strings.HasPrefix(line, IOErrorTag) {
+			errs = append(errs, line)
+		}
+	}
+	return errs
+}
@@ -0,0 +1,35 @@
+package iowatch
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFindGaps(t *testing.T) {
+	// 12 is torn and 40 arrives out of order, e.g. after a remount.
+	beats := ParseHeartbeats("10\n11\n1\x002\n13\n40\n14\n15\n")
+	if len(beats) != 6 {
+		t.Fatalf("parsed %d heartbeats, want 6", len(beats))
+	}
+
+	gaps := FindGaps(beats, 5*time.Second)
+	if len(gaps) != 1 {
+		t.Fatalf("got gaps %v, want exactly one", gaps)
+	}
+	if gaps[0].From.Unix() != 15 || gaps[0].Duration() != 25*time.Second {
+		t.Errorf("unexpected gap %s", gaps[0])
+	}
+	if got := LongestGap(beats); got != gaps[0] {
+		t.Errorf("LongestGap = %s, want %s", got, gaps[0])
+	}
+	if got := LongestGap(nil); got.Duration() != 0 {
+		t.Errorf("LongestGap(nil) = %s", got)
+	}
+}
+
+func TestIOErrors(t *testing.T) {
+	logs := "starting\nIOERROR 100: write to /data/heartbeat failed\nsh: can't create /data/heartbeat: I/O error\n"
+	if errs := IOErrors(logs); len(errs) != 1 {
+		t.Errorf("IOErrors = %v, want one entry", errs)
+	}
+}
@@ -0,0 +1,161 @@
+package kyverno
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// SourceFile names the file next to vendored policies that records where
+// and at which version they were taken from.
+const SourceFile = "SOURCE"
+
+// Result is one policy rule evaluated against one resource by the kyverno
+// CLI.
+type Result struct {
+	Policy string
+	Rule   string
+	// Result is pass, fail, warn, error or skip.
+	Result    string
+	Message   string
+	Kind      string
+	Namespace string
+	Name      string
+}
+
+func (r Result) String() string {
+	return fmt.Sprintf("%s/%s on %s %s/%s: %s %s", r.Policy, r.Rule, r.Kind, r.Namespace, r.Name, r.Result, r.Message)
+}
+
+// Blocking reports whether the result denies admission under an enforced
+// policy.
+func (r Result) Blocking() bool {
+	return r.Result == "fail" || r.Result == "error"
+}
+
+type policyReport struct {
+	Results []struct {
+		Policy    string `json:"policy"`
+		Rule      string `json:"rule"`
+		Result    string `json:"result"`
+		Message   string `json:"message"`
+		Resources []struct {
+			Kind      string `json:"kind"`
+			Namespace string `json:"namespace"`
+			Name      string `json:"name"`
+		} `json:"resources"`
+	} `json:"results"`
+}
+
+// Source returns the contents of the SourceFile in dir, or an error if the
+// policies there were not vendored.
+func Source(dir string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(dir, SourceFile)) // #nosec G304
+	if err != nil {
+		return "", fmt.Errorf("%s has no vendored policies: %w", dir, err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// Apply runs `kyverno apply` with the policies in dir against resources,
+// honouring exceptions, and returns the results of its policy report.
+// Resources and exceptions are YAML documents. Like admission, Kyverno
+// evaluates pod controllers under the autogen rules.
+func Apply(ctx context.Context, binary, dir string, resources, exceptions [][]byte) ([]Result, error) {
+	policies, err := policyDocuments(dir)
+	if err != nil {
+		return nil, err
+	}
+	tmp, err := os.MkdirTemp("", "kyverno-apply-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+
+	files := map[string][][]byte{"policies.yaml": policies, "resources.yaml": resources, "exceptions.yaml": exceptions}
+	for name, docs := range files {
+		if err := os.WriteFile(filepath.Join(tmp, name), bytes.Join(docs, []byte("\n---\n")), 0o600); err != nil {
+			return nil, err
+		}
+	}
+	args := []string{"apply", filepath.Join(tmp, "policies.yaml"), "--resource", filepath.Join(tmp, "resources.yaml"), "--policy-report"}
+	if len(exceptions) > 0 {
+		args = append(args, "--exception", filepath.Join(tmp, "exceptions.yaml"))
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, binary, args...) // #nosec G204
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	// kyverno apply exits non-zero when a rule fails, which the report
+	// already says, so only a missing report is an error.
+	runErr := cmd.Run()
+	results, err := parseReport(stdout.String())
+	if err != nil {
+		return nil, fmt.Errorf("kyverno apply: %w (exit: %v, stderr: %s)", err, runErr, strings.TrimSpace(stderr.String()))
+	}
+	return results, nil
+}
+
+// parseReport reads the policy report kyverno apply --policy-report prints
+// after its summary.
+func parseReport(out string) ([]Result, error) {
+	i := strings.Index(out, "apiVersion:")
+	if i < 0 {
+		return nil, fmt.Errorf("no policy report in output: %q", out)
+	}
+	var results []Result
+	for _, doc := range strings.Split(out[i:], "\n---") {
+		var r policyReport
+		if err := yaml.Unmarshal([]byte(doc), &r); err != nil {
+			return nil, fmt.Errorf("parsing policy report: %w", err)
+		}
+		for _, res := range r.Results {
+			for _, obj := range res.Resources {
+				results = append(results, Result{
+					Policy:    res.Policy,
+					Rule:      res.Rule,
+					Result:    res.Result,
+					Message:   res.Message,
+					Kind:      obj.Kind,
+					Namespace: obj.Namespace,
+					Name:      obj.Name,
+				})
+			}
+		}
+	}
+	return results, nil
+}
+
+// policyDocuments returns the ClusterPolicy and Policy documents of the
+// YAML files in dir, leaving out whatever else a rendered chart holds.
+func policyDocuments(dir string) ([][]byte, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.yaml"))
+	if err != nil {
+		return nil, err
+	}
+	var docs [][]byte
+	for _, file := range files {
+		data, err := os.ReadFile(file) // #nosec G304
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", file, err)
+		}
+		for _, doc := range strings.Split(string(data), "\n---") {
+			var d policyDoc
+			if err := yaml.Unmarshal([]byte(doc), &d); err != nil {
+				return nil, fmt.Errorf("parsing %s: %w", file, err)
+			}
+			if d.Kind == "ClusterPolicy" || d.Kind == "Policy" {
+				docs = append(docs, []byte(doc))
+			}
+		}
+	}
+	if len(docs) == 0 {
+		return nil, fmt.Errorf("no policies in %s", dir)
+	}
+	return docs, nil
+}
@@ -0,0 +1,241 @@
+package kyverno
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+const autogenAnnotation = "pod-policies.kyverno.io/autogen-controllers"
+
+// defaultAutogenControllers are the pod controllers Kyverno generates rules
+// for when a policy does not restrict them.
+var defaultAutogenControllers = []string{"DaemonSet", "Deployment", "Job", "StatefulSet", "ReplicaSet", "ReplicationController", "CronJob"}
+
+// Rule is a policy rule and the kinds it matches.
+type Rule struct {
+	Name  string
+	Kinds []string
+}
+
+// Policy is the part of a Kyverno (Cluster)Policy needed to tell which
+// rules apply to a resource.
+type Policy struct {
+	Name string
+	// Action is the validationFailureAction, Audit or Enforce.
+	Action string
+	// AutogenControllers is the autogen annotation, empty for the default.
+	AutogenControllers string
+	Rules              []Rule
+}
+
+type policyDoc struct {
+	Kind     string            `json:"kind"`
+	Metadata metav1.ObjectMeta `json:"metadata"`
+	Spec     struct {
+		ValidationFailureAction string `json:"validationFailureAction"`
+		Rules                   []struct {
+			Name  string `json:"name"`
+			Match Match  `json:"match"`
+		} `json:"rules"`
+	} `json:"spec"`
+}
+
+// LoadPolicies reads every ClusterPolicy and Policy from the YAML files in dir.
+func LoadPolicies(dir string) ([]Policy, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.yaml"))
+	if err != nil {
+		return nil, err
+	}
+	var policies []Policy
+	for _, file := range files {
+		data, err := os.ReadFile(file) // #nosec G304
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", file, err)
+		}
+		for _, doc := range strings.Split(string(data), "\n---") {
+			var d policyDoc
+			if err := yaml.Unmarshal([]byte(doc), &d); err != nil {
+				return nil, fmt.Errorf("parsing %s: %w", file, err)
+			}
+			if d.Kind != "ClusterPolicy" && d.Kind != "Policy" {
+				continue
+			}
+			p := Policy{
+				Name:               d.Metadata.Name,
+				Action:             d.Spec.ValidationFailureAction,
+				AutogenControllers: d.Metadata.Annotations[autogenAnnotation],
+			}
+			for _, r := range d.Spec.Rules {
+				rule := Rule{Name: r.Name}
+				for _, f := range append(r.Match.Any, r.Match.All...) {
+					rule.Kinds = append(rule.Kinds, f.Resources.Kinds...)
+				}
+				p.Rules = append(p.Rules, rule)
+			}
+			policies = append(policies, p)
+		}
+	}
+	return policies, nil
+}
+
+// Enforced reports whether violations of the policy block admission.
+func (p Policy) Enforced() bool {
+	return strings.EqualFold(p.Action, "Enforce")
+}
+
+// RuleName returns the name under which Kyverno evaluates rule for a
+// resource of the given kind: the rule itself for Pods, its autogen
+// variant for pod controllers, or "" if the rule does not apply.
+func (p Policy) RuleName(rule Rule, kind string) string {
+	if slices.Contains(rule.Kinds, kind) {
+		return rule.Name
+	}
+	if !slices.Contains(rule.Kinds, "Pod") || !slices.Contains(p.autogenControllers(), kind) {
+		return ""
+	}
+	if kind == "CronJob" {
+		return "autogen-cronjob-" + rule.Name
+	}
+	return "autogen-" + rule.Name
+}
+
+// RuleNames returns every rule name the policy can be evaluated under,
+// including autogen variants.
+func (p Policy) RuleNames() []string {
+	seen := map[string]bool{}
+	for _, r := range p.Rules {
+		for _, kind := range append([]string{"Pod"}, p.autogenControllers()...) {
+			if name := p.RuleName(r, kind); name != "" {
+				seen[name] = true
+			}
+		}
+	}
+	names := make([]string, 0, len(seen))
+	for n := range seen {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (p Policy) autogenControllers() []string {
+	switch p.AutogenControllers {
+	case "":
+		return defaultAutogenControllers
+	case "none":
+		return nil
+	}
+	return strings.Split(p.AutogenControllers, ",")
+}
+
+// Match selects the resources a rule or exception applies to.
+type Match struct {
+	Any []ResourceFilter `json:"any,omitempty"`
+	All []ResourceFilter `json:"all,omitempty"`
+}
+
+// ResourceFilter is one entry of a Match.
+type ResourceFilter struct {
+	Resources ResourceDescription `json:"resources"`
+}
+
+// ResourceDescription matches resources by kind, namespace and name.
+// Names and namespaces may use * and ? wildcards.
+type ResourceDescription struct {
+	Kinds      []string `json:"kinds,omitempty"`
+	Namespaces []string `json:"namespaces,omitempty"`
+	Names      []string `json:"names,omitempty"`
+}
+
+func (d ResourceDescription) matches(kind, namespace, name string) bool {
+	return slices.Contains(d.Kinds, kind) && matchesAny(d.Namespaces, namespace) && matchesAny(d.Names, name)
+}
+
+// matchesAny is true for an empty pattern list, like Kyverno.
+func matchesAny(patterns []string, s string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, s); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Exception lists the rules of one policy a PolicyException skips.
+type Exception struct {
+	PolicyName string   `json:"policyName"`
+	RuleNames  []string `json:"ruleNames"`
+}
+
+// PolicyException is a kyverno.io/v2 PolicyException.
+type PolicyException struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              struct {
+		Exceptions []Exception `json:"exceptions"`
+		Match      Match       `json:"match"`
+	} `json:"spec"`
+}
+
+// Matches reports whether the exception applies to the resource.
+func (e PolicyException) Matches(kind, namespace, name string) bool {
+	for _, f := range e.Spec.Match.Any {
+		if f.Resources.matches(kind, namespace, name) {
+			return true
+		}
+	}
+	if len(e.Spec.Match.All) == 0 {
+		return false
+	}
+	for _, f := range e.Spec.Match.All {
+		if !f.Resources.matches(kind, namespace, name) {
+			return false
+		}
+	}
+	return true
+}
+
+// Excepts reports whether the exception lists the policy rule.
+func (e PolicyException) Excepts(policy, rule string) bool {
+	for _, ex := range e.Spec.Exceptions {
+		if ex.PolicyName == policy && slices.Contains(ex.RuleNames, rule) {
+			return true
+		}
+	}
+	return false
+}
+
+// UnknownReferences returns the policies and rules the exception names
+// that do not exist in policies. Such entries silently stop matching.
+func UnknownReferences(e PolicyException, policies []Policy) []string {
+	byName := map[string]Policy{}
+	for _, p := range policies {
+		byName[p.Name] = p
+	}
+	var unknown []string
+	for _, ex := range e.Spec.Exceptions {
+		p, ok := byName[ex.PolicyName]
+		if !ok {
+			unknown = append(unknown, fmt.Sprintf("policy %s", ex.PolicyName))
+			continue
+		}
+		known := p.RuleNames()
+		for _, r := range ex.RuleNames {
+			if !slices.Contains(known, r) {
+				unknown = append(unknown, fmt.Sprintf("rule %s/%s", ex.PolicyName, r))
+			}
+		}
+	}
+	return unknown
+}
@@ -0,0 +1,151 @@
+package kyverno
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+const fixtures = "testdata/fixtures"
+
+func loadFixtures(t *testing.T) []Policy {
+	t.Helper()
+	policies, err := LoadPolicies(fixtures)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(policies) == 0 {
+		t.Fatalf("no policies in %s", fixtures)
+	}
+	return policies
+}
+
+func TestRuleNames(t *testing.T) {
+	rule := Rule{Name: "host-path", Kinds: []string{"Pod"}}
+	p := Policy{Name: "disallow-host-path", Rules: []Rule{rule}}
+
+	for kind, want := range map[string]string{
+		"Pod":        "host-path",
+		"DaemonSet":  "autogen-host-path",
+		"Deployment": "autogen-host-path",
+		"CronJob":    "autogen-cronjob-host-path",
+		"Service":    "",
+	} {
+		if got := p.RuleName(rule, kind); got != want {
+			t.Errorf("RuleName(%s) = %q, want %q", kind, got, want)
+		}
+	}
+	if got := p.RuleNames(); !slices.Equal(got, []string{"autogen-cronjob-host-path", "autogen-host-path", "host-path"}) {
+		t.Errorf("RuleNames() = %v", got)
+	}
+
+	p.AutogenControllers = "none"
+	if got := p.RuleName(rule, "DaemonSet"); got != "" {
+		t.Errorf("RuleName(DaemonSet) with autogen disabled = %q", got)
+	}
+	p.AutogenControllers = "Deployment"
+	if p.RuleName(rule, "DaemonSet") != "" || p.RuleName(rule, "Deployment") != "autogen-host-path" {
+		t.Error("autogen annotation not honoured")
+	}
+}
+
+func TestUnknownReferences(t *testing.T) {
+	var e PolicyException
+	e.Spec.Exceptions = []Exception{
+		{PolicyName: "disallow-host-path", RuleNames: []string{"host-path", "autogen-host-path"}},
+		{PolicyName: "disallow-host-namespaces", RuleNames: []string{"host-namespace"}},
+		{PolicyName: "restrict-volumes", RuleNames: []string{"restricted-volumes"}},
+	}
+	got := UnknownReferences(e, loadFixtures(t))
+	want := []string{"rule disallow-host-namespaces/host-namespace", "policy restrict-volumes"}
+	if !slices.Equal(got, want) {
+		t.Errorf("UnknownReferences() = %v, want %v", got, want)
+	}
+}
+
+func TestExceptionMatches(t *testing.T) {
+	var e PolicyException
+	e.Spec.Match.Any = []ResourceFilter{{Resources: ResourceDescription{
+		Kinds:      []string{"DaemonSet", "Pod"},
+		Namespaces: []string{"kube-system"},
+		Names:      []string{"efs-csi-node*"},
+	}}}
+
+	for _, tt := range []struct {
+		kind, namespace, name string
+		want                  bool
+	}{
+		{"DaemonSet", "kube-system", "efs-csi-node", true},
+		{"Pod", "kube-system", "efs-csi-node-x7k2p", true},
+		{"Deployment", "kube-system", "efs-csi-node", false},
+		{"Pod", "default", "efs-csi-node-x7k2p", false},
+		{"Pod", "kube-system", "efs-csi-controller-5d9f-abc", false},
+	} {
+		if got := e.Matches(tt.kind, tt.namespace, tt.name); got != tt.want {
+			t.Errorf("Matches(%s, %s, %s) = %v, want %v", tt.kind, tt.namespace, tt.name, got, tt.want)
+		}
+	}
+}
+
+// fakeKyverno writes a kyverno stand-in that checks its arguments, prints a
+// summary and the report, and exits 1 like kyverno apply on a failed rule.
+func fakeKyverno(t *testing.T, report string) string {
+	t.Helper()
+	bin := filepath.Join(t.TempDir(), "kyverno")
+	script := `#!/bin/sh
+[ "$1" = apply ] || { echo "unexpected command $1" >&2; exit 2; }
+case "$*" in *"--exception "*) ;; *) echo "no --exception" >&2; exit 2 ;; esac
+grep -q "kind: ClusterPolicy" "$2" || { echo "no policies in $2" >&2; exit 2; }
+echo "Applying 2 policy rule(s) to 1 resource(s) with 1 exception(s)..."
+cat <<'REPORT'
+` + report + `
+REPORT
+exit 1
+`
+	if err := os.WriteFile(bin, []byte(script), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	return bin
+}
+
+func TestApply(t *testing.T) {
+	bin := fakeKyverno(t, `apiVersion: wgpolicyk8s.io/v1alpha2
+kind: ClusterPolicyReport
+results:
+- policy: disallow-host-path
+  rule: autogen-host-path
+  result: fail
+  message: HostPath volumes are forbidden.
+  resources:
+  - kind: DaemonSet
+    namespace: kube-system
+    name: efs-csi-node
+- policy: disallow-host-namespaces
+  rule: autogen-host-namespaces
+  result: skip
+  resources:
+  - kind: DaemonSet
+    namespace: kube-system
+    name: efs-csi-node`)
+
+	results, err := Apply(context.Background(), bin, fixtures, [][]byte{[]byte("kind: DaemonSet")}, [][]byte{[]byte("kind: PolicyException")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var blocking []string
+	for _, r := range results {
+		if r.Blocking() {
+			blocking = append(blocking, r.Policy+"/"+r.Rule+" "+r.Kind+" "+r.Name)
+		}
+	}
+	if len(results) != 2 || !slices.Equal(blocking, []string{"disallow-host-path/autogen-host-path DaemonSet efs-csi-node"}) {
+		t.Errorf("results = %v", results)
+	}
+
+	if _, err := Apply(context.Background(), fakeKyverno(t, "Error: no resources"), fixtures, nil, [][]byte{[]byte("kind: PolicyException")}); err == nil || !strings.Contains(err.Error(), "no policy report") {
+		t.Errorf("Apply without a report: err = %v", err)
+	}
+}
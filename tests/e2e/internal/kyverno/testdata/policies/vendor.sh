@@ -0,0 +1,13 @@
+#!/bin/sh
+# Vendors the ClusterPolicies of the Giant Swarm kyverno-policies chart,
+# rendered unmodified, at the given chart version, and records the source in
+# SOURCE.
+set -eu
+
+version=${1:?usage: vendor.sh <kyverno-policies chart version>}
+repo=${KYVERNO_POLICIES_REPO:-https://giantswarm.github.io/giantswarm-catalog/}
+dir=$(dirname "$0")
+
+helm template kyverno-policies kyverno-policies --repo "$repo" --version "$version" >"$dir/kyverno-policies.yaml.tmp"
+mv "$dir/kyverno-policies.yaml.tmp" "$dir/kyverno-policies.yaml"
+echo "$repo kyverno-policies $version" >"$dir/SOURCE"
@@ -0,0 +1,160 @@
+package scale
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"e2e/internal/efsapi"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// LocalControllerOptions say which driver binary LocalController runs and
+// which endpoints stand in for AWS.
+type LocalControllerOptions struct {
+	// Binary is the efs-plugin binary of the driver under test.
+	Binary string
+	// Args are added to --endpoint, e.g. --v=5.
+	Args []string
+	// EFSEndpoint is the EFS API the driver calls, e.g. an efsapi.Server.
+	EFSEndpoint string
+	// MetadataEndpoint is the instance metadata service the driver reads
+	// its region and zone from, e.g. an efsapi.MetadataServer.
+	MetadataEndpoint string
+	Region           string
+	FileSystemID     string
+	// Output receives the driver's stdout and stderr.
+	Output io.Writer
+}
+
+// LocalController runs the driver's efs-plugin outside a cluster with its
+// AWS endpoints overridden, and provisions volumes through its CSI
+// controller service the way csi-provisioner does. Throttling, retries and
+// GID allocation are therefore the driver's own.
+type LocalController struct {
+	opts       LocalControllerOptions
+	cmd        *exec.Cmd
+	exited     chan error
+	dir        string
+	conn       *grpc.ClientConn
+	controller csi.ControllerClient
+}
+
+// StartLocalController starts the driver and waits until its CSI endpoint
+// answers Probe. Close stops it.
+func StartLocalController(ctx context.Context, opts LocalControllerOptions) (*LocalController, error) {
+	dir, err := os.MkdirTemp("", "efs-plugin-")
+	if err != nil {
+		return nil, err
+	}
+	socket := filepath.Join(dir, "csi.sock")
+
+	cmd := exec.Command(opts.Binary, append([]string{"--endpoint=unix://" + socket}, opts.Args...)...) // #nosec G204
+	cmd.Env = append(os.Environ(),
+		"AWS_ENDPOINT_URL_EFS="+opts.EFSEndpoint,
+		"AWS_EC2_METADATA_SERVICE_ENDPOINT="+opts.MetadataEndpoint,
+		"AWS_REGION="+opts.Region,
+		"AWS_ACCESS_KEY_ID=local",
+		"AWS_SECRET_ACCESS_KEY=local",
+		"CSI_NODE_NAME=local",
+	)
+	cmd.Stdout, cmd.Stderr = opts.Output, opts.Output
+	if err := cmd.Start(); err != nil {
+		_ = os.RemoveAll(dir)
+		return nil, fmt.Errorf("starting %s: %w", opts.Binary, err)
+	}
+	c := &LocalController{opts: opts, cmd: cmd, exited: make(chan error, 1), dir: dir}
+	go func() { c.exited <- cmd.Wait() }()
+
+	if err := c.connect(ctx, socket); err != nil {
+		_ = c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// connect waits for the driver to listen on socket and answer Probe.
+func (c *LocalController) connect(ctx context.Context, socket string) error {
+	conn, err := grpc.NewClient("unix://"+socket, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return err
+	}
+	c.conn = conn
+	c.controller = csi.NewControllerClient(conn)
+	identity := csi.NewIdentityClient(conn)
+
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	for {
+		probe, err := identity.Probe(ctx, &csi.ProbeRequest{})
+		if err == nil && probe.GetReady().GetValue() {
+			return nil
+		}
+		select {
+		case exitErr := <-c.exited:
+			c.exited <- exitErr
+			return fmt.Errorf("%s exited before it was ready: %v", c.opts.Binary, exitErr)
+		case <-ctx.Done():
+			return fmt.Errorf("waiting for %s to answer Probe: %w", c.opts.Binary, errors.Join(ctx.Err(), err))
+		case <-time.After(200 * time.Millisecond):
+		}
+	}
+}
+
+// Provision creates a volume in efs-ap mode like csi-provisioner does for
+// a PVC and returns its access point ID.
+func (c *LocalController) Provision(ctx context.Context, volumeName string) (string, error) {
+	out, err := c.controller.CreateVolume(ctx, &csi.CreateVolumeRequest{
+		Name:          volumeName,
+		CapacityRange: &csi.CapacityRange{RequiredBytes: 5 << 30},
+		VolumeCapabilities: []*csi.VolumeCapability{{
+			AccessType: &csi.VolumeCapability_Mount{Mount: &csi.VolumeCapability_MountVolume{}},
+			AccessMode: &csi.VolumeCapability_AccessMode{Mode: csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER},
+		}},
+		Parameters: map[string]string{
+			"provisioningMode": "efs-ap",
+			"fileSystemId":     c.opts.FileSystemID,
+			"directoryPerms":   "700",
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("creating volume %s: %w", volumeName, err)
+	}
+	_, accessPointID, err := efsapi.ParseVolumeHandle(out.GetVolume().GetVolumeId())
+	if err != nil {
+		return "", fmt.Errorf("volume %s: %w", volumeName, err)
+	}
+	return accessPointID, nil
+}
+
+// Delete deletes the volume of an access point like csi-provisioner does
+// for a released PV.
+func (c *LocalController) Delete(ctx context.Context, accessPointID string) error {
+	volumeID := c.opts.FileSystemID + "::" + accessPointID
+	if _, err := c.controller.DeleteVolume(ctx, &csi.DeleteVolumeRequest{VolumeId: volumeID}); err != nil {
+		return fmt.Errorf("deleting volume %s: %w", volumeID, err)
+	}
+	return nil
+}
+
+// Close stops the driver and removes its socket.
+func (c *LocalController) Close() error {
+	if c.conn != nil {
+		_ = c.conn.Close()
+	}
+	select {
+	case <-c.exited:
+	default:
+		_ = c.cmd.Process.Kill()
+		<-c.exited
+	}
+	return os.RemoveAll(c.dir)
+}
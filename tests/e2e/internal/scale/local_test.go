@@ -0,0 +1,176 @@
+package scale
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"e2e/internal/efsapi"
+)
+
+// TestLocalScale runs the efs-plugin binary at E2E_EFS_PLUGIN_BINARY
+// against the local EFS endpoint and provisions and deletes E2E_SCALE_PVCS
+// volumes through its CSI controller service, so provisioner bottlenecks
+// such as listing every access point per create or retry-quota exhaustion
+// under throttling show up without AWS. E2E_SCALE_LOCAL_RPS and
+// E2E_SCALE_LOCAL_LATENCY emulate the EFS API limits, and
+// E2E_EFS_PLUGIN_ARGS adds flags to the driver. The report is written to
+// $REPORT_DIR/scale-report-local.json when REPORT_DIR is set. Without
+// E2E_EFS_PLUGIN_BINARY the test is skipped.
+func TestLocalScale(t *testing.T) {
+	binary := os.Getenv("E2E_EFS_PLUGIN_BINARY")
+	if binary == "" {
+		t.Skip("set E2E_EFS_PLUGIN_BINARY to an efs-plugin binary to run the local scale test")
+	}
+	n := intFromEnv(t, "E2E_SCALE_PVCS", 200)
+	concurrency := intFromEnv(t, "E2E_SCALE_CONCURRENCY", 20)
+	rps := intFromEnv(t, "E2E_SCALE_LOCAL_RPS", 0)
+	latency := 5 * time.Millisecond
+	if v := os.Getenv("E2E_SCALE_LOCAL_LATENCY"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			t.Fatalf("E2E_SCALE_LOCAL_LATENCY: %v", err)
+		}
+		latency = d
+	}
+
+	const fileSystemID = "fs-0000000000local"
+	fake := efsapi.NewFake()
+	srv := efsapi.NewServer(fake, efsapi.ServerOptions{Latency: latency, RequestsPerSecond: float64(rps)})
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+	imds := httptest.NewServer(efsapi.MetadataServer{InstanceID: "i-0000000000local", Region: "us-east-1", AvailabilityZone: "us-east-1a"})
+	defer imds.Close()
+
+	ctx := context.Background()
+	var driverLog strings.Builder
+	p, err := StartLocalController(ctx, LocalControllerOptions{
+		Binary:           binary,
+		Args:             strings.Fields(os.Getenv("E2E_EFS_PLUGIN_ARGS")),
+		EFSEndpoint:      ts.URL,
+		MetadataEndpoint: imds.URL,
+		Region:           "us-east-1",
+		FileSystemID:     fileSystemID,
+		Output:           &lockedWriter{w: &driverLog},
+	})
+	if err != nil {
+		t.Fatalf("%v\n%s", err, driverLog.String())
+	}
+	defer func() {
+		if err := p.Close(); err != nil {
+			t.Error(err)
+		}
+		if t.Failed() {
+			t.Logf("efs-plugin output:\n%s", driverLog.String())
+		}
+	}()
+
+	var mu sync.Mutex
+	accessPoints := map[int]string{}
+	name := func(i int) string { return fmt.Sprintf("pvc-scale-%04d", i) }
+	samples := Run(ctx, n, concurrency, name, func(ctx context.Context, i int) (time.Duration, error) {
+		start := time.Now()
+		id, err := p.Provision(ctx, name(i))
+		if err == nil {
+			mu.Lock()
+			accessPoints[i] = id
+			mu.Unlock()
+		}
+		return time.Since(start), err
+	})
+
+	report := Report{
+		Mode:        "local",
+		PVCs:        n,
+		Concurrency: concurrency,
+		TimeToBound: Summarize(samples),
+		Samples:     samples,
+	}
+	for _, s := range samples {
+		if IsThrottling(s.Error) {
+			report.Throttling.Add(s.Error)
+		}
+	}
+
+	var ids []string
+	for _, id := range accessPoints {
+		ids = append(ids, id)
+	}
+	Run(ctx, len(ids), concurrency, func(i int) string { return ids[i] }, func(ctx context.Context, i int) (time.Duration, error) {
+		return 0, p.Delete(ctx, ids[i])
+	})
+	leftover, err := fake.ListAccessPoints(ctx, fileSystemID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report.AccessPointsVerified = true
+	report.LeftoverAccessPoints = []string{}
+	for _, ap := range leftover {
+		report.LeftoverAccessPoints = append(report.LeftoverAccessPoints, ap.ID)
+	}
+
+	stats := srv.Stats()
+	report.APICalls = stats.Requests
+	// Server-side counts include throttled requests the SDK retried
+	// successfully, which never surface as errors.
+	report.Throttling.Events = max(report.Throttling.Events, stats.TotalThrottled())
+
+	if dir := os.Getenv("REPORT_DIR"); dir != "" {
+		if err := WriteReport(filepath.Join(dir, "scale-report-local.json"), report); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Logf("time to provision: %+v, throttled: %d, API calls: %v", report.TimeToBound, report.Throttling.Events, report.APICalls)
+
+	if rps == 0 && report.TimeToBound.Failed > 0 {
+		t.Errorf("%d of %d volumes failed to provision without a rate limit", report.TimeToBound.Failed, n)
+	}
+	if len(report.LeftoverAccessPoints) > 0 {
+		t.Errorf("%d access points left after deleting every volume: %v", len(report.LeftoverAccessPoints), report.LeftoverAccessPoints)
+	}
+}
+
+func TestStartLocalControllerReportsExit(t *testing.T) {
+	binary, err := exec.LookPath("false")
+	if err != nil {
+		t.Skip(err)
+	}
+	_, err = StartLocalController(context.Background(), LocalControllerOptions{Binary: binary, Output: io.Discard})
+	if err == nil || !strings.Contains(err.Error(), "exited before it was ready") {
+		t.Errorf("StartLocalController with a driver that exits = %v, want the exit reported", err)
+	}
+}
+
+func intFromEnv(t *testing.T, name string, fallback int) int {
+	t.Helper()
+	v := os.Getenv(name)
+	if v == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		t.Fatalf("%s=%q is not a non-negative integer", name, v)
+	}
+	return n
+}
+
+// lockedWriter serializes the driver's stdout and stderr.
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (l *lockedWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.w.Write(p)
+}
@@ -0,0 +1,156 @@
+package scale
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Sample is how long one volume took to provision, or why it failed.
+type Sample struct {
+	Name    string  `json:"name"`
+	Seconds float64 `json:"seconds"`
+	Error   string  `json:"error,omitempty"`
+}
+
+// Summary holds time-to-bound percentiles over the successful samples.
+type Summary struct {
+	Count  int     `json:"count"`
+	Failed int     `json:"failed"`
+	P50    float64 `json:"p50Seconds"`
+	P90    float64 `json:"p90Seconds"`
+	P99    float64 `json:"p99Seconds"`
+	Max    float64 `json:"maxSeconds"`
+}
+
+// Summarize computes nearest-rank percentiles of the successful samples.
+func Summarize(samples []Sample) Summary {
+	var secs []float64
+	s := Summary{Count: len(samples)}
+	for _, sample := range samples {
+		if sample.Error != "" {
+			s.Failed++
+			continue
+		}
+		secs = append(secs, sample.Seconds)
+	}
+	if len(secs) == 0 {
+		return s
+	}
+	sort.Float64s(secs)
+	s.P50 = percentile(secs, 50)
+	s.P90 = percentile(secs, 90)
+	s.P99 = percentile(secs, 99)
+	s.Max = secs[len(secs)-1]
+	return s
+}
+
+func percentile(sorted []float64, p float64) float64 {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	return sorted[max(rank, 1)-1]
+}
+
+// Throttling records API throttling seen while provisioning.
+type Throttling struct {
+	Events int `json:"events"`
+	// Messages holds distinct throttling messages, at most maxMessages.
+	Messages []string `json:"messages,omitempty"`
+}
+
+const maxMessages = 20
+
+// Add counts a throttling message, keeping distinct ones for the report.
+func (t *Throttling) Add(message string) {
+	t.Events++
+	for _, m := range t.Messages {
+		if m == message {
+			return
+		}
+	}
+	if len(t.Messages) < maxMessages {
+		t.Messages = append(t.Messages, message)
+	}
+}
+
+// throttlingMarkers are what the AWS SDK and the provisioner put into
+// errors and events when EFS rejects calls for exceeding the API rate.
+var throttlingMarkers = []string{
+	"throttlingexception",
+	"rate exceeded",
+	"toomanyrequests",
+	"retry quota exceeded",
+	"requestlimitexceeded",
+}
+
+// IsThrottling reports whether an error message or event is about API
+// throttling.
+func IsThrottling(message string) bool {
+	message = strings.ToLower(message)
+	for _, m := range throttlingMarkers {
+		if strings.Contains(message, m) {
+			return true
+		}
+	}
+	return false
+}
+
+// Report is the machine-readable result of a scale run.
+type Report struct {
+	// Mode is "cluster" for a run against a workload cluster and "local"
+	// for a run against the local EFS endpoint.
+	Mode         string `json:"mode"`
+	ChartVersion string `json:"chartVersion,omitempty"`
+	PVCs         int    `json:"pvcs"`
+	Concurrency  int    `json:"concurrency"`
+
+	TimeToBound Summary    `json:"timeToBound"`
+	Throttling  Throttling `json:"throttling"`
+	// APICalls counts EFS API requests per operation, when known.
+	APICalls map[string]int `json:"apiCalls,omitempty"`
+
+	// AccessPointsVerified is false when the access points could not be
+	// listed after deletion, e.g. without AWS credentials.
+	AccessPointsVerified bool     `json:"accessPointsVerified"`
+	LeftoverAccessPoints []string `json:"leftoverAccessPoints"`
+
+	Samples []Sample `json:"samples"`
+}
+
+// WriteReport writes a report as indented JSON.
+func WriteReport(path string, r Report) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644) // #nosec G306
+}
+
+// Run calls fn for every index below n with at most concurrency calls in
+// flight, and returns one sample per index named by name. The sample holds
+// the duration fn reports, so callers that provision asynchronously can
+// measure up to the bind instead of up to the API call returning.
+func Run(ctx context.Context, n, concurrency int, name func(i int) string, fn func(ctx context.Context, i int) (time.Duration, error)) []Sample {
+	samples := make([]Sample, n)
+	sem := make(chan struct{}, max(concurrency, 1))
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			d, err := fn(ctx, i)
+			samples[i] = Sample{Name: name(i), Seconds: d.Seconds()}
+			if err != nil {
+				samples[i].Error = err.Error()
+			}
+		}(i)
+	}
+	wg.Wait()
+	return samples
+}
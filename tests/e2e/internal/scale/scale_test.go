@@ -0,0 +1,84 @@
+package scale
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSummarize(t *testing.T) {
+	var samples []Sample
+	for i := 1; i <= 100; i++ {
+		samples = append(samples, Sample{Name: fmt.Sprint(i), Seconds: float64(i)})
+	}
+	samples = append(samples, Sample{Name: "failed", Error: "timed out"})
+
+	got := Summarize(samples)
+	want := Summary{Count: 101, Failed: 1, P50: 50, P90: 90, P99: 99, Max: 100}
+	if got != want {
+		t.Errorf("Summarize() = %+v, want %+v", got, want)
+	}
+
+	if got := Summarize([]Sample{{Seconds: 3}}); got.P50 != 3 || got.P99 != 3 || got.Max != 3 {
+		t.Errorf("Summarize() of one sample = %+v", got)
+	}
+	if got := Summarize(nil); got != (Summary{}) {
+		t.Errorf("Summarize(nil) = %+v", got)
+	}
+}
+
+func TestIsThrottling(t *testing.T) {
+	for msg, want := range map[string]bool{
+		"failed to provision volume with StorageClass \"efs\": rpc error: code = Internal desc = Failed to create Access point in File System fs-1 : Failed to create access point: operation error EFS: CreateAccessPoint, exceeded maximum number of attempts, 3, https response error StatusCode: 429, api error ThrottlingException: Rate exceeded": true,
+		"operation error EFS: DescribeAccessPoints, failed to get rate limit token, retry quota exceeded, 0 available, 5 requested": true,
+		"failed to provision volume: Access Denied": false,
+		"waiting for a volume to be created":        false,
+	} {
+		if got := IsThrottling(msg); got != want {
+			t.Errorf("IsThrottling(%q) = %v, want %v", msg, got, want)
+		}
+	}
+}
+
+func TestThrottlingAdd(t *testing.T) {
+	var th Throttling
+	th.Add("Rate exceeded")
+	th.Add("Rate exceeded")
+	th.Add("retry quota exceeded")
+	if th.Events != 3 || len(th.Messages) != 2 {
+		t.Errorf("Throttling = %+v, want 3 events and 2 distinct messages", th)
+	}
+}
+
+func TestRunBoundsConcurrency(t *testing.T) {
+	var inFlight, peak int32
+	samples := Run(context.Background(), 20, 4, func(i int) string { return fmt.Sprintf("pvc-%d", i) },
+		func(_ context.Context, i int) (time.Duration, error) {
+			n := atomic.AddInt32(&inFlight, 1)
+			for {
+				p := atomic.LoadInt32(&peak)
+				if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+					break
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+			atomic.AddInt32(&inFlight, -1)
+			if i == 3 {
+				return 0, errors.New("boom")
+			}
+			return time.Duration(i) * time.Second, nil
+		})
+
+	if peak > 4 {
+		t.Errorf("saw %d calls in flight, want at most 4", peak)
+	}
+	if len(samples) != 20 || samples[7].Name != "pvc-7" || samples[7].Seconds != 7 {
+		t.Errorf("unexpected samples: %+v", samples)
+	}
+	if samples[3].Error != "boom" {
+		t.Errorf("samples[3] = %+v, want the error recorded", samples[3])
+	}
+}
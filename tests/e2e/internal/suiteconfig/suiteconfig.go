@@ -0,0 +1,480 @@
+// Package suiteconfig holds the parameters e2e suites used to hard-code:
+// timeouts, the test image, the namespace, the PVC size, the StorageClass
+// parameters and the RWX, benchmark, resilience and scale settings. They are read from the e2e section of the
+// suite's config.yaml, the file apptest-framework reads, and can be
+// overridden from the environment.
+package suiteconfig
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"e2e/internal/efsinfra"
+	"e2e/internal/testhelpers"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/yaml"
+)
+
+// Config is the e2e section of config.yaml.
+type Config struct {
+	// Namespace is where test PVCs and pods are created.
+	Namespace string `json:"namespace"`
+	// Image runs the test pods. It needs sh and the busybox tools.
+	Image string `json:"image"`
+	// RegistryMirror, e.g. gsoci.azurecr.io/giantswarm, is where test
+	// images are pulled from instead of their own registry.
+	RegistryMirror string `json:"registryMirror"`
+	// ImagePullSecrets name secrets in Namespace for pulling test images.
+	ImagePullSecrets []string `json:"imagePullSecrets"`
+	// PVCSize is the storage request of test PVCs. EFS does not enforce it.
+	PVCSize resource.Quantity `json:"pvcSize"`
+	// StorageClassParameters are added to every StorageClass the suites
+	// create. fileSystemId always comes from the fixture.
+	StorageClassParameters map[string]string `json:"storageClassParameters"`
+	Timeouts               Timeouts          `json:"timeouts"`
+	RWX                    RWX               `json:"rwx"`
+	Benchmark              Benchmark         `json:"benchmark"`
+	Resilience             Resilience        `json:"resilience"`
+	Scale                  Scale             `json:"scale"`
+}
+
+// RWX sizes the RWX consistency check of the basic suite.
+type RWX struct {
+	// PodsPerRole is how many writers and how many readers share the
+	// volume, at most. Every pod runs on a node of its own.
+	PodsPerRole int `json:"podsPerRole"`
+}
+
+// Benchmark configures the fio runs of the benchmark suite.
+type Benchmark struct {
+	// FioImage runs fio. It must be referenced by digest, so that results
+	// are only compared with a baseline taken with the same fio build.
+	FioImage string `json:"fioImage"`
+	// ThroughputModes are benchmarked one after another; the file system
+	// is switched to each in turn.
+	ThroughputModes []string `json:"throughputModes"`
+	// Runtime is how long fio runs each job.
+	Runtime metav1.Duration `json:"runtime"`
+	// Timeout is how long one fio run may take.
+	Timeout metav1.Duration `json:"timeout"`
+}
+
+// Resilience bounds the I/O stalls the resilience suite accepts.
+type Resilience struct {
+	// StallWindow is the longest gap between writes while efs-csi-node is
+	// restarted under a mounted volume.
+	StallWindow metav1.Duration `json:"stallWindow"`
+	// DrainWindow is the longest gap while the workload is evicted,
+	// rescheduled and its volume mounted on another node.
+	DrainWindow metav1.Duration `json:"drainWindow"`
+	// FailoverPVCs is how many PVCs are in flight when the controller
+	// leader is killed.
+	FailoverPVCs int `json:"failoverPVCs"`
+	// FailoverWindow is how long another controller replica may take to
+	// take over the leases.
+	FailoverWindow metav1.Duration `json:"failoverWindow"`
+	// FailoverBindTimeout is how long the PVCs created across the
+	// failover may take to bind.
+	FailoverBindTimeout metav1.Duration `json:"failoverBindTimeout"`
+}
+
+// Scale sizes the PVC burst of the scale suite.
+type Scale struct {
+	// PVCs is how many PVCs the burst creates.
+	PVCs int `json:"pvcs"`
+	// Concurrency is how many of them are created at a time.
+	Concurrency int `json:"concurrency"`
+	// BindTimeout is how long the whole burst may take to bind, and its
+	// PVs to be deleted.
+	BindTimeout metav1.Duration `json:"bindTimeout"`
+}
+
+// Timeouts bound how long the suites wait.
+type Timeouts struct {
+	// HelmRelease is how long the chart under test may take to be ready.
+	HelmRelease metav1.Duration `json:"helmRelease"`
+	// Rollout is how long driver workloads may take to become available,
+	// be replaced, or be removed by an uninstall.
+	Rollout metav1.Duration `json:"rollout"`
+	// Crossplane is how long the bundle's Crossplane IAM Role may take to
+	// be Ready or deleted.
+	Crossplane metav1.Duration `json:"crossplane"`
+	// Pod is how long a test pod may take to run or succeed.
+	Pod metav1.Duration `json:"pod"`
+	// Volume is how long a PVC may take to bind or a PV to be released.
+	Volume metav1.Duration `json:"volume"`
+	// Delete is how long a deleted PVC or PV may take to be gone.
+	Delete metav1.Duration `json:"delete"`
+	// Workload is how long a test workload that does more than a quick
+	// check, such as the RWX consistency pods, may take to complete.
+	Workload metav1.Duration `json:"workload"`
+	// Cleanup is how long one deferred teardown may wait for what it
+	// deletes to be gone.
+	Cleanup metav1.Duration `json:"cleanup"`
+	// Remount is how long I/O on a mounted volume may take to resume once
+	// the driver is back after an uninstall.
+	Remount metav1.Duration `json:"remount"`
+	// Drain is how long draining a node may take.
+	Drain metav1.Duration `json:"drain"`
+	// Probe is how long a connection between pods may take to get through
+	// a NetworkPolicy.
+	Probe metav1.Duration `json:"probe"`
+	// VPARecommendation is how long the VPA recommender may take to
+	// recommend resources for the driver.
+	VPARecommendation metav1.Duration `json:"vpaRecommendation"`
+	// FixtureReady, FixtureAvailable and FixtureDelete bound the waits of
+	// the EFS fixture, see efsinfra.Timeouts.
+	FixtureReady     metav1.Duration `json:"fixtureReady"`
+	FixtureAvailable metav1.Duration `json:"fixtureAvailable"`
+	FixtureDelete    metav1.Duration `json:"fixtureDelete"`
+}
+
+type namedTimeout struct {
+	name string
+	d    *metav1.Duration
+}
+
+// named lists the timeouts by their config.yaml keys.
+func (t *Timeouts) named() []namedTimeout {
+	return []namedTimeout{
+		{"helmRelease", &t.HelmRelease},
+		{"rollout", &t.Rollout},
+		{"crossplane", &t.Crossplane},
+		{"pod", &t.Pod},
+		{"volume", &t.Volume},
+		{"delete", &t.Delete},
+		{"workload", &t.Workload},
+		{"cleanup", &t.Cleanup},
+		{"remount", &t.Remount},
+		{"drain", &t.Drain},
+		{"probe", &t.Probe},
+		{"vpaRecommendation", &t.VPARecommendation},
+		{"fixtureReady", &t.FixtureReady},
+		{"fixtureAvailable", &t.FixtureAvailable},
+		{"fixtureDelete", &t.FixtureDelete},
+	}
+}
+
+// digestImage matches an image referenced by digest, with or without a tag.
+var digestImage = regexp.MustCompile(`^[^\s@]+@sha256:[0-9a-f]{64}$`)
+
+// Default returns the values the suites used before they were configurable.
+func Default() Config {
+	fixture := efsinfra.DefaultTimeouts()
+	return Config{
+		Namespace: "default",
+		Image:     "busybox:1.36",
+		PVCSize:   resource.MustParse("5Gi"),
+		StorageClassParameters: map[string]string{
+			"provisioningMode": "efs-ap",
+			"directoryPerms":   "700",
+		},
+		Timeouts: Timeouts{
+			HelmRelease:       metav1.Duration{Duration: 15 * time.Minute},
+			Rollout:           metav1.Duration{Duration: 10 * time.Minute},
+			Crossplane:        metav1.Duration{Duration: 10 * time.Minute},
+			Pod:               metav1.Duration{Duration: 10 * time.Minute},
+			Volume:            metav1.Duration{Duration: 5 * time.Minute},
+			Delete:            metav1.Duration{Duration: 5 * time.Minute},
+			Workload:          metav1.Duration{Duration: 15 * time.Minute},
+			Cleanup:           metav1.Duration{Duration: 30 * time.Minute},
+			Remount:           metav1.Duration{Duration: 5 * time.Minute},
+			Drain:             metav1.Duration{Duration: 5 * time.Minute},
+			Probe:             metav1.Duration{Duration: time.Minute},
+			VPARecommendation: metav1.Duration{Duration: 10 * time.Minute},
+			FixtureReady:      metav1.Duration{Duration: fixture.Ready},
+			FixtureAvailable:  metav1.Duration{Duration: fixture.Available},
+			FixtureDelete:     metav1.Duration{Duration: fixture.Delete},
+		},
+		Benchmark: Benchmark{
+			ThroughputModes: []string{"bursting", "elastic"},
+			Runtime:         metav1.Duration{Duration: 60 * time.Second},
+			Timeout:         metav1.Duration{Duration: 30 * time.Minute},
+		},
+		Resilience: Resilience{
+			// The new efs-plugin container restarts the TLS proxies from
+			// /var/run/efs, and the NFS client then has to notice the dead
+			// connection (timeo=600) and reconnect, so allow about two NFS
+			// timeouts.
+			StallWindow: metav1.Duration{Duration: 2 * time.Minute},
+			DrainWindow: metav1.Duration{Duration: 5 * time.Minute},
+			// The failover window is the lease duration of csi-provisioner
+			// (15s) plus its retry period, with room for a slow API server.
+			FailoverPVCs:        20,
+			FailoverWindow:      metav1.Duration{Duration: 90 * time.Second},
+			FailoverBindTimeout: metav1.Duration{Duration: 5 * time.Minute},
+		},
+		RWX: RWX{
+			PodsPerRole: 3,
+		},
+		Scale: Scale{
+			PVCs:        100,
+			Concurrency: 20,
+			BindTimeout: metav1.Duration{Duration: 15 * time.Minute},
+		},
+	}
+}
+
+// Load reads the config from $E2E_CONFIG, or from config.yaml in the suite
+// directory or the e2e root like apptest-framework, applies the
+// environment overrides and validates the result. Settings missing from
+// the file keep their defaults, and so does everything without a file.
+func Load() (Config, error) {
+	path := os.Getenv("E2E_CONFIG")
+	if path == "" {
+		for _, p := range []string{"config.yaml", "../../config.yaml"} {
+			if _, err := os.Stat(p); err == nil {
+				path = p
+				break
+			}
+		}
+	}
+
+	cfg := Default()
+	if path != "" {
+		data, err := os.ReadFile(path) // #nosec G304
+		if err != nil {
+			return Config{}, err
+		}
+		if err := cfg.parse(data); err != nil {
+			return Config{}, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	if err := cfg.applyEnv(os.LookupEnv); err != nil {
+		return Config{}, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return Config{}, fmt.Errorf("invalid e2e config: %w", err)
+	}
+	return cfg, nil
+}
+
+// parse overlays the e2e section of a config.yaml, rejecting unknown keys
+// in it. The other keys belong to apptest-framework. StorageClass
+// parameters are merged into the defaults.
+func (c *Config) parse(data []byte) error {
+	var file map[string]interface{}
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return err
+	}
+	section, ok := file["e2e"]
+	if !ok {
+		return nil
+	}
+	raw, err := yaml.Marshal(section)
+	if err != nil {
+		return err
+	}
+	return yaml.UnmarshalStrict(raw, c)
+}
+
+// applyEnv applies the E2E_* overrides.
+func (c *Config) applyEnv(lookup func(string) (string, bool)) error {
+	var errs []error
+	if v, ok := lookup("E2E_NAMESPACE"); ok {
+		c.Namespace = v
+	}
+	if v, ok := lookup("E2E_TEST_IMAGE"); ok {
+		c.Image = v
+	}
+	if v, ok := lookup("E2E_REGISTRY_MIRROR"); ok {
+		c.RegistryMirror = v
+	}
+	if v, ok := lookup("E2E_IMAGE_PULL_SECRETS"); ok {
+		c.ImagePullSecrets = nil
+		for _, name := range strings.Split(v, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				c.ImagePullSecrets = append(c.ImagePullSecrets, name)
+			}
+		}
+	}
+	if v, ok := lookup("E2E_PVC_SIZE"); ok {
+		q, err := resource.ParseQuantity(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("E2E_PVC_SIZE: %w", err))
+		}
+		c.PVCSize = q
+	}
+	if v, ok := lookup("E2E_STORAGECLASS_PARAMETERS"); ok && v != "" {
+		if c.StorageClassParameters == nil {
+			c.StorageClassParameters = map[string]string{}
+		}
+		for _, kv := range strings.Split(v, ",") {
+			key, value, found := strings.Cut(kv, "=")
+			if !found {
+				errs = append(errs, fmt.Errorf("E2E_STORAGECLASS_PARAMETERS: %q is not key=value", kv))
+				continue
+			}
+			c.StorageClassParameters[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
+	}
+	if v, ok := lookup("E2E_FIO_IMAGE"); ok {
+		c.Benchmark.FioImage = v
+	}
+	if v, ok := lookup("E2E_EFS_THROUGHPUT_MODES"); ok {
+		c.Benchmark.ThroughputModes = nil
+		for _, mode := range strings.Split(v, ",") {
+			if mode = strings.TrimSpace(mode); mode != "" {
+				c.Benchmark.ThroughputModes = append(c.Benchmark.ThroughputModes, mode)
+			}
+		}
+	}
+	durations := map[string]*metav1.Duration{
+		"E2E_BENCHMARK_RUNTIME":     &c.Benchmark.Runtime,
+		"E2E_BENCHMARK_TIMEOUT":     &c.Benchmark.Timeout,
+		"E2E_IO_STALL_WINDOW":       &c.Resilience.StallWindow,
+		"E2E_IO_DRAIN_WINDOW":       &c.Resilience.DrainWindow,
+		"E2E_FAILOVER_WINDOW":       &c.Resilience.FailoverWindow,
+		"E2E_FAILOVER_BIND_TIMEOUT": &c.Resilience.FailoverBindTimeout,
+		"E2E_SCALE_BIND_TIMEOUT":    &c.Scale.BindTimeout,
+	}
+	for _, t := range c.Timeouts.named() {
+		durations["E2E_TIMEOUT_"+strings.ToUpper(t.name)] = t.d
+	}
+	for name, d := range durations {
+		if v, ok := lookup(name); ok {
+			parsed, err := time.ParseDuration(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			}
+			d.Duration = parsed
+		}
+	}
+	ints := map[string]*int{
+		"E2E_SCALE_PVCS":        &c.Scale.PVCs,
+		"E2E_SCALE_CONCURRENCY": &c.Scale.Concurrency,
+		"E2E_FAILOVER_PVCS":     &c.Resilience.FailoverPVCs,
+		"E2E_RWX_PODS_PER_ROLE": &c.RWX.PodsPerRole,
+	}
+	for name, n := range ints {
+		if v, ok := lookup(name); ok {
+			parsed, err := strconv.Atoi(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			}
+			*n = parsed
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Validate reports every setting the suites cannot work with.
+func (c Config) Validate() error {
+	var errs []error
+	for _, msg := range validation.IsDNS1123Label(c.Namespace) {
+		errs = append(errs, fmt.Errorf("namespace %q: %s", c.Namespace, msg))
+	}
+	if c.Image == "" {
+		errs = append(errs, errors.New("image is empty"))
+	}
+	if strings.Contains(c.RegistryMirror, "://") || strings.HasSuffix(c.RegistryMirror, "/") {
+		errs = append(errs, fmt.Errorf("registryMirror %q must be a registry and path, without scheme or trailing slash", c.RegistryMirror))
+	}
+	for _, name := range c.ImagePullSecrets {
+		for _, msg := range validation.IsDNS1123Subdomain(name) {
+			errs = append(errs, fmt.Errorf("imagePullSecrets %q: %s", name, msg))
+		}
+	}
+	if c.PVCSize.Sign() <= 0 {
+		errs = append(errs, fmt.Errorf("pvcSize %s is not positive", c.PVCSize.String()))
+	}
+	if _, ok := c.StorageClassParameters["fileSystemId"]; ok {
+		errs = append(errs, errors.New("storageClassParameters: fileSystemId is set by the suites"))
+	}
+	if perms, ok := c.StorageClassParameters["directoryPerms"]; ok {
+		if _, err := strconv.ParseUint(perms, 8, 12); err != nil {
+			errs = append(errs, fmt.Errorf("storageClassParameters: directoryPerms %q is not an octal mode", perms))
+		}
+	}
+	for _, t := range c.Timeouts.named() {
+		if t.d.Duration <= 0 {
+			errs = append(errs, fmt.Errorf("timeouts.%s %s is not positive", t.name, t.d.Duration))
+		}
+	}
+	if c.Benchmark.FioImage != "" && !digestImage.MatchString(c.Benchmark.FioImage) {
+		errs = append(errs, fmt.Errorf("benchmark.fioImage %q is not referenced by digest, e.g. gsoci.azurecr.io/giantswarm/fio@sha256:<digest>", c.Benchmark.FioImage))
+	}
+	if len(c.Benchmark.ThroughputModes) == 0 {
+		errs = append(errs, errors.New("benchmark.throughputModes is empty"))
+	}
+	for i, mode := range c.Benchmark.ThroughputModes {
+		switch {
+		case mode != "bursting" && mode != "elastic":
+			// provisioned needs a throughput and may only be left once a day.
+			errs = append(errs, fmt.Errorf("benchmark.throughputModes: %q is not bursting or elastic", mode))
+		case slices.Contains(c.Benchmark.ThroughputModes[:i], mode):
+			errs = append(errs, fmt.Errorf("benchmark.throughputModes: %q is listed twice", mode))
+		}
+	}
+	positive := []namedTimeout{
+		{"benchmark.runtime", &c.Benchmark.Runtime},
+		{"benchmark.timeout", &c.Benchmark.Timeout},
+		{"resilience.stallWindow", &c.Resilience.StallWindow},
+		{"resilience.drainWindow", &c.Resilience.DrainWindow},
+		{"resilience.failoverWindow", &c.Resilience.FailoverWindow},
+		{"resilience.failoverBindTimeout", &c.Resilience.FailoverBindTimeout},
+		{"scale.bindTimeout", &c.Scale.BindTimeout},
+	}
+	for _, t := range positive {
+		if t.d.Duration <= 0 {
+			errs = append(errs, fmt.Errorf("%s %s is not positive", t.name, t.d.Duration))
+		}
+	}
+	if c.Benchmark.Runtime.Duration >= c.Benchmark.Timeout.Duration {
+		errs = append(errs, fmt.Errorf("benchmark.runtime %s is not below benchmark.timeout %s", c.Benchmark.Runtime.Duration, c.Benchmark.Timeout.Duration))
+	}
+	if c.RWX.PodsPerRole <= 0 {
+		errs = append(errs, fmt.Errorf("rwx.podsPerRole %d is not positive", c.RWX.PodsPerRole))
+	}
+	if c.Resilience.FailoverPVCs < 2 {
+		errs = append(errs, fmt.Errorf("resilience.failoverPVCs %d is below 2, so no PVC is created after the leader is killed", c.Resilience.FailoverPVCs))
+	}
+	if c.Scale.PVCs <= 0 {
+		errs = append(errs, fmt.Errorf("scale.pvcs %d is not positive", c.Scale.PVCs))
+	}
+	if c.Scale.Concurrency <= 0 || c.Scale.Concurrency > c.Scale.PVCs {
+		errs = append(errs, fmt.Errorf("scale.concurrency %d is not between 1 and scale.pvcs", c.Scale.Concurrency))
+	}
+	return errors.Join(errs...)
+}
+
+// PodDefaults returns what testhelpers builds test pods and PVCs from.
+func (c Config) PodDefaults() testhelpers.Defaults {
+	return testhelpers.Defaults{
+		Image:            c.Image,
+		PVCSize:          c.PVCSize,
+		Registry:         c.RegistryMirror,
+		ImagePullSecrets: c.ImagePullSecrets,
+	}
+}
+
+// FixtureTimeouts returns the waits of the EFS fixture.
+func (c Config) FixtureTimeouts() efsinfra.Timeouts {
+	return efsinfra.Timeouts{
+		Ready:     c.Timeouts.FixtureReady.Duration,
+		Available: c.Timeouts.FixtureAvailable.Duration,
+		Delete:    c.Timeouts.FixtureDelete.Duration,
+	}
+}
+
+// ParametersFor returns the configured parameters for a StorageClass on
+// the given file system, with extra parameters on top.
+func (c Config) ParametersFor(fileSystemID string, extra map[string]string) map[string]string {
+	params := map[string]string{"fileSystemId": fileSystemID}
+	for k, v := range c.StorageClassParameters {
+		params[k] = v
+	}
+	for k, v := range extra {
+		params[k] = v
+	}
+	return params
+}
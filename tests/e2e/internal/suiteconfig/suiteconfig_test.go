@@ -0,0 +1,180 @@
+package suiteconfig
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const configYAML = `appName: "aws-efs-csi-driver-bundle"
+repoName: "aws-efs-csi-driver"
+appCatalog: "giantswarm"
+
+providers:
+  - capa
+
+e2e:
+  image: gsoci.azurecr.io/giantswarm/busybox:1.36
+  registryMirror: gsoci.azurecr.io/giantswarm
+  pvcSize: 1Gi
+  storageClassParameters:
+    basePath: /e2e
+  timeouts:
+    helmRelease: 30m
+  benchmark:
+    fioImage: gsoci.azurecr.io/giantswarm/fio:3.38@sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef
+  resilience:
+    stallWindow: 3m
+  scale:
+    pvcs: 500
+`
+
+func writeConfig(t *testing.T, content string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("E2E_CONFIG", path)
+}
+
+func TestLoad(t *testing.T) {
+	writeConfig(t, configYAML)
+	t.Setenv("E2E_NAMESPACE", "efs-e2e")
+	t.Setenv("E2E_TIMEOUT_POD", "20m")
+	t.Setenv("E2E_IMAGE_PULL_SECRETS", "mirror-pull, other-pull")
+	t.Setenv("E2E_STORAGECLASS_PARAMETERS", "directoryPerms=750, gidRangeStart=1000")
+	t.Setenv("E2E_EFS_THROUGHPUT_MODES", "elastic")
+	t.Setenv("E2E_SCALE_CONCURRENCY", "50")
+	t.Setenv("E2E_IO_DRAIN_WINDOW", "10m")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Namespace != "efs-e2e" || cfg.Image != "gsoci.azurecr.io/giantswarm/busybox:1.36" || cfg.PVCSize.String() != "1Gi" {
+		t.Errorf("namespace=%q image=%q pvcSize=%s", cfg.Namespace, cfg.Image, cfg.PVCSize.String())
+	}
+	if d := cfg.PodDefaults(); d.Registry != "gsoci.azurecr.io/giantswarm" || len(d.ImagePullSecrets) != 2 || d.ImagePullSecrets[1] != "other-pull" {
+		t.Errorf("pod defaults = %+v", d)
+	}
+	if cfg.Timeouts.HelmRelease.Duration != 30*time.Minute || cfg.Timeouts.Pod.Duration != 20*time.Minute || cfg.Timeouts.Volume.Duration != 5*time.Minute {
+		t.Errorf("timeouts = %+v, want helmRelease from the file, pod from the environment, volume by default", cfg.Timeouts)
+	}
+	if b := cfg.Benchmark; !strings.HasSuffix(b.FioImage, "@sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef") || len(b.ThroughputModes) != 1 || b.ThroughputModes[0] != "elastic" {
+		t.Errorf("benchmark = %+v, want fioImage from the file and throughput modes from the environment", b)
+	}
+	if r := cfg.Resilience; r.StallWindow.Duration != 3*time.Minute || r.DrainWindow.Duration != 10*time.Minute {
+		t.Errorf("resilience = %+v, want stallWindow from the file and drainWindow from the environment", r)
+	}
+	if sc := cfg.Scale; sc.PVCs != 500 || sc.Concurrency != 50 || sc.BindTimeout.Duration != 15*time.Minute {
+		t.Errorf("scale = %+v, want pvcs from the file, concurrency from the environment and bindTimeout by default", sc)
+	}
+	params := cfg.ParametersFor("fs-1", map[string]string{"uid": "1000"})
+	want := map[string]string{
+		"fileSystemId":     "fs-1",
+		"provisioningMode": "efs-ap",
+		"directoryPerms":   "750",
+		"basePath":         "/e2e",
+		"gidRangeStart":    "1000",
+		"uid":              "1000",
+	}
+	if len(params) != len(want) {
+		t.Errorf("parameters = %v, want %v", params, want)
+	}
+	for k, v := range want {
+		if params[k] != v {
+			t.Errorf("parameter %s = %q, want %q", k, params[k], v)
+		}
+	}
+}
+
+func TestLoadWithoutE2ESection(t *testing.T) {
+	writeConfig(t, "appName: aws-efs-csi-driver-bundle\n")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := Default(); cfg.Image != d.Image || cfg.Timeouts != d.Timeouts || cfg.PVCSize.Cmp(d.PVCSize) != 0 {
+		t.Errorf("Load() = %+v, want the defaults", cfg)
+	}
+}
+
+func TestLoadRejectsInvalidConfig(t *testing.T) {
+	tests := map[string]struct {
+		config string
+		env    map[string]string
+		want   []string
+	}{
+		"unknown key": {
+			config: "e2e:\n  timeout:\n    pod: 1m\n",
+			want:   []string{`unknown field "timeout"`},
+		},
+		"invalid values": {
+			config: "e2e:\n  namespace: Default\n  storageClassParameters:\n    fileSystemId: fs-1\n    directoryPerms: rwx\n",
+			env: map[string]string{
+				"E2E_TIMEOUT_VOLUME":       "0s",
+				"E2E_TEST_IMAGE":           "",
+				"E2E_REGISTRY_MIRROR":      "https://mirror.local/",
+				"E2E_IMAGE_PULL_SECRETS":   "Pull_Secret",
+				"E2E_FIO_IMAGE":            "nixery.dev/shell/fio",
+				"E2E_EFS_THROUGHPUT_MODES": "elastic,provisioned,elastic",
+				"E2E_IO_STALL_WINDOW":      "0s",
+				"E2E_BENCHMARK_RUNTIME":    "1h",
+				"E2E_FAILOVER_PVCS":        "1",
+				"E2E_RWX_PODS_PER_ROLE":    "0",
+				"E2E_SCALE_PVCS":           "10",
+				"E2E_SCALE_CONCURRENCY":    "20",
+			},
+			want: []string{
+				`namespace "Default"`,
+				"image is empty",
+				"fileSystemId is set by the suites",
+				`directoryPerms "rwx" is not an octal mode`,
+				"timeouts.volume 0s is not positive",
+				`registryMirror "https://mirror.local/"`,
+				`imagePullSecrets "Pull_Secret"`,
+				`benchmark.fioImage "nixery.dev/shell/fio" is not referenced by digest`,
+				`"provisioned" is not bursting or elastic`,
+				`"elastic" is listed twice`,
+				"resilience.stallWindow 0s is not positive",
+				"benchmark.runtime 1h0m0s is not below benchmark.timeout 30m0s",
+				"rwx.podsPerRole 0 is not positive",
+				"resilience.failoverPVCs 1 is below 2",
+				"scale.concurrency 20 is not between 1 and scale.pvcs",
+			},
+		},
+		"unparsable environment": {
+			config: "",
+			env: map[string]string{
+				"E2E_PVC_SIZE":                "five",
+				"E2E_TIMEOUT_POD":             "10",
+				"E2E_STORAGECLASS_PARAMETERS": "tls",
+				"E2E_SCALE_PVCS":              "many",
+				"E2E_SCALE_BIND_TIMEOUT":      "soon",
+				"E2E_TIMEOUT_CROSSPLANE":      "long",
+				"E2E_FAILOVER_WINDOW":         "quick",
+			},
+			want: []string{"E2E_PVC_SIZE", "E2E_TIMEOUT_POD", `"tls" is not key=value`, "E2E_SCALE_PVCS", "E2E_SCALE_BIND_TIMEOUT", "E2E_TIMEOUT_CROSSPLANE", "E2E_FAILOVER_WINDOW"},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			writeConfig(t, tt.config)
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			_, err := Load()
+			if err == nil {
+				t.Fatal("Load() succeeded")
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("Load() error %q does not contain %q", err, want)
+				}
+			}
+		})
+	}
+}
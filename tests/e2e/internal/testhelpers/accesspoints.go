@@ -0,0 +1,22 @@
+package testhelpers
+
+import (
+	"context"
+	"fmt"
+
+	"e2e/internal/efsapi"
+
+	. "github.com/onsi/ginkgo/v2"
+)
+
+// AccessPointClient returns an EFS API client for region, or skips the
+// spec when the test runner has no AWS credentials. Specs whose point is
+// what happens to access points call it before creating anything, so they
+// show up as skipped instead of passing on Kubernetes-side evidence alone.
+func AccessPointClient(ctx context.Context, region string) efsapi.Client {
+	c, err := efsapi.NewAWSClient(ctx, region)
+	if err != nil {
+		Skip(fmt.Sprintf("access point checks need AWS credentials for the cluster's account, e.g. from AWS_PROFILE: %v", err))
+	}
+	return c
+}
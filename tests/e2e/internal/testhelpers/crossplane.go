@@ -0,0 +1,51 @@
+package testhelpers
+
+import (
+	"context"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// IAMRoleGVK is the Crossplane IAM Role the bundle chart creates for IRSA.
+var IAMRoleGVK = schema.GroupVersionKind{
+	Group:   "iam.aws.upbound.io",
+	Version: "v1beta1",
+	Kind:    "Role",
+}
+
+// DriverIAMRoleName returns the name of the IAM Role the bundle creates for
+// the controller service account of a cluster.
+func DriverIAMRoleName(clusterName string) string {
+	return clusterName + "-aws-efs-csi-driver-role"
+}
+
+// GetDriverIAMRole fetches the controller's IAM Role from the MC.
+func GetDriverIAMRole(ctx context.Context, mcClient client.Client, clusterName string) (*unstructured.Unstructured, error) {
+	role := &unstructured.Unstructured{}
+	role.SetGroupVersionKind(IAMRoleGVK)
+	err := mcClient.Get(ctx, types.NamespacedName{Name: DriverIAMRoleName(clusterName)}, role)
+	if err != nil {
+		return nil, err
+	}
+	return role, nil
+}
+
+// CrossplaneConditionIsTrue reports whether a Crossplane managed resource
+// has the given condition (e.g. Ready or Synced) set to True.
+func CrossplaneConditionIsTrue(obj *unstructured.Unstructured, conditionType string) bool {
+	conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	for _, c := range conditions {
+		cond, ok := c.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if cond["type"] == conditionType && cond["status"] == string(metav1.ConditionTrue) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,69 @@
+package testhelpers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Delete deletes objects that may not exist and, with wait set, waits up to
+// timeout for each to be gone. It is meant for cleanup.Func teardowns. All
+// deletes are issued before the first wait.
+func Delete(ctx context.Context, c client.Client, wait bool, timeout time.Duration, objs ...client.Object) error {
+	for _, obj := range objs {
+		if err := client.IgnoreNotFound(c.Delete(ctx, obj)); err != nil {
+			return fmt.Errorf("deleting %s: %w", client.ObjectKeyFromObject(obj), err)
+		}
+	}
+	if !wait {
+		return nil
+	}
+	for _, obj := range objs {
+		if err := WaitDeleted(ctx, c, obj, timeout); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WaitDeleted waits up to timeout for obj to be gone.
+func WaitDeleted(ctx context.Context, c client.Client, obj client.Object, timeout time.Duration) error {
+	key := client.ObjectKeyFromObject(obj)
+	err := wait.PollUntilContextTimeout(ctx, 5*time.Second, timeout, true, func(ctx context.Context) (bool, error) {
+		err := c.Get(ctx, key, obj)
+		return apierrors.IsNotFound(err), nil
+	})
+	if err != nil {
+		return fmt.Errorf("waiting for %T %s to be deleted: %w", obj, key, err)
+	}
+	return nil
+}
+
+// DeleteVolume deletes a test volume: the pods using it, its PVC and, if
+// scName is set, its StorageClass. With wait set it waits up to timeout for
+// the PVC to be gone, so the provisioner removes the access point while the
+// driver is still running.
+func DeleteVolume(ctx context.Context, c client.Client, wait bool, timeout time.Duration, namespace, pvcName, scName string, podNames ...string) error {
+	var pods []client.Object
+	for _, name := range podNames {
+		pods = append(pods, &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace}})
+	}
+	if err := Delete(ctx, c, false, 0, pods...); err != nil {
+		return err
+	}
+	pvc := &corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: pvcName, Namespace: namespace}}
+	if err := Delete(ctx, c, wait, timeout, pvc); err != nil {
+		return err
+	}
+	if scName == "" {
+		return nil
+	}
+	return Delete(ctx, c, false, 0, &storagev1.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: scName}})
+}
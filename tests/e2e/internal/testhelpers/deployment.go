@@ -0,0 +1,31 @@
+package testhelpers
+
+import (
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// NewTestDeployment returns a single-replica Deployment whose pods look like
+// NewTestPod's, for workloads that must survive eviction. Pods are labelled
+// app=<name>.
+func NewTestDeployment(name, namespace, pvcName string, command []string, opts ...PodOption) *appsv1.Deployment {
+	labels := map[string]string{"app": name}
+	pod := NewTestPod(name, namespace, pvcName, command, append([]PodOption{WithLabels(labels)}, opts...)...)
+	pod.Spec.RestartPolicy = corev1.RestartPolicyAlways
+
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: ptr(int32(1)),
+			Selector: &metav1.LabelSelector{MatchLabels: labels},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: pod.Labels},
+				Spec:       pod.Spec,
+			},
+		},
+	}
+}
@@ -1,27 +1,116 @@
 package testhelpers
 
 import (
+	"context"
+	"fmt"
+	"strings"
+
 	helmv2 "github.com/fluxcd/helm-controller/api/v2"
-	"github.com/giantswarm/apptest-framework/v2/pkg/state"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
-// HelmReleaseIsReady checks if the EFS CSI driver HelmRelease is ready on the MC.
-func HelmReleaseIsReady(mcClient client.Client, clusterName, orgName string) (bool, error) {
-	hr := &helmv2.HelmRelease{}
-	err := mcClient.Get(state.GetContext(), types.NamespacedName{
+// HelmReleaseStatus is a flattened view of a Flux HelmRelease's status.
+type HelmReleaseStatus struct {
+	Name      string
+	Namespace string
+
+	Ready        bool
+	ReadyMessage string
+
+	// LastAppliedRevision is the Helm release revision of the latest
+	// successful deploy, zero if the chart was never deployed.
+	LastAppliedRevision int
+	// ChartVersion is the chart version of that deploy.
+	ChartVersion string
+	// FirstDeployed is when the chart was first installed, zero if never.
+	FirstDeployed metav1.Time
+	// LastAttemptedRevision is the chart version Flux last tried to apply,
+	// successful or not.
+	LastAttemptedRevision string
+
+	InstallFailures int64
+	UpgradeFailures int64
+
+	ReleasedMessage    string
+	TestSuccessMessage string
+}
+
+// String summarises the status for logs and failure messages.
+func (s HelmReleaseStatus) String() string {
+	return fmt.Sprintf("%s/%s ready=%t revision=%d chart=%s attempted=%s installFailures=%d upgradeFailures=%d released=%q testSuccess=%q",
+		s.Namespace, s.Name, s.Ready, s.LastAppliedRevision, s.ChartVersion, s.LastAttemptedRevision,
+		s.InstallFailures, s.UpgradeFailures, s.ReleasedMessage, s.TestSuccessMessage)
+}
+
+// CheckChartVersion returns an error unless the release is Ready and its
+// latest deployed chart version is want. A leading "v" is ignored on both
+// sides, since app versions and chart versions differ in that.
+func (s HelmReleaseStatus) CheckChartVersion(want string) error {
+	if !s.Ready {
+		return fmt.Errorf("HelmRelease %s/%s is not ready: %s", s.Namespace, s.Name, s.ReadyMessage)
+	}
+	if strings.TrimPrefix(s.ChartVersion, "v") != strings.TrimPrefix(want, "v") {
+		return fmt.Errorf("HelmRelease %s/%s has chart version %q deployed, want %q (last attempted %q)",
+			s.Namespace, s.Name, s.ChartVersion, want, s.LastAttemptedRevision)
+	}
+	return nil
+}
+
+// DriverHelmReleaseKey returns the key of the HelmRelease the bundle
+// creates for a cluster in the given organization namespace.
+func DriverHelmReleaseKey(clusterName, orgNamespace string) types.NamespacedName {
+	return types.NamespacedName{
 		Name:      clusterName + "-aws-efs-csi-driver",
-		Namespace: "org-" + orgName,
-	}, hr)
-	if err != nil {
-		return false, err
-	}
-	for _, cond := range hr.Status.Conditions {
-		if cond.Type == "Ready" && cond.Status == metav1.ConditionTrue {
-			return true, nil
+		Namespace: orgNamespace,
+	}
+}
+
+// GetHelmReleaseStatus fetches a HelmRelease and returns its status.
+func GetHelmReleaseStatus(ctx context.Context, c client.Client, key types.NamespacedName) (HelmReleaseStatus, error) {
+	hr := &helmv2.HelmRelease{}
+	if err := c.Get(ctx, key, hr); err != nil {
+		return HelmReleaseStatus{}, err
+	}
+	return helmReleaseStatus(hr), nil
+}
+
+func helmReleaseStatus(hr *helmv2.HelmRelease) HelmReleaseStatus {
+	s := HelmReleaseStatus{
+		Name:                  hr.Name,
+		Namespace:             hr.Namespace,
+		LastAttemptedRevision: hr.Status.LastAttemptedRevision,
+		InstallFailures:       hr.Status.InstallFailures,
+		UpgradeFailures:       hr.Status.UpgradeFailures,
+	}
+
+	if cond := apimeta.FindStatusCondition(hr.Status.Conditions, "Ready"); cond != nil {
+		s.Ready = cond.Status == metav1.ConditionTrue
+		s.ReadyMessage = cond.Message
+	}
+	if cond := apimeta.FindStatusCondition(hr.Status.Conditions, helmv2.ReleasedCondition); cond != nil {
+		s.ReleasedMessage = cond.Message
+	}
+	if cond := apimeta.FindStatusCondition(hr.Status.Conditions, helmv2.TestSuccessCondition); cond != nil {
+		s.TestSuccessMessage = cond.Message
+	}
+
+	// Skip failed or superseded attempts, newest first.
+	history := append(helmv2.Snapshots(nil), hr.Status.History...)
+	history.SortByVersion()
+	for _, snap := range history {
+		if snap != nil && snap.Status == "deployed" {
+			s.LastAppliedRevision = snap.Version
+			s.ChartVersion = snap.ChartVersion
+			break
+		}
+	}
+	for _, snap := range history {
+		if snap != nil && !snap.FirstDeployed.IsZero() {
+			s.FirstDeployed = snap.FirstDeployed
 		}
 	}
-	return false, nil
+	return s
 }
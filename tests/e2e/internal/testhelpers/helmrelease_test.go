@@ -0,0 +1,104 @@
+package testhelpers
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	helmv2 "github.com/fluxcd/helm-controller/api/v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestHelmReleaseStatus(t *testing.T) {
+	hr := &helmv2.HelmRelease{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-aws-efs-csi-driver", Namespace: "org-giantswarm"},
+		Status: helmv2.HelmReleaseStatus{
+			Conditions: []metav1.Condition{
+				{Type: "Ready", Status: metav1.ConditionTrue, Message: "Helm upgrade succeeded"},
+				{Type: helmv2.ReleasedCondition, Status: metav1.ConditionTrue, Message: "Helm upgrade succeeded for release kube-system/aws-efs-csi-driver.v3"},
+				{Type: helmv2.TestSuccessCondition, Status: metav1.ConditionTrue, Message: "Helm test succeeded"},
+			},
+			History: helmv2.Snapshots{
+				{Version: 2, Status: "superseded", ChartVersion: "3.3.0"},
+				{Version: 4, Status: "failed", ChartVersion: "3.5.0"},
+				{Version: 3, Status: "deployed", ChartVersion: "3.4.0"},
+			},
+			LastAttemptedRevision: "3.5.0",
+			InstallFailures:       0,
+			UpgradeFailures:       2,
+		},
+	}
+
+	s := helmReleaseStatus(hr)
+	if !s.Ready || s.LastAppliedRevision != 3 || s.ChartVersion != "3.4.0" || s.UpgradeFailures != 2 {
+		t.Fatalf("unexpected status: %s", s)
+	}
+	if !strings.Contains(s.ReleasedMessage, "aws-efs-csi-driver.v3") || s.TestSuccessMessage != "Helm test succeeded" {
+		t.Errorf("condition messages not extracted: %s", s)
+	}
+	// The history order in the object must be left alone.
+	if hr.Status.History[0].Version != 2 {
+		t.Error("helmReleaseStatus reordered the HelmRelease history")
+	}
+
+	if err := s.CheckChartVersion("v3.4.0"); err != nil {
+		t.Errorf("CheckChartVersion(v3.4.0) = %v", err)
+	}
+	// The attempted upgrade to 3.5.0 failed, so a stale 3.4.0 must not pass.
+	if err := s.CheckChartVersion("3.5.0"); err == nil {
+		t.Error("CheckChartVersion accepted a chart version that was never deployed")
+	}
+
+	s.Ready = false
+	if err := s.CheckChartVersion("3.4.0"); err == nil {
+		t.Error("CheckChartVersion accepted a release that is not ready")
+	}
+}
+
+func TestHelmReleaseStatusFirstDeployed(t *testing.T) {
+	install := metav1.NewTime(time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC))
+	reinstall := metav1.NewTime(time.Date(2025, 6, 1, 10, 0, 0, 0, time.UTC))
+
+	tests := map[string]struct {
+		history helmv2.Snapshots
+		want    metav1.Time
+	}{
+		"no history": {},
+		"install failed": {
+			history: helmv2.Snapshots{
+				{Version: 1, Status: "failed", ChartVersion: "3.4.0"},
+			},
+		},
+		"upgraded": {
+			history: helmv2.Snapshots{
+				{Version: 3, Status: "deployed", ChartVersion: "3.5.0", FirstDeployed: install},
+				{Version: 1, Status: "superseded", ChartVersion: "3.3.0", FirstDeployed: install},
+				{Version: 2, Status: "superseded", ChartVersion: "3.4.0", FirstDeployed: install},
+			},
+			want: install,
+		},
+		// The oldest snapshot wins, whatever order the history is in.
+		"reinstalled": {
+			history: helmv2.Snapshots{
+				{Version: 2, Status: "deployed", ChartVersion: "3.4.0", FirstDeployed: reinstall},
+				{Version: 1, Status: "uninstalled", ChartVersion: "3.3.0", FirstDeployed: install},
+			},
+			want: install,
+		},
+		"first deployed only on the latest snapshot": {
+			history: helmv2.Snapshots{
+				{Version: 1, Status: "failed", ChartVersion: "3.3.0"},
+				{Version: 2, Status: "deployed", ChartVersion: "3.4.0", FirstDeployed: reinstall},
+			},
+			want: reinstall,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			hr := &helmv2.HelmRelease{Status: helmv2.HelmReleaseStatus{History: tt.history}}
+			if got := helmReleaseStatus(hr).FirstDeployed; !got.Equal(&tt.want) {
+				t.Errorf("FirstDeployed = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
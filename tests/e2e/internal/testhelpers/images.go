@@ -0,0 +1,117 @@
+package testhelpers
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// gsoci is the Giant Swarm registry whose images mirrors carry.
+const gsoci = "gsoci.azurecr.io/giantswarm"
+
+// MirrorImage rewrites image to be pulled from mirror, a registry with an
+// optional path such as gsoci.azurecr.io/giantswarm. Only Docker Hub and
+// gsoci images are rewritten, because those are the ones mirrors carry.
+// Their registry is dropped, and so are the library/ path of Docker Hub
+// images and the giantswarm/ path of gsoci images: busybox:1.36 becomes
+// mirror.local:5000/busybox:1.36 and gsoci.azurecr.io/giantswarm/fio@sha256:...
+// becomes mirror.local:5000/fio@sha256:... Other images, an empty mirror,
+// or an image already under it are left unchanged.
+func MirrorImage(image, mirror string) string {
+	if mirror == "" || strings.HasPrefix(image, mirror+"/") {
+		return image
+	}
+	path, ok := mirrorPath(image)
+	if !ok {
+		return image
+	}
+	return mirror + "/" + path
+}
+
+// mirrorPath returns the path of image under a mirror, and false for an
+// image that is neither on Docker Hub nor on gsoci.
+func mirrorPath(image string) (string, bool) {
+	if rest, found := strings.CutPrefix(image, gsoci+"/"); found {
+		return rest, true
+	}
+	path := image
+	if host, rest, found := strings.Cut(image, "/"); found && (strings.ContainsAny(host, ".:") || host == "localhost") {
+		if host != "docker.io" && host != "index.docker.io" && host != "registry-1.docker.io" {
+			return "", false
+		}
+		path = rest
+	}
+	return strings.TrimPrefix(path, "library/"), true
+}
+
+// imagePullFailures are the container waiting reasons that mean the
+// kubelet cannot get the image.
+var imagePullFailures = []string{"ErrImagePull", "ImagePullBackOff", "InvalidImageName", "ErrImageNeverPull"}
+
+// CheckImagePull runs sh -c true in a pod built like NewTestPod's, so with
+// the default registry mirror and pull secrets, and waits up to timeout for
+// it to succeed. When the image cannot be pulled it fails right away with
+// the kubelet's reason, instead of leaving test pods Pending in a way that
+// looks like a storage problem. The pod is deleted before it returns.
+func CheckImagePull(ctx context.Context, c client.Client, name, namespace, image string, timeout time.Duration) error {
+	for _, secret := range defaults.ImagePullSecrets {
+		if err := c.Get(ctx, client.ObjectKey{Name: secret, Namespace: namespace}, &corev1.Secret{}); err != nil {
+			return fmt.Errorf("image pull secret %s/%s: %w", namespace, secret, err)
+		}
+	}
+
+	pod := NewTestPod(name, namespace, "", []string{"sh", "-c", "true"}, WithoutVolume(), WithImage(image))
+	var note string
+	if _, ok := mirrorPath(image); !ok && defaults.Registry != "" && !strings.HasPrefix(image, defaults.Registry+"/") {
+		note = fmt.Sprintf(" (%s is not on Docker Hub or gsoci, so it is pulled from its own registry instead of the mirror %s)", image, defaults.Registry)
+	}
+	image = pod.Spec.Containers[0].Image
+	if err := c.Create(ctx, pod); err != nil {
+		return fmt.Errorf("creating image pull check pod for %s: %w", image, err)
+	}
+	defer func() {
+		_ = Delete(context.WithoutCancel(ctx), c, false, 0, pod)
+	}()
+
+	var last string
+	err := wait.PollUntilContextTimeout(ctx, 2*time.Second, timeout, true, func(ctx context.Context) (bool, error) {
+		if err := c.Get(ctx, client.ObjectKeyFromObject(pod), pod); err != nil {
+			return false, err
+		}
+		last = string(pod.Status.Phase)
+		switch pod.Status.Phase {
+		case corev1.PodSucceeded:
+			return true, nil
+		case corev1.PodFailed:
+			return false, fmt.Errorf("%s was pulled, but sh -c true failed in it: %s", image, terminationMessage(pod))
+		}
+		for _, s := range pod.Status.ContainerStatuses {
+			if w := s.State.Waiting; w != nil {
+				last = w.Reason
+				if slices.Contains(imagePullFailures, w.Reason) {
+					return false, fmt.Errorf("cannot pull %s: %s: %s%s", image, w.Reason, w.Message, note)
+				}
+			}
+		}
+		return false, nil
+	})
+	if err != nil && ctx.Err() == nil && wait.Interrupted(err) {
+		return fmt.Errorf("pod pulling %s did not succeed within %s, last seen %s", image, timeout, last)
+	}
+	return err
+}
+
+func terminationMessage(pod *corev1.Pod) string {
+	for _, s := range pod.Status.ContainerStatuses {
+		if t := s.State.Terminated; t != nil {
+			return fmt.Sprintf("exit code %d, %s", t.ExitCode, t.Reason)
+		}
+	}
+	return pod.Status.Reason
+}
@@ -0,0 +1,109 @@
+package testhelpers
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+func TestMirrorImage(t *testing.T) {
+	tests := []struct {
+		image, mirror, want string
+	}{
+		{"busybox:1.36", "", "busybox:1.36"},
+		{"busybox:1.36", "gsoci.azurecr.io/giantswarm", "gsoci.azurecr.io/giantswarm/busybox:1.36"},
+		{"docker.io/library/busybox:1.36", "gsoci.azurecr.io/giantswarm", "gsoci.azurecr.io/giantswarm/busybox:1.36"},
+		{"nixery.dev/shell/fio", "mirror.local:5000", "nixery.dev/shell/fio"},
+		{"gsoci.azurecr.io/giantswarm/fio@sha256:abc", "mirror.local:5000", "mirror.local:5000/fio@sha256:abc"},
+		{"registry.k8s.io/pause:3.9", "gsoci.azurecr.io/giantswarm", "registry.k8s.io/pause:3.9"},
+		{"bitnami/kubectl@sha256:abc", "gsoci.azurecr.io/giantswarm", "gsoci.azurecr.io/giantswarm/bitnami/kubectl@sha256:abc"},
+		{"gsoci.azurecr.io/giantswarm/busybox:1.36", "gsoci.azurecr.io/giantswarm", "gsoci.azurecr.io/giantswarm/busybox:1.36"},
+	}
+	for _, tt := range tests {
+		if got := MirrorImage(tt.image, tt.mirror); got != tt.want {
+			t.Errorf("MirrorImage(%q, %q) = %q, want %q", tt.image, tt.mirror, got, tt.want)
+		}
+	}
+}
+
+// withDefaults sets the testhelpers defaults for one test.
+func withDefaults(t *testing.T, d Defaults) {
+	orig := defaults
+	t.Cleanup(func() { defaults = orig })
+	SetDefaults(d)
+}
+
+func TestNewTestPodUsesMirrorAndPullSecrets(t *testing.T) {
+	withDefaults(t, Defaults{Image: "busybox:1.36", PVCSize: resource.MustParse("1Gi"), Registry: "gsoci.azurecr.io/giantswarm", ImagePullSecrets: []string{"mirror-pull"}})
+
+	pod := NewTestPod("fio", "default", "pvc", nil, WithImage("docker.io/xridge/fio:3.38"))
+	if got := pod.Spec.Containers[0].Image; got != "gsoci.azurecr.io/giantswarm/xridge/fio:3.38" {
+		t.Errorf("image = %q", got)
+	}
+	if len(pod.Spec.ImagePullSecrets) != 1 || pod.Spec.ImagePullSecrets[0].Name != "mirror-pull" {
+		t.Errorf("imagePullSecrets = %v", pod.Spec.ImagePullSecrets)
+	}
+	if got := NewTestPVC("pvc", "default", "sc").Spec.Resources.Requests[corev1.ResourceStorage]; got.String() != "1Gi" {
+		t.Errorf("PVC request = %s, want 1Gi", got.String())
+	}
+}
+
+// kubelet fakes the kubelet by giving pods the given container state.
+func kubelet(state corev1.ContainerState, objs ...client.Object) client.Client {
+	return interceptor.NewClient(fake.NewClientBuilder().WithObjects(objs...).Build(), interceptor.Funcs{
+		Get: func(ctx context.Context, c client.WithWatch, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+			if err := c.Get(ctx, key, obj, opts...); err != nil {
+				return err
+			}
+			if pod, ok := obj.(*corev1.Pod); ok {
+				pod.Status.Phase = corev1.PodPending
+				pod.Status.ContainerStatuses = []corev1.ContainerStatus{{Name: "test", State: state}}
+				if state.Terminated != nil {
+					pod.Status.Phase = corev1.PodSucceeded
+				}
+			}
+			return nil
+		},
+	})
+}
+
+func TestCheckImagePull(t *testing.T) {
+	withDefaults(t, Defaults{Image: "busybox:1.36", Registry: "gsoci.azurecr.io/giantswarm", ImagePullSecrets: []string{"mirror-pull"}})
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "mirror-pull", Namespace: "default"}}
+	ctx := context.Background()
+
+	c := kubelet(corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{Reason: "Completed"}}, secret)
+	if err := CheckImagePull(ctx, c, "pull", "default", "busybox:1.36", time.Minute); err != nil {
+		t.Fatalf("CheckImagePull() = %v", err)
+	}
+	if err := c.Get(ctx, client.ObjectKey{Name: "pull", Namespace: "default"}, &corev1.Pod{}); !apierrors.IsNotFound(err) {
+		t.Errorf("check pod left behind: %v", err)
+	}
+
+	c = kubelet(corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{
+		Reason:  "ErrImagePull",
+		Message: "failed to pull image: 403 Forbidden",
+	}}, secret)
+	err := CheckImagePull(ctx, c, "pull", "default", "busybox:1.36", time.Minute)
+	if err == nil || !strings.Contains(err.Error(), "cannot pull gsoci.azurecr.io/giantswarm/busybox:1.36: ErrImagePull: failed to pull image: 403 Forbidden") {
+		t.Errorf("CheckImagePull() = %v, want the pull failure", err)
+	}
+	err = CheckImagePull(ctx, c, "pull", "default", "nixery.dev/shell/fio", time.Minute)
+	if err == nil || !strings.Contains(err.Error(), "nixery.dev/shell/fio is not on Docker Hub or gsoci, so it is pulled from its own registry instead of the mirror gsoci.azurecr.io/giantswarm") {
+		t.Errorf("CheckImagePull() = %v, want the image not mirrored", err)
+	}
+
+	err = CheckImagePull(ctx, kubelet(corev1.ContainerState{}), "pull", "default", "busybox:1.36", time.Minute)
+	if err == nil || !strings.Contains(err.Error(), "image pull secret default/mirror-pull") {
+		t.Errorf("CheckImagePull() = %v, want the missing secret", err)
+	}
+}
@@ -0,0 +1,82 @@
+package testhelpers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// SetNodeUnschedulable cordons or uncordons a node.
+func SetNodeUnschedulable(ctx context.Context, c client.Client, name string, unschedulable bool) error {
+	var node corev1.Node
+	if err := c.Get(ctx, types.NamespacedName{Name: name}, &node); err != nil {
+		return err
+	}
+	patch := client.MergeFrom(node.DeepCopy())
+	node.Spec.Unschedulable = unschedulable
+	return c.Patch(ctx, &node, patch)
+}
+
+// DrainNode cordons a node and evicts every pod on it that is not owned by a
+// DaemonSet or mirrored from a static manifest, like kubectl drain. Evictions
+// blocked by a PodDisruptionBudget are retried until timeout.
+func DrainNode(ctx context.Context, c client.Client, name string, timeout time.Duration) error {
+	if err := SetNodeUnschedulable(ctx, c, name, true); err != nil {
+		return fmt.Errorf("cordoning %s: %w", name, err)
+	}
+
+	var pods corev1.PodList
+	if err := c.List(ctx, &pods, client.MatchingFields{"spec.nodeName": name}); err != nil {
+		return fmt.Errorf("listing pods on %s: %w", name, err)
+	}
+
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if !evictable(pod) {
+			continue
+		}
+		err := wait.PollUntilContextTimeout(ctx, 5*time.Second, timeout, true, func(ctx context.Context) (bool, error) {
+			err := c.SubResource("eviction").Create(ctx, pod, &policyv1.Eviction{
+				ObjectMeta: metav1.ObjectMeta{Name: pod.Name, Namespace: pod.Namespace},
+			})
+			switch {
+			case err == nil, apierrors.IsNotFound(err):
+				return true, nil
+			case apierrors.IsTooManyRequests(err):
+				GinkgoLogr.Info("eviction blocked by a disruption budget, retrying", "pod", pod.Namespace+"/"+pod.Name)
+				return false, nil
+			default:
+				return false, err
+			}
+		})
+		if err != nil {
+			return fmt.Errorf("evicting %s/%s: %w", pod.Namespace, pod.Name, err)
+		}
+		GinkgoLogr.Info("evicted pod", "node", name, "pod", pod.Namespace+"/"+pod.Name)
+	}
+	return nil
+}
+
+func evictable(pod *corev1.Pod) bool {
+	if _, mirror := pod.Annotations[corev1.MirrorPodAnnotationKey]; mirror {
+		return false
+	}
+	if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+		return false
+	}
+	for _, ref := range pod.OwnerReferences {
+		if ref.Kind == "DaemonSet" {
+			return false
+		}
+	}
+	return true
+}
@@ -1,13 +1,181 @@
 package testhelpers
 
 import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
-// NewTestPod creates a PSS-compliant pod that mounts a PVC and runs the given command.
-func NewTestPod(name, namespace, pvcName string, command []string) *corev1.Pod {
-	return &corev1.Pod{
+// Defaults are what NewTestPod and NewTestPVC use unless told otherwise.
+type Defaults struct {
+	// Image runs the test container.
+	Image string
+	// PVCSize is the storage request of test PVCs.
+	PVCSize resource.Quantity
+	// Registry is the mirror test images are pulled from, see MirrorImage.
+	Registry string
+	// ImagePullSecrets name secrets in the pod namespace for pulling the
+	// test images.
+	ImagePullSecrets []string
+}
+
+// defaults are empty until SetDefaults; suiteconfig.Default holds their
+// values.
+var defaults Defaults
+
+// SetDefaults sets the defaults of NewTestPod and NewTestPVC from the suite
+// config. Call it before the specs run.
+func SetDefaults(d Defaults) {
+	defaults = d
+}
+
+// PodOption customises a pod built by NewTestPod.
+type PodOption func(*corev1.Pod)
+
+// WithRunAsUser sets the uid the test container runs as.
+func WithRunAsUser(uid int64) PodOption {
+	return func(p *corev1.Pod) {
+		p.Spec.SecurityContext.RunAsUser = ptr(uid)
+	}
+}
+
+// WithRunAsGroup sets the primary gid the test container runs as.
+func WithRunAsGroup(gid int64) PodOption {
+	return func(p *corev1.Pod) {
+		p.Spec.SecurityContext.RunAsGroup = ptr(gid)
+	}
+}
+
+// WithFSGroup sets the pod fsGroup.
+func WithFSGroup(gid int64) PodOption {
+	return func(p *corev1.Pod) {
+		p.Spec.SecurityContext.FSGroup = ptr(gid)
+	}
+}
+
+// WithoutFSGroup removes the pod fsGroup.
+func WithoutFSGroup() PodOption {
+	return func(p *corev1.Pod) {
+		p.Spec.SecurityContext.FSGroup = nil
+	}
+}
+
+// WithFSGroupChangePolicy sets how the kubelet applies the fsGroup to volumes.
+func WithFSGroupChangePolicy(policy corev1.PodFSGroupChangePolicy) PodOption {
+	return func(p *corev1.Pod) {
+		p.Spec.SecurityContext.FSGroupChangePolicy = &policy
+	}
+}
+
+// WithReadOnly mounts the PVC passed to NewTestPod read-only.
+func WithReadOnly() PodOption {
+	return func(p *corev1.Pod) {
+		p.Spec.Containers[0].VolumeMounts[0].ReadOnly = true
+	}
+}
+
+// WithSubPath mounts only the given sub-directory of the PVC passed to NewTestPod.
+func WithSubPath(subPath string) PodOption {
+	return func(p *corev1.Pod) {
+		p.Spec.Containers[0].VolumeMounts[0].SubPath = subPath
+	}
+}
+
+// WithVolume mounts an additional PVC into the test container.
+func WithVolume(name, pvcName, mountPath string, readOnly bool) PodOption {
+	return func(p *corev1.Pod) {
+		p.Spec.Volumes = append(p.Spec.Volumes, corev1.Volume{
+			Name: name,
+			VolumeSource: corev1.VolumeSource{
+				PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+					ClaimName: pvcName,
+				},
+			},
+		})
+		p.Spec.Containers[0].VolumeMounts = append(p.Spec.Containers[0].VolumeMounts, corev1.VolumeMount{
+			Name:      name,
+			MountPath: mountPath,
+			ReadOnly:  readOnly,
+		})
+	}
+}
+
+// WithoutVolume drops the PVC passed to NewTestPod, for pods that only
+// probe the network.
+func WithoutVolume() PodOption {
+	return func(p *corev1.Pod) {
+		p.Spec.Volumes = nil
+		p.Spec.Containers[0].VolumeMounts = nil
+	}
+}
+
+// WithImage replaces the default image of the test container.
+func WithImage(image string) PodOption {
+	return func(p *corev1.Pod) {
+		p.Spec.Containers[0].Image = image
+	}
+}
+
+// WithLabels adds labels to the pod.
+func WithLabels(labels map[string]string) PodOption {
+	return func(p *corev1.Pod) {
+		if p.Labels == nil {
+			p.Labels = map[string]string{}
+		}
+		for k, v := range labels {
+			p.Labels[k] = v
+		}
+	}
+}
+
+// WithEnv sets an environment variable in the test container.
+func WithEnv(name, value string) PodOption {
+	return func(p *corev1.Pod) {
+		p.Spec.Containers[0].Env = append(p.Spec.Containers[0].Env, corev1.EnvVar{Name: name, Value: value})
+	}
+}
+
+// WithPodAntiAffinity forbids scheduling the pod into a topology domain that
+// already runs a pod matching the given labels.
+func WithPodAntiAffinity(matchLabels map[string]string, topologyKey string) PodOption {
+	return func(p *corev1.Pod) {
+		if p.Spec.Affinity == nil {
+			p.Spec.Affinity = &corev1.Affinity{}
+		}
+		if p.Spec.Affinity.PodAntiAffinity == nil {
+			p.Spec.Affinity.PodAntiAffinity = &corev1.PodAntiAffinity{}
+		}
+		aa := p.Spec.Affinity.PodAntiAffinity
+		aa.RequiredDuringSchedulingIgnoredDuringExecution = append(aa.RequiredDuringSchedulingIgnoredDuringExecution, corev1.PodAffinityTerm{
+			LabelSelector: &metav1.LabelSelector{MatchLabels: matchLabels},
+			TopologyKey:   topologyKey,
+		})
+	}
+}
+
+// WithTopologySpread asks the scheduler to spread pods matching the given
+// labels evenly over the topology key, without blocking scheduling.
+func WithTopologySpread(matchLabels map[string]string, topologyKey string) PodOption {
+	return func(p *corev1.Pod) {
+		p.Spec.TopologySpreadConstraints = append(p.Spec.TopologySpreadConstraints, corev1.TopologySpreadConstraint{
+			MaxSkew:           1,
+			TopologyKey:       topologyKey,
+			WhenUnsatisfiable: corev1.ScheduleAnyway,
+			LabelSelector:     &metav1.LabelSelector{MatchLabels: matchLabels},
+		})
+	}
+}
+
+// NewTestPod creates a PSS-compliant pod that mounts a PVC at /data and runs the given command.
+// By default it runs as uid/gid 1000 with fsGroup 1000; use PodOptions to change that.
+// Its images, including one set WithImage, are pulled through the default registry mirror.
+func NewTestPod(name, namespace, pvcName string, command []string, opts ...PodOption) *corev1.Pod {
+	pod := &corev1.Pod{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      name,
 			Namespace: namespace,
@@ -26,7 +194,7 @@ func NewTestPod(name, namespace, pvcName string, command []string) *corev1.Pod {
 			Containers: []corev1.Container{
 				{
 					Name:    "test",
-					Image:   "busybox:1.36",
+					Image:   defaults.Image,
 					Command: command,
 					SecurityContext: &corev1.SecurityContext{
 						AllowPrivilegeEscalation: ptr(false),
@@ -54,6 +222,29 @@ func NewTestPod(name, namespace, pvcName string, command []string) *corev1.Pod {
 			},
 		},
 	}
+	for _, name := range defaults.ImagePullSecrets {
+		pod.Spec.ImagePullSecrets = append(pod.Spec.ImagePullSecrets, corev1.LocalObjectReference{Name: name})
+	}
+	for _, opt := range opts {
+		opt(pod)
+	}
+	for i := range pod.Spec.Containers {
+		pod.Spec.Containers[i].Image = MirrorImage(pod.Spec.Containers[i].Image, defaults.Registry)
+	}
+	return pod
+}
+
+// PodPhase returns the current phase of a pod, logging its status so that
+// callers polling with Eventually leave a trail in the test output.
+func PodPhase(ctx context.Context, c client.Client, name, namespace string) (corev1.PodPhase, error) {
+	var pod corev1.Pod
+	err := c.Get(ctx, types.NamespacedName{Name: name, Namespace: namespace}, &pod)
+	if err != nil {
+		GinkgoLogr.Info("pod not found yet", "name", name, "error", err.Error())
+		return "", err
+	}
+	GinkgoLogr.Info("pod status", "name", name, "phase", pod.Status.Phase, "reason", pod.Status.Reason, "message", pod.Status.Message)
+	return pod.Status.Phase, nil
 }
 
 func ptr[T any](v T) *T { return &v }
@@ -0,0 +1,173 @@
+package testhelpers
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	"github.com/onsi/ginkgo/v2/reporters"
+	"github.com/onsi/ginkgo/v2/types"
+)
+
+// phaseEntryPrefix marks the report entries that RecordPhase adds.
+const phaseEntryPrefix = "phase "
+
+// Phase is how long one step of a suite run took, e.g. until Crossplane
+// reported the file system ID, and the ID of the resource it produced.
+type Phase struct {
+	Name    string  `json:"name"`
+	Seconds float64 `json:"seconds"`
+	ID      string  `json:"id,omitempty"`
+	// Spec is the spec that recorded the phase.
+	Spec string `json:"spec,omitempty"`
+}
+
+func (p Phase) String() string {
+	s := fmt.Sprintf("%s took %s", p.Name, p.Duration())
+	if p.ID != "" {
+		s += " (" + p.ID + ")"
+	}
+	return s
+}
+
+// Duration returns the phase duration rounded to the second.
+func (p Phase) Duration() time.Duration {
+	return (time.Duration(p.Seconds * float64(time.Second))).Round(time.Second)
+}
+
+// addReportEntry is Ginkgo's AddReportEntry, swapped out in unit tests that
+// run outside a spec.
+var addReportEntry = AddReportEntry
+
+// RecordPhase adds a report entry for a phase of the running spec. The
+// entries end up in the suite report, from which WritePhaseReports builds
+// the JUnit properties and the JSON summary.
+func RecordPhase(name string, took time.Duration, id string) {
+	addReportEntry(phaseEntryPrefix+name, Phase{Name: name, Seconds: took.Seconds(), ID: id}, ReportEntryVisibilityFailureOrVerbose)
+}
+
+// StartPhase starts timing a phase. Calling the returned func records it
+// with the ID of the resource it produced, if any.
+func StartPhase(name string) func(id string) {
+	start := time.Now()
+	return func(id string) {
+		RecordPhase(name, time.Since(start), id)
+	}
+}
+
+// PhaseSummary is the JSON summary of a suite run written by
+// WritePhaseReports, meant to trend slow AWS and Crossplane phases across
+// runs.
+type PhaseSummary struct {
+	Suite     string    `json:"suite"`
+	Start     time.Time `json:"start"`
+	Seconds   float64   `json:"seconds"`
+	Succeeded bool      `json:"succeeded"`
+	Phases    []Phase   `json:"phases"`
+}
+
+// SummarizePhases collects the phases recorded in a suite report, in the
+// order they were recorded.
+func SummarizePhases(report types.Report) PhaseSummary {
+	s := PhaseSummary{
+		Suite:     report.SuiteDescription,
+		Start:     report.StartTime,
+		Seconds:   report.RunTime.Seconds(),
+		Succeeded: report.SuiteSucceeded,
+		Phases:    []Phase{},
+	}
+	for _, spec := range report.SpecReports {
+		for _, entry := range spec.ReportEntries {
+			if !strings.HasPrefix(entry.Name, phaseEntryPrefix) {
+				continue
+			}
+			// Entries from parallel processes only carry the JSON encoding.
+			p, ok := entry.Value.GetRawValue().(Phase)
+			if !ok && json.Unmarshal([]byte(entry.Value.AsJSON), &p) != nil {
+				continue
+			}
+			p.Spec = spec.FullText()
+			s.Phases = append(s.Phases, p)
+		}
+	}
+	return s
+}
+
+// Properties returns the phases as JUnit properties, phase.<name>.seconds
+// and phase.<name>.id, with spaces in names replaced by underscores. A
+// phase recorded more than once keeps its first value.
+func (s PhaseSummary) Properties() []reporters.JUnitProperty {
+	var props []reporters.JUnitProperty
+	seen := map[string]bool{}
+	for _, p := range s.Phases {
+		key := "phase." + strings.ReplaceAll(p.Name, " ", "_")
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		props = append(props, reporters.JUnitProperty{Name: key + ".seconds", Value: fmt.Sprintf("%.1f", p.Seconds)})
+		if p.ID != "" {
+			props = append(props, reporters.JUnitProperty{Name: key + ".id", Value: p.ID})
+		}
+	}
+	return props
+}
+
+// ReportDir returns $REPORT_DIR, where suites write their reports, or the
+// temporary directory when it is unset.
+func ReportDir() string {
+	if dir := os.Getenv("REPORT_DIR"); dir != "" {
+		return dir
+	}
+	return os.TempDir()
+}
+
+// WritePhaseReports writes <name>-phases.json and <name>-junit.xml to dir.
+// The JUnit report is Ginkgo's, with the phases added to the suite
+// properties. Call it from a ReportAfterSuite.
+func WritePhaseReports(report types.Report, dir, name string) error {
+	summary := SummarizePhases(report)
+
+	data, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, name+"-phases.json"), append(data, '\n'), 0o644); err != nil { // #nosec G306
+		return err
+	}
+
+	junitPath := filepath.Join(dir, name+"-junit.xml")
+	if err := reporters.GenerateJUnitReport(report, junitPath); err != nil {
+		return err
+	}
+	return addJUnitProperties(junitPath, summary.Properties())
+}
+
+// addJUnitProperties rewrites a JUnit report generated by Ginkgo with
+// extra suite properties.
+func addJUnitProperties(path string, props []reporters.JUnitProperty) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var suites reporters.JUnitTestSuites
+	if err := xml.Unmarshal(data, &suites); err != nil {
+		return fmt.Errorf("parsing %s: %w", path, err)
+	}
+	for i := range suites.TestSuites {
+		suites.TestSuites[i].Properties.Properties = append(suites.TestSuites[i].Properties.Properties, props...)
+	}
+	out, err := xml.MarshalIndent(suites, "  ", "    ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append([]byte(xml.Header), out...), 0o644) // #nosec G306
+}
@@ -0,0 +1,88 @@
+package testhelpers
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/onsi/ginkgo/v2/reporters"
+	"github.com/onsi/ginkgo/v2/types"
+)
+
+func TestWritePhaseReports(t *testing.T) {
+	var entries []types.ReportEntry
+	orig := addReportEntry
+	t.Cleanup(func() { addReportEntry = orig })
+	addReportEntry = func(name string, args ...interface{}) {
+		entries = append(entries, types.ReportEntry{Name: name, Value: types.WrapEntryValue(args[0])})
+	}
+
+	RecordPhase("FileSystem ID", 95*time.Second, "fs-1")
+	RecordPhase("PVC bound", 4*time.Second, "pvc-1")
+	report := types.Report{
+		SuiteDescription: "EFS Dynamic Provisioning",
+		SuiteSucceeded:   true,
+		SpecReports: types.SpecReports{
+			{LeafNodeText: "should create EFS infrastructure via Crossplane", LeafNodeType: types.NodeTypeIt, ReportEntries: entries[:1]},
+			{LeafNodeText: "should provision a volume", LeafNodeType: types.NodeTypeIt, ReportEntries: types.ReportEntries{
+				entries[1],
+				{Name: "cleanup", Value: types.WrapEntryValue("deleted")},
+				// As decoded from a parallel process.
+				{Name: "phase PVC bound", Value: types.ReportEntryValue{AsJSON: `{"name":"PVC bound","seconds":9,"id":"pvc-2"}`}},
+			}},
+		},
+	}
+
+	dir := t.TempDir()
+	if err := WritePhaseReports(report, dir, "basic"); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "basic-phases.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var summary PhaseSummary
+	if err := json.Unmarshal(data, &summary); err != nil {
+		t.Fatal(err)
+	}
+	if len(summary.Phases) != 3 || !summary.Succeeded {
+		t.Fatalf("summary = %+v, want 3 phases of a succeeded suite", summary)
+	}
+	if p := summary.Phases[0]; p.Name != "FileSystem ID" || p.Seconds != 95 || p.ID != "fs-1" || p.Spec != "should create EFS infrastructure via Crossplane" {
+		t.Errorf("first phase = %+v", p)
+	}
+	if p := summary.Phases[2]; p.ID != "pvc-2" || p.Duration() != 9*time.Second {
+		t.Errorf("JSON-only phase = %+v", p)
+	}
+
+	data, err = os.ReadFile(filepath.Join(dir, "basic-junit.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var suites reporters.JUnitTestSuites
+	if err := xml.Unmarshal(data, &suites); err != nil {
+		t.Fatal(err)
+	}
+	props := map[string]string{}
+	for _, p := range suites.TestSuites[0].Properties.Properties {
+		props[p.Name] = p.Value
+	}
+	for name, want := range map[string]string{
+		"SuiteSucceeded":              "true",
+		"phase.FileSystem_ID.seconds": "95.0",
+		"phase.FileSystem_ID.id":      "fs-1",
+		"phase.PVC_bound.seconds":     "4.0",
+		"phase.PVC_bound.id":          "pvc-1",
+	} {
+		if props[name] != want {
+			t.Errorf("property %s = %q, want %q", name, props[name], want)
+		}
+	}
+	if suites.Tests != 2 {
+		t.Errorf("JUnit report has %d tests, want the 2 specs", suites.Tests)
+	}
+}
@@ -1,10 +1,14 @@
 package basic
 
 import (
+	"context"
 	"fmt"
 	"testing"
 	"time"
 
+	"e2e/internal/cleanup"
+	"e2e/internal/efsinfra"
+	"e2e/internal/suiteconfig"
 	"e2e/internal/testhelpers"
 
 	"github.com/giantswarm/apptest-framework/v2/pkg/state"
@@ -15,62 +19,85 @@ import (
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	storagev1 "k8s.io/api/storage/v1"
-	apierrors "k8s.io/apimachinery/pkg/api/errors"
-	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
-	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 const (
 	isUpgrade = false
 
 	efsProvisioner = "efs.csi.aws.com"
-	testNamespace  = "default"
-	scName = "efs-dynamic-e2e"
+	scName         = "efs-dynamic-e2e"
 )
 
 // Shared state between hooks and tests.
-var efs *efsInfra
+var (
+	efs *efsinfra.Infra
+	// cleanups defers the teardown of everything the specs create.
+	cleanups = cleanup.New(GinkgoLogr)
+	// cfg holds the suite parameters from config.yaml and the environment.
+	cfg suiteconfig.Config
+)
+
+// Writes the phase timings recorded by the specs as JUnit properties and a
+// JSON summary, to trend slow AWS and Crossplane phases across runs.
+var _ = ReportAfterSuite("phase report", func(report Report) {
+	if err := testhelpers.WritePhaseReports(report, testhelpers.ReportDir(), "basic"); err != nil {
+		GinkgoLogr.Info("writing phase report failed", "error", err.Error())
+	}
+})
+
+// Issues the deletes of teardowns that a second interrupt made Ginkgo skip,
+// and fails the run if anything the specs created may be left behind.
+var _ = ReportAfterSuite("cleanup report", func(ctx SpecContext, _ Report) {
+	teardown := cleanups.Finish(ctx)
+	GinkgoWriter.Printf("cleanup:\n%s", teardown)
+	Expect(teardown.Unconfirmed()).To(BeEmpty(), "resources not confirmed deleted:\n%s", teardown)
+})
 
 func TestBasic(t *testing.T) {
+	var err error
+	if cfg, err = suiteconfig.Load(); err != nil {
+		t.Fatal(err)
+	}
+	testhelpers.SetDefaults(cfg.PodDefaults())
+	cleanups.WithTimeout(cfg.Timeouts.Cleanup.Duration)
+
 	suite.New().
 		WithInCluster(true).
 		WithInstallNamespace("").
 		WithIsUpgrade(isUpgrade).
 		WithValuesFile("./values.yaml").
 		AfterClusterReady(func() {
-			It("should create EFS infrastructure via Crossplane", func() {
-				mcClient := state.GetFramework().MC()
-				ctx := state.GetContext()
-				cluster := state.GetCluster()
+			It("should pull the test image", func() {
+				wcClient, err := state.GetFramework().WC(state.GetCluster().Name)
+				Expect(err).Should(Succeed())
 
-				efs = newEFSInfra(cluster.Name, "org-"+cluster.Organization.Name)
-				efs.DiscoverProviderConfig(ctx, *mcClient)
-				Expect(efs.DiscoverNetwork(ctx, *mcClient)).To(Succeed())
-				efs.Create(ctx, *mcClient)
+				Expect(testhelpers.CheckImagePull(state.GetContext(), wcClient, "efs-image-pull-e2e", cfg.Namespace, cfg.Image, cfg.Timeouts.Pod.Duration)).
+					To(Succeed(), "test pods cannot start on this cluster; set e2e.registryMirror or e2e.imagePullSecrets in config.yaml")
 			})
 		}).
 		Tests(func() {
-			It("should have the HelmRelease ready on the management cluster", func() {
+			It("should have the HelmRelease ready with the chart version under test", func() {
 				mcClient := state.GetFramework().MC()
-				clusterName := state.GetCluster().Name
-				orgName := state.GetCluster().Organization.Name
+				cluster := state.GetCluster()
+				key := testhelpers.DriverHelmReleaseKey(cluster.Name, cluster.Organization.GetNamespace())
+				version := state.GetApplication().Version
 
-				Eventually(func() (bool, error) {
-					ready, err := testhelpers.HelmReleaseIsReady(*mcClient, clusterName, orgName)
+				ready := testhelpers.StartPhase("HelmRelease ready")
+				Eventually(func() error {
+					status, err := testhelpers.GetHelmReleaseStatus(state.GetContext(), *mcClient, key)
 					if err != nil {
-						GinkgoLogr.Info("HelmRelease check failed", "error", err.Error())
-					} else if !ready {
-						GinkgoLogr.Info("HelmRelease not ready yet", "name", clusterName+"-aws-efs-csi-driver")
-					} else {
-						GinkgoLogr.Info("HelmRelease is ready", "name", clusterName+"-aws-efs-csi-driver")
+						GinkgoLogr.Info("HelmRelease check failed", "name", key.Name, "error", err.Error())
+						return err
 					}
-					return ready, err
+					GinkgoLogr.Info("HelmRelease status", "status", status.String())
+					return status.CheckChartVersion(version)
 				}).
-					WithTimeout(15 * time.Minute).
-					WithPolling(10 * time.Second).
-					Should(BeTrue(), failurehandler.LLMPrompt(state.GetFramework(), state.GetCluster(), "Investigate HelmRelease not ready for aws-efs-csi-driver"))
+					WithTimeout(cfg.Timeouts.HelmRelease.Duration).
+					WithPolling(10*time.Second).
+					Should(Succeed(), failurehandler.LLMPrompt(state.GetFramework(), state.GetCluster(), "Investigate HelmRelease not ready for aws-efs-csi-driver"))
+				ready(key.Name)
 			})
 
 			It("should have the efs-csi-controller deployment running", func() {
@@ -94,8 +121,8 @@ func TestBasic(t *testing.T) {
 					}
 					return err
 				}).
-					WithTimeout(10 * time.Minute).
-					WithPolling(5 * time.Second).
+					WithTimeout(cfg.Timeouts.Rollout.Duration).
+					WithPolling(5*time.Second).
 					ShouldNot(HaveOccurred(), failurehandler.LLMPrompt(state.GetFramework(), state.GetCluster(), "Investigate efs-csi-controller deployment not found or not running"))
 			})
 
@@ -119,158 +146,183 @@ func TestBasic(t *testing.T) {
 					}
 					return err
 				}).
-					WithTimeout(10 * time.Minute).
-					WithPolling(5 * time.Second).
+					WithTimeout(cfg.Timeouts.Rollout.Duration).
+					WithPolling(5*time.Second).
 					ShouldNot(HaveOccurred(), failurehandler.LLMPrompt(state.GetFramework(), state.GetCluster(), "Investigate efs-csi-node daemonset not found or not running"))
 			})
 
-			It("should dynamically provision an EFS volume and allow shared read-write access", func() {
-				Expect(efs).NotTo(BeNil(), "EFS infrastructure was not created")
-				Expect(efs.fileSystemID).NotTo(BeEmpty(), "EFS filesystem ID is not available")
+			bundleTests()
 
-				wcClient, err := state.GetFramework().WC(state.GetCluster().Name)
-				Expect(err).Should(Succeed())
-				ctx := state.GetContext()
-
-				pvcName := "efs-claim-e2e"
-				writerPodName := "efs-writer-e2e"
-				readerPodName := "efs-reader-e2e"
-				testData := "efs-dynamic-provisioning-works"
-
-				By("Creating a StorageClass for EFS dynamic provisioning")
-				bindingMode := storagev1.VolumeBindingImmediate
-				reclaimPolicy := corev1.PersistentVolumeReclaimDelete
-				sc := &storagev1.StorageClass{
-					ObjectMeta: metav1.ObjectMeta{
-						Name: scName,
-					},
-					Provisioner:       efsProvisioner,
-					VolumeBindingMode: &bindingMode,
-					ReclaimPolicy:     &reclaimPolicy,
-					Parameters: map[string]string{
-						"provisioningMode": "efs-ap",
-						"fileSystemId":     efs.fileSystemID,
-						"directoryPerms":   "700",
-					},
-				}
-				Expect(wcClient.Create(ctx, sc)).To(Succeed())
-
-				By("Creating a PVC that uses the EFS StorageClass")
-				pvc := &corev1.PersistentVolumeClaim{
-					ObjectMeta: metav1.ObjectMeta{
-						Name:      pvcName,
-						Namespace: testNamespace,
-					},
-					Spec: corev1.PersistentVolumeClaimSpec{
-						AccessModes:      []corev1.PersistentVolumeAccessMode{corev1.ReadWriteMany},
-						StorageClassName: ptr(scName),
-						Resources: corev1.VolumeResourceRequirements{
-							Requests: corev1.ResourceList{
-								corev1.ResourceStorage: resource.MustParse("5Gi"),
-							},
+			irsaTests()
+
+			vpaTests()
+
+			// The file system is created once the App is installed and torn
+			// down after the last spec in here, before the App is
+			// uninstalled, so that PVC deletion still removes the access
+			// points.
+			Describe("with EFS infrastructure", Ordered, ContinueOnFailure, func() {
+				BeforeAll(func() {
+					mcClient := state.GetFramework().MC()
+					ctx := state.GetContext()
+					cluster := state.GetCluster()
+
+					efs = efsinfra.New(cluster.Name, cluster.Organization.GetNamespace()).
+						WithLogger(GinkgoLogr).
+						WithTimeouts(cfg.FixtureTimeouts()).
+						WithPhaseRecorder(testhelpers.RecordPhase).
+						WithExistingFromEnv().
+						WithConfigMapState(*mcClient)
+					cleanups.Defer("EFS infrastructure", func(ctx context.Context, wait bool) error {
+						if !wait {
+							return efs.Delete(ctx, *mcClient)
+						}
+						return efs.Cleanup(ctx, *mcClient)
+					})
+					// Resumes the fixture of an interrupted run of this cluster.
+					_, err := efs.LoadState(ctx)
+					Expect(err).NotTo(HaveOccurred())
+					wcClient, err := state.GetFramework().WC(cluster.Name)
+					Expect(err).NotTo(HaveOccurred())
+					// Finds the ProviderConfig and the network, and checks the MC and
+					// WC before anything is made in AWS.
+					preflight := efs.Preflight(ctx, *mcClient, wcClient)
+					AddReportEntry("pre-flight", preflight.String())
+					Expect(preflight.Err()).NotTo(HaveOccurred(), "the EFS fixture cannot be created for this cluster; see the fix under each failed check")
+					Expect(efs.Create(ctx, *mcClient)).To(Succeed())
+
+					By("Creating a StorageClass for EFS dynamic provisioning")
+					cleanups.Defer("dynamic provisioning StorageClass", func(ctx context.Context, _ bool) error {
+						return testhelpers.Delete(ctx, wcClient, false, 0, &storagev1.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: scName}})
+					})
+					bindingMode := storagev1.VolumeBindingImmediate
+					reclaimPolicy := corev1.PersistentVolumeReclaimDelete
+					sc := &storagev1.StorageClass{
+						ObjectMeta: metav1.ObjectMeta{
+							Name: scName,
 						},
-					},
-				}
-				Expect(wcClient.Create(ctx, pvc)).To(Succeed())
-
-				By("Creating a writer Pod that mounts the EFS volume and writes data")
-				writerPod := testhelpers.NewTestPod(writerPodName, testNamespace, pvcName,
-					[]string{"sh", "-c", fmt.Sprintf("echo '%s' > /data/testfile && echo 'write-ok'", testData)},
-				)
-				Expect(wcClient.Create(ctx, writerPod)).To(Succeed())
-
-				By("Waiting for the writer Pod to succeed")
-				Eventually(func() (corev1.PodPhase, error) {
-					var pod corev1.Pod
-					err := wcClient.Get(ctx, types.NamespacedName{
-						Name:      writerPodName,
-						Namespace: testNamespace,
-					}, &pod)
-					if err != nil {
-						GinkgoLogr.Info("writer pod not found yet", "error", err.Error())
-						return "", err
+						Provisioner:       efsProvisioner,
+						VolumeBindingMode: &bindingMode,
+						ReclaimPolicy:     &reclaimPolicy,
+						Parameters:        cfg.ParametersFor(efs.FileSystemID(), nil),
 					}
-					GinkgoLogr.Info("writer pod status", "phase", pod.Status.Phase, "reason", pod.Status.Reason, "message", pod.Status.Message)
-					return pod.Status.Phase, nil
-				}).
-					WithTimeout(10 * time.Minute).
-					WithPolling(5 * time.Second).
-					Should(Equal(corev1.PodSucceeded), failurehandler.LLMPrompt(state.GetFramework(), state.GetCluster(), "Investigate EFS writer pod not succeeding - check pod events, CSI driver logs, and mount target connectivity"))
-
-				By("Verifying the PVC is bound")
-				var claim corev1.PersistentVolumeClaim
-				Expect(wcClient.Get(ctx, types.NamespacedName{
-					Name:      pvcName,
-					Namespace: testNamespace,
-				}, &claim)).To(Succeed())
-				Expect(claim.Status.Phase).To(Equal(corev1.ClaimBound))
-
-				By("Creating a reader Pod that reads data from the same EFS volume")
-				readerPod := testhelpers.NewTestPod(readerPodName, testNamespace, pvcName,
-					[]string{"sh", "-c", fmt.Sprintf("cat /data/testfile | grep '%s'", testData)},
-				)
-				Expect(wcClient.Create(ctx, readerPod)).To(Succeed())
-
-				By("Waiting for the reader Pod to succeed, confirming shared access works")
-				Eventually(func() (corev1.PodPhase, error) {
-					var pod corev1.Pod
-					err := wcClient.Get(ctx, types.NamespacedName{
-						Name:      readerPodName,
-						Namespace: testNamespace,
-					}, &pod)
-					if err != nil {
-						GinkgoLogr.Info("reader pod not found yet", "error", err.Error())
-						return "", err
+					Expect(wcClient.Create(ctx, sc)).To(Succeed())
+				})
+
+				It("should dynamically provision an EFS volume and allow shared read-write access", func() {
+					Expect(efs).NotTo(BeNil(), "EFS infrastructure was not created")
+					Expect(efs.FileSystemID()).NotTo(BeEmpty(), "EFS filesystem ID is not available")
+
+					wcClient, err := state.GetFramework().WC(state.GetCluster().Name)
+					Expect(err).Should(Succeed())
+					ctx := state.GetContext()
+
+					pvcName := "efs-claim-e2e"
+					writerPodName := "efs-writer-e2e"
+					readerPodName := "efs-reader-e2e"
+					testData := "efs-dynamic-provisioning-works"
+
+					cleanups.Defer("dynamic provisioning volume", func(ctx context.Context, wait bool) error {
+						return testhelpers.DeleteVolume(ctx, wcClient, wait, cfg.Timeouts.Delete.Duration, cfg.Namespace, pvcName, "", readerPodName, writerPodName)
+					})
+
+					By("Creating a PVC that uses the EFS StorageClass")
+					pvc := &corev1.PersistentVolumeClaim{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:      pvcName,
+							Namespace: cfg.Namespace,
+						},
+						Spec: corev1.PersistentVolumeClaimSpec{
+							AccessModes:      []corev1.PersistentVolumeAccessMode{corev1.ReadWriteMany},
+							StorageClassName: ptr(scName),
+							Resources: corev1.VolumeResourceRequirements{
+								Requests: corev1.ResourceList{
+									corev1.ResourceStorage: cfg.PVCSize,
+								},
+							},
+						},
 					}
-					GinkgoLogr.Info("reader pod status", "phase", pod.Status.Phase, "reason", pod.Status.Reason, "message", pod.Status.Message)
-					return pod.Status.Phase, nil
-				}).
-					WithTimeout(5 * time.Minute).
-					WithPolling(5 * time.Second).
-					Should(Equal(corev1.PodSucceeded), failurehandler.LLMPrompt(state.GetFramework(), state.GetCluster(), "Investigate EFS reader pod not succeeding - check shared volume access and pod events"))
+					bound := testhelpers.StartPhase("PVC bound")
+					Expect(wcClient.Create(ctx, pvc)).To(Succeed())
+
+					By("Waiting for the PVC to be bound")
+					var claim corev1.PersistentVolumeClaim
+					Eventually(func() (corev1.PersistentVolumeClaimPhase, error) {
+						err := wcClient.Get(ctx, types.NamespacedName{
+							Name:      pvcName,
+							Namespace: cfg.Namespace,
+						}, &claim)
+						return claim.Status.Phase, err
+					}).
+						WithTimeout(cfg.Timeouts.Volume.Duration).
+						WithPolling(2*time.Second).
+						Should(Equal(corev1.ClaimBound), failurehandler.LLMPrompt(state.GetFramework(), state.GetCluster(), "Investigate EFS PVC not binding - check efs-csi-controller provisioner logs and access point creation"))
+					bound(claim.Spec.VolumeName)
+
+					By("Creating a writer Pod that mounts the EFS volume and writes data")
+					writerPod := testhelpers.NewTestPod(writerPodName, cfg.Namespace, pvcName,
+						[]string{"sh", "-c", fmt.Sprintf("echo '%s' > /data/testfile && echo 'write-ok'", testData)},
+					)
+					succeeded := testhelpers.StartPhase("pod succeeded")
+					Expect(wcClient.Create(ctx, writerPod)).To(Succeed())
+
+					By("Waiting for the writer Pod to succeed")
+					Eventually(func() (corev1.PodPhase, error) {
+						var pod corev1.Pod
+						err := wcClient.Get(ctx, types.NamespacedName{
+							Name:      writerPodName,
+							Namespace: cfg.Namespace,
+						}, &pod)
+						if err != nil {
+							GinkgoLogr.Info("writer pod not found yet", "error", err.Error())
+							return "", err
+						}
+						GinkgoLogr.Info("writer pod status", "phase", pod.Status.Phase, "reason", pod.Status.Reason, "message", pod.Status.Message)
+						return pod.Status.Phase, nil
+					}).
+						WithTimeout(cfg.Timeouts.Pod.Duration).
+						WithPolling(5*time.Second).
+						Should(Equal(corev1.PodSucceeded), failurehandler.LLMPrompt(state.GetFramework(), state.GetCluster(), "Investigate EFS writer pod not succeeding - check pod events, CSI driver logs, and mount target connectivity"))
+					succeeded(writerPodName)
+
+					By("Creating a reader Pod that reads data from the same EFS volume")
+					readerPod := testhelpers.NewTestPod(readerPodName, cfg.Namespace, pvcName,
+						[]string{"sh", "-c", fmt.Sprintf("cat /data/testfile | grep '%s'", testData)},
+					)
+					Expect(wcClient.Create(ctx, readerPod)).To(Succeed())
+
+					By("Waiting for the reader Pod to succeed, confirming shared access works")
+					Eventually(func() (corev1.PodPhase, error) {
+						var pod corev1.Pod
+						err := wcClient.Get(ctx, types.NamespacedName{
+							Name:      readerPodName,
+							Namespace: cfg.Namespace,
+						}, &pod)
+						if err != nil {
+							GinkgoLogr.Info("reader pod not found yet", "error", err.Error())
+							return "", err
+						}
+						GinkgoLogr.Info("reader pod status", "phase", pod.Status.Phase, "reason", pod.Status.Reason, "message", pod.Status.Message)
+						return pod.Status.Phase, nil
+					}).
+						WithTimeout(cfg.Timeouts.Pod.Duration).
+						WithPolling(5*time.Second).
+						Should(Equal(corev1.PodSucceeded), failurehandler.LLMPrompt(state.GetFramework(), state.GetCluster(), "Investigate EFS reader pod not succeeding - check shared volume access and pod events"))
+				})
+
+				networkPolicyTests()
+
+				reclaimPolicyTests()
+
+				ownershipTests()
+
+				rwxConsistencyTests()
+
+				// Attaches a file system policy requiring TLS and IAM, so it
+				// has to run last.
+				mountOptionsTests()
 			})
 		}).
-		AfterSuite(func() {
-			ctx := state.GetContext()
-
-			// Clean up WC resources while the CSI driver is still running,
-			// so that PVC deletion triggers access point removal.
-			wcClient, err := state.GetFramework().WC(state.GetCluster().Name)
-			if err == nil {
-				for _, name := range []string{"efs-reader-e2e", "efs-writer-e2e"} {
-					pod := &corev1.Pod{
-						ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: testNamespace},
-					}
-					_ = client.IgnoreNotFound(wcClient.Delete(ctx, pod))
-				}
-
-				pvc := &corev1.PersistentVolumeClaim{
-					ObjectMeta: metav1.ObjectMeta{Name: "efs-claim-e2e", Namespace: testNamespace},
-				}
-				_ = client.IgnoreNotFound(wcClient.Delete(ctx, pvc))
-
-				// Wait for PVC to be fully deleted so the CSI driver can
-				// clean up the access point before we tear down the filesystem.
-				Eventually(func() bool {
-					err := wcClient.Get(ctx, types.NamespacedName{
-						Name:      "efs-claim-e2e",
-						Namespace: testNamespace,
-					}, &corev1.PersistentVolumeClaim{})
-					return apierrors.IsNotFound(err)
-				}).WithTimeout(5 * time.Minute).WithPolling(5 * time.Second).Should(BeTrue())
-
-				sc := &storagev1.StorageClass{
-					ObjectMeta: metav1.ObjectMeta{Name: scName},
-				}
-				_ = client.IgnoreNotFound(wcClient.Delete(ctx, sc))
-			}
-
-			// Clean up Crossplane EFS resources on the MC.
-			if efs != nil {
-				mcClient := state.GetFramework().MC()
-				efs.Cleanup(ctx, *mcClient)
-			}
-		}).
 		Run(t, "EFS Dynamic Provisioning")
 }
 
@@ -0,0 +1,128 @@
+package basic
+
+import (
+	"strings"
+	"time"
+
+	"e2e/internal/testhelpers"
+
+	helmv2 "github.com/fluxcd/helm-controller/api/v2"
+	"github.com/giantswarm/apptest-framework/v2/pkg/state"
+	"github.com/giantswarm/clustertest/v2/pkg/failurehandler"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/yaml"
+)
+
+var ociRepositoryGVK = schema.GroupVersionKind{
+	Group:   "source.toolkit.fluxcd.io",
+	Version: "v1beta2",
+	Kind:    "OCIRepository",
+}
+
+// bundleTests checks the objects the bundle chart renders on the MC, next
+// to the HelmRelease covered by the readiness check.
+func bundleTests() {
+	It("should resolve the chart version under test in the OCIRepository", func() {
+		mcClient := state.GetFramework().MC()
+		ctx := state.GetContext()
+		cluster := state.GetCluster()
+		version := strings.TrimPrefix(state.GetApplication().Version, "v")
+
+		repo := &unstructured.Unstructured{}
+		repo.SetGroupVersionKind(ociRepositoryGVK)
+		key := types.NamespacedName{Name: cluster.Name + "-aws-efs-csi-driver", Namespace: cluster.Organization.GetNamespace()}
+		Expect(mcClient.Get(ctx, key, repo)).To(Succeed())
+
+		tag, _, _ := unstructured.NestedString(repo.Object, "spec", "ref", "tag")
+		Expect(strings.TrimPrefix(tag, "v")).To(Equal(version), "OCIRepository %s does not point at the version under test", key.Name)
+
+		Eventually(func() (string, error) {
+			if err := mcClient.Get(ctx, key, repo); err != nil {
+				return "", err
+			}
+			revision, _, _ := unstructured.NestedString(repo.Object, "status", "artifact", "revision")
+			GinkgoLogr.Info("OCIRepository artifact", "name", key.Name, "tag", tag, "revision", revision)
+			return revision, nil
+		}).
+			WithTimeout(cfg.Timeouts.HelmRelease.Duration).
+			WithPolling(10*time.Second).
+			// Flux records the revision as <tag>@<digest>.
+			Should(HavePrefix(tag+"@"), failurehandler.LLMPrompt(state.GetFramework(), state.GetCluster(), "Investigate OCIRepository for aws-efs-csi-driver not resolving the expected tag"))
+	})
+
+	It("should render a values ConfigMap carrying the IRSA annotation", func() {
+		mcClient := state.GetFramework().MC()
+		ctx := state.GetContext()
+		cluster := state.GetCluster()
+
+		var cm corev1.ConfigMap
+		Expect(mcClient.Get(ctx, types.NamespacedName{
+			Name:      cluster.Name + "-aws-efs-csi-driver-config",
+			Namespace: cluster.Organization.GetNamespace(),
+		}, &cm)).To(Succeed())
+		Expect(cm.Data).To(HaveKey("values"), "the HelmRelease reads valuesKey: values")
+
+		var values map[string]interface{}
+		Expect(yaml.Unmarshal([]byte(cm.Data["values"]), &values)).To(Succeed(), "values in ConfigMap %s are not valid YAML", cm.Name)
+
+		annotations, found, err := unstructured.NestedStringMap(values, "upstream", "controller", "serviceAccount", "annotations")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(found).To(BeTrue(), "values have no upstream.controller.serviceAccount.annotations")
+		Expect(annotations).To(HaveKeyWithValue(irsaRoleARNAnnotation, HaveSuffix(":role/"+testhelpers.DriverIAMRoleName(cluster.Name))))
+	})
+
+	It("should have the IAM Role Ready", func() {
+		mcClient := state.GetFramework().MC()
+		ctx := state.GetContext()
+		clusterName := state.GetCluster().Name
+
+		Eventually(func() (bool, error) {
+			role, err := testhelpers.GetDriverIAMRole(ctx, *mcClient, clusterName)
+			if err != nil {
+				return false, err
+			}
+			return testhelpers.CrossplaneConditionIsTrue(role, "Ready") && testhelpers.CrossplaneConditionIsTrue(role, "Synced"), nil
+		}).
+			WithTimeout(cfg.Timeouts.Crossplane.Duration).
+			WithPolling(10*time.Second).
+			Should(BeTrue(), failurehandler.LLMPrompt(state.GetFramework(), state.GetCluster(), "Investigate the aws-efs-csi-driver IAM Role not becoming Ready and Synced in Crossplane"))
+	})
+
+	It("should install only after the cloud-provider-aws HelmRelease it depends on", func() {
+		mcClient := state.GetFramework().MC()
+		ctx := state.GetContext()
+		cluster := state.GetCluster()
+		key := testhelpers.DriverHelmReleaseKey(cluster.Name, cluster.Organization.GetNamespace())
+
+		var hr helmv2.HelmRelease
+		Expect(mcClient.Get(ctx, key, &hr)).To(Succeed())
+
+		depKey := types.NamespacedName{Name: cluster.Name + "-cloud-provider-aws", Namespace: key.Namespace}
+		var deps []types.NamespacedName
+		for _, d := range hr.Spec.DependsOn {
+			ns := d.Namespace
+			if ns == "" {
+				ns = hr.Namespace
+			}
+			deps = append(deps, types.NamespacedName{Name: d.Name, Namespace: ns})
+		}
+		Expect(deps).To(ContainElement(depKey), "HelmRelease %s does not depend on %s", key.Name, depKey)
+
+		dep, err := testhelpers.GetHelmReleaseStatus(ctx, *mcClient, depKey)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dep.Ready).To(BeTrue(), "dependency %s", dep)
+		own, err := testhelpers.GetHelmReleaseStatus(ctx, *mcClient, key)
+		Expect(err).NotTo(HaveOccurred())
+		GinkgoLogr.Info("HelmRelease install order", "dependency", dep.FirstDeployed, "driver", own.FirstDeployed)
+
+		Expect(dep.FirstDeployed.IsZero()).To(BeFalse(), "dependency %s has no deploy history", depKey)
+		Expect(own.FirstDeployed.IsZero()).To(BeFalse(), "HelmRelease %s has no deploy history", key)
+		Expect(own.FirstDeployed.Before(&dep.FirstDeployed)).To(BeFalse(),
+			"%s was installed at %s, before its dependency %s at %s", key.Name, own.FirstDeployed, depKey.Name, dep.FirstDeployed)
+	})
+}
@@ -0,0 +1,124 @@
+package basic
+
+import (
+	"fmt"
+	"time"
+
+	"e2e/internal/testhelpers"
+
+	"github.com/giantswarm/apptest-framework/v2/pkg/state"
+	"github.com/giantswarm/clustertest/v2/pkg/failurehandler"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	controllerServiceAccount = "efs-csi-sa"
+	controllerPodLabel       = "efs-csi-controller"
+	controllerContainer      = "efs-plugin"
+	irsaRoleARNAnnotation    = "eks.amazonaws.com/role-arn"
+	irsaTokenAudience        = "sts.amazonaws.com"
+)
+
+func irsaTests() {
+	// roleARN is the ARN the annotation points at, checked against the
+	// controller pods once it is known to be correct.
+	var roleARN string
+
+	It("should annotate the controller service account with the IAM Role's ARN", func() {
+		mcClient := state.GetFramework().MC()
+		wcClient, err := state.GetFramework().WC(state.GetCluster().Name)
+		Expect(err).Should(Succeed())
+		ctx := state.GetContext()
+		clusterName := state.GetCluster().Name
+
+		By("Waiting for the IAM Role to be Ready on the management cluster")
+		var role *unstructured.Unstructured
+		Eventually(func() (bool, error) {
+			role, err = testhelpers.GetDriverIAMRole(ctx, *mcClient, clusterName)
+			if err != nil {
+				GinkgoLogr.Info("IAM Role not found yet", "name", testhelpers.DriverIAMRoleName(clusterName), "error", err.Error())
+				return false, nil
+			}
+			return testhelpers.CrossplaneConditionIsTrue(role, "Ready"), nil
+		}).
+			WithTimeout(cfg.Timeouts.Crossplane.Duration).
+			WithPolling(10*time.Second).
+			Should(BeTrue(), failurehandler.LLMPrompt(state.GetFramework(), state.GetCluster(), "Investigate the aws-efs-csi-driver IAM Role not becoming Ready in Crossplane"))
+
+		arn, _, _ := unstructured.NestedString(role.Object, "status", "atProvider", "arn")
+		Expect(arn).NotTo(BeEmpty(), "IAM Role %s has no status.atProvider.arn", role.GetName())
+
+		By("Comparing it with the annotation on kube-system/" + controllerServiceAccount)
+		var sa corev1.ServiceAccount
+		Expect(wcClient.Get(ctx, types.NamespacedName{Name: controllerServiceAccount, Namespace: "kube-system"}, &sa)).To(Succeed())
+		Expect(sa.Annotations).To(HaveKeyWithValue(irsaRoleARNAnnotation, arn),
+			"the IRSA annotation computed by giantswarm.setValues does not match the Role created by Crossplane")
+
+		roleARN = arn
+		GinkgoLogr.Info("IRSA annotation matches the IAM Role", "serviceAccount", sa.Name, "roleARN", arn)
+	})
+
+	It("should inject the web identity token and role ARN into the controller", func() {
+		Expect(roleARN).NotTo(BeEmpty(), "the IRSA annotation was not verified")
+
+		wcClient, err := state.GetFramework().WC(state.GetCluster().Name)
+		Expect(err).Should(Succeed())
+		ctx := state.GetContext()
+
+		var pods corev1.PodList
+		Expect(wcClient.List(ctx, &pods,
+			client.InNamespace("kube-system"),
+			client.MatchingLabels{"app": controllerPodLabel},
+		)).To(Succeed())
+		Expect(pods.Items).NotTo(BeEmpty(), "no efs-csi-controller pods found")
+
+		for _, pod := range pods.Items {
+			By(fmt.Sprintf("Checking IRSA wiring of pod %s", pod.Name))
+			Expect(pod.Spec.ServiceAccountName).To(Equal(controllerServiceAccount))
+
+			var container *corev1.Container
+			for i := range pod.Spec.Containers {
+				if pod.Spec.Containers[i].Name == controllerContainer {
+					container = &pod.Spec.Containers[i]
+				}
+			}
+			Expect(container).NotTo(BeNil(), "pod %s has no %s container", pod.Name, controllerContainer)
+
+			env := map[string]string{}
+			for _, e := range container.Env {
+				env[e.Name] = e.Value
+			}
+			Expect(env).To(HaveKeyWithValue("AWS_ROLE_ARN", roleARN), "pod %s", pod.Name)
+			Expect(env).To(HaveKey("AWS_WEB_IDENTITY_TOKEN_FILE"), "pod %s", pod.Name)
+
+			// The token file must come from a projected service account token
+			// issued for STS.
+			var tokenVolume string
+			for _, v := range pod.Spec.Volumes {
+				if v.Projected == nil {
+					continue
+				}
+				for _, src := range v.Projected.Sources {
+					if src.ServiceAccountToken != nil && src.ServiceAccountToken.Audience == irsaTokenAudience {
+						tokenVolume = v.Name
+					}
+				}
+			}
+			Expect(tokenVolume).NotTo(BeEmpty(), "pod %s has no projected token volume for audience %s", pod.Name, irsaTokenAudience)
+
+			var mounted bool
+			for _, m := range container.VolumeMounts {
+				if m.Name == tokenVolume {
+					mounted = true
+					Expect(env["AWS_WEB_IDENTITY_TOKEN_FILE"]).To(HavePrefix(m.MountPath), "pod %s reads its token outside the projected volume", pod.Name)
+				}
+			}
+			Expect(mounted).To(BeTrue(), "pod %s does not mount the projected token volume %s", pod.Name, tokenVolume)
+		}
+	})
+}
@@ -0,0 +1,283 @@
+package basic
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"e2e/internal/efsmount"
+	"e2e/internal/testhelpers"
+
+	"github.com/giantswarm/apptest-framework/v2/pkg/state"
+	clusterclient "github.com/giantswarm/clustertest/v2/pkg/client"
+	"github.com/giantswarm/clustertest/v2/pkg/failurehandler"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	mountOptionsSCName     = "efs-mount-tls-iam-e2e"
+	mountOptionsPVCName    = "efs-mount-tls-iam-claim-e2e"
+	mountOptionsPodName    = "efs-mount-tls-iam-e2e"
+	mountOptionsPolicyPod  = "efs-mount-tls-iam-policy-e2e"
+	efsCSINodeLabel        = "efs-csi-node"
+	efsPluginContainerName = "efs-plugin"
+)
+
+// mountOptionsPolicy requires encryption in transit and rejects anonymous
+// NFS clients: only IAM-authenticated principals connecting through a mount
+// target are allowed in, and any request without TLS is denied.
+const mountOptionsPolicy = `{
+  "Version": "2012-10-17",
+  "Statement": [
+    {
+      "Sid": "AllowIAMClientsThroughMountTargets",
+      "Effect": "Allow",
+      "Principal": {"AWS": "*"},
+      "Action": [
+        "elasticfilesystem:ClientMount",
+        "elasticfilesystem:ClientWrite",
+        "elasticfilesystem:ClientRootAccess"
+      ],
+      "Condition": {"Bool": {"elasticfilesystem:AccessedViaMountTarget": "true"}}
+    },
+    {
+      "Sid": "DenyUnencryptedTransport",
+      "Effect": "Deny",
+      "Principal": {"AWS": "*"},
+      "Action": "*",
+      "Condition": {"Bool": {"aws:SecureTransport": "false"}}
+    }
+  ]
+}`
+
+// rejectedMount is a StorageClass whose mounts the file system policy must
+// refuse.
+type rejectedMount struct {
+	name         string
+	mountOptions []string
+}
+
+var rejectedMounts = []rejectedMount{
+	// efs-utils refuses iam without tls, so IAM is dropped on its own and
+	// then both together.
+	{name: "efs-mount-tls-only-e2e", mountOptions: []string{"tls"}},
+	{name: "efs-mount-plain-e2e", mountOptions: nil},
+}
+
+func mountOptionsTests() {
+	// The second spec mounts the volume of the first again, so both are
+	// removed after the last spec.
+	Context("with tls and iam mount options", Ordered, func() {
+		BeforeAll(func() {
+			Expect(efs).NotTo(BeNil(), "EFS infrastructure was not created")
+			Expect(efs.FileSystemID()).NotTo(BeEmpty(), "EFS filesystem ID is not available")
+
+			wcClient, err := state.GetFramework().WC(state.GetCluster().Name)
+			Expect(err).Should(Succeed())
+			ctx := state.GetContext()
+			cleanups.Defer("mount options resources", func(ctx context.Context, wait bool) error {
+				return cleanupMountOptionsResources(ctx, wcClient, wait)
+			})
+
+			By("Creating a StorageClass with the tls and iam mount options")
+			Expect(wcClient.Create(ctx, newMountOptionsStorageClass(mountOptionsSCName, []string{"tls", "iam"}))).To(Succeed())
+			Expect(wcClient.Create(ctx, testhelpers.NewTestPVC(mountOptionsPVCName, cfg.Namespace, mountOptionsSCName))).To(Succeed())
+		})
+
+		It("should mount with TLS, IAM authorization and the provisioned access point", func() {
+			wcClient, err := state.GetFramework().WC(state.GetCluster().Name)
+			Expect(err).Should(Succeed())
+			ctx := state.GetContext()
+
+			pv := boundPersistentVolume(ctx, wcClient, mountOptionsPVCName)
+			_, apID := accessPointFromPV(pv)
+
+			By("Starting a pod that keeps the volume mounted")
+			Expect(wcClient.Create(ctx, testhelpers.NewTestPod(mountOptionsPodName, cfg.Namespace, mountOptionsPVCName,
+				[]string{"sh", "-c", "echo ok > /data/probe && sleep 3600"},
+			))).To(Succeed())
+			pod := waitForPodRunning(ctx, wcClient, mountOptionsPodName)
+
+			By("Inspecting the mount from the efs-csi-node pod on " + pod.Spec.NodeName)
+			mount, mountState := inspectNodeMount(ctx, wcClient, pod, pv.Name)
+			GinkgoLogr.Info("node-side mount",
+				"source", mount.Source,
+				"target", mount.Target,
+				"fstype", mount.FSType,
+				"stateFile", mountState.File,
+				"tunnel", mountState.Cmd,
+				"credentialsMethod", mountState.CredentialsMethod,
+				"accessPoint", mountState.AccessPoint,
+			)
+
+			Expect(mount.Source).To(HavePrefix("127.0.0.1:"), "mount is not routed through the local efs-utils tunnel")
+			Expect(mountState.TLS()).To(BeTrue(), "efs-utils tunnel %v does not use TLS", mountState.Cmd)
+			// The controller gets its IRSA role from giantswarm.setValues; the node
+			// has no role of its own, so efs-utils falls back to whatever
+			// credentials the node provides. Either way the method is recorded.
+			Expect(mountState.IAM()).To(BeTrue(), "efs-utils did not authorize the mount with IAM credentials")
+			Expect(mountState.AccessPoint).To(Equal(apID), "mount does not go through the PV's access point")
+
+			AddReportEntry("mount-options", map[string]interface{}{
+				"node":              pod.Spec.NodeName,
+				"tunnel":            mountState.Cmd,
+				"credentialsMethod": mountState.CredentialsMethod,
+				"accessPoint":       mountState.AccessPoint,
+			})
+		})
+
+		It("should keep mounting under a file system policy that requires TLS and IAM", func() {
+			if efs.Reused() {
+				Skip("the file system is reused and must not get a policy attached")
+			}
+
+			wcClient, err := state.GetFramework().WC(state.GetCluster().Name)
+			Expect(err).Should(Succeed())
+			mcClient := state.GetFramework().MC()
+			ctx := state.GetContext()
+
+			// The policy stays attached until the infrastructure is torn down,
+			// so this must run after every test that mounts without tls and iam.
+			Expect(efs.ApplyFileSystemPolicy(ctx, *mcClient, mountOptionsPolicy)).To(Succeed())
+
+			By("Mounting the tls,iam volume again with the policy in place")
+			Expect(wcClient.Create(ctx, testhelpers.NewTestPod(mountOptionsPolicyPod, cfg.Namespace, mountOptionsPVCName,
+				[]string{"sh", "-c", "grep ok /data/probe && echo again >> /data/probe"},
+			))).To(Succeed())
+			waitForPodCompletion(ctx, wcClient, mountOptionsPolicyPod)
+
+			for _, m := range rejectedMounts {
+				By(fmt.Sprintf("Checking that a mount with options %v is refused", m.mountOptions))
+				Expect(wcClient.Create(ctx, newMountOptionsStorageClass(m.name, m.mountOptions))).To(Succeed())
+				Expect(wcClient.Create(ctx, testhelpers.NewTestPVC(m.name, cfg.Namespace, m.name))).To(Succeed())
+				Expect(wcClient.Create(ctx, testhelpers.NewTestPod(m.name, cfg.Namespace, m.name,
+					[]string{"sh", "-c", "touch /data/should-not-exist"},
+				))).To(Succeed())
+
+				pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: m.name, Namespace: cfg.Namespace}}
+				Eventually(func() (string, error) {
+					events, err := wcClient.GetWarningEventsForResource(ctx, pod)
+					if err != nil {
+						return "", err
+					}
+					for _, ev := range events.Items {
+						if ev.Reason == "FailedMount" {
+							return ev.Message, nil
+						}
+					}
+					return "", nil
+				}).
+					WithTimeout(cfg.Timeouts.Pod.Duration).
+					WithPolling(10*time.Second).
+					ShouldNot(BeEmpty(), failurehandler.LLMPrompt(state.GetFramework(), state.GetCluster(), "Investigate EFS mount without TLS or IAM not being rejected by the file system policy"))
+
+				phase, err := testhelpers.PodPhase(ctx, wcClient, m.name, cfg.Namespace)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(phase).To(Equal(corev1.PodPending), "pod %s got its volume despite the file system policy", m.name)
+			}
+		})
+	})
+}
+
+// inspectNodeMount reads the mount table and efs-utils state from the
+// efs-csi-node pod running next to pod and returns the entries for its
+// volume backed by pvName.
+func inspectNodeMount(ctx context.Context, wcClient *clusterclient.Client, pod *corev1.Pod, pvName string) (efsmount.Mount, efsmount.State) {
+	var nodePods corev1.PodList
+	Expect(wcClient.List(ctx, &nodePods,
+		client.InNamespace("kube-system"),
+		client.MatchingLabels{"app": efsCSINodeLabel},
+	)).To(Succeed())
+
+	var nodePod string
+	for _, p := range nodePods.Items {
+		if p.Spec.NodeName == pod.Spec.NodeName {
+			nodePod = p.Name
+			break
+		}
+	}
+	Expect(nodePod).NotTo(BeEmpty(), "no efs-csi-node pod on node %s", pod.Spec.NodeName)
+
+	var (
+		mount      efsmount.Mount
+		mountState efsmount.State
+	)
+	// The state file is written by efs-utils right after the mount, give it
+	// a moment in case the pod was just started.
+	Eventually(func() error {
+		stdout, stderr, err := wcClient.ExecInPod(ctx, nodePod, "kube-system", efsPluginContainerName, efsmount.SnapshotCommand())
+		if err != nil {
+			return fmt.Errorf("exec in %s: %w (stderr: %s)", nodePod, err, strings.TrimSpace(stderr))
+		}
+		snap, err := efsmount.ParseSnapshot(stdout)
+		if err != nil {
+			return err
+		}
+		mount, mountState, err = snap.FindVolume(string(pod.UID), pvName)
+		return err
+	}).WithTimeout(cfg.Timeouts.Volume.Duration).WithPolling(10 * time.Second).Should(Succeed())
+
+	return mount, mountState
+}
+
+// waitForPodRunning waits for a long-running pod to start and returns it.
+func waitForPodRunning(ctx context.Context, wcClient client.Client, name string) *corev1.Pod {
+	Eventually(func() (corev1.PodPhase, error) {
+		return testhelpers.PodPhase(ctx, wcClient, name, cfg.Namespace)
+	}).
+		WithTimeout(cfg.Timeouts.Pod.Duration).
+		WithPolling(5*time.Second).
+		Should(Equal(corev1.PodRunning), failurehandler.LLMPrompt(state.GetFramework(), state.GetCluster(), "Investigate EFS pod not starting - check mount errors from efs-csi-node"))
+
+	var pod corev1.Pod
+	Expect(wcClient.Get(ctx, types.NamespacedName{Name: name, Namespace: cfg.Namespace}, &pod)).To(Succeed())
+	return &pod
+}
+
+// cleanupMountOptionsResources removes the mount option pods, PVCs and
+// StorageClasses and, with wait, waits for the PVCs to be gone.
+func cleanupMountOptionsResources(ctx context.Context, wcClient client.Client, wait bool) error {
+	pods := []string{mountOptionsPodName, mountOptionsPolicyPod}
+	pvcs := []string{mountOptionsPVCName}
+	scs := []string{mountOptionsSCName}
+	for _, m := range rejectedMounts {
+		pods = append(pods, m.name)
+		pvcs = append(pvcs, m.name)
+		scs = append(scs, m.name)
+	}
+
+	var objs []client.Object
+	for _, name := range pods {
+		objs = append(objs, &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: cfg.Namespace}})
+	}
+	if err := testhelpers.Delete(ctx, wcClient, false, 0, objs...); err != nil {
+		return err
+	}
+
+	objs = nil
+	for _, name := range pvcs {
+		objs = append(objs, &corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: cfg.Namespace}})
+	}
+	if err := testhelpers.Delete(ctx, wcClient, wait, cfg.Timeouts.Delete.Duration, objs...); err != nil {
+		return err
+	}
+
+	objs = nil
+	for _, name := range scs {
+		objs = append(objs, &storagev1.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: name}})
+	}
+	return testhelpers.Delete(ctx, wcClient, false, 0, objs...)
+}
+
+func newMountOptionsStorageClass(name string, mountOptions []string) *storagev1.StorageClass {
+	sc := newReclaimStorageClass(name, corev1.PersistentVolumeReclaimDelete)
+	sc.MountOptions = mountOptions
+	return sc
+}
@@ -0,0 +1,318 @@
+package basic
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"e2e/internal/testhelpers"
+
+	"github.com/giantswarm/apptest-framework/v2/pkg/state"
+	clusterclient "github.com/giantswarm/clustertest/v2/pkg/client"
+	"github.com/giantswarm/clustertest/v2/pkg/failurehandler"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	networkPolicyName = "aws-efs-csi"
+	netProbePodName   = "efs-netprobe-e2e"
+	// restrictedPVCName names the volume and pod of the restricted mode
+	// provisioning spec.
+	restrictedPVCName = "efs-restricted-e2e"
+	// netProbePort is served by the probe pod and allowed by no rule of
+	// the restricted policy.
+	netProbePort = 8080
+)
+
+// networkPolicyTests checks the chart's NetworkPolicy against the running
+// driver pods, then switches the App to restricted mode for the specs that
+// need it.
+func networkPolicyTests() {
+	It("should select both the controller and the node pods with the NetworkPolicy", func() {
+		wcClient, err := state.GetFramework().WC(state.GetCluster().Name)
+		Expect(err).Should(Succeed())
+		ctx := state.GetContext()
+
+		selector := networkPolicySelector(ctx, wcClient)
+		for _, app := range []string{"efs-csi-controller", "efs-csi-node"} {
+			var pods corev1.PodList
+			Expect(wcClient.List(ctx, &pods, client.InNamespace("kube-system"), client.MatchingLabels{"app": app})).To(Succeed())
+			Expect(pods.Items).NotTo(BeEmpty(), "no %s pods found", app)
+			for _, pod := range pods.Items {
+				Expect(selector.Matches(labels.Set(pod.Labels))).To(BeTrue(),
+					"NetworkPolicy %s selector %s does not match %s with labels %v", networkPolicyName, selector, pod.Name, pod.Labels)
+			}
+		}
+	})
+
+	// Restricted mode needs CIDRs only known once the cluster exists, so
+	// it is set on the installed App here rather than in values.yaml, and
+	// reverted after these specs.
+	Context("with networkPolicy.restricted", Ordered, func() {
+		// probe serves a port no rule of the restricted policy allows.
+		var probe *corev1.Pod
+
+		BeforeAll(func() {
+			Expect(efs).NotTo(BeNil(), "EFS infrastructure was not created")
+			mcClient := state.GetFramework().MC()
+			wcClient, err := state.GetFramework().WC(state.GetCluster().Name)
+			Expect(err).Should(Succeed())
+			ctx := state.GetContext()
+
+			restricted, err := restrictedValues(ctx, wcClient, efs.VPCCIDR())
+			Expect(err).NotTo(HaveOccurred())
+			AddReportEntry("networkPolicy.restricted", restricted)
+
+			probe = startNetProbe(ctx, wcClient)
+
+			app := *state.GetApplication()
+			app.Values, err = withNetworkPolicy(app.Values, restricted)
+			Expect(err).NotTo(HaveOccurred())
+			By("Enabling networkPolicy.restricted on the App")
+			Expect(mcClient.DeployApp(ctx, app)).To(Succeed())
+			waitForNetworkPolicy(ctx, wcClient, true)
+		})
+
+		AfterAll(func() {
+			mcClient := state.GetFramework().MC()
+			wcClient, err := state.GetFramework().WC(state.GetCluster().Name)
+			Expect(err).Should(Succeed())
+			ctx := state.GetContext()
+
+			By("Restoring the App values")
+			Expect(mcClient.DeployApp(ctx, *state.GetApplication())).To(Succeed())
+			waitForNetworkPolicy(ctx, wcClient, false)
+		})
+
+		It("should provision and mount a volume", func() {
+			wcClient, err := state.GetFramework().WC(state.GetCluster().Name)
+			Expect(err).Should(Succeed())
+			ctx := state.GetContext()
+
+			cleanups.Defer("restricted NetworkPolicy volume", func(ctx context.Context, wait bool) error {
+				return testhelpers.DeleteVolume(ctx, wcClient, wait, cfg.Timeouts.Delete.Duration, cfg.Namespace, restrictedPVCName, "", restrictedPVCName)
+			})
+			Expect(wcClient.Create(ctx, testhelpers.NewTestPVC(restrictedPVCName, cfg.Namespace, scName))).To(Succeed())
+			Expect(wcClient.Create(ctx, testhelpers.NewTestPod(restrictedPVCName, cfg.Namespace, restrictedPVCName,
+				[]string{"sh", "-c", "echo restricted > /data/restricted && cat /data/restricted"},
+			))).To(Succeed())
+			Eventually(func() (corev1.PodPhase, error) {
+				return testhelpers.PodPhase(ctx, wcClient, restrictedPVCName, cfg.Namespace)
+			}).
+				WithTimeout(cfg.Timeouts.Volume.Duration+cfg.Timeouts.Pod.Duration).
+				WithPolling(5*time.Second).
+				Should(Equal(corev1.PodSucceeded), failurehandler.LLMPrompt(state.GetFramework(), state.GetCluster(), "Investigate EFS provisioning or mounting failing under the restricted aws-efs-csi NetworkPolicy - check the efs-csi-controller logs for EFS and STS API timeouts"))
+		})
+
+		It("should keep the driver health ports reachable", func() {
+			wcClient, err := state.GetFramework().WC(state.GetCluster().Name)
+			Expect(err).Should(Succeed())
+			ctx := state.GetContext()
+
+			var pods corev1.PodList
+			Expect(wcClient.List(ctx, &pods, client.InNamespace("kube-system"), client.MatchingLabels{"app.kubernetes.io/name": "aws-efs-csi-driver"})).To(Succeed())
+			checked := 0
+			for _, pod := range pods.Items {
+				// NetworkPolicies do not apply to host network pods, so
+				// reaching them would only test the node security groups.
+				if pod.Spec.HostNetwork || pod.Status.PodIP == "" {
+					continue
+				}
+				port := healthPort(&pod)
+				if port == 0 {
+					continue
+				}
+				url := fmt.Sprintf("http://%s:%d/healthz", pod.Status.PodIP, port)
+				By(fmt.Sprintf("Probing %s of %s", url, pod.Name))
+				Eventually(func() error {
+					_, stderr, err := wcClient.ExecInPod(ctx, probe.Name, cfg.Namespace, "test", []string{"wget", "-q", "-T", "5", "-O", "/dev/null", url})
+					if err != nil {
+						return fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr))
+					}
+					return nil
+				}).
+					WithTimeout(cfg.Timeouts.Probe.Duration).
+					WithPolling(10*time.Second).
+					Should(Succeed(), failurehandler.LLMPrompt(state.GetFramework(), state.GetCluster(), "Investigate the aws-efs-csi NetworkPolicy blocking the efs-plugin health port"))
+				checked++
+			}
+			if checked == 0 {
+				Skip("no driver pod with a healthz port on the pod network")
+			}
+		})
+
+		It("should only allow the restricted egress destinations", func() {
+			wcClient, err := state.GetFramework().WC(state.GetCluster().Name)
+			Expect(err).Should(Succeed())
+			ctx := state.GetContext()
+
+			var controllers corev1.PodList
+			Expect(wcClient.List(ctx, &controllers, client.InNamespace("kube-system"), client.MatchingLabels{"app": controllerPodLabel})).To(Succeed())
+			var controller *corev1.Pod
+			for i := range controllers.Items {
+				if !controllers.Items[i].Spec.HostNetwork && controllers.Items[i].Status.Phase == corev1.PodRunning {
+					controller = &controllers.Items[i]
+					break
+				}
+			}
+			if controller == nil {
+				Skip("no efs-csi-controller pod on the pod network")
+			}
+
+			By("Reaching the API server from " + controller.Name)
+			Expect(connectFrom(ctx, wcClient, controller, "os.environ['KUBERNETES_SERVICE_HOST']", "os.environ['KUBERNETES_SERVICE_PORT']")).To(Succeed(),
+				"efs-plugin cannot reach the API server with the restricted NetworkPolicy")
+
+			By(fmt.Sprintf("Failing to reach %s:%d from %s", probe.Status.PodIP, netProbePort, controller.Name))
+			Expect(connectFrom(ctx, wcClient, controller, fmt.Sprintf("'%s'", probe.Status.PodIP), fmt.Sprint(netProbePort))).NotTo(Succeed(),
+				"efs-plugin reached a port no restricted egress rule allows")
+		})
+	})
+}
+
+// restrictedValues returns networkPolicy.restricted values for this cluster:
+// NFS to the VPC, the public EFS and STS endpoints, and the endpoints of the
+// kubernetes Service, which is what the policy sees after Service
+// translation.
+func restrictedValues(ctx context.Context, c client.Client, vpcCIDR string) (map[string]any, error) {
+	var endpointSlices discoveryv1.EndpointSliceList
+	if err := c.List(ctx, &endpointSlices, client.InNamespace(metav1.NamespaceDefault), client.MatchingLabels{discoveryv1.LabelServiceName: "kubernetes"}); err != nil {
+		return nil, err
+	}
+	var cidrs []string
+	var ports []int32
+	for _, s := range endpointSlices.Items {
+		bits := "/32"
+		if s.AddressType == discoveryv1.AddressTypeIPv6 {
+			bits = "/128"
+		}
+		for _, ep := range s.Endpoints {
+			for _, addr := range ep.Addresses {
+				cidrs = append(cidrs, addr+bits)
+			}
+		}
+		for _, p := range s.Ports {
+			if p.Port != nil {
+				ports = append(ports, *p.Port)
+			}
+		}
+	}
+	if len(cidrs) == 0 || len(ports) == 0 {
+		return nil, fmt.Errorf("the kubernetes Service has no endpoints in %d EndpointSlices", len(endpointSlices.Items))
+	}
+	slices.Sort(cidrs)
+	slices.Sort(ports)
+	return map[string]any{
+		"enabled":        true,
+		"nfsCIDRs":       []string{vpcCIDR},
+		"awsAPICIDRs":    []string{"0.0.0.0/0"},
+		"apiServerCIDRs": slices.Compact(cidrs),
+		"apiServerPorts": slices.Compact(ports),
+	}, nil
+}
+
+// withNetworkPolicy returns the App values with networkPolicy.restricted
+// replaced.
+func withNetworkPolicy(values string, restricted map[string]any) (string, error) {
+	v := map[string]any{}
+	if err := yaml.Unmarshal([]byte(values), &v); err != nil {
+		return "", err
+	}
+	v["networkPolicy"] = map[string]any{"enabled": true, "restricted": restricted}
+	out, err := yaml.Marshal(v)
+	return string(out), err
+}
+
+// waitForNetworkPolicy waits for the release to render the NetworkPolicy in
+// restricted mode, or back in the default allow-all egress mode.
+func waitForNetworkPolicy(ctx context.Context, c client.Client, restricted bool) {
+	Eventually(func() (bool, error) {
+		var np networkingv1.NetworkPolicy
+		if err := c.Get(ctx, types.NamespacedName{Name: networkPolicyName, Namespace: "kube-system"}, &np); err != nil {
+			return false, err
+		}
+		return slices.Contains(np.Spec.PolicyTypes, networkingv1.PolicyTypeIngress), nil
+	}).
+		WithTimeout(cfg.Timeouts.HelmRelease.Duration).
+		WithPolling(10*time.Second).
+		Should(Equal(restricted), failurehandler.LLMPrompt(state.GetFramework(), state.GetCluster(), "Investigate the aws-efs-csi NetworkPolicy not following the App's networkPolicy.restricted values - check the HelmRelease status"))
+}
+
+func networkPolicySelector(ctx context.Context, wcClient client.Client) labels.Selector {
+	var np networkingv1.NetworkPolicy
+	Expect(wcClient.Get(ctx, types.NamespacedName{Name: networkPolicyName, Namespace: "kube-system"}, &np)).To(Succeed())
+	selector, err := metav1.LabelSelectorAsSelector(&np.Spec.PodSelector)
+	Expect(err).NotTo(HaveOccurred())
+	return selector
+}
+
+// healthPort returns the efs-plugin container's healthz port, zero if it
+// has none.
+func healthPort(pod *corev1.Pod) int32 {
+	for _, c := range pod.Spec.Containers {
+		if c.Name != controllerContainer {
+			continue
+		}
+		for _, p := range c.Ports {
+			if p.Name == "healthz" {
+				return p.ContainerPort
+			}
+		}
+	}
+	return 0
+}
+
+// startNetProbe runs a busybox pod serving HTTP on netProbePort and returns
+// it once it has an IP. It is deleted after the calling container's specs.
+func startNetProbe(ctx context.Context, wcClient client.Client) *corev1.Pod {
+	cleanups.Defer("network policy probe pod", func(ctx context.Context, _ bool) error {
+		return cleanupNetworkPolicyResources(ctx, wcClient)
+	})
+	Expect(wcClient.Create(ctx, testhelpers.NewTestPod(netProbePodName, cfg.Namespace, "", []string{
+		"httpd", "-f", "-p", fmt.Sprint(netProbePort), "-h", "/tmp",
+	}, testhelpers.WithoutVolume()))).To(Succeed())
+
+	var pod corev1.Pod
+	key := types.NamespacedName{Name: netProbePodName, Namespace: cfg.Namespace}
+	Eventually(func() (corev1.PodPhase, error) {
+		if err := wcClient.Get(ctx, key, &pod); err != nil {
+			return "", err
+		}
+		return pod.Status.Phase, nil
+	}).
+		WithTimeout(cfg.Timeouts.Pod.Duration).
+		WithPolling(5*time.Second).
+		Should(Equal(corev1.PodRunning), failurehandler.LLMPrompt(state.GetFramework(), state.GetCluster(), "Investigate network probe pod not running"))
+	return &pod
+}
+
+// connectFrom opens a TCP connection from the pod's efs-plugin container,
+// which ships python3 for efs-utils. host and port are Python expressions.
+func connectFrom(ctx context.Context, wcClient *clusterclient.Client, pod *corev1.Pod, host, port string) error {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	script := fmt.Sprintf("import os, socket; socket.create_connection((%s, int(%s)), 5).close()", host, port)
+	_, stderr, err := wcClient.ExecInPod(ctx, pod.Name, pod.Namespace, controllerContainer, []string{"python3", "-c", script})
+	if err != nil {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr))
+	}
+	return nil
+}
+
+// cleanupNetworkPolicyResources removes the probe pod.
+func cleanupNetworkPolicyResources(ctx context.Context, wcClient client.Client) error {
+	return testhelpers.Delete(ctx, wcClient, false, 0,
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: netProbePodName, Namespace: cfg.Namespace}},
+	)
+}
@@ -0,0 +1,283 @@
+package basic
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"e2e/internal/testhelpers"
+
+	"github.com/giantswarm/apptest-framework/v2/pkg/state"
+	"github.com/giantswarm/clustertest/v2/pkg/failurehandler"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	ownershipSCName     = "efs-ownership-e2e"
+	ownershipAltSCName  = "efs-ownership-alt-e2e"
+	ownershipPVCName    = "efs-ownership-claim-e2e"
+	ownershipAltPVCName = "efs-ownership-alt-claim-e2e"
+
+	// POSIX identities enforced by the access points of the two StorageClasses.
+	ownershipOwner    = "1500:1500"
+	ownershipAltOwner = "1600:1600"
+
+	// ownershipDirPerms is the creationInfo mode of the access point root
+	// directories. The chart's CSIDriver leaves fsGroupPolicy at its
+	// default, under which kubelet does not change the ownership or mode of
+	// ReadWriteMany volumes without an fsType, so no fsGroup setting may
+	// change it, and a subPath directory kubelet creates inherits it.
+	ownershipDirPerms = "750"
+	// ownershipFileMode is the mode of a file written by the probe under
+	// its umask of 022; neither the access point nor fsGroup changes it.
+	ownershipFileMode = "644"
+)
+
+// ownershipCase describes a pod variant and the ownership outcome expected
+// when it writes through an EFS access point.
+type ownershipCase struct {
+	podName string
+	opts    []testhelpers.PodOption
+	// mounts are the paths probed by the pod, reported as m0, m1, ...
+	mounts []string
+	want   map[string]string
+	// wantGroups must all be part of the process group list.
+	wantGroups []string
+}
+
+var ownershipPodNames []string
+
+func ownershipTests() {
+	// The pods of the table share the volumes, which are removed after the
+	// last of them.
+	Context("with access point identities", Ordered, func() {
+		BeforeAll(func() {
+			Expect(efs).NotTo(BeNil(), "EFS infrastructure was not created")
+			Expect(efs.FileSystemID()).NotTo(BeEmpty(), "EFS filesystem ID is not available")
+
+			wcClient, err := state.GetFramework().WC(state.GetCluster().Name)
+			Expect(err).Should(Succeed())
+			ctx := state.GetContext()
+			cleanups.Defer("ownership resources", func(ctx context.Context, wait bool) error {
+				return cleanupOwnershipResources(ctx, wcClient, wait)
+			})
+
+			By("Creating StorageClasses that pin the access point uid/gid")
+			Expect(wcClient.Create(ctx, newOwnershipStorageClass(ownershipSCName, "1500"))).To(Succeed())
+			Expect(wcClient.Create(ctx, newOwnershipStorageClass(ownershipAltSCName, "1600"))).To(Succeed())
+
+			By("Creating a PVC for each StorageClass")
+			Expect(wcClient.Create(ctx, testhelpers.NewTestPVC(ownershipPVCName, cfg.Namespace, ownershipSCName))).To(Succeed())
+			Expect(wcClient.Create(ctx, testhelpers.NewTestPVC(ownershipAltPVCName, cfg.Namespace, ownershipAltSCName))).To(Succeed())
+
+			boundPersistentVolume(ctx, wcClient, ownershipPVCName)
+			boundPersistentVolume(ctx, wcClient, ownershipAltPVCName)
+		})
+
+		DescribeTable("should apply the access point identity regardless of the pod security context",
+			func(c ownershipCase) {
+				wcClient, err := state.GetFramework().WC(state.GetCluster().Name)
+				Expect(err).Should(Succeed())
+				ctx := state.GetContext()
+
+				pod := testhelpers.NewTestPod(c.podName, cfg.Namespace, ownershipPVCName,
+					[]string{"sh", "-c", ownershipProbeScript(c.mounts)},
+					c.opts...,
+				)
+				Expect(wcClient.Create(ctx, pod)).To(Succeed())
+				ownershipPodNames = append(ownershipPodNames, c.podName)
+
+				Eventually(func() (corev1.PodPhase, error) {
+					return testhelpers.PodPhase(ctx, wcClient, c.podName, cfg.Namespace)
+				}).
+					WithTimeout(cfg.Timeouts.Pod.Duration).
+					WithPolling(5*time.Second).
+					Should(Equal(corev1.PodSucceeded), failurehandler.LLMPrompt(state.GetFramework(), state.GetCluster(), "Investigate EFS ownership probe pod not succeeding - check pod security context and access point POSIX identity"))
+
+				logs, err := wcClient.GetLogs(ctx, pod, nil)
+				Expect(err).NotTo(HaveOccurred())
+				got := parseProbeOutput(logs)
+				GinkgoLogr.Info("ownership probe result", "pod", c.podName, "result", got)
+				for key, want := range c.want {
+					Expect(got).To(HaveKeyWithValue(key, want), "unexpected %s for pod %s", key, c.podName)
+				}
+				Expect(strings.Fields(got["groups"])).To(ContainElements(c.wantGroups), "unexpected groups for pod %s", c.podName)
+			},
+			Entry("default identity (uid/gid 1000, fsGroup 1000)", ownershipCase{
+				podName: "efs-ownership-default-e2e",
+				mounts:  []string{"/data"},
+				want: map[string]string{
+					"uid":         "1000",
+					"m0.write":    "ok",
+					"m0.file":     ownershipOwner,
+					"m0.filemode": ownershipFileMode,
+					"m0.dir":      ownershipOwner,
+					"m0.dirmode":  ownershipDirPerms,
+				},
+			}),
+			Entry("custom uid and gid without fsGroup", ownershipCase{
+				podName: "efs-ownership-nofsgroup-e2e",
+				opts: []testhelpers.PodOption{
+					testhelpers.WithRunAsUser(2000),
+					testhelpers.WithRunAsGroup(3000),
+					testhelpers.WithoutFSGroup(),
+				},
+				mounts: []string{"/data"},
+				want: map[string]string{
+					"uid":         "2000",
+					"m0.write":    "ok",
+					"m0.file":     ownershipOwner,
+					"m0.filemode": ownershipFileMode,
+					"m0.dir":      ownershipOwner,
+					"m0.dirmode":  ownershipDirPerms,
+				},
+				wantGroups: []string{"3000"},
+			}),
+			Entry("fsGroup with fsGroupChangePolicy Always", ownershipCase{
+				podName: "efs-ownership-fsgroup-always-e2e",
+				opts: []testhelpers.PodOption{
+					testhelpers.WithFSGroup(4000),
+					testhelpers.WithFSGroupChangePolicy(corev1.FSGroupChangeAlways),
+				},
+				mounts: []string{"/data"},
+				want: map[string]string{
+					"m0.write":    "ok",
+					"m0.file":     ownershipOwner,
+					"m0.filemode": ownershipFileMode,
+					"m0.dir":      ownershipOwner,
+					"m0.dirmode":  ownershipDirPerms,
+				},
+				wantGroups: []string{"1000", "4000"},
+			}),
+			Entry("fsGroup with fsGroupChangePolicy OnRootMismatch", ownershipCase{
+				podName: "efs-ownership-fsgroup-onrootmismatch-e2e",
+				opts: []testhelpers.PodOption{
+					testhelpers.WithFSGroup(4000),
+					testhelpers.WithFSGroupChangePolicy(corev1.FSGroupChangeOnRootMismatch),
+				},
+				mounts: []string{"/data"},
+				want: map[string]string{
+					"m0.write":    "ok",
+					"m0.file":     ownershipOwner,
+					"m0.filemode": ownershipFileMode,
+					"m0.dir":      ownershipOwner,
+					"m0.dirmode":  ownershipDirPerms,
+				},
+				wantGroups: []string{"1000", "4000"},
+			}),
+			Entry("read-only mount", ownershipCase{
+				podName: "efs-ownership-readonly-e2e",
+				opts:    []testhelpers.PodOption{testhelpers.WithReadOnly()},
+				mounts:  []string{"/data"},
+				want: map[string]string{
+					"m0.write":   "denied",
+					"m0.dir":     ownershipOwner,
+					"m0.dirmode": ownershipDirPerms,
+				},
+			}),
+			Entry("subPath mount", ownershipCase{
+				podName: "efs-ownership-subpath-e2e",
+				opts:    []testhelpers.PodOption{testhelpers.WithSubPath("nested")},
+				mounts:  []string{"/data"},
+				want: map[string]string{
+					"m0.write":    "ok",
+					"m0.file":     ownershipOwner,
+					"m0.filemode": ownershipFileMode,
+					"m0.dir":      ownershipOwner,
+					"m0.dirmode":  ownershipDirPerms,
+				},
+			}),
+			Entry("multiple volumes with different access point identities", ownershipCase{
+				podName: "efs-ownership-multi-e2e",
+				opts: []testhelpers.PodOption{
+					testhelpers.WithVolume("efs-volume-alt", ownershipAltPVCName, "/alt", false),
+				},
+				mounts: []string{"/data", "/alt"},
+				want: map[string]string{
+					"m0.write":    "ok",
+					"m0.file":     ownershipOwner,
+					"m0.filemode": ownershipFileMode,
+					"m1.write":    "ok",
+					"m1.file":     ownershipAltOwner,
+					"m1.filemode": ownershipFileMode,
+					"m1.dir":      ownershipAltOwner,
+					"m1.dirmode":  ownershipDirPerms,
+				},
+			}),
+		)
+	})
+}
+
+// cleanupOwnershipResources removes the probe pods, PVCs and StorageClasses
+// and, with wait, waits for the PVCs to be gone so their access points are
+// removed.
+func cleanupOwnershipResources(ctx context.Context, wcClient client.Client, wait bool) error {
+	var pods []client.Object
+	for _, name := range ownershipPodNames {
+		pods = append(pods, &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: cfg.Namespace}})
+	}
+	if err := testhelpers.Delete(ctx, wcClient, false, 0, pods...); err != nil {
+		return err
+	}
+
+	if err := testhelpers.Delete(ctx, wcClient, wait, cfg.Timeouts.Delete.Duration,
+		&corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: ownershipPVCName, Namespace: cfg.Namespace}},
+		&corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: ownershipAltPVCName, Namespace: cfg.Namespace}},
+	); err != nil {
+		return err
+	}
+
+	return testhelpers.Delete(ctx, wcClient, false, 0,
+		&storagev1.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: ownershipSCName}},
+		&storagev1.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: ownershipAltSCName}},
+	)
+}
+
+func newOwnershipStorageClass(name, id string) *storagev1.StorageClass {
+	bindingMode := storagev1.VolumeBindingImmediate
+	reclaimPolicy := corev1.PersistentVolumeReclaimDelete
+	return &storagev1.StorageClass{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+		},
+		Provisioner:       efsProvisioner,
+		VolumeBindingMode: &bindingMode,
+		ReclaimPolicy:     &reclaimPolicy,
+		Parameters: cfg.ParametersFor(efs.FileSystemID(), map[string]string{
+			"uid":            id,
+			"gid":            id,
+			"directoryPerms": ownershipDirPerms,
+		}),
+	}
+}
+
+// ownershipProbeScript writes a file to each mount and prints key=value
+// lines describing the effective identity and the resulting ownership and
+// mode.
+func ownershipProbeScript(mounts []string) string {
+	var b strings.Builder
+	b.WriteString(`umask 022; echo "uid=$(id -u)"; echo "groups=$(id -G)"; `)
+	for i, m := range mounts {
+		f := fmt.Sprintf("%s/probe-$(hostname)", m)
+		fmt.Fprintf(&b, `if echo probe > %[2]s 2>/dev/null; then echo "m%[1]d.write=ok"; echo "m%[1]d.file=$(stat -c %%u:%%g %[2]s)"; echo "m%[1]d.filemode=$(stat -c %%a %[2]s)"; else echo "m%[1]d.write=denied"; fi; `, i, f)
+		fmt.Fprintf(&b, `echo "m%[1]d.dir=$(stat -c %%u:%%g %[2]s)"; echo "m%[1]d.dirmode=$(stat -c %%a %[2]s)"; `, i, m)
+	}
+	return b.String()
+}
+
+func parseProbeOutput(logs string) map[string]string {
+	out := map[string]string{}
+	for _, line := range strings.Split(logs, "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), "=")
+		if ok {
+			out[key] = value
+		}
+	}
+	return out
+}
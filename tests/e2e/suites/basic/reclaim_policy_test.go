@@ -0,0 +1,268 @@
+package basic
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"e2e/internal/efsapi"
+	"e2e/internal/testhelpers"
+
+	"github.com/giantswarm/apptest-framework/v2/pkg/state"
+	"github.com/giantswarm/clustertest/v2/pkg/failurehandler"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	reclaimDeleteSCName  = "efs-reclaim-delete-e2e"
+	reclaimRetainSCName  = "efs-reclaim-retain-e2e"
+	reclaimDeletePVCName = "efs-reclaim-delete-claim-e2e"
+	reclaimRetainPVCName = "efs-reclaim-retain-claim-e2e"
+	reclaimStaticPVName  = "efs-reclaim-static-pv-e2e"
+	reclaimStaticPVCName = "efs-reclaim-static-claim-e2e"
+
+	reclaimDeleteWriterPodName = "efs-reclaim-delete-writer-e2e"
+	reclaimRetainWriterPodName = "efs-reclaim-retain-writer-e2e"
+	reclaimStaticReaderPodName = "efs-reclaim-static-reader-e2e"
+)
+
+// retainedPVName is the dynamically provisioned PV left behind by the Retain
+// scenario. Its cleanup switches it to Delete so its access point is removed.
+var retainedPVName string
+
+func reclaimPolicyTests() {
+	It("should remove the access point when a PVC with reclaim policy Delete is deleted", func() {
+		Expect(efs).NotTo(BeNil(), "EFS infrastructure was not created")
+		Expect(efs.FileSystemID()).NotTo(BeEmpty(), "EFS filesystem ID is not available")
+
+		wcClient, err := state.GetFramework().WC(state.GetCluster().Name)
+		Expect(err).Should(Succeed())
+		ctx := state.GetContext()
+		apClient := testhelpers.AccessPointClient(ctx, efs.Region())
+		cleanups.Defer("reclaim policy resources", func(ctx context.Context, wait bool) error {
+			return cleanupReclaimPolicyResources(ctx, wcClient, wait)
+		})
+
+		By("Creating a StorageClass with reclaim policy Delete")
+		Expect(wcClient.Create(ctx, newReclaimStorageClass(reclaimDeleteSCName, corev1.PersistentVolumeReclaimDelete))).To(Succeed())
+
+		By("Provisioning a volume and writing to it")
+		Expect(wcClient.Create(ctx, testhelpers.NewTestPVC(reclaimDeletePVCName, cfg.Namespace, reclaimDeleteSCName))).To(Succeed())
+		writerPod := testhelpers.NewTestPod(reclaimDeleteWriterPodName, cfg.Namespace, reclaimDeletePVCName,
+			[]string{"sh", "-c", "echo 'reclaim-delete' > /data/testfile"},
+		)
+		Expect(wcClient.Create(ctx, writerPod)).To(Succeed())
+		Eventually(func() (corev1.PodPhase, error) {
+			return testhelpers.PodPhase(ctx, wcClient, reclaimDeleteWriterPodName, cfg.Namespace)
+		}).
+			WithTimeout(cfg.Timeouts.Pod.Duration).
+			WithPolling(5*time.Second).
+			Should(Equal(corev1.PodSucceeded), failurehandler.LLMPrompt(state.GetFramework(), state.GetCluster(), "Investigate EFS writer pod not succeeding for the reclaim policy Delete scenario"))
+
+		pv := boundPersistentVolume(ctx, wcClient, reclaimDeletePVCName)
+		fsID, apID := accessPointFromPV(pv)
+		Expect(fsID).To(Equal(efs.FileSystemID()))
+
+		By("Verifying the access point exists via the EFS API")
+		Expect(efsapi.AccessPointExists(ctx, apClient, fsID, apID)).To(BeTrue())
+
+		By("Deleting the pod and the PVC")
+		Expect(client.IgnoreNotFound(wcClient.Delete(ctx, writerPod))).To(Succeed())
+		Expect(wcClient.Delete(ctx, &corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{Name: reclaimDeletePVCName, Namespace: cfg.Namespace},
+		})).To(Succeed())
+
+		By("Waiting for the PersistentVolume to be removed")
+		Eventually(func() bool {
+			err := wcClient.Get(ctx, types.NamespacedName{Name: pv.Name}, &corev1.PersistentVolume{})
+			return apierrors.IsNotFound(err)
+		}).WithTimeout(cfg.Timeouts.Volume.Duration).WithPolling(5 * time.Second).Should(BeTrue())
+
+		By("Verifying the access point is gone via the EFS API")
+		Eventually(func() (bool, error) {
+			return efsapi.AccessPointExists(ctx, apClient, fsID, apID)
+		}).WithTimeout(cfg.Timeouts.Volume.Duration).WithPolling(10 * time.Second).Should(BeFalse())
+	})
+
+	It("should keep the access point and data when a PVC with reclaim policy Retain is deleted", func() {
+		Expect(efs).NotTo(BeNil(), "EFS infrastructure was not created")
+		Expect(efs.FileSystemID()).NotTo(BeEmpty(), "EFS filesystem ID is not available")
+
+		wcClient, err := state.GetFramework().WC(state.GetCluster().Name)
+		Expect(err).Should(Succeed())
+		ctx := state.GetContext()
+		apClient := testhelpers.AccessPointClient(ctx, efs.Region())
+		cleanups.Defer("reclaim policy resources", func(ctx context.Context, wait bool) error {
+			return cleanupReclaimPolicyResources(ctx, wcClient, wait)
+		})
+		testData := "efs-retained-data-survives"
+
+		By("Creating a StorageClass with reclaim policy Retain")
+		Expect(wcClient.Create(ctx, newReclaimStorageClass(reclaimRetainSCName, corev1.PersistentVolumeReclaimRetain))).To(Succeed())
+
+		By("Provisioning a volume and writing to it")
+		Expect(wcClient.Create(ctx, testhelpers.NewTestPVC(reclaimRetainPVCName, cfg.Namespace, reclaimRetainSCName))).To(Succeed())
+		writerPod := testhelpers.NewTestPod(reclaimRetainWriterPodName, cfg.Namespace, reclaimRetainPVCName,
+			[]string{"sh", "-c", fmt.Sprintf("echo '%s' > /data/testfile", testData)},
+		)
+		Expect(wcClient.Create(ctx, writerPod)).To(Succeed())
+		Eventually(func() (corev1.PodPhase, error) {
+			return testhelpers.PodPhase(ctx, wcClient, reclaimRetainWriterPodName, cfg.Namespace)
+		}).
+			WithTimeout(cfg.Timeouts.Pod.Duration).
+			WithPolling(5*time.Second).
+			Should(Equal(corev1.PodSucceeded), failurehandler.LLMPrompt(state.GetFramework(), state.GetCluster(), "Investigate EFS writer pod not succeeding for the reclaim policy Retain scenario"))
+
+		pv := boundPersistentVolume(ctx, wcClient, reclaimRetainPVCName)
+		retainedPVName = pv.Name
+		fsID, apID := accessPointFromPV(pv)
+
+		By("Deleting the pod and the PVC")
+		Expect(client.IgnoreNotFound(wcClient.Delete(ctx, writerPod))).To(Succeed())
+		Expect(wcClient.Delete(ctx, &corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{Name: reclaimRetainPVCName, Namespace: cfg.Namespace},
+		})).To(Succeed())
+
+		By("Waiting for the PersistentVolume to become Released")
+		Eventually(func() (corev1.PersistentVolumePhase, error) {
+			var released corev1.PersistentVolume
+			if err := wcClient.Get(ctx, types.NamespacedName{Name: pv.Name}, &released); err != nil {
+				return "", err
+			}
+			GinkgoLogr.Info("retained PV status", "name", pv.Name, "phase", released.Status.Phase)
+			return released.Status.Phase, nil
+		}).WithTimeout(cfg.Timeouts.Volume.Duration).WithPolling(5 * time.Second).Should(Equal(corev1.VolumeReleased))
+
+		By("Verifying the access point still exists via the EFS API")
+		Consistently(func() (bool, error) {
+			return efsapi.AccessPointExists(ctx, apClient, fsID, apID)
+		}).WithTimeout(30 * time.Second).WithPolling(10 * time.Second).Should(BeTrue())
+
+		By("Binding the retained access point through a new static PV")
+		staticPV := &corev1.PersistentVolume{
+			ObjectMeta: metav1.ObjectMeta{Name: reclaimStaticPVName},
+			Spec: corev1.PersistentVolumeSpec{
+				Capacity: corev1.ResourceList{
+					corev1.ResourceStorage: cfg.PVCSize,
+				},
+				AccessModes:                   []corev1.PersistentVolumeAccessMode{corev1.ReadWriteMany},
+				PersistentVolumeReclaimPolicy: corev1.PersistentVolumeReclaimRetain,
+				StorageClassName:              "",
+				PersistentVolumeSource: corev1.PersistentVolumeSource{
+					CSI: &corev1.CSIPersistentVolumeSource{
+						Driver:       efsProvisioner,
+						VolumeHandle: pv.Spec.CSI.VolumeHandle,
+					},
+				},
+				ClaimRef: &corev1.ObjectReference{
+					Namespace: cfg.Namespace,
+					Name:      reclaimStaticPVCName,
+				},
+			},
+		}
+		Expect(wcClient.Create(ctx, staticPV)).To(Succeed())
+
+		staticPVC := testhelpers.NewTestPVC(reclaimStaticPVCName, cfg.Namespace, "")
+		staticPVC.Spec.VolumeName = reclaimStaticPVName
+		Expect(wcClient.Create(ctx, staticPVC)).To(Succeed())
+
+		By("Reading the retained data through the static PV")
+		readerPod := testhelpers.NewTestPod(reclaimStaticReaderPodName, cfg.Namespace, reclaimStaticPVCName,
+			[]string{"sh", "-c", fmt.Sprintf("cat /data/testfile | grep '%s'", testData)},
+		)
+		Expect(wcClient.Create(ctx, readerPod)).To(Succeed())
+		Eventually(func() (corev1.PodPhase, error) {
+			return testhelpers.PodPhase(ctx, wcClient, reclaimStaticReaderPodName, cfg.Namespace)
+		}).
+			WithTimeout(cfg.Timeouts.Pod.Duration).
+			WithPolling(5*time.Second).
+			Should(Equal(corev1.PodSucceeded), failurehandler.LLMPrompt(state.GetFramework(), state.GetCluster(), "Investigate EFS reader pod not reading retained data through a static PV"))
+	})
+}
+
+// cleanupReclaimPolicyResources removes everything the reclaim policy specs
+// created. The retained PV is switched to Delete once nothing references its
+// access point any more, so the provisioner removes the access point before
+// the filesystem is torn down.
+func cleanupReclaimPolicyResources(ctx context.Context, wcClient client.Client, wait bool) error {
+	var objs []client.Object
+	for _, name := range []string{reclaimStaticReaderPodName, reclaimRetainWriterPodName, reclaimDeleteWriterPodName} {
+		objs = append(objs, &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: cfg.Namespace}})
+	}
+	for _, name := range []string{reclaimStaticPVCName, reclaimRetainPVCName, reclaimDeletePVCName} {
+		objs = append(objs, &corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: cfg.Namespace}})
+	}
+	if err := testhelpers.Delete(ctx, wcClient, false, 0, objs...); err != nil {
+		return err
+	}
+
+	staticPV := &corev1.PersistentVolume{ObjectMeta: metav1.ObjectMeta{Name: reclaimStaticPVName}}
+	if err := testhelpers.Delete(ctx, wcClient, wait, cfg.Timeouts.Delete.Duration, staticPV); err != nil {
+		return err
+	}
+
+	if retainedPVName != "" {
+		var pv corev1.PersistentVolume
+		if err := wcClient.Get(ctx, types.NamespacedName{Name: retainedPVName}, &pv); err == nil {
+			patch := client.MergeFrom(pv.DeepCopy())
+			pv.Spec.PersistentVolumeReclaimPolicy = corev1.PersistentVolumeReclaimDelete
+			if err := wcClient.Patch(ctx, &pv, patch); err != nil {
+				return fmt.Errorf("switching retained PV %s to Delete: %w", retainedPVName, err)
+			}
+		}
+		if wait {
+			if err := testhelpers.WaitDeleted(ctx, wcClient, &corev1.PersistentVolume{ObjectMeta: metav1.ObjectMeta{Name: retainedPVName}}, cfg.Timeouts.Delete.Duration); err != nil {
+				return err
+			}
+		}
+	}
+
+	return testhelpers.Delete(ctx, wcClient, false, 0,
+		&storagev1.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: reclaimDeleteSCName}},
+		&storagev1.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: reclaimRetainSCName}},
+	)
+}
+
+func newReclaimStorageClass(name string, reclaimPolicy corev1.PersistentVolumeReclaimPolicy) *storagev1.StorageClass {
+	bindingMode := storagev1.VolumeBindingImmediate
+	return &storagev1.StorageClass{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+		},
+		Provisioner:       efsProvisioner,
+		VolumeBindingMode: &bindingMode,
+		ReclaimPolicy:     &reclaimPolicy,
+		Parameters:        cfg.ParametersFor(efs.FileSystemID(), nil),
+	}
+}
+
+// boundPersistentVolume waits for the PVC to be bound and returns its PV.
+func boundPersistentVolume(ctx context.Context, wcClient client.Client, pvcName string) *corev1.PersistentVolume {
+	var claim corev1.PersistentVolumeClaim
+	Eventually(func() (corev1.PersistentVolumeClaimPhase, error) {
+		err := wcClient.Get(ctx, types.NamespacedName{Name: pvcName, Namespace: cfg.Namespace}, &claim)
+		return claim.Status.Phase, err
+	}).WithTimeout(cfg.Timeouts.Volume.Duration).WithPolling(5 * time.Second).Should(Equal(corev1.ClaimBound))
+
+	var pv corev1.PersistentVolume
+	Expect(wcClient.Get(ctx, types.NamespacedName{Name: claim.Spec.VolumeName}, &pv)).To(Succeed())
+	Expect(pv.Spec.CSI).NotTo(BeNil(), "PV %s is not a CSI volume", pv.Name)
+	return &pv
+}
+
+// accessPointFromPV returns the file system and access point IDs backing a
+// dynamically provisioned PV.
+func accessPointFromPV(pv *corev1.PersistentVolume) (string, string) {
+	fsID, apID, err := efsapi.ParseVolumeHandle(pv.Spec.CSI.VolumeHandle)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(apID).NotTo(BeEmpty(), "PV %s has no access point in its volume handle", pv.Name)
+	GinkgoLogr.Info("volume backed by access point", "pv", pv.Name, "fileSystemID", fsID, "accessPointID", apID)
+	return fsID, apID
+}
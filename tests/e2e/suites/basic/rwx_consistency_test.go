@@ -0,0 +1,256 @@
+package basic
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"e2e/internal/testhelpers"
+
+	"github.com/giantswarm/apptest-framework/v2/pkg/state"
+	clusterclient "github.com/giantswarm/clustertest/v2/pkg/client"
+	"github.com/giantswarm/clustertest/v2/pkg/failurehandler"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	rwxPVCName          = "efs-rwx-consistency-claim-e2e"
+	rwxVerifierPodName  = "efs-rwx-verifier-e2e"
+	rwxIterations       = 50
+	rwxRoleLabel        = "efs-e2e/rwx-role"
+	rwxAppLabel         = "efs-e2e/rwx"
+	rwxZoneTopologyKey  = "topology.kubernetes.io/zone"
+	rwxNodeTopologyKey  = "kubernetes.io/hostname"
+	rwxInconsistencyTag = "INCONSISTENCY"
+)
+
+// rwxWriterScript waits until every writer and reader is running, then
+// appends to a shared log and bumps a shared counter under flock(1), and
+// publishes one small file per iteration. On NFSv4 the Linux client maps
+// flock(2) onto fcntl byte-range locks, so this exercises both.
+const rwxWriterScript = `
+d=/data/rwx
+mkdir -p $d
+touch $d/ready-w$ID
+while [ $(ls $d | grep -c '^ready-') -lt $PODS ]; do sleep 1; done
+i=1
+while [ $i -le $ITERATIONS ]; do
+  printf 'w%s-%s\n' $ID $i > $d/cto-w$ID-$i
+  flock $d/lock sh -c "
+    echo 'w$ID $i' >> $d/append.log
+    c=\$(cat $d/counter 2>/dev/null || echo 0)
+    echo \$((c + 1)) > $d/counter
+    echo cto-w$ID-$i >> $d/published
+  " || echo "INCONSISTENCY lock: flock failed for w$ID iteration $i"
+  i=$((i + 1))
+done
+touch $d/done-w$ID
+echo "writer w$ID done"
+`
+
+// rwxReaderScript opens every published file once its writer has closed it
+// and checks the content is complete (close-to-open consistency).
+const rwxReaderScript = `
+d=/data/rwx
+mkdir -p $d
+touch $d/ready-r$ID
+while [ $(ls $d | grep -c '^ready-') -lt $PODS ]; do sleep 1; done
+seen=" "; checked=0; final=0
+while :; do
+  done_writers=$(ls $d | grep -c '^done-w')
+  for f in $(cat $d/published 2>/dev/null); do
+    case "$seen" in *" $f "*) continue ;; esac
+    want=${f#cto-}
+    got=$(cat $d/$f 2>/dev/null)
+    if [ "$got" != "$want" ]; then
+      echo "INCONSISTENCY close-to-open: reader r$ID read '$got' from $f, expected '$want'"
+    fi
+    seen="$seen$f "
+    checked=$((checked + 1))
+  done
+  [ $final -eq 1 ] && break
+  [ $done_writers -ge $WRITERS ] && final=1
+  sleep 1
+done
+if [ $checked -ne $((WRITERS * ITERATIONS)) ]; then
+  echo "INCONSISTENCY close-to-open: reader r$ID saw $checked published files, expected $((WRITERS * ITERATIONS))"
+fi
+echo "reader r$ID checked $checked files"
+`
+
+// rwxVerifierScript checks the shared append log and counter once all
+// writers are finished.
+const rwxVerifierScript = `
+d=/data/rwx
+expected=$((WRITERS * ITERATIONS))
+lines=$(wc -l < $d/append.log)
+[ "$lines" -eq "$expected" ] || echo "INCONSISTENCY append: $lines lines in append.log, expected $expected"
+counter=$(cat $d/counter)
+[ "$counter" -eq "$expected" ] || echo "INCONSISTENCY lock: counter is $counter, expected $expected (lost update under flock)"
+torn=$(grep -cvE '^w[0-9]+ [0-9]+$' $d/append.log)
+[ "$torn" -eq 0 ] || echo "INCONSISTENCY append: $torn torn or interleaved lines in append.log"
+want=$(seq 1 $ITERATIONS | tr '\n' ' ')
+w=0
+while [ $w -lt $WRITERS ]; do
+  got=$(grep "^w$w " $d/append.log | cut -d' ' -f2 | tr '\n' ' ')
+  [ "$got" = "$want" ] || echo "INCONSISTENCY ordering: appends of writer w$w are out of order or missing"
+  w=$((w + 1))
+done
+echo "verified $lines appends"
+`
+
+var rwxPodNames []string
+
+func rwxConsistencyTests() {
+	It("should keep a shared volume consistent under concurrent multi-node access", func() {
+		Expect(efs).NotTo(BeNil(), "EFS infrastructure was not created")
+		Expect(efs.FileSystemID()).NotTo(BeEmpty(), "EFS filesystem ID is not available")
+
+		wcClient, err := state.GetFramework().WC(state.GetCluster().Name)
+		Expect(err).Should(Succeed())
+		ctx := state.GetContext()
+
+		By("Counting schedulable worker nodes and their zones")
+		var nodes corev1.NodeList
+		Expect(wcClient.List(ctx, &nodes, clusterclient.DoesNotHaveLabels{"node-role.kubernetes.io/control-plane"})).To(Succeed())
+		zones := map[string]string{}
+		nodeZones := map[string]bool{}
+		for _, node := range nodes.Items {
+			if !node.Spec.Unschedulable {
+				zones[node.Name] = node.Labels[rwxZoneTopologyKey]
+				nodeZones[node.Labels[rwxZoneTopologyKey]] = true
+			}
+		}
+		// Writers and readers all need a node of their own.
+		perRole := min(len(zones)/2, cfg.RWX.PodsPerRole)
+		if perRole < 1 {
+			Skip(fmt.Sprintf("need at least 2 schedulable worker nodes, found %d", len(zones)))
+		}
+		GinkgoLogr.Info("running RWX consistency check", "podsPerRole", perRole, "nodes", zones)
+		cleanups.Defer("RWX consistency resources", func(ctx context.Context, wait bool) error {
+			return cleanupRWXConsistencyResources(ctx, wcClient, wait)
+		})
+
+		By("Creating a shared PVC")
+		Expect(wcClient.Create(ctx, testhelpers.NewTestPVC(rwxPVCName, cfg.Namespace, scName))).To(Succeed())
+
+		By(fmt.Sprintf("Starting %d writers and %d readers on distinct nodes", perRole, perRole))
+		// One selector for both roles, so no writer shares a node with a
+		// reader either.
+		shared := map[string]string{rwxAppLabel: "consistency"}
+		for _, role := range []string{"writer", "reader"} {
+			script := rwxWriterScript
+			if role == "reader" {
+				script = rwxReaderScript
+			}
+			for i := 0; i < perRole; i++ {
+				name := fmt.Sprintf("efs-rwx-%s-%d-e2e", role, i)
+				pod := testhelpers.NewTestPod(name, cfg.Namespace, rwxPVCName,
+					[]string{"sh", "-c", script},
+					testhelpers.WithLabels(shared),
+					testhelpers.WithLabels(map[string]string{rwxRoleLabel: role}),
+					testhelpers.WithPodAntiAffinity(shared, rwxNodeTopologyKey),
+					testhelpers.WithTopologySpread(shared, rwxZoneTopologyKey),
+					testhelpers.WithEnv("ID", strconv.Itoa(i)),
+					testhelpers.WithEnv("PODS", strconv.Itoa(2*perRole)),
+					testhelpers.WithEnv("WRITERS", strconv.Itoa(perRole)),
+					testhelpers.WithEnv("ITERATIONS", strconv.Itoa(rwxIterations)),
+				)
+				Expect(wcClient.Create(ctx, pod)).To(Succeed())
+				rwxPodNames = append(rwxPodNames, name)
+			}
+		}
+
+		By("Waiting for all writers and readers to finish")
+		placement := map[string]string{}
+		podNodes := map[string]bool{}
+		podZones := map[string]bool{}
+		for _, name := range rwxPodNames {
+			waitForPodCompletion(ctx, wcClient, name)
+			var pod corev1.Pod
+			Expect(wcClient.Get(ctx, types.NamespacedName{Name: name, Namespace: cfg.Namespace}, &pod)).To(Succeed())
+			placement[name] = fmt.Sprintf("%s (%s)", pod.Spec.NodeName, zones[pod.Spec.NodeName])
+			podNodes[pod.Spec.NodeName] = true
+			podZones[zones[pod.Spec.NodeName]] = true
+		}
+		GinkgoLogr.Info("RWX pod placement", "placement", placement)
+
+		By("Checking that writers and readers ran on distinct nodes and spread over zones")
+		Expect(podNodes).To(HaveLen(len(rwxPodNames)), "writers and readers shared nodes: %v", placement)
+		// The zone spread does not block scheduling, so check it held.
+		if len(nodeZones) > 1 {
+			Expect(len(podZones)).To(BeNumerically(">", 1), "writers and readers all ran in one zone although the nodes span %d: %v", len(nodeZones), placement)
+		}
+
+		By("Verifying the shared append log and lock-protected counter")
+		verifier := testhelpers.NewTestPod(rwxVerifierPodName, cfg.Namespace, rwxPVCName,
+			[]string{"sh", "-c", rwxVerifierScript},
+			testhelpers.WithEnv("WRITERS", strconv.Itoa(perRole)),
+			testhelpers.WithEnv("ITERATIONS", strconv.Itoa(rwxIterations)),
+		)
+		Expect(wcClient.Create(ctx, verifier)).To(Succeed())
+		rwxPodNames = append(rwxPodNames, rwxVerifierPodName)
+		waitForPodCompletion(ctx, wcClient, rwxVerifierPodName)
+
+		By("Collecting inconsistencies reported by readers and the verifier")
+		var inconsistencies []string
+		for _, name := range rwxPodNames {
+			pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: cfg.Namespace}}
+			logs, err := wcClient.GetLogs(ctx, pod, nil)
+			Expect(err).NotTo(HaveOccurred())
+			for _, line := range strings.Split(logs, "\n") {
+				if strings.HasPrefix(line, rwxInconsistencyTag) {
+					inconsistencies = append(inconsistencies, fmt.Sprintf("%s: %s", name, line))
+				}
+			}
+		}
+		AddReportEntry("rwx-consistency", map[string]interface{}{
+			"podsPerRole":     perRole,
+			"iterations":      rwxIterations,
+			"placement":       placement,
+			"nodes":           len(podNodes),
+			"zones":           slices.Sorted(maps.Keys(podZones)),
+			"inconsistencies": inconsistencies,
+		})
+		Expect(inconsistencies).To(BeEmpty(), "shared volume showed inconsistencies across nodes")
+	})
+}
+
+// waitForPodCompletion waits for a pod to terminate and fails if it did not succeed.
+func waitForPodCompletion(ctx context.Context, wcClient client.Client, name string) {
+	Eventually(func() (corev1.PodPhase, error) {
+		return testhelpers.PodPhase(ctx, wcClient, name, cfg.Namespace)
+	}).
+		WithTimeout(cfg.Timeouts.Workload.Duration).
+		WithPolling(5*time.Second).
+		Should(BeElementOf(corev1.PodSucceeded, corev1.PodFailed), failurehandler.LLMPrompt(state.GetFramework(), state.GetCluster(), "Investigate EFS RWX consistency pods not completing - check scheduling across nodes and mount errors"))
+
+	phase, err := testhelpers.PodPhase(ctx, wcClient, name, cfg.Namespace)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(phase).To(Equal(corev1.PodSucceeded), "pod %s failed", name)
+}
+
+// cleanupRWXConsistencyResources removes the consistency pods and the shared
+// PVC and, with wait, waits for the PVC to be gone.
+func cleanupRWXConsistencyResources(ctx context.Context, wcClient client.Client, wait bool) error {
+	var pods []client.Object
+	for _, name := range rwxPodNames {
+		pods = append(pods, &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: cfg.Namespace}})
+	}
+	if err := testhelpers.Delete(ctx, wcClient, false, 0, pods...); err != nil {
+		return err
+	}
+
+	return testhelpers.Delete(ctx, wcClient, wait, cfg.Timeouts.Delete.Duration,
+		&corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: rwxPVCName, Namespace: cfg.Namespace}},
+	)
+}
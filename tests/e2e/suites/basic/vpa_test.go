@@ -0,0 +1,143 @@
+package basic
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/giantswarm/apptest-framework/v2/pkg/state"
+	"github.com/giantswarm/clustertest/v2/pkg/failurehandler"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var vpaGVK = schema.GroupVersionKind{
+	Group:   "autoscaling.k8s.io",
+	Version: "v1",
+	Kind:    "VerticalPodAutoscaler",
+}
+
+// vpaTests checks that the chart's VPAs point at the driver workloads and
+// that the recommender produces recommendations for their containers within
+// the configured bounds.
+func vpaTests() {
+	for _, tc := range []struct {
+		vpa, kind, target string
+	}{
+		{"efs-csi-controller-vpa", "Deployment", "efs-csi-controller"},
+		{"efs-csi-node-vpa", "DaemonSet", "efs-csi-node"},
+	} {
+		It(fmt.Sprintf("should get VPA recommendations for the %s containers", tc.target), func() {
+			wcClient, err := state.GetFramework().WC(state.GetCluster().Name)
+			Expect(err).Should(Succeed())
+			ctx := state.GetContext()
+
+			vpa := &unstructured.Unstructured{}
+			vpa.SetGroupVersionKind(vpaGVK)
+			err = wcClient.Get(ctx, types.NamespacedName{Name: tc.vpa, Namespace: "kube-system"}, vpa)
+			if meta.IsNoMatchError(err) {
+				Skip("the VerticalPodAutoscaler CRD is not installed")
+			}
+			Expect(err).To(Succeed())
+
+			targetRef, _, _ := unstructured.NestedStringMap(vpa.Object, "spec", "targetRef")
+			Expect(targetRef).To(HaveKeyWithValue("kind", tc.kind))
+			Expect(targetRef).To(HaveKeyWithValue("name", tc.target))
+
+			containers := workloadContainers(ctx, wcClient, tc.kind, tc.target)
+
+			By("Checking the container policies name containers of " + tc.target)
+			policies, _, _ := unstructured.NestedSlice(vpa.Object, "spec", "resourcePolicy", "containerPolicies")
+			Expect(policies).NotTo(BeEmpty(), "%s has no container policies", tc.vpa)
+			bounds := map[string]map[string]map[string]string{}
+			for _, p := range policies {
+				policy := p.(map[string]interface{})
+				name, _ := policy["containerName"].(string)
+				Expect(containers).To(ContainElement(name), "%s has a policy for %q, which is not a container of %s", tc.vpa, name, tc.target)
+				bounds[name] = map[string]map[string]string{}
+				for _, bound := range []string{"minAllowed", "maxAllowed"} {
+					bounds[name][bound], _, _ = unstructured.NestedStringMap(policy, bound)
+				}
+			}
+
+			By("Waiting for the recommender to cover " + tc.target)
+			Eventually(func() error {
+				if err := wcClient.Get(ctx, client.ObjectKeyFromObject(vpa), vpa); err != nil {
+					return err
+				}
+				recs, _, _ := unstructured.NestedSlice(vpa.Object, "status", "recommendation", "containerRecommendations")
+				var recommended []string
+				for _, r := range recs {
+					rec := r.(map[string]interface{})
+					name, _ := rec["containerName"].(string)
+					if !slices.Contains(containers, name) {
+						return StopTrying(fmt.Sprintf("%s recommends for %q, which is not a container of %s", tc.vpa, name, tc.target))
+					}
+					recommended = append(recommended, name)
+					target, _, _ := unstructured.NestedStringMap(rec, "target")
+					if err := withinBounds(target, bounds[name]); err != nil {
+						return StopTrying(fmt.Sprintf("%s target for %s: %v", tc.vpa, name, err))
+					}
+				}
+				for name := range bounds {
+					if !slices.Contains(recommended, name) {
+						return fmt.Errorf("no recommendation for %s yet, have %v", name, recommended)
+					}
+				}
+				return nil
+			}).
+				WithTimeout(cfg.Timeouts.VPARecommendation.Duration).
+				WithPolling(15*time.Second).
+				Should(Succeed(), failurehandler.LLMPrompt(state.GetFramework(), state.GetCluster(), "Investigate why the VPA recommender has no recommendation for "+tc.target))
+		})
+	}
+}
+
+// workloadContainers returns the container names in the pod template of
+// the Deployment or DaemonSet.
+func workloadContainers(ctx context.Context, c client.Client, kind, name string) []string {
+	key := types.NamespacedName{Name: name, Namespace: "kube-system"}
+	var template corev1.PodTemplateSpec
+	switch kind {
+	case "Deployment":
+		var d appsv1.Deployment
+		Expect(c.Get(ctx, key, &d)).To(Succeed())
+		template = d.Spec.Template
+	case "DaemonSet":
+		var ds appsv1.DaemonSet
+		Expect(c.Get(ctx, key, &ds)).To(Succeed())
+		template = ds.Spec.Template
+	}
+	var names []string
+	for _, ctr := range template.Spec.Containers {
+		names = append(names, ctr.Name)
+	}
+	return names
+}
+
+// withinBounds checks a recommended target against a container policy's
+// minAllowed and maxAllowed.
+func withinBounds(target map[string]string, bounds map[string]map[string]string) error {
+	for res, value := range target {
+		got, err := resource.ParseQuantity(value)
+		if err != nil {
+			return err
+		}
+		if lo, ok := bounds["minAllowed"][res]; ok && got.Cmp(resource.MustParse(lo)) < 0 {
+			return fmt.Errorf("%s %s is below minAllowed %s", res, value, lo)
+		}
+		if hi, ok := bounds["maxAllowed"][res]; ok && got.Cmp(resource.MustParse(hi)) > 0 {
+			return fmt.Errorf("%s %s is above maxAllowed %s", res, value, hi)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,286 @@
+package benchmark
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"e2e/internal/benchmark"
+	"e2e/internal/cleanup"
+	"e2e/internal/efsinfra"
+	"e2e/internal/suiteconfig"
+	"e2e/internal/testhelpers"
+
+	"github.com/giantswarm/apptest-framework/v2/pkg/state"
+	"github.com/giantswarm/apptest-framework/v2/pkg/suite"
+	"github.com/giantswarm/clustertest/v2/pkg/failurehandler"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	isUpgrade = false
+
+	efsProvisioner = "efs.csi.aws.com"
+
+	// Metrics may deviate this much from the baseline before they are
+	// flagged. EFS performance is noisy, so keep this generous.
+	regressionTolerance = 0.25
+	baselineFile        = "./baseline.json"
+)
+
+var (
+	// Shared state between hooks and tests.
+	efs    *efsinfra.Infra
+	report benchmark.Report
+	// cleanups defers the teardown of everything the specs create.
+	cleanups = cleanup.New(GinkgoLogr)
+	// cfg holds the suite parameters from config.yaml and the environment.
+	cfg suiteconfig.Config
+
+	mountOptionSets = [][]string{
+		nil,
+		{"tls"},
+		{"tls", "iam"},
+	}
+)
+
+// Writes the phase timings recorded by the specs as JUnit properties and a
+// JSON summary, to trend slow AWS and Crossplane phases across runs.
+var _ = ReportAfterSuite("phase report", func(report Report) {
+	if err := testhelpers.WritePhaseReports(report, testhelpers.ReportDir(), "benchmark"); err != nil {
+		GinkgoLogr.Info("writing phase report failed", "error", err.Error())
+	}
+})
+
+// Issues the deletes of teardowns that a second interrupt made Ginkgo skip,
+// and fails the run if anything the specs created may be left behind.
+var _ = ReportAfterSuite("cleanup report", func(ctx SpecContext, _ Report) {
+	teardown := cleanups.Finish(ctx)
+	GinkgoWriter.Printf("cleanup:\n%s", teardown)
+	Expect(teardown.Unconfirmed()).To(BeEmpty(), "resources not confirmed deleted:\n%s", teardown)
+})
+
+func TestBenchmark(t *testing.T) {
+	var err error
+	if cfg, err = suiteconfig.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Benchmark.FioImage == "" {
+		t.Fatal("set e2e.benchmark.fioImage in config.yaml, or E2E_FIO_IMAGE, to a fio image referenced by digest, e.g. gsoci.azurecr.io/giantswarm/fio@sha256:<digest>")
+	}
+	testhelpers.SetDefaults(cfg.PodDefaults())
+	cleanups.WithTimeout(cfg.Timeouts.Cleanup.Duration)
+
+	suite.New().
+		WithInCluster(true).
+		WithInstallNamespace("").
+		WithIsUpgrade(isUpgrade).
+		WithValuesFile("./values.yaml").
+		AfterClusterReady(func() {
+			It("should pull the test image", func() {
+				wcClient, err := state.GetFramework().WC(state.GetCluster().Name)
+				Expect(err).Should(Succeed())
+
+				Expect(testhelpers.CheckImagePull(state.GetContext(), wcClient, "efs-image-pull-e2e", cfg.Namespace, cfg.Benchmark.FioImage, cfg.Timeouts.Pod.Duration)).
+					To(Succeed(), "test pods cannot start on this cluster; set e2e.registryMirror or e2e.imagePullSecrets in config.yaml")
+			})
+		}).
+		Tests(func() {
+			It("should have the HelmRelease ready with the chart version under test", func() {
+				mcClient := state.GetFramework().MC()
+				cluster := state.GetCluster()
+				key := testhelpers.DriverHelmReleaseKey(cluster.Name, cluster.Organization.GetNamespace())
+				version := state.GetApplication().Version
+
+				ready := testhelpers.StartPhase("HelmRelease ready")
+				Eventually(func() error {
+					status, err := testhelpers.GetHelmReleaseStatus(state.GetContext(), *mcClient, key)
+					if err != nil {
+						GinkgoLogr.Info("HelmRelease check failed", "name", key.Name, "error", err.Error())
+						return err
+					}
+					GinkgoLogr.Info("HelmRelease status", "status", status.String())
+					return status.CheckChartVersion(version)
+				}).
+					WithTimeout(cfg.Timeouts.HelmRelease.Duration).
+					WithPolling(10*time.Second).
+					Should(Succeed(), failurehandler.LLMPrompt(state.GetFramework(), state.GetCluster(), "Investigate HelmRelease not ready for aws-efs-csi-driver"))
+				ready(key.Name)
+			})
+
+			// The file system is created once the App is installed and torn
+			// down after the last spec in here, before the App is
+			// uninstalled, so that PVC deletion still removes the access
+			// points.
+			Describe("with EFS infrastructure", Ordered, ContinueOnFailure, func() {
+				BeforeAll(func() {
+					mcClient := state.GetFramework().MC()
+					ctx := state.GetContext()
+					cluster := state.GetCluster()
+
+					efs = efsinfra.New(cluster.Name, cluster.Organization.GetNamespace()).
+						WithLogger(GinkgoLogr).
+						WithTimeouts(cfg.FixtureTimeouts()).
+						WithPhaseRecorder(testhelpers.RecordPhase).
+						WithThroughputMode(cfg.Benchmark.ThroughputModes[0]).
+						WithExistingFromEnv().
+						WithConfigMapState(*mcClient)
+					cleanups.Defer("EFS infrastructure", func(ctx context.Context, wait bool) error {
+						if !wait {
+							return efs.Delete(ctx, *mcClient)
+						}
+						return efs.Cleanup(ctx, *mcClient)
+					})
+					// Resumes the fixture of an interrupted run of this cluster.
+					_, err := efs.LoadState(ctx)
+					Expect(err).NotTo(HaveOccurred())
+					wcClient, err := state.GetFramework().WC(cluster.Name)
+					Expect(err).NotTo(HaveOccurred())
+					// Finds the ProviderConfig and the network, and checks the MC and
+					// WC before anything is made in AWS.
+					preflight := efs.Preflight(ctx, *mcClient, wcClient)
+					AddReportEntry("pre-flight", preflight.String())
+					Expect(preflight.Err()).NotTo(HaveOccurred(), "the EFS fixture cannot be created for this cluster; see the fix under each failed check")
+					Expect(efs.Create(ctx, *mcClient)).To(Succeed())
+				})
+
+				for _, mode := range cfg.Benchmark.ThroughputModes {
+					It(fmt.Sprintf("should switch the file system to throughput mode %s", mode), func() {
+						Expect(efs).NotTo(BeNil(), "EFS infrastructure was not created")
+						if efs.Reused() {
+							if efs.ThroughputMode() != mode {
+								Skip(fmt.Sprintf("the reused file system %s is in throughput mode %q and is not changed", efs.FileSystemID(), efs.ThroughputMode()))
+							}
+							return
+						}
+						mcClient := state.GetFramework().MC()
+						Expect(efs.SetThroughputMode(state.GetContext(), *mcClient, mode)).To(Succeed())
+					})
+
+					for i, mountOptions := range mountOptionSets {
+						profile := benchmark.Profile{MountOptions: mountOptions, ThroughputMode: mode}
+
+						It(fmt.Sprintf("should benchmark a volume with profile %s", profile.Key()), func() {
+							Expect(efs).NotTo(BeNil(), "EFS infrastructure was not created")
+							Expect(efs.FileSystemID()).NotTo(BeEmpty(), "EFS filesystem ID is not available")
+							if efs.ThroughputMode() != mode {
+								Skip(fmt.Sprintf("the file system is in throughput mode %q, not %s", efs.ThroughputMode(), mode))
+							}
+
+							wcClient, err := state.GetFramework().WC(state.GetCluster().Name)
+							Expect(err).Should(Succeed())
+							ctx := state.GetContext()
+
+							scName := benchmarkName(mode, i, "sc")
+							pvcName := benchmarkName(mode, i, "claim")
+							podName := benchmarkName(mode, i, "fio")
+
+							cleanups.Defer("volume "+pvcName, func(ctx context.Context, wait bool) error {
+								return testhelpers.DeleteVolume(ctx, wcClient, wait, cfg.Timeouts.Delete.Duration, cfg.Namespace, pvcName, scName, podName)
+							})
+
+							By("Creating a StorageClass with the profile's mount options")
+							bindingMode := storagev1.VolumeBindingImmediate
+							reclaimPolicy := corev1.PersistentVolumeReclaimDelete
+							Expect(wcClient.Create(ctx, &storagev1.StorageClass{
+								ObjectMeta:        metav1.ObjectMeta{Name: scName},
+								Provisioner:       efsProvisioner,
+								VolumeBindingMode: &bindingMode,
+								ReclaimPolicy:     &reclaimPolicy,
+								MountOptions:      mountOptions,
+								Parameters:        cfg.ParametersFor(efs.FileSystemID(), nil),
+							})).To(Succeed())
+							Expect(wcClient.Create(ctx, testhelpers.NewTestPVC(pvcName, cfg.Namespace, scName))).To(Succeed())
+
+							By("Running fio against the volume")
+							pod := testhelpers.NewTestPod(podName, cfg.Namespace, pvcName,
+								benchmark.FioArgs("/data", cfg.Benchmark.Runtime.Duration),
+								testhelpers.WithImage(cfg.Benchmark.FioImage),
+							)
+							Expect(wcClient.Create(ctx, pod)).To(Succeed())
+
+							Eventually(func() (corev1.PodPhase, error) {
+								return testhelpers.PodPhase(ctx, wcClient, podName, cfg.Namespace)
+							}).
+								WithTimeout(cfg.Benchmark.Timeout.Duration).
+								WithPolling(10*time.Second).
+								Should(BeElementOf(corev1.PodSucceeded, corev1.PodFailed), failurehandler.LLMPrompt(state.GetFramework(), state.GetCluster(), "Investigate EFS fio benchmark pod not completing"))
+
+							logs, err := wcClient.GetLogs(ctx, pod, nil)
+							Expect(err).NotTo(HaveOccurred())
+							phase, err := testhelpers.PodPhase(ctx, wcClient, podName, cfg.Namespace)
+							Expect(err).NotTo(HaveOccurred())
+							Expect(phase).To(Equal(corev1.PodSucceeded), "fio failed:\n%s", logs)
+
+							jobs, err := benchmark.ParseFioOutput(logs)
+							Expect(err).NotTo(HaveOccurred())
+							run := benchmark.Run{
+								ChartVersion: state.GetApplication().Version,
+								Profile:      profile,
+								Jobs:         jobs,
+							}
+							report.Runs = append(report.Runs, run)
+							AddReportEntry("benchmark "+profile.Key(), run)
+						})
+					}
+				}
+
+				It("should compare the mount options and throughput modes", func() {
+					Expect(report.Runs).NotTo(BeEmpty(), "no benchmark results were collected")
+
+					// Every profile is set against the plain mount of the first
+					// throughput mode of the same run.
+					reference := benchmark.Profile{ThroughputMode: cfg.Benchmark.ThroughputModes[0]}
+					report.Comparison = benchmark.CompareProfiles(report.Runs, reference)
+					comparison := make([]string, 0, len(report.Comparison))
+					for _, d := range report.Comparison {
+						comparison = append(comparison, d.String())
+					}
+					AddReportEntry("benchmark comparison", comparison)
+					Expect(report.Comparison).NotTo(BeEmpty(), "no run of profile %s to compare the others with", reference.Key())
+				})
+
+				It("should not regress against the stored baseline", func() {
+					Expect(report.Runs).NotTo(BeEmpty(), "no benchmark results were collected")
+
+					resultsFile := filepath.Join(testhelpers.ReportDir(), "benchmark-results.json")
+					Expect(benchmark.WriteReport(resultsFile, report)).To(Succeed())
+					GinkgoLogr.Info("wrote benchmark results", "path", resultsFile)
+
+					baseline, err := benchmark.LoadReport(baselineFile)
+					Expect(err).NotTo(HaveOccurred())
+
+					var regressions, missing []string
+					for _, run := range report.Runs {
+						base, ok := baseline.Find(run.Profile)
+						if !ok {
+							missing = append(missing, run.Profile.Key())
+							continue
+						}
+						for _, r := range benchmark.Compare(base, run, regressionTolerance) {
+							regressions = append(regressions, r.String())
+						}
+					}
+					AddReportEntry("benchmark regressions", regressions)
+					// A profile without a baseline has nothing to regress
+					// against. It is listed so the baseline can be recorded.
+					if len(missing) > 0 {
+						AddReportEntry("benchmark profiles without baseline", missing)
+						GinkgoLogr.Info("profiles without baseline, record one from the results on a reference cluster", "baseline", baselineFile, "results", resultsFile, "profiles", missing)
+					}
+					Expect(regressions).To(BeEmpty(), "benchmark results regressed by more than %.0f%% against %s", regressionTolerance*100, baselineFile)
+				})
+			})
+		}).
+		Run(t, "EFS Benchmark")
+}
+
+func benchmarkName(mode string, profile int, kind string) string {
+	return fmt.Sprintf("efs-bench-%s-%d-%s-e2e", mode, profile, kind)
+}
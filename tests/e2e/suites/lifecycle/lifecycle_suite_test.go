@@ -0,0 +1,424 @@
+package lifecycle
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"e2e/internal/cleanup"
+	"e2e/internal/efsinfra"
+	"e2e/internal/iowatch"
+	"e2e/internal/suiteconfig"
+	"e2e/internal/testhelpers"
+
+	"github.com/giantswarm/apptest-framework/v2/pkg/state"
+	"github.com/giantswarm/apptest-framework/v2/pkg/suite"
+	clusterclient "github.com/giantswarm/clustertest/v2/pkg/client"
+	"github.com/giantswarm/clustertest/v2/pkg/failurehandler"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	isUpgrade = false
+
+	efsProvisioner = "efs.csi.aws.com"
+	heartbeatFile  = "/data/heartbeat"
+	seedFile       = "/data/seed"
+)
+
+// lifecycleVolume is a volume provisioned before the uninstall, mounted by a
+// pod that keeps writing heartbeats to it throughout.
+//
+// While the app is gone, I/O on these volumes is expected to block, not
+// fail: efs-utils routes every mount through an efs-proxy (or stunnel)
+// process inside the efs-plugin container, which dies with efs-csi-node.
+// The kernel keeps retrying the hard NFS mount, and writes resume once the
+// reinstalled node plugin restarts the proxies from their state in
+// /var/run/efs. The stall is reported, not bounded, since it spans the whole
+// uninstall and reinstall.
+type lifecycleVolume struct {
+	name         string
+	mountOptions []string
+}
+
+var (
+	// Shared state between hooks and tests.
+	efs         *efsinfra.Infra
+	uninstalled time.Time
+	reinstalled time.Time
+	// cleanups defers the teardown of everything the specs create.
+	cleanups = cleanup.New(GinkgoLogr)
+	// cfg holds the suite parameters from config.yaml and the environment.
+	cfg suiteconfig.Config
+
+	// policyExceptions are the PolicyExceptions of pss-exceptions.yaml.
+	// They belong to the release, so uninstall removes them and the
+	// reinstall creates them again.
+	policyExceptions = []string{"aws-efs-csi-controller-exceptions", "aws-efs-csi-node-exceptions"}
+	// installedExceptions maps the policyExceptions found before the
+	// uninstall to their creation time.
+	installedExceptions = map[string]time.Time{}
+
+	volumes = []lifecycleVolume{
+		{name: "efs-lifecycle-plain-e2e"},
+		{name: "efs-lifecycle-tls-e2e", mountOptions: []string{"tls"}},
+	}
+
+	vpaGVK = schema.GroupVersionKind{
+		Group:   "autoscaling.k8s.io",
+		Version: "v1",
+		Kind:    "VerticalPodAutoscaler",
+	}
+	policyExceptionGVK = schema.GroupVersionKind{
+		Group:   "kyverno.io",
+		Version: "v2",
+		Kind:    "PolicyException",
+	}
+)
+
+// Writes the phase timings recorded by the specs as JUnit properties and a
+// JSON summary, to trend slow AWS and Crossplane phases across runs.
+var _ = ReportAfterSuite("phase report", func(report Report) {
+	if err := testhelpers.WritePhaseReports(report, testhelpers.ReportDir(), "lifecycle"); err != nil {
+		GinkgoLogr.Info("writing phase report failed", "error", err.Error())
+	}
+})
+
+// Issues the deletes of teardowns that a second interrupt made Ginkgo skip,
+// and fails the run if anything the specs created may be left behind.
+var _ = ReportAfterSuite("cleanup report", func(ctx SpecContext, _ Report) {
+	teardown := cleanups.Finish(ctx)
+	GinkgoWriter.Printf("cleanup:\n%s", teardown)
+	Expect(teardown.Unconfirmed()).To(BeEmpty(), "resources not confirmed deleted:\n%s", teardown)
+})
+
+func TestLifecycle(t *testing.T) {
+	var err error
+	if cfg, err = suiteconfig.Load(); err != nil {
+		t.Fatal(err)
+	}
+	testhelpers.SetDefaults(cfg.PodDefaults())
+	cleanups.WithTimeout(cfg.Timeouts.Cleanup.Duration)
+
+	suite.New().
+		WithInCluster(true).
+		WithInstallNamespace("").
+		WithIsUpgrade(isUpgrade).
+		WithValuesFile("./values.yaml").
+		AfterClusterReady(func() {
+			It("should pull the test image", func() {
+				wcClient, err := state.GetFramework().WC(state.GetCluster().Name)
+				Expect(err).Should(Succeed())
+
+				Expect(testhelpers.CheckImagePull(state.GetContext(), wcClient, "efs-image-pull-e2e", cfg.Namespace, cfg.Image, cfg.Timeouts.Pod.Duration)).
+					To(Succeed(), "test pods cannot start on this cluster; set e2e.registryMirror or e2e.imagePullSecrets in config.yaml")
+			})
+		}).
+		Tests(func() {
+			It("should have the HelmRelease ready with the chart version under test", func() {
+				waitForHelmRelease()
+			})
+
+			// The file system and the volumes are created once the App is
+			// installed and torn down after the last spec in here, when the
+			// driver is installed again.
+			Describe("with EFS infrastructure", Ordered, ContinueOnFailure, func() {
+				BeforeAll(func() {
+					mcClient := state.GetFramework().MC()
+					ctx := state.GetContext()
+					cluster := state.GetCluster()
+
+					efs = efsinfra.New(cluster.Name, cluster.Organization.GetNamespace()).
+						WithLogger(GinkgoLogr).
+						WithTimeouts(cfg.FixtureTimeouts()).
+						WithPhaseRecorder(testhelpers.RecordPhase).
+						WithExistingFromEnv().
+						WithConfigMapState(*mcClient)
+					cleanups.Defer("EFS infrastructure", func(ctx context.Context, wait bool) error {
+						if !wait {
+							return efs.Delete(ctx, *mcClient)
+						}
+						return efs.Cleanup(ctx, *mcClient)
+					})
+					// Resumes the fixture of an interrupted run of this cluster.
+					_, err := efs.LoadState(ctx)
+					Expect(err).NotTo(HaveOccurred())
+					wcClient, err := state.GetFramework().WC(cluster.Name)
+					Expect(err).NotTo(HaveOccurred())
+					// Finds the ProviderConfig and the network, and checks the MC and
+					// WC before anything is made in AWS.
+					preflight := efs.Preflight(ctx, *mcClient, wcClient)
+					AddReportEntry("pre-flight", preflight.String())
+					Expect(preflight.Err()).NotTo(HaveOccurred(), "the EFS fixture cannot be created for this cluster; see the fix under each failed check")
+					Expect(efs.Create(ctx, *mcClient)).To(Succeed())
+
+					// The volumes outlive the uninstall and reinstall specs.
+					for _, v := range volumes {
+						By(fmt.Sprintf("Provisioning %s with mount options %v", v.name, v.mountOptions))
+						// Without a reinstalled driver nothing removes the access
+						// point, so there is no point waiting; it goes with the
+						// file system.
+						cleanups.Defer("volume "+v.name, func(ctx context.Context, wait bool) error {
+							return testhelpers.DeleteVolume(ctx, wcClient, wait && !reinstalled.IsZero(), cfg.Timeouts.Delete.Duration, cfg.Namespace, v.name, v.name, v.name, v.name+"-reader")
+						})
+						bindingMode := storagev1.VolumeBindingImmediate
+						reclaimPolicy := corev1.PersistentVolumeReclaimDelete
+						Expect(wcClient.Create(ctx, &storagev1.StorageClass{
+							ObjectMeta:        metav1.ObjectMeta{Name: v.name},
+							Provisioner:       efsProvisioner,
+							VolumeBindingMode: &bindingMode,
+							ReclaimPolicy:     &reclaimPolicy,
+							MountOptions:      v.mountOptions,
+							Parameters:        cfg.ParametersFor(efs.FileSystemID(), nil),
+						})).To(Succeed())
+						Expect(wcClient.Create(ctx, testhelpers.NewTestPVC(v.name, cfg.Namespace, v.name))).To(Succeed())
+						Expect(wcClient.Create(ctx, testhelpers.NewTestPod(v.name, cfg.Namespace, v.name, []string{
+							"sh", "-c", fmt.Sprintf("echo %s > %s && %s", v.name, seedFile, iowatch.HeartbeatScript(heartbeatFile)),
+						}))).To(Succeed())
+					}
+
+					for _, v := range volumes {
+						Eventually(func() (corev1.PodPhase, error) {
+							return testhelpers.PodPhase(ctx, wcClient, v.name, cfg.Namespace)
+						}).
+							WithTimeout(cfg.Timeouts.Pod.Duration).
+							WithPolling(5*time.Second).
+							Should(Equal(corev1.PodRunning), failurehandler.LLMPrompt(state.GetFramework(), state.GetCluster(), "Investigate EFS heartbeat pod not starting before the uninstall"))
+					}
+				})
+
+				It("should remove the driver from the workload cluster when the app is deleted", func() {
+					mcClient := state.GetFramework().MC()
+					wcClient, err := state.GetFramework().WC(state.GetCluster().Name)
+					Expect(err).Should(Succeed())
+					ctx := state.GetContext()
+					cluster := state.GetCluster()
+
+					By("Recording the PolicyExceptions the chart installed")
+					for _, name := range policyExceptions {
+						created, err := policyExceptionCreated(ctx, wcClient, name)
+						Expect(err).NotTo(HaveOccurred(), "PolicyException %s of the chart was not installed", name)
+						installedExceptions[name] = created
+					}
+
+					By("Deleting the bundle App")
+					uninstalled = time.Now()
+					Expect(mcClient.DeleteApp(ctx, *state.GetApplication())).To(Succeed())
+
+					By("Waiting for the HelmRelease to be gone")
+					key := testhelpers.DriverHelmReleaseKey(cluster.Name, cluster.Organization.GetNamespace())
+					Eventually(func() bool {
+						_, err := testhelpers.GetHelmReleaseStatus(ctx, *mcClient, key)
+						return apierrors.IsNotFound(err)
+					}).
+						WithTimeout(cfg.Timeouts.HelmRelease.Duration).
+						WithPolling(10*time.Second).
+						Should(BeTrue(), failurehandler.LLMPrompt(state.GetFramework(), state.GetCluster(), "Investigate aws-efs-csi-driver HelmRelease not being removed after deleting the App"))
+
+					By("Waiting for the release's resources to be removed from the workload cluster")
+					gone := []client.Object{
+						&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "efs-csi-controller", Namespace: "kube-system"}},
+						&appsv1.DaemonSet{ObjectMeta: metav1.ObjectMeta{Name: "efs-csi-node", Namespace: "kube-system"}},
+						&storagev1.CSIDriver{ObjectMeta: metav1.ObjectMeta{Name: efsProvisioner}},
+						&networkingv1.NetworkPolicy{ObjectMeta: metav1.ObjectMeta{Name: "aws-efs-csi", Namespace: "kube-system"}},
+					}
+					for _, name := range []string{"efs-csi-controller-vpa", "efs-csi-node-vpa"} {
+						gone = append(gone, newUnstructured(vpaGVK, name, "kube-system"))
+					}
+					for _, name := range policyExceptions {
+						gone = append(gone, newUnstructured(policyExceptionGVK, name, "policy-exceptions"))
+					}
+					for _, obj := range gone {
+						Eventually(func() error {
+							return expectGone(ctx, wcClient, obj)
+						}).
+							WithTimeout(cfg.Timeouts.Rollout.Duration).
+							WithPolling(10*time.Second).
+							Should(Succeed(), failurehandler.LLMPrompt(state.GetFramework(), state.GetCluster(), "Investigate aws-efs-csi-driver resources left behind on the workload cluster after uninstall"))
+					}
+				})
+
+				It("should delete the Crossplane IAM role", func() {
+					mcClient := state.GetFramework().MC()
+					ctx := state.GetContext()
+
+					Eventually(func() bool {
+						_, err := testhelpers.GetDriverIAMRole(ctx, *mcClient, state.GetCluster().Name)
+						return apierrors.IsNotFound(err)
+					}).
+						WithTimeout(cfg.Timeouts.Crossplane.Duration).
+						WithPolling(10*time.Second).
+						Should(BeTrue(), failurehandler.LLMPrompt(state.GetFramework(), state.GetCluster(), "Investigate aws-efs-csi-driver IAM Role not deleted after uninstall"))
+				})
+
+				It("should reinstall and pick up the existing volumes without data loss", func() {
+					mcClient := state.GetFramework().MC()
+					wcClient, err := state.GetFramework().WC(state.GetCluster().Name)
+					Expect(err).Should(Succeed())
+					ctx := state.GetContext()
+
+					By("Recreating the bundle App")
+					reinstalled = time.Now()
+					Expect(mcClient.DeployApp(ctx, *state.GetApplication())).To(Succeed())
+					waitForHelmRelease()
+
+					By("Checking the reinstall created the PolicyExceptions again")
+					for name, before := range installedExceptions {
+						created, err := policyExceptionCreated(ctx, wcClient, name)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(created).To(BeTemporally(">", before), "PolicyException %s was not recreated by the reinstall", name)
+					}
+
+					By("Waiting for efs-csi-node to be ready on every node")
+					Eventually(func() error {
+						var ds appsv1.DaemonSet
+						if err := wcClient.Get(ctx, types.NamespacedName{Name: "efs-csi-node", Namespace: "kube-system"}, &ds); err != nil {
+							return err
+						}
+						if ds.Status.DesiredNumberScheduled == 0 || ds.Status.NumberReady != ds.Status.DesiredNumberScheduled {
+							return fmt.Errorf("efs-csi-node has %d/%d pods ready", ds.Status.NumberReady, ds.Status.DesiredNumberScheduled)
+						}
+						return nil
+					}).WithTimeout(cfg.Timeouts.Rollout.Duration).WithPolling(10 * time.Second).Should(Succeed())
+
+					report := map[string]interface{}{
+						"uninstalled": uninstalled,
+						"reinstalled": reinstalled,
+					}
+					for _, v := range volumes {
+						By(fmt.Sprintf("Waiting for heartbeats on %s to resume", v.name))
+						Eventually(func() (time.Time, error) {
+							return lastHeartbeat(ctx, wcClient, v.name)
+						}).
+							WithTimeout(cfg.Timeouts.Remount.Duration).
+							WithPolling(10*time.Second).
+							Should(BeTemporally(">", reinstalled), failurehandler.LLMPrompt(state.GetFramework(), state.GetCluster(), "Investigate EFS mount not recovering after reinstalling aws-efs-csi-driver"))
+
+						pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: v.name, Namespace: cfg.Namespace}}
+						logs, err := wcClient.GetLogs(ctx, pod, nil)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(iowatch.IOErrors(logs)).To(BeEmpty(), "%s saw failed writes", v.name)
+
+						content, err := readFile(ctx, wcClient, v.name, heartbeatFile)
+						Expect(err).NotTo(HaveOccurred())
+						longest := iowatch.LongestGap(iowatch.ParseHeartbeats(content))
+						report[v.name] = map[string]interface{}{
+							"mountOptions": v.mountOptions,
+							"longestGap":   longest.Duration().String(),
+							"gapFrom":      longest.From,
+						}
+
+						By(fmt.Sprintf("Reading the data written to %s before the uninstall", v.name))
+						reader := v.name + "-reader"
+						Expect(wcClient.Create(ctx, testhelpers.NewTestPod(reader, cfg.Namespace, v.name,
+							[]string{"sh", "-c", fmt.Sprintf("grep -x %s %s", v.name, seedFile)},
+						))).To(Succeed())
+						Eventually(func() (corev1.PodPhase, error) {
+							return testhelpers.PodPhase(ctx, wcClient, reader, cfg.Namespace)
+						}).
+							WithTimeout(cfg.Timeouts.Pod.Duration).
+							WithPolling(5*time.Second).
+							Should(Equal(corev1.PodSucceeded), failurehandler.LLMPrompt(state.GetFramework(), state.GetCluster(), "Investigate EFS volume not readable through the reinstalled driver"))
+					}
+					AddReportEntry("lifecycle", report)
+				})
+			})
+		}).
+		Run(t, "EFS Lifecycle")
+}
+
+func waitForHelmRelease() {
+	mcClient := state.GetFramework().MC()
+	cluster := state.GetCluster()
+	key := testhelpers.DriverHelmReleaseKey(cluster.Name, cluster.Organization.GetNamespace())
+	version := state.GetApplication().Version
+
+	ready := testhelpers.StartPhase("HelmRelease ready")
+	Eventually(func() error {
+		status, err := testhelpers.GetHelmReleaseStatus(state.GetContext(), *mcClient, key)
+		if err != nil {
+			GinkgoLogr.Info("HelmRelease check failed", "name", key.Name, "error", err.Error())
+			return err
+		}
+		GinkgoLogr.Info("HelmRelease status", "status", status.String())
+		return status.CheckChartVersion(version)
+	}).
+		WithTimeout(cfg.Timeouts.HelmRelease.Duration).
+		WithPolling(10*time.Second).
+		Should(Succeed(), failurehandler.LLMPrompt(state.GetFramework(), state.GetCluster(), "Investigate HelmRelease not ready for aws-efs-csi-driver"))
+	ready(key.Name)
+}
+
+// expectGone returns nil once obj no longer exists. A missing CRD (e.g. no
+// VPA installed) counts as gone.
+func expectGone(ctx context.Context, c client.Client, obj client.Object) error {
+	err := c.Get(ctx, client.ObjectKeyFromObject(obj), obj)
+	switch {
+	case apierrors.IsNotFound(err), meta.IsNoMatchError(err):
+		return nil
+	case err != nil:
+		return err
+	default:
+		return fmt.Errorf("%T %s still exists", obj, client.ObjectKeyFromObject(obj))
+	}
+}
+
+// policyExceptionCreated returns when a PolicyException of the chart was
+// created.
+func policyExceptionCreated(ctx context.Context, c client.Client, name string) (time.Time, error) {
+	obj := newUnstructured(policyExceptionGVK, name, "policy-exceptions")
+	if err := c.Get(ctx, client.ObjectKeyFromObject(obj), obj); err != nil {
+		return time.Time{}, err
+	}
+	return obj.GetCreationTimestamp().Time, nil
+}
+
+func newUnstructured(gvk schema.GroupVersionKind, name, namespace string) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(gvk)
+	obj.SetName(name)
+	obj.SetNamespace(namespace)
+	return obj
+}
+
+// readFile returns a file from a test pod's volume. The exec is bounded so a
+// stalled mount fails the call instead of hanging the suite.
+func readFile(ctx context.Context, c *clusterclient.Client, pod, path string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	stdout, stderr, err := c.ExecInPod(ctx, pod, cfg.Namespace, "test", []string{"cat", path})
+	if err != nil {
+		return "", fmt.Errorf("reading %s in %s: %w (stderr: %s)", path, pod, err, strings.TrimSpace(stderr))
+	}
+	return stdout, nil
+}
+
+// lastHeartbeat returns the newest heartbeat written by a pod.
+func lastHeartbeat(ctx context.Context, c *clusterclient.Client, pod string) (time.Time, error) {
+	content, err := readFile(ctx, c, pod, heartbeatFile)
+	if err != nil {
+		return time.Time{}, err
+	}
+	beats := iowatch.ParseHeartbeats(content)
+	if len(beats) == 0 {
+		return time.Time{}, fmt.Errorf("no heartbeats in %s yet", pod)
+	}
+	last := beats[len(beats)-1]
+	GinkgoLogr.Info("last heartbeat", "pod", pod, "at", last, "count", strconv.Itoa(len(beats)))
+	return last, nil
+}
@@ -0,0 +1,222 @@
+package resilience
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"e2e/internal/efsapi"
+	"e2e/internal/testhelpers"
+
+	"github.com/giantswarm/apptest-framework/v2/pkg/state"
+	"github.com/giantswarm/clustertest/v2/pkg/failurehandler"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	failoverSCName = "efs-failover-e2e"
+
+	// provisionerLease is the Lease csi-provisioner uses for leader
+	// election: the driver name with dots replaced by dashes.
+	provisionerLease = "efs-csi-aws-com"
+)
+
+func failoverTests() {
+	It("should bind every PVC exactly once when the controller leader is killed mid-burst", func() {
+		Expect(efs).NotTo(BeNil(), "EFS infrastructure was not created")
+		Expect(efs.FileSystemID()).NotTo(BeEmpty(), "EFS filesystem ID is not available")
+
+		wcClient, err := state.GetFramework().WC(state.GetCluster().Name)
+		Expect(err).Should(Succeed())
+		ctx := state.GetContext()
+
+		var controllers corev1.PodList
+		Expect(wcClient.List(ctx, &controllers, client.InNamespace("kube-system"), client.MatchingLabels{"app": "efs-csi-controller"})).To(Succeed())
+		if len(controllers.Items) < 2 {
+			Skip(fmt.Sprintf("need at least 2 efs-csi-controller replicas for a failover, found %d", len(controllers.Items)))
+		}
+		apClient := testhelpers.AccessPointClient(ctx, efs.Region())
+		cleanups.Defer("failover resources", func(ctx context.Context, wait bool) error {
+			return cleanupFailoverResources(ctx, wcClient, wait)
+		})
+
+		By("Finding the current leader from the Lease")
+		leader, err := leaseHolder(ctx, wcClient)
+		Expect(err).NotTo(HaveOccurred())
+		leaderPod := controllerPodFor(controllers.Items, leader)
+		Expect(leaderPod).NotTo(BeNil(), "Lease holder %q is not one of the efs-csi-controller pods", leader)
+		GinkgoLogr.Info("current provisioner leader", "holder", leader, "pod", leaderPod.Name, "node", leaderPod.Spec.NodeName)
+
+		bindingMode := storagev1.VolumeBindingImmediate
+		reclaimPolicy := corev1.PersistentVolumeReclaimDelete
+		Expect(wcClient.Create(ctx, &storagev1.StorageClass{
+			ObjectMeta:        metav1.ObjectMeta{Name: failoverSCName},
+			Provisioner:       efsProvisioner,
+			VolumeBindingMode: &bindingMode,
+			ReclaimPolicy:     &reclaimPolicy,
+			Parameters:        cfg.ParametersFor(efs.FileSystemID(), nil),
+		})).To(Succeed())
+
+		// A reused file system may hold access points of other runs, so only
+		// those created from here on are checked for orphans.
+		existing := map[string]bool{}
+		aps, err := apClient.ListAccessPoints(ctx, efs.FileSystemID())
+		Expect(err).NotTo(HaveOccurred())
+		for _, ap := range aps {
+			existing[ap.ID] = true
+		}
+
+		By(fmt.Sprintf("Creating %d PVCs and killing the leader while they are in flight", cfg.Resilience.FailoverPVCs))
+		var wg sync.WaitGroup
+		errs := make(chan error, cfg.Resilience.FailoverPVCs)
+		for i := 0; i < cfg.Resilience.FailoverPVCs; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				defer GinkgoRecover()
+				errs <- wcClient.Create(ctx, testhelpers.NewTestPVC(failoverPVCName(i), cfg.Namespace, failoverSCName))
+			}(i)
+			if i == cfg.Resilience.FailoverPVCs/2 {
+				Expect(wcClient.Delete(ctx, leaderPod, client.GracePeriodSeconds(0))).To(Succeed())
+			}
+		}
+		killed := time.Now()
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		By("Waiting for another replica to take the Lease over")
+		var newLeader string
+		Eventually(func() (string, error) {
+			newLeader, err = leaseHolder(ctx, wcClient)
+			return newLeader, err
+		}).
+			WithTimeout(cfg.Resilience.FailoverWindow.Duration).
+			WithPolling(2*time.Second).
+			ShouldNot(Or(BeEmpty(), Equal(leader)), failurehandler.LLMPrompt(state.GetFramework(), state.GetCluster(), "Investigate efs-csi-controller leader election not failing over - check the Lease and csi-provisioner logs"))
+		failover := time.Since(killed)
+		GinkgoLogr.Info("provisioner leader failed over", "from", leader, "to", newLeader, "after", failover)
+
+		By("Waiting for every PVC to bind")
+		Eventually(func() (int, error) {
+			bound := 0
+			for i := 0; i < cfg.Resilience.FailoverPVCs; i++ {
+				var pvc corev1.PersistentVolumeClaim
+				if err := wcClient.Get(ctx, types.NamespacedName{Name: failoverPVCName(i), Namespace: cfg.Namespace}, &pvc); err != nil {
+					return bound, err
+				}
+				if pvc.Status.Phase == corev1.ClaimBound {
+					bound++
+				}
+			}
+			return bound, nil
+		}).
+			WithTimeout(cfg.Resilience.FailoverBindTimeout.Duration).
+			WithPolling(5*time.Second).
+			Should(Equal(cfg.Resilience.FailoverPVCs), failurehandler.LLMPrompt(state.GetFramework(), state.GetCluster(), "Investigate PVCs not binding after efs-csi-controller leader failover"))
+		bindTime := time.Since(killed)
+
+		By("Checking no PVC got a duplicate volume or access point")
+		var pvs corev1.PersistentVolumeList
+		Expect(wcClient.List(ctx, &pvs)).To(Succeed())
+		volumesPerClaim := map[string][]string{}
+		claimPerAccessPoint := map[string]string{}
+		for _, pv := range pvs.Items {
+			if pv.Spec.StorageClassName != failoverSCName || pv.Spec.ClaimRef == nil || pv.Spec.CSI == nil {
+				continue
+			}
+			claim := pv.Spec.ClaimRef.Name
+			volumesPerClaim[claim] = append(volumesPerClaim[claim], pv.Name)
+			_, apID, err := efsapi.ParseVolumeHandle(pv.Spec.CSI.VolumeHandle)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(claimPerAccessPoint).NotTo(HaveKey(apID), "access point %s backs both %s and %s", apID, claimPerAccessPoint[apID], claim)
+			claimPerAccessPoint[apID] = claim
+		}
+		Expect(volumesPerClaim).To(HaveLen(cfg.Resilience.FailoverPVCs))
+		for claim, volumes := range volumesPerClaim {
+			Expect(volumes).To(HaveLen(1), "PVC %s has several volumes provisioned: %v", claim, volumes)
+		}
+
+		By("Checking the file system has no orphaned access points")
+		known := map[string]bool{}
+		for _, pv := range pvs.Items {
+			if pv.Spec.CSI == nil {
+				continue
+			}
+			if _, apID, err := efsapi.ParseVolumeHandle(pv.Spec.CSI.VolumeHandle); err == nil {
+				known[apID] = true
+			}
+		}
+		aps, err = apClient.ListAccessPoints(ctx, efs.FileSystemID())
+		Expect(err).NotTo(HaveOccurred())
+		var orphaned []string
+		for _, ap := range aps {
+			if !known[ap.ID] && !existing[ap.ID] {
+				orphaned = append(orphaned, ap.ID)
+			}
+		}
+		Expect(orphaned).To(BeEmpty(), "access points created during the failover without a PersistentVolume")
+
+		AddReportEntry("controller-failover", map[string]interface{}{
+			"pvcs":       cfg.Resilience.FailoverPVCs,
+			"fromLeader": leader,
+			"toLeader":   newLeader,
+			"failover":   failover.String(),
+			"allBound":   bindTime.String(),
+		})
+	})
+}
+
+// leaseHolder returns the identity holding the csi-provisioner Lease.
+func leaseHolder(ctx context.Context, wcClient client.Client) (string, error) {
+	var lease coordinationv1.Lease
+	if err := wcClient.Get(ctx, types.NamespacedName{Name: provisionerLease, Namespace: "kube-system"}, &lease); err != nil {
+		return "", err
+	}
+	if lease.Spec.HolderIdentity == nil {
+		return "", nil
+	}
+	return *lease.Spec.HolderIdentity, nil
+}
+
+// controllerPodFor maps a Lease holder identity to its pod. The identity is
+// the pod's hostname, which csi-lib-utils may suffix with a random ID.
+func controllerPodFor(pods []corev1.Pod, holder string) *corev1.Pod {
+	for i := range pods {
+		if holder == pods[i].Name || strings.HasPrefix(holder, pods[i].Name+"_") {
+			return &pods[i]
+		}
+	}
+	return nil
+}
+
+func failoverPVCName(i int) string {
+	return fmt.Sprintf("efs-failover-%02d-claim-e2e", i)
+}
+
+// cleanupFailoverResources removes the burst PVCs and, with wait, waits for
+// them to be gone so their access points are deleted.
+func cleanupFailoverResources(ctx context.Context, wcClient client.Client, wait bool) error {
+	var pvcs []client.Object
+	for i := 0; i < cfg.Resilience.FailoverPVCs; i++ {
+		pvcs = append(pvcs, &corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: failoverPVCName(i), Namespace: cfg.Namespace}})
+	}
+	if err := testhelpers.Delete(ctx, wcClient, wait, cfg.Timeouts.Delete.Duration, pvcs...); err != nil {
+		return err
+	}
+
+	return testhelpers.Delete(ctx, wcClient, false, 0,
+		&storagev1.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: failoverSCName}},
+	)
+}
@@ -0,0 +1,380 @@
+package resilience
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"e2e/internal/cleanup"
+	"e2e/internal/efsinfra"
+	"e2e/internal/iowatch"
+	"e2e/internal/suiteconfig"
+	"e2e/internal/testhelpers"
+
+	"github.com/giantswarm/apptest-framework/v2/pkg/state"
+	"github.com/giantswarm/apptest-framework/v2/pkg/suite"
+	clusterclient "github.com/giantswarm/clustertest/v2/pkg/client"
+	"github.com/giantswarm/clustertest/v2/pkg/failurehandler"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	isUpgrade = false
+
+	efsProvisioner = "efs.csi.aws.com"
+	workloadName   = "efs-resilience-e2e"
+	heartbeatFile  = "/data/heartbeat"
+	seedFile       = "/data/seed"
+)
+
+var (
+	// Shared state between hooks and tests.
+	efs *efsinfra.Infra
+	// cleanups defers the teardown of everything the specs create.
+	cleanups = cleanup.New(GinkgoLogr)
+	// cfg holds the suite parameters from config.yaml and the environment.
+	cfg suiteconfig.Config
+)
+
+// Writes the phase timings recorded by the specs as JUnit properties and a
+// JSON summary, to trend slow AWS and Crossplane phases across runs.
+var _ = ReportAfterSuite("phase report", func(report Report) {
+	if err := testhelpers.WritePhaseReports(report, testhelpers.ReportDir(), "resilience"); err != nil {
+		GinkgoLogr.Info("writing phase report failed", "error", err.Error())
+	}
+})
+
+// Issues the deletes of teardowns that a second interrupt made Ginkgo skip,
+// and fails the run if anything the specs created may be left behind.
+var _ = ReportAfterSuite("cleanup report", func(ctx SpecContext, _ Report) {
+	teardown := cleanups.Finish(ctx)
+	GinkgoWriter.Printf("cleanup:\n%s", teardown)
+	Expect(teardown.Unconfirmed()).To(BeEmpty(), "resources not confirmed deleted:\n%s", teardown)
+})
+
+func TestResilience(t *testing.T) {
+	var err error
+	if cfg, err = suiteconfig.Load(); err != nil {
+		t.Fatal(err)
+	}
+	testhelpers.SetDefaults(cfg.PodDefaults())
+	cleanups.WithTimeout(cfg.Timeouts.Cleanup.Duration)
+
+	suite.New().
+		WithInCluster(true).
+		WithInstallNamespace("").
+		WithIsUpgrade(isUpgrade).
+		WithValuesFile("./values.yaml").
+		AfterClusterReady(func() {
+			It("should pull the test image", func() {
+				wcClient, err := state.GetFramework().WC(state.GetCluster().Name)
+				Expect(err).Should(Succeed())
+
+				Expect(testhelpers.CheckImagePull(state.GetContext(), wcClient, "efs-image-pull-e2e", cfg.Namespace, cfg.Image, cfg.Timeouts.Pod.Duration)).
+					To(Succeed(), "test pods cannot start on this cluster; set e2e.registryMirror or e2e.imagePullSecrets in config.yaml")
+			})
+		}).
+		Tests(func() {
+			It("should have the HelmRelease ready with the chart version under test", func() {
+				mcClient := state.GetFramework().MC()
+				cluster := state.GetCluster()
+				key := testhelpers.DriverHelmReleaseKey(cluster.Name, cluster.Organization.GetNamespace())
+				version := state.GetApplication().Version
+
+				ready := testhelpers.StartPhase("HelmRelease ready")
+				Eventually(func() error {
+					status, err := testhelpers.GetHelmReleaseStatus(state.GetContext(), *mcClient, key)
+					if err != nil {
+						GinkgoLogr.Info("HelmRelease check failed", "name", key.Name, "error", err.Error())
+						return err
+					}
+					GinkgoLogr.Info("HelmRelease status", "status", status.String())
+					return status.CheckChartVersion(version)
+				}).
+					WithTimeout(cfg.Timeouts.HelmRelease.Duration).
+					WithPolling(10*time.Second).
+					Should(Succeed(), failurehandler.LLMPrompt(state.GetFramework(), state.GetCluster(), "Investigate HelmRelease not ready for aws-efs-csi-driver"))
+				ready(key.Name)
+			})
+
+			// The file system and the I/O workload are created once the App
+			// is installed and torn down after the last spec in here, before
+			// the App is uninstalled, so that PVC deletion still removes the
+			// access point.
+			Describe("with EFS infrastructure", Ordered, ContinueOnFailure, func() {
+				BeforeAll(func() {
+					mcClient := state.GetFramework().MC()
+					ctx := state.GetContext()
+					cluster := state.GetCluster()
+
+					efs = efsinfra.New(cluster.Name, cluster.Organization.GetNamespace()).
+						WithLogger(GinkgoLogr).
+						WithTimeouts(cfg.FixtureTimeouts()).
+						WithPhaseRecorder(testhelpers.RecordPhase).
+						WithExistingFromEnv().
+						WithConfigMapState(*mcClient)
+					cleanups.Defer("EFS infrastructure", func(ctx context.Context, wait bool) error {
+						if !wait {
+							return efs.Delete(ctx, *mcClient)
+						}
+						return efs.Cleanup(ctx, *mcClient)
+					})
+					// Resumes the fixture of an interrupted run of this cluster.
+					_, err := efs.LoadState(ctx)
+					Expect(err).NotTo(HaveOccurred())
+					wcClient, err := state.GetFramework().WC(cluster.Name)
+					Expect(err).NotTo(HaveOccurred())
+					// Finds the ProviderConfig and the network, and checks the MC and
+					// WC before anything is made in AWS.
+					preflight := efs.Preflight(ctx, *mcClient, wcClient)
+					AddReportEntry("pre-flight", preflight.String())
+					Expect(preflight.Err()).NotTo(HaveOccurred(), "the EFS fixture cannot be created for this cluster; see the fix under each failed check")
+					Expect(efs.Create(ctx, *mcClient)).To(Succeed())
+
+					By("Starting a long-lived I/O workload on an EFS volume")
+					cleanups.Defer("I/O workload", func(ctx context.Context, wait bool) error {
+						deploy := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: workloadName, Namespace: cfg.Namespace}}
+						if err := client.IgnoreNotFound(wcClient.Delete(ctx, deploy, client.PropagationPolicy(metav1.DeletePropagationForeground))); err != nil {
+							return err
+						}
+						return testhelpers.DeleteVolume(ctx, wcClient, wait, cfg.Timeouts.Delete.Duration, cfg.Namespace, workloadName, workloadName)
+					})
+
+					bindingMode := storagev1.VolumeBindingImmediate
+					reclaimPolicy := corev1.PersistentVolumeReclaimDelete
+					Expect(wcClient.Create(ctx, &storagev1.StorageClass{
+						ObjectMeta:        metav1.ObjectMeta{Name: workloadName},
+						Provisioner:       efsProvisioner,
+						VolumeBindingMode: &bindingMode,
+						ReclaimPolicy:     &reclaimPolicy,
+						MountOptions:      []string{"tls"},
+						Parameters:        cfg.ParametersFor(efs.FileSystemID(), nil),
+					})).To(Succeed())
+					Expect(wcClient.Create(ctx, testhelpers.NewTestPVC(workloadName, cfg.Namespace, workloadName))).To(Succeed())
+
+					// Every replacement pod appends to the same heartbeat file, so
+					// gaps across reschedules show up too.
+					Expect(wcClient.Create(ctx, testhelpers.NewTestDeployment(workloadName, cfg.Namespace, workloadName, []string{
+						"sh", "-c", fmt.Sprintf("[ -f %[1]s ] || echo %[2]s > %[1]s; %[3]s", seedFile, workloadName, iowatch.HeartbeatScript(heartbeatFile)),
+					}))).To(Succeed())
+
+					pod := waitForWorkloadPod(ctx, wcClient, "")
+					GinkgoLogr.Info("I/O workload running", "pod", pod.Name, "node", pod.Spec.NodeName)
+				})
+
+				It("should not stall I/O beyond the window when the efs-csi-node pod is deleted", func() {
+					wcClient, err := state.GetFramework().WC(state.GetCluster().Name)
+					Expect(err).Should(Succeed())
+					ctx := state.GetContext()
+
+					pod := waitForWorkloadPod(ctx, wcClient, "")
+					nodePod, err := efsCSINodePod(ctx, wcClient, pod.Spec.NodeName)
+					Expect(err).NotTo(HaveOccurred())
+
+					By(fmt.Sprintf("Deleting %s on %s", nodePod.Name, pod.Spec.NodeName))
+					since := time.Now()
+					Expect(wcClient.Delete(ctx, nodePod)).To(Succeed())
+					Eventually(func() error {
+						replacement, err := efsCSINodePod(ctx, wcClient, pod.Spec.NodeName)
+						if err != nil {
+							return err
+						}
+						if replacement.UID == nodePod.UID {
+							return fmt.Errorf("%s not replaced yet", nodePod.Name)
+						}
+						return podReady(replacement)
+					}).WithTimeout(cfg.Timeouts.Rollout.Duration).WithPolling(5 * time.Second).Should(Succeed())
+
+					expectIOWithinWindow(ctx, wcClient, "efs-csi-node pod restart", since, cfg.Resilience.StallWindow.Duration)
+				})
+
+				It("should not stall I/O beyond the window when efs-csi-node is rolled", func() {
+					wcClient, err := state.GetFramework().WC(state.GetCluster().Name)
+					Expect(err).Should(Succeed())
+					ctx := state.GetContext()
+
+					By("Restarting the efs-csi-node DaemonSet like kubectl rollout restart")
+					var ds appsv1.DaemonSet
+					key := types.NamespacedName{Name: "efs-csi-node", Namespace: "kube-system"}
+					Expect(wcClient.Get(ctx, key, &ds)).To(Succeed())
+					patch := client.MergeFrom(ds.DeepCopy())
+					if ds.Spec.Template.Annotations == nil {
+						ds.Spec.Template.Annotations = map[string]string{}
+					}
+					since := time.Now()
+					ds.Spec.Template.Annotations["kubectl.kubernetes.io/restartedAt"] = since.Format(time.RFC3339)
+					Expect(wcClient.Patch(ctx, &ds, patch)).To(Succeed())
+
+					Eventually(func() error {
+						if err := wcClient.Get(ctx, key, &ds); err != nil {
+							return err
+						}
+						s := ds.Status
+						if s.ObservedGeneration < ds.Generation || s.UpdatedNumberScheduled != s.DesiredNumberScheduled || s.NumberAvailable != s.DesiredNumberScheduled {
+							return fmt.Errorf("efs-csi-node rollout: %d/%d updated, %d available", s.UpdatedNumberScheduled, s.DesiredNumberScheduled, s.NumberAvailable)
+						}
+						return nil
+					}).
+						WithTimeout(cfg.Timeouts.Rollout.Duration).
+						WithPolling(10*time.Second).
+						Should(Succeed(), failurehandler.LLMPrompt(state.GetFramework(), state.GetCluster(), "Investigate efs-csi-node DaemonSet rollout not completing"))
+
+					expectIOWithinWindow(ctx, wcClient, "efs-csi-node rollout", since, cfg.Resilience.StallWindow.Duration)
+				})
+
+				failoverTests()
+
+				It("should remount transparently when the workload's node is drained and uncordoned", func() {
+					wcClient, err := state.GetFramework().WC(state.GetCluster().Name)
+					Expect(err).Should(Succeed())
+					ctx := state.GetContext()
+
+					var nodes corev1.NodeList
+					Expect(wcClient.List(ctx, &nodes, clusterclient.DoesNotHaveLabels{"node-role.kubernetes.io/control-plane"})).To(Succeed())
+					if len(nodes.Items) < 2 {
+						Skip(fmt.Sprintf("need at least 2 worker nodes to drain one, found %d", len(nodes.Items)))
+					}
+
+					pod := waitForWorkloadPod(ctx, wcClient, "")
+					drainedNode := pod.Spec.NodeName
+					cleanups.Defer("uncordon "+drainedNode, func(ctx context.Context, _ bool) error {
+						return testhelpers.SetNodeUnschedulable(ctx, wcClient, drainedNode, false)
+					})
+
+					By("Draining " + drainedNode)
+					since := time.Now()
+					Expect(testhelpers.DrainNode(ctx, wcClient, drainedNode, cfg.Timeouts.Drain.Duration)).To(Succeed())
+
+					moved := waitForWorkloadPod(ctx, wcClient, drainedNode)
+					GinkgoLogr.Info("I/O workload rescheduled", "from", drainedNode, "to", moved.Spec.NodeName)
+					expectIOWithinWindow(ctx, wcClient, "node drain", since, cfg.Resilience.DrainWindow.Duration)
+
+					By("Checking the data written before the drain is still there")
+					seed, err := execInWorkload(ctx, wcClient, moved.Name, "cat", seedFile)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(strings.TrimSpace(seed)).To(Equal(workloadName))
+
+					By("Uncordoning " + drainedNode)
+					Expect(testhelpers.SetNodeUnschedulable(ctx, wcClient, drainedNode, false)).To(Succeed())
+				})
+			})
+		}).
+		Run(t, "EFS Resilience")
+}
+
+// expectIOWithinWindow waits for the workload's heartbeats to resume after
+// since, then fails if any write failed or writes stalled longer than
+// window in the meantime.
+func expectIOWithinWindow(ctx context.Context, wcClient *clusterclient.Client, disruption string, since time.Time, window time.Duration) {
+	By(fmt.Sprintf("Checking I/O stalls after the %s stay within %s", disruption, window))
+	var beats []time.Time
+	Eventually(func() (time.Time, error) {
+		pod, err := findWorkloadPod(ctx, wcClient, "")
+		if err != nil {
+			return time.Time{}, err
+		}
+		content, err := execInWorkload(ctx, wcClient, pod.Name, "cat", heartbeatFile)
+		if err != nil {
+			return time.Time{}, err
+		}
+		beats = iowatch.ParseHeartbeats(content)
+		if len(beats) == 0 {
+			return time.Time{}, fmt.Errorf("no heartbeats yet")
+		}
+		return beats[len(beats)-1], nil
+	}).
+		WithTimeout(window+2*time.Minute).
+		WithPolling(10*time.Second).
+		Should(BeTemporally(">", since.Add(window/2)), failurehandler.LLMPrompt(state.GetFramework(), state.GetCluster(), "Investigate EFS I/O not resuming after an efs-csi-node disruption - check efs-utils watchdog and efs-proxy logs"))
+
+	var longest iowatch.Gap
+	for _, g := range iowatch.FindGaps(beats, 0) {
+		if g.To.After(since) && g.Duration() > longest.Duration() {
+			longest = g
+		}
+	}
+	// Reported per spec, so that the stalls of specs that ran are kept
+	// when a later one is skipped or fails.
+	AddReportEntry("io-stalls", map[string]string{disruption: longest.Duration().String()})
+	GinkgoLogr.Info("longest I/O stall", "disruption", disruption, "stall", longest.String())
+	Expect(longest.Duration()).To(BeNumerically("<=", window), "writes stalled for %s during the %s", longest, disruption)
+
+	var pods corev1.PodList
+	Expect(wcClient.List(ctx, &pods, client.InNamespace(cfg.Namespace), client.MatchingLabels{"app": workloadName})).To(Succeed())
+	for i := range pods.Items {
+		logs, err := wcClient.GetLogs(ctx, &pods.Items[i], nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(iowatch.IOErrors(logs)).To(BeEmpty(), "pod %s saw failed writes during the %s", pods.Items[i].Name, disruption)
+	}
+}
+
+// waitForWorkloadPod returns the running workload pod, waiting for one that
+// is not on avoidNode if set.
+func waitForWorkloadPod(ctx context.Context, wcClient client.Client, avoidNode string) *corev1.Pod {
+	var running *corev1.Pod
+	Eventually(func() (err error) {
+		running, err = findWorkloadPod(ctx, wcClient, avoidNode)
+		return err
+	}).
+		WithTimeout(cfg.Timeouts.Pod.Duration).
+		WithPolling(5*time.Second).
+		Should(Succeed(), failurehandler.LLMPrompt(state.GetFramework(), state.GetCluster(), "Investigate EFS I/O workload pod not running - check scheduling and mount errors"))
+	return running
+}
+
+func findWorkloadPod(ctx context.Context, wcClient client.Client, avoidNode string) (*corev1.Pod, error) {
+	var pods corev1.PodList
+	if err := wcClient.List(ctx, &pods, client.InNamespace(cfg.Namespace), client.MatchingLabels{"app": workloadName}); err != nil {
+		return nil, err
+	}
+	for i := range pods.Items {
+		p := &pods.Items[i]
+		if p.DeletionTimestamp == nil && p.Spec.NodeName != avoidNode && podReady(p) == nil {
+			return p, nil
+		}
+	}
+	return nil, fmt.Errorf("no ready %s pod (avoiding node %q)", workloadName, avoidNode)
+}
+
+func efsCSINodePod(ctx context.Context, wcClient client.Client, nodeName string) (*corev1.Pod, error) {
+	var pods corev1.PodList
+	if err := wcClient.List(ctx, &pods, client.InNamespace("kube-system"), client.MatchingLabels{"app": "efs-csi-node"}); err != nil {
+		return nil, err
+	}
+	for i := range pods.Items {
+		if pods.Items[i].Spec.NodeName == nodeName && pods.Items[i].DeletionTimestamp == nil {
+			return &pods.Items[i], nil
+		}
+	}
+	return nil, fmt.Errorf("no efs-csi-node pod on node %s", nodeName)
+}
+
+func podReady(pod *corev1.Pod) error {
+	for _, c := range pod.Status.Conditions {
+		if c.Type == corev1.PodReady && c.Status == corev1.ConditionTrue {
+			return nil
+		}
+	}
+	return fmt.Errorf("pod %s is not ready (%s)", pod.Name, pod.Status.Phase)
+}
+
+// execInWorkload runs a command in a workload pod. The exec is bounded so a
+// stalled mount fails the call instead of hanging the suite.
+func execInWorkload(ctx context.Context, wcClient *clusterclient.Client, pod string, command ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	stdout, stderr, err := wcClient.ExecInPod(ctx, pod, cfg.Namespace, "test", command)
+	if err != nil {
+		return "", fmt.Errorf("exec %v in %s: %w (stderr: %s)", command, pod, err, strings.TrimSpace(stderr))
+	}
+	return stdout, nil
+}
@@ -0,0 +1,386 @@
+package scale
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"e2e/internal/cleanup"
+	"e2e/internal/efsapi"
+	"e2e/internal/efsinfra"
+	"e2e/internal/scale"
+	"e2e/internal/suiteconfig"
+	"e2e/internal/testhelpers"
+
+	"github.com/giantswarm/apptest-framework/v2/pkg/state"
+	"github.com/giantswarm/apptest-framework/v2/pkg/suite"
+	clusterclient "github.com/giantswarm/clustertest/v2/pkg/client"
+	"github.com/giantswarm/clustertest/v2/pkg/failurehandler"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	isUpgrade = false
+
+	efsProvisioner = "efs.csi.aws.com"
+	scaleName      = "efs-scale-e2e"
+
+	// bindPolling is how often PVCs are checked for Bound, and so the
+	// resolution of the time-to-bound samples.
+	bindPolling = 2 * time.Second
+)
+
+var (
+	// Shared state between hooks and tests.
+	efs    *efsinfra.Infra
+	report = scale.Report{Mode: "cluster"}
+	// cleanups defers the teardown of everything the specs create.
+	cleanups = cleanup.New(GinkgoLogr)
+	// cfg holds the suite parameters from config.yaml and the environment.
+	cfg suiteconfig.Config
+)
+
+// Writes the phase timings recorded by the specs as JUnit properties and a
+// JSON summary, to trend slow AWS and Crossplane phases across runs.
+var _ = ReportAfterSuite("phase report", func(report Report) {
+	if err := testhelpers.WritePhaseReports(report, testhelpers.ReportDir(), "scale"); err != nil {
+		GinkgoLogr.Info("writing phase report failed", "error", err.Error())
+	}
+})
+
+// Issues the deletes of teardowns that a second interrupt made Ginkgo skip,
+// and fails the run if anything the specs created may be left behind.
+var _ = ReportAfterSuite("cleanup report", func(ctx SpecContext, _ Report) {
+	teardown := cleanups.Finish(ctx)
+	GinkgoWriter.Printf("cleanup:\n%s", teardown)
+	Expect(teardown.Unconfirmed()).To(BeEmpty(), "resources not confirmed deleted:\n%s", teardown)
+})
+
+func TestScale(t *testing.T) {
+	var err error
+	if cfg, err = suiteconfig.Load(); err != nil {
+		t.Fatal(err)
+	}
+	testhelpers.SetDefaults(cfg.PodDefaults())
+	cleanups.WithTimeout(cfg.Timeouts.Cleanup.Duration)
+
+	suite.New().
+		WithInCluster(true).
+		WithInstallNamespace("").
+		WithIsUpgrade(isUpgrade).
+		WithValuesFile("./values.yaml").
+		Tests(func() {
+			It("should have the HelmRelease ready with the chart version under test", func() {
+				mcClient := state.GetFramework().MC()
+				cluster := state.GetCluster()
+				key := testhelpers.DriverHelmReleaseKey(cluster.Name, cluster.Organization.GetNamespace())
+				version := state.GetApplication().Version
+
+				ready := testhelpers.StartPhase("HelmRelease ready")
+				Eventually(func() error {
+					status, err := testhelpers.GetHelmReleaseStatus(state.GetContext(), *mcClient, key)
+					if err != nil {
+						GinkgoLogr.Info("HelmRelease check failed", "name", key.Name, "error", err.Error())
+						return err
+					}
+					GinkgoLogr.Info("HelmRelease status", "status", status.String())
+					return status.CheckChartVersion(version)
+				}).
+					WithTimeout(cfg.Timeouts.HelmRelease.Duration).
+					WithPolling(10*time.Second).
+					Should(Succeed(), failurehandler.LLMPrompt(state.GetFramework(), state.GetCluster(), "Investigate HelmRelease not ready for aws-efs-csi-driver"))
+				ready(key.Name)
+			})
+
+			// The file system is created once the App is installed and torn
+			// down after the last spec in here, before the App is
+			// uninstalled, so that PVC deletion still removes the access
+			// points.
+			Describe("with EFS infrastructure", Ordered, ContinueOnFailure, func() {
+				BeforeAll(func() {
+					mcClient := state.GetFramework().MC()
+					ctx := state.GetContext()
+					cluster := state.GetCluster()
+
+					efs = efsinfra.New(cluster.Name, cluster.Organization.GetNamespace()).
+						WithLogger(GinkgoLogr).
+						WithTimeouts(cfg.FixtureTimeouts()).
+						WithPhaseRecorder(testhelpers.RecordPhase).
+						WithExistingFromEnv().
+						WithConfigMapState(*mcClient)
+					cleanups.Defer("EFS infrastructure", func(ctx context.Context, wait bool) error {
+						if !wait {
+							return efs.Delete(ctx, *mcClient)
+						}
+						return efs.Cleanup(ctx, *mcClient)
+					})
+					// Resumes the fixture of an interrupted run of this cluster.
+					_, err := efs.LoadState(ctx)
+					Expect(err).NotTo(HaveOccurred())
+					wcClient, err := state.GetFramework().WC(cluster.Name)
+					Expect(err).NotTo(HaveOccurred())
+					// Finds the ProviderConfig and the network, and checks the MC and
+					// WC before anything is made in AWS.
+					preflight := efs.Preflight(ctx, *mcClient, wcClient)
+					AddReportEntry("pre-flight", preflight.String())
+					Expect(preflight.Err()).NotTo(HaveOccurred(), "the EFS fixture cannot be created for this cluster; see the fix under each failed check")
+					Expect(efs.Create(ctx, *mcClient)).To(Succeed())
+
+					// Both specs below work on the burst's PVCs, so they are
+					// removed after the last one.
+					cleanups.Defer("scale PVCs", func(ctx context.Context, waitGone bool) error {
+						if err := wcClient.DeleteAllOf(ctx, &corev1.PersistentVolumeClaim{}, client.InNamespace(cfg.Namespace), client.MatchingLabels{"app": scaleName}); err != nil {
+							return err
+						}
+						if waitGone {
+							// The PVs go once the provisioner removed their access points.
+							if err := wait.PollUntilContextTimeout(ctx, 10*time.Second, cfg.Scale.BindTimeout.Duration, true, func(ctx context.Context) (bool, error) {
+								pvs, err := scaleVolumes(ctx, wcClient)
+								return err == nil && len(pvs) == 0, nil
+							}); err != nil {
+								return fmt.Errorf("waiting for the scale PVs to be deleted: %w", err)
+							}
+						}
+						return testhelpers.Delete(ctx, wcClient, false, 0, &storagev1.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: scaleName}})
+					})
+				})
+
+				It("should bind every PVC of a concurrent burst", func() {
+					Expect(efs).NotTo(BeNil(), "EFS infrastructure was not created")
+					Expect(efs.FileSystemID()).NotTo(BeEmpty(), "EFS filesystem ID is not available")
+
+					wcClient, err := state.GetFramework().WC(state.GetCluster().Name)
+					Expect(err).Should(Succeed())
+					ctx := state.GetContext()
+					defer writeReport()
+
+					report.ChartVersion = state.GetApplication().Version
+					report.PVCs = cfg.Scale.PVCs
+					report.Concurrency = cfg.Scale.Concurrency
+
+					bindingMode := storagev1.VolumeBindingImmediate
+					reclaimPolicy := corev1.PersistentVolumeReclaimDelete
+					Expect(wcClient.Create(ctx, &storagev1.StorageClass{
+						ObjectMeta:        metav1.ObjectMeta{Name: scaleName},
+						Provisioner:       efsProvisioner,
+						VolumeBindingMode: &bindingMode,
+						ReclaimPolicy:     &reclaimPolicy,
+						Parameters:        cfg.ParametersFor(efs.FileSystemID(), nil),
+					})).To(Succeed())
+
+					By(fmt.Sprintf("Creating %d PVCs, %d at a time", cfg.Scale.PVCs, cfg.Scale.Concurrency))
+					var mu sync.Mutex
+					created := map[string]time.Time{}
+					creates := scale.Run(ctx, cfg.Scale.PVCs, cfg.Scale.Concurrency, pvcName, func(ctx context.Context, i int) (time.Duration, error) {
+						pvc := testhelpers.NewTestPVC(pvcName(i), cfg.Namespace, scaleName)
+						pvc.Labels = map[string]string{"app": scaleName}
+						start := time.Now()
+						if err := wcClient.Create(ctx, pvc); err != nil {
+							return 0, err
+						}
+						mu.Lock()
+						created[pvc.Name] = start
+						mu.Unlock()
+						return time.Since(start), nil
+					})
+					for _, c := range creates {
+						Expect(c.Error).To(BeEmpty(), "creating PVC %s", c.Name)
+					}
+
+					By("Waiting for every PVC to bind")
+					bound := map[string]time.Time{}
+					defer func() {
+						report.Samples = bindSamples(created, bound)
+						report.TimeToBound = scale.Summarize(report.Samples)
+						report.Throttling = collectThrottling(ctx, wcClient)
+						GinkgoLogr.Info("time to bound", "summary", fmt.Sprintf("%+v", report.TimeToBound), "throttlingEvents", report.Throttling.Events)
+					}()
+					Eventually(func() (int, error) {
+						var pvcs corev1.PersistentVolumeClaimList
+						if err := wcClient.List(ctx, &pvcs, client.InNamespace(cfg.Namespace), client.MatchingLabels{"app": scaleName}); err != nil {
+							return len(bound), err
+						}
+						now := time.Now()
+						for _, pvc := range pvcs.Items {
+							if _, seen := bound[pvc.Name]; !seen && pvc.Status.Phase == corev1.ClaimBound {
+								bound[pvc.Name] = now
+							}
+						}
+						return len(bound), nil
+					}).
+						WithTimeout(cfg.Scale.BindTimeout.Duration).
+						WithPolling(bindPolling).
+						Should(Equal(cfg.Scale.PVCs), failurehandler.LLMPrompt(state.GetFramework(), state.GetCluster(), "Investigate PVCs not binding during an EFS provisioning burst - check csi-provisioner logs for throttling"))
+				})
+
+				It("should delete every access point when the PVCs are deleted", func() {
+					wcClient, err := state.GetFramework().WC(state.GetCluster().Name)
+					Expect(err).Should(Succeed())
+					ctx := state.GetContext()
+					defer writeReport()
+
+					accessPoints := map[string]string{}
+					pvs, err := scaleVolumes(ctx, wcClient)
+					Expect(err).NotTo(HaveOccurred())
+					for _, pv := range pvs {
+						_, apID, err := efsapi.ParseVolumeHandle(pv.Spec.CSI.VolumeHandle)
+						Expect(err).NotTo(HaveOccurred())
+						accessPoints[pv.Name] = apID
+					}
+					Expect(accessPoints).NotTo(BeEmpty(), "no volumes were provisioned for %s", scaleName)
+
+					By(fmt.Sprintf("Deleting %d PVCs", cfg.Scale.PVCs))
+					deletes := scale.Run(ctx, cfg.Scale.PVCs, cfg.Scale.Concurrency, pvcName, func(ctx context.Context, i int) (time.Duration, error) {
+						pvc := &corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: pvcName(i), Namespace: cfg.Namespace}}
+						return 0, client.IgnoreNotFound(wcClient.Delete(ctx, pvc))
+					})
+					for _, d := range deletes {
+						Expect(d.Error).To(BeEmpty(), "deleting PVC %s", d.Name)
+					}
+
+					// external-provisioner only removes a PV once DeleteVolume,
+					// and so the access point deletion, succeeded. What is left
+					// after the wait is reported before it is asserted on.
+					var remaining []corev1.PersistentVolume
+					_ = wait.PollUntilContextTimeout(ctx, 10*time.Second, cfg.Scale.BindTimeout.Duration, true, func(ctx context.Context) (bool, error) {
+						remaining, err = scaleVolumes(ctx, wcClient)
+						return err == nil && len(remaining) == 0, nil
+					})
+					Expect(err).NotTo(HaveOccurred())
+
+					By("Checking the access points are gone from the file system")
+					report.LeftoverAccessPoints = []string{}
+					apClient, err := efsapi.NewAWSClient(ctx, efs.Region())
+					if err != nil {
+						// Without the EFS API, a PV still there stands for its
+						// access point.
+						GinkgoLogr.Info("EFS API not available, relying on PV deletion only", "error", err.Error())
+						for _, pv := range remaining {
+							report.LeftoverAccessPoints = append(report.LeftoverAccessPoints, accessPoints[pv.Name])
+						}
+					} else {
+						provisioned := map[string]bool{}
+						for _, apID := range accessPoints {
+							provisioned[apID] = true
+						}
+						// The file system may be shared, so only the access
+						// points of this suite's volumes count.
+						aps, err := apClient.ListAccessPoints(ctx, efs.FileSystemID())
+						Expect(err).NotTo(HaveOccurred())
+						for _, ap := range aps {
+							if provisioned[ap.ID] {
+								report.LeftoverAccessPoints = append(report.LeftoverAccessPoints, ap.ID)
+							}
+						}
+						report.AccessPointsVerified = true
+					}
+
+					AddReportEntry("scale", report.TimeToBound, report.Throttling, map[string]interface{}{
+						"remainingPVs":         len(remaining),
+						"leftoverAccessPoints": len(report.LeftoverAccessPoints),
+						"accessPointsVerified": report.AccessPointsVerified,
+					})
+					Expect(remaining).To(BeEmpty(), failurehandler.LLMPrompt(state.GetFramework(), state.GetCluster(), "Investigate EFS PVs not being deleted after their PVCs - check csi-provisioner DeleteVolume errors"))
+					Expect(report.LeftoverAccessPoints).To(BeEmpty(), "access points left behind after deleting the PVCs")
+				})
+			})
+		}).
+		Run(t, "EFS Scale")
+}
+
+func pvcName(i int) string {
+	return fmt.Sprintf("efs-scale-%04d-claim-e2e", i)
+}
+
+// bindSamples turns creation and first-seen-Bound times into samples. PVCs
+// that never bound are recorded as failed.
+func bindSamples(created, bound map[string]time.Time) []scale.Sample {
+	var samples []scale.Sample
+	for i := 0; i < cfg.Scale.PVCs; i++ {
+		name := pvcName(i)
+		start, ok := created[name]
+		if !ok {
+			continue
+		}
+		s := scale.Sample{Name: name}
+		if at, ok := bound[name]; ok {
+			s.Seconds = at.Sub(start).Seconds()
+		} else {
+			s.Error = fmt.Sprintf("not bound within %s", cfg.Scale.BindTimeout.Duration)
+		}
+		samples = append(samples, s)
+	}
+	return samples
+}
+
+// scaleVolumes lists the PVs provisioned from the scale StorageClass.
+func scaleVolumes(ctx context.Context, wcClient client.Client) ([]corev1.PersistentVolume, error) {
+	var pvs corev1.PersistentVolumeList
+	if err := wcClient.List(ctx, &pvs); err != nil {
+		return nil, err
+	}
+	var out []corev1.PersistentVolume
+	for _, pv := range pvs.Items {
+		if pv.Spec.StorageClassName == scaleName && pv.Spec.CSI != nil {
+			out = append(out, pv)
+		}
+	}
+	return out, nil
+}
+
+// collectThrottling gathers throttling from the PVCs' warning events and
+// the controller's logs, where retried calls show up even if the volume
+// was eventually provisioned.
+func collectThrottling(ctx context.Context, wcClient *clusterclient.Client) scale.Throttling {
+	var t scale.Throttling
+
+	var events corev1.EventList
+	if err := wcClient.List(ctx, &events, client.InNamespace(cfg.Namespace)); err != nil {
+		GinkgoLogr.Info("listing events failed", "error", err.Error())
+	}
+	for _, ev := range events.Items {
+		if ev.Type == corev1.EventTypeWarning && ev.InvolvedObject.Kind == "PersistentVolumeClaim" &&
+			strings.HasPrefix(ev.InvolvedObject.Name, "efs-scale-") && scale.IsThrottling(ev.Message) {
+			t.Add(ev.Message)
+		}
+	}
+
+	var controllers corev1.PodList
+	if err := wcClient.List(ctx, &controllers, client.InNamespace("kube-system"), client.MatchingLabels{"app": "efs-csi-controller"}); err != nil {
+		GinkgoLogr.Info("listing efs-csi-controller pods failed", "error", err.Error())
+	}
+	for i := range controllers.Items {
+		logs, err := wcClient.GetLogs(ctx, &controllers.Items[i], nil)
+		if err != nil {
+			GinkgoLogr.Info("fetching efs-csi-controller logs failed", "pod", controllers.Items[i].Name, "error", err.Error())
+			continue
+		}
+		for _, line := range strings.Split(logs, "\n") {
+			if scale.IsThrottling(line) {
+				t.Add(strings.TrimSpace(line))
+			}
+		}
+	}
+	return t
+}
+
+// writeReport writes the report collected so far to
+// $REPORT_DIR/scale-report.json, next to the benchmark results.
+func writeReport() {
+	path := filepath.Join(testhelpers.ReportDir(), "scale-report.json")
+	if err := scale.WriteReport(path, report); err != nil {
+		GinkgoLogr.Info("writing scale report failed", "path", path, "error", err.Error())
+		return
+	}
+	GinkgoLogr.Info("scale report written", "path", path)
+}